@@ -0,0 +1,327 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"invoice-generator-go/einvoice"
+	"invoice-generator-go/models"
+	"invoice-generator-go/storage"
+	"invoice-generator-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxBillUploadSize caps the size of an uploaded e-invoice.
+const maxBillUploadSize = 5 << 20
+
+// importBill books an incoming UBL or CII e-invoice as a purchase bill.
+func importBill(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "E-invoice file is required"})
+		return
+	}
+	if file.Size > maxBillUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "E-invoice file is too large (max 5 MB)"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
+		return
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, maxBillUploadSize))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	doc, format, err := einvoice.Parse(data)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Could not read e-invoice", "details": err.Error()})
+		return
+	}
+
+	bill, supplier := doc.ToBill()
+	if err := utils.ValidateAmount(bill.TotalAmount, "total amount"); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err := utils.ValidateCurrency(bill.Currency); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Bill currency must be an ISO 4217 code", "currency": bill.Currency})
+		return
+	}
+	if bill.Subtotal < 0 || bill.TaxAmount < 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Bills with negative totals are not supported"})
+		return
+	}
+
+	supplier.UserID = userUUID
+	supplier.Name = utils.SanitizeString(supplier.Name, 255)
+	supplier.Email = utils.SanitizeString(supplier.Email, 255)
+	supplier.City = utils.SanitizeString(supplier.City, 255)
+	supplier.PostalCode = utils.SanitizeString(supplier.PostalCode, 50)
+	supplier.VATID = utils.SanitizeString(supplier.VATID, 50)
+	if len(supplier.CountryCode) != 2 {
+		supplier.CountryCode = ""
+	}
+	if err := storage.FindOrCreateSupplier(&supplier); err != nil {
+		log.Printf("Error saving supplier: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save supplier"})
+		return
+	}
+
+	bill.UserID = userUUID
+	bill.SupplierID = supplier.ID
+	bill.BillNumber = utils.SanitizeString(bill.BillNumber, 100)
+	bill.SourceFormat = format
+	bill.SourceDocument = string(data)
+
+	billID, err := storage.CreateBill(&bill)
+	if errors.Is(err, storage.ErrDuplicateBill) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This bill has already been imported"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving bill: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save bill"})
+		return
+	}
+
+	warnings := doc.Check()
+	if warnings == nil {
+		warnings = []einvoice.Violation{}
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Bill imported",
+		"bill_id":  billID,
+		"bill":     bill,
+		"supplier": supplier,
+		"warnings": warnings,
+	})
+}
+
+// listBills retrieves the authenticated user's bills, optionally filtered by
+// ?status=.
+func listBills(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format", "details": err.Error()})
+		return
+	}
+
+	bills, err := storage.GetBillsByUserID(userUUID, c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bills", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bills": bills})
+}
+
+// getBill returns a bill with its items, payments and supplier.
+func getBill(c *gin.Context) {
+	bill, ok := loadOwnedBill(c, "view")
+	if !ok {
+		return
+	}
+
+	items, err := storage.GetBillItemsByBillID(bill.ID)
+	if err != nil {
+		log.Printf("Error fetching bill items: %v", err)
+		items = []models.BillItem{}
+	}
+	bill.Items = items
+
+	payments, err := storage.GetBillPaymentsByBillID(bill.ID)
+	if err != nil {
+		log.Printf("Error fetching bill payments: %v", err)
+		payments = []models.BillPayment{}
+	}
+	bill.Payments = payments
+
+	supplier, err := storage.GetSupplierByID(bill.SupplierID)
+	if err != nil {
+		log.Printf("Error fetching supplier: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bill": bill, "supplier": supplier})
+}
+
+// downloadBillSource returns the original e-invoice XML of a bill.
+func downloadBillSource(c *gin.Context) {
+	bill, ok := loadOwnedBill(c, "view")
+	if !ok {
+		return
+	}
+
+	source, err := storage.GetBillSourceDocument(bill.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load bill source document"})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=bill_"+bill.ID.String()+".xml")
+	c.Data(http.StatusOK, "application/xml", []byte(source))
+}
+
+// recordBillPayment records a (partial) payment against a bill.
+func recordBillPayment(c *gin.Context) {
+	bill, ok := loadOwnedBill(c, "pay")
+	if !ok {
+		return
+	}
+
+	var payment models.BillPayment
+	if err := c.ShouldBindJSON(&payment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment data", "details": err.Error()})
+		return
+	}
+	if err := utils.ValidateAmount(payment.Amount, "amount"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	payment.BillID = bill.ID
+	payment.Reference = utils.SanitizeString(payment.Reference, 255)
+	if payment.PaidAt.IsZero() {
+		payment.PaidAt = time.Now()
+	}
+
+	updated, err := storage.RecordBillPayment(&payment)
+	if errors.Is(err, storage.ErrBillVoid) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot record a payment on a void bill"})
+		return
+	}
+	if errors.Is(err, storage.ErrBillPaid) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Bill is already paid"})
+		return
+	}
+	if errors.Is(err, storage.ErrOverpayment) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment exceeds the open balance of the bill"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error recording bill payment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Payment recorded", "payment": payment, "bill": updated})
+}
+
+// voidBill marks a bill as void so it no longer counts as payable.
+func voidBill(c *gin.Context) {
+	bill, ok := loadOwnedBill(c, "void")
+	if !ok {
+		return
+	}
+
+	if err := storage.UpdateBillStatus(bill.ID, "void"); err != nil {
+		log.Printf("Error voiding bill: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to void bill"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bill voided"})
+}
+
+// deleteBill deletes a bill together with its items and payments.
+func deleteBill(c *gin.Context) {
+	bill, ok := loadOwnedBill(c, "delete")
+	if !ok {
+		return
+	}
+
+	if err := storage.DeleteBill(bill.ID); err != nil {
+		log.Printf("Error deleting bill: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete bill"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bill deleted successfully"})
+}
+
+// listSuppliers retrieves the suppliers known for the authenticated user.
+func listSuppliers(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format", "details": err.Error()})
+		return
+	}
+
+	suppliers, err := storage.GetSuppliersByUserID(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve suppliers", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suppliers": suppliers})
+}
+
+// loadOwnedBill fetches the bill named in the URL and verifies that it
+// belongs to the authenticated user. action completes the 403 message. It
+// writes the error response itself and returns false on failure.
+func loadOwnedBill(c *gin.Context, action string) (*models.Bill, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	billID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bill ID"})
+		return nil, false
+	}
+
+	bill, err := storage.GetBillByID(billID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bill not found"})
+		return nil, false
+	}
+
+	userUUID, err := uuid.Parse(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return nil, false
+	}
+
+	if bill.UserID != userUUID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to " + action + " this bill"})
+		return nil, false
+	}
+
+	return bill, true
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"invoice-generator-go/config"
+	"invoice-generator-go/einvoice"
+	"invoice-generator-go/models"
+	"invoice-generator-go/payments/provider"
+	"invoice-generator-go/paymentterms"
+	"invoice-generator-go/share"
+	"invoice-generator-go/storage"
+	"invoice-generator-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookSize bounds the payload of a payment provider webhook.
+const maxWebhookSize = 1 << 20
+
+// checkoutRequest sets where the customer returns to from the payment page.
+type checkoutRequest struct {
+	SuccessURL string `json:"success_url"`
+	CancelURL  string `json:"cancel_url"`
+}
+
+// createPublicInvoiceCheckout starts paying the invoice of an invoice share
+// link online.
+func createPublicInvoiceCheckout(c *gin.Context) {
+	link, token, ok := loadShareLink(c, false)
+	if !ok {
+		return
+	}
+
+	invoice, err := storage.GetInvoiceByID(*link.InvoiceID)
+	if err != nil || !share.Visible(*invoice) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return
+	}
+
+	startCheckout(c, invoice, share.InvoiceURL(config.GetConfig().PublicURL, token))
+}
+
+// createPublicCustomerCheckout starts paying one of the invoices of a
+// customer share link's customer online.
+func createPublicCustomerCheckout(c *gin.Context) {
+	link, token, ok := loadShareLink(c, true)
+	if !ok {
+		return
+	}
+	invoice, ok := loadPublicCustomerInvoice(c, link)
+	if !ok {
+		return
+	}
+
+	startCheckout(c, invoice, share.CustomerURL(config.GetConfig().PublicURL, token))
+}
+
+// paymentWebhook receives the payment provider's notifications. Paid
+// checkout sessions are recorded as payments on their invoice, once however
+// often the provider delivers the event; answering with an error makes the
+// provider deliver it again later.
+func paymentWebhook(c *gin.Context) {
+	p := provider.Default
+	if p == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Online payment is not enabled"})
+		return
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request"})
+		return
+	}
+	if err := p.VerifyWebhook(payload, c.Request.Header); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signature"})
+		return
+	}
+	event, err := p.ParseEvent(payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event", "details": err.Error()})
+		return
+	}
+	if event.Type == "" {
+		c.JSON(http.StatusOK, gin.H{"received": true})
+		return
+	}
+
+	session, err := storage.GetCheckoutSession(p.Name(), event.SessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Sessions of other applications on the same provider account
+		log.Printf("Ignoring %s event %s for unknown checkout session %q", p.Name(), event.ID, event.SessionID)
+		c.JSON(http.StatusOK, gin.H{"received": true})
+		return
+	}
+	if err != nil {
+		log.Printf("Error retrieving checkout session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve checkout session"})
+		return
+	}
+
+	switch event.Type {
+	case provider.EventPaymentSucceeded:
+		if event.Amount <= 0 || (event.Currency != "" && !strings.EqualFold(event.Currency, einvoice.CurrencyCode(session.Currency))) {
+			log.Printf("Ignoring %s event %s: paid %.2f %s for a session of %.2f %s", p.Name(), event.ID, event.Amount, event.Currency, session.Amount, session.Currency)
+			break
+		}
+		payment := models.Payment{
+			Amount:            event.Amount,
+			PaidAt:            event.Created,
+			Reference:         event.PaymentID,
+			ProviderPaymentID: event.PaymentID,
+		}
+		invoice, recorded, err := storage.RecordProviderPayment(event.ID, session, &payment)
+		if err != nil {
+			log.Printf("Error recording %s payment: %v", p.Name(), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment"})
+			return
+		}
+		if recorded && invoice.AmountPaid > invoice.TotalAmount+0.005 {
+			log.Printf("Warning: invoice %s overpaid online by %.2f %s", invoice.InvoiceNumber, invoice.AmountPaid-invoice.TotalAmount, invoice.Currency)
+		}
+	case provider.EventPaymentFailed, provider.EventSessionExpired:
+		status := "failed"
+		if event.Type == provider.EventSessionExpired {
+			status = "expired"
+		}
+		if _, err := storage.CloseCheckoutSession(event.ID, event.Type, session, status); err != nil {
+			log.Printf("Error closing checkout session: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update checkout session"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// startCheckout starts a checkout session for what is due on invoice and
+// answers with the payment page the customer is to be sent to. Without
+// return addresses in the request, the customer comes back to returnURL.
+func startCheckout(c *gin.Context, invoice *models.Invoice, returnURL string) {
+	p := provider.Default
+	if p == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Online payment is not enabled"})
+		return
+	}
+	if !payableOnline(*invoice) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This invoice cannot be paid online"})
+		return
+	}
+	// Invoices may carry a symbol such as "$"; providers take the ISO code
+	currency := einvoice.CurrencyCode(invoice.Currency)
+	if err := utils.ValidateCurrency(currency); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "The invoice currency must be an ISO 4217 code to be paid online", "details": err.Error()})
+		return
+	}
+
+	var input checkoutRequest
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+	if input.SuccessURL == "" {
+		input.SuccessURL = returnURL
+	}
+	if input.CancelURL == "" {
+		input.CancelURL = returnURL
+	}
+	// The provider sends the customer on to these, so they are kept to our
+	// own origin rather than redirecting anywhere a link's holder asks
+	publicURL := config.GetConfig().PublicURL
+	if !validReturnURL(input.SuccessURL, publicURL) || !validReturnURL(input.CancelURL, publicURL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "success_url and cancel_url must be URLs on " + publicURL})
+		return
+	}
+
+	req := provider.CheckoutRequest{
+		InvoiceID:     invoice.ID,
+		InvoiceNumber: invoice.InvoiceNumber,
+		Description:   "Invoice " + invoice.InvoiceNumber,
+		Amount:        paymentterms.AmountDue(*invoice, time.Now()),
+		Currency:      currency,
+		CustomerEmail: invoice.CustomerEmail,
+		SuccessURL:    input.SuccessURL,
+		CancelURL:     input.CancelURL,
+	}
+	started, err := p.CreateCheckoutSession(c.Request.Context(), req)
+	if err != nil {
+		log.Printf("Error starting %s checkout: %v", p.Name(), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to start the payment"})
+		return
+	}
+
+	session := models.CheckoutSession{
+		InvoiceID:         invoice.ID,
+		Provider:          p.Name(),
+		ProviderSessionID: started.ID,
+		Amount:            req.Amount,
+		Currency:          req.Currency,
+		URL:               started.URL,
+	}
+	if err := storage.CreateCheckoutSession(&session); err != nil {
+		log.Printf("Error storing checkout session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start the payment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Checkout started", "checkout_session": session})
+}
+
+// payableOnline reports whether a customer can pay invoice online: online
+// payment is enabled and the invoice is issued with money due.
+func payableOnline(invoice models.Invoice) bool {
+	if provider.Default == nil || invoice.DocumentType == "credit_note" {
+		return false
+	}
+	if invoice.Status != "sent" && invoice.Status != "overdue" {
+		return false
+	}
+	return paymentterms.AmountDue(invoice, time.Now()) > 0
+}
+
+// validReturnURL reports whether raw is an absolute http or https URL with
+// the same origin as publicURL.
+func validReturnURL(raw, publicURL string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return false
+	}
+	public, err := url.Parse(publicURL)
+	return err == nil && strings.EqualFold(u.Scheme, public.Scheme) && strings.EqualFold(u.Host, public.Host)
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"invoice-generator-go/dunning"
+	"invoice-generator-go/models"
+	"invoice-generator-go/storage"
+	"invoice-generator-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getDunningPolicy returns the account's dunning policy, or the suggested
+// default, disabled, when it has none.
+func getDunningPolicy(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	policy, err := storage.GetDunningPolicy(userUUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusOK, dunning.DefaultPolicy())
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve dunning policy", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// setDunningPolicy replaces the account's dunning policy.
+func setDunningPolicy(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var policy models.DunningPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+	if policy.Steps == nil {
+		policy.Steps = []models.DunningStep{}
+	}
+	if err := dunning.Validate(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := storage.SetDunningPolicy(userUUID, &policy); err != nil {
+		log.Printf("Error saving dunning policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save dunning policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// listDunningExclusions lists the customers exempted from reminders.
+func listDunningExclusions(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	exclusions, err := storage.GetDunningExclusions(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve dunning exclusions", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"exclusions": exclusions})
+}
+
+// setDunningExclusion exempts a customer from reminders.
+func setDunningExclusion(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var exclusion models.DunningExclusion
+	if err := c.ShouldBindJSON(&exclusion); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+	exclusion.Reason = utils.SanitizeString(exclusion.Reason, 1000)
+
+	if err := storage.SetDunningExclusion(userUUID, &exclusion); err != nil {
+		log.Printf("Error saving dunning exclusion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save dunning exclusion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, exclusion)
+}
+
+// deleteDunningExclusion lets reminders go to the customer given by
+// ?customer_email= again.
+func deleteDunningExclusion(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	email := c.Query("customer_email")
+	if email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "customer_email is required"})
+		return
+	}
+
+	found, err := storage.DeleteDunningExclusion(userUUID, email)
+	if err != nil {
+		log.Printf("Error deleting dunning exclusion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete dunning exclusion"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "This customer is not excluded"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Dunning exclusion removed"})
+}
+
+// listInvoiceReminders lists the reminder steps taken for an invoice.
+func listInvoiceReminders(c *gin.Context) {
+	invoice, ok := loadOwnedInvoice(c, "view reminders of")
+	if !ok {
+		return
+	}
+
+	events, err := storage.GetDunningEvents(invoice.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reminders", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reminders": events})
+}
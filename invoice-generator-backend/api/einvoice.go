@@ -0,0 +1,175 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"invoice-generator-go/einvoice"
+	"invoice-generator-go/models"
+	"invoice-generator-go/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// exportEInvoice emits an invoice as a structured e-invoice (UBL 2.1 / Peppol
+// BIS Billing 3.0 or Factur-X CII).
+func exportEInvoice(c *gin.Context) {
+	doc, violations, ok := loadEInvoiceDocument(c)
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", "ubl")
+	var (
+		data []byte
+		err  error
+	)
+	switch format {
+	case "ubl":
+		data, err = einvoice.MarshalUBL(doc)
+		if err == nil {
+			violations = append(violations, einvoice.CheckUBL(data)...)
+		}
+	case "cii":
+		data, err = einvoice.MarshalCII(doc)
+		if err == nil {
+			var ciiViolations []einvoice.Violation
+			ciiViolations, err = ciiViolationsOf(data)
+			violations = append(violations, ciiViolations...)
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported export format, expected ubl or cii"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error exporting invoice: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export invoice"})
+		return
+	}
+
+	if len(violations) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      "Invoice does not satisfy the business rules for this format",
+			"violations": violations,
+		})
+		return
+	}
+
+	fileName := fmt.Sprintf("invoice_%s_%s.xml", doc.Number, format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
+	c.Data(http.StatusOK, "application/xml", data)
+}
+
+// checkEInvoice reports which business rules an invoice would fail when
+// exported, without producing the document.
+func checkEInvoice(c *gin.Context) {
+	doc, violations, ok := loadEInvoiceDocument(c)
+	if !ok {
+		return
+	}
+
+	switch c.DefaultQuery("format", "ubl") {
+	case "ubl":
+		data, err := einvoice.MarshalUBL(doc)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export invoice"})
+			return
+		}
+		violations = append(violations, einvoice.CheckUBL(data)...)
+	case "cii":
+		data, err := einvoice.MarshalCII(doc)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export invoice"})
+			return
+		}
+		ciiViolations, err := ciiViolationsOf(data)
+		if err != nil {
+			log.Printf("Error validating CII: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate invoice"})
+			return
+		}
+		violations = append(violations, ciiViolations...)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported export format, expected ubl or cii"})
+		return
+	}
+
+	if violations == nil {
+		violations = []einvoice.Violation{}
+	}
+	c.JSON(http.StatusOK, gin.H{"valid": len(violations) == 0, "violations": violations})
+}
+
+// loadEInvoiceDocument fetches the invoice named in the URL, verifies that
+// it belongs to the authenticated user and maps it to an e-invoice document.
+// It also returns the ways the invoice's stored totals disagree with its
+// items, which block the export. It writes the error response itself and
+// returns false on failure.
+func loadEInvoiceDocument(c *gin.Context) (einvoice.Document, []einvoice.Violation, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return einvoice.Document{}, nil, false
+	}
+
+	invoiceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return einvoice.Document{}, nil, false
+	}
+
+	invoice, err := storage.GetInvoiceByID(invoiceID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return einvoice.Document{}, nil, false
+	}
+
+	userUUID, err := uuid.Parse(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return einvoice.Document{}, nil, false
+	}
+
+	if invoice.UserID != userUUID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to export this invoice"})
+		return einvoice.Document{}, nil, false
+	}
+
+	items, err := storage.GetInvoiceItemsByInvoiceID(invoiceID)
+	if err != nil {
+		log.Printf("Error fetching invoice items: %v", err)
+		items = []models.InvoiceItem{}
+	}
+
+	company, err := storage.GetCompanyProfileForInvoice(invoice)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load seller details"})
+		return einvoice.Document{}, nil, false
+	}
+
+	doc, err := einvoice.FromInvoice(*invoice, items, *company)
+	if err != nil {
+		verr, ok := err.(*einvoice.ValidationError)
+		if !ok {
+			log.Printf("Error mapping invoice to e-invoice: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export invoice"})
+			return einvoice.Document{}, nil, false
+		}
+		return doc, verr.Violations, true
+	}
+	return doc, nil, true
+}
+
+// ciiViolationsOf validates a Cross Industry Invoice and returns what it
+// fails, or an error when it couldn't be validated.
+func ciiViolationsOf(data []byte) ([]einvoice.Violation, error) {
+	err := einvoice.ValidateCII(data)
+	var verr *einvoice.ValidationError
+	if errors.As(err, &verr) {
+		return verr.Violations, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"invoice-generator-go/mail"
+	"invoice-generator-go/models"
+	"invoice-generator-go/pdf"
+	"invoice-generator-go/storage"
+	"invoice-generator-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sendInvoiceRequest overrides the recipients and text of an invoice email.
+// To defaults to the invoice's customer email; subject and body default to
+// the account's invoice email template.
+type sendInvoiceRequest struct {
+	To      []string `json:"to"`
+	Cc      []string `json:"cc"`
+	Subject string   `json:"subject"`
+	Body    string   `json:"body"`
+}
+
+// sendInvoice emails an invoice to the customer with its PDF attached. Draft
+// invoices move to sent once the email is delivered.
+func sendInvoice(c *gin.Context) {
+	invoice, ok := loadOwnedInvoice(c, "send")
+	if !ok {
+		return
+	}
+	if invoice.Status == "void" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot send a void invoice"})
+		return
+	}
+
+	var input sendInvoiceRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+			return
+		}
+	}
+	if len(input.To) == 0 && invoice.CustomerEmail != "" {
+		input.To = []string{invoice.CustomerEmail}
+	}
+	if len(input.To) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The invoice has no customer email, pass recipients in to"})
+		return
+	}
+	for _, address := range append(append([]string{}, input.To...), input.Cc...) {
+		if err := utils.ValidateEmail(address); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipient " + address})
+			return
+		}
+	}
+	if err := mail.ValidateOverrides(input.Subject, input.Body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sent, err := mail.SendInvoice(invoice, mail.SendOptions{To: input.To, Cc: input.Cc, Subject: input.Subject, Body: input.Body})
+	if errors.Is(err, mail.ErrDelivery) {
+		log.Printf("Error delivering invoice email: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to deliver the email", "details": err.Error(), "email": sent})
+		return
+	}
+	if err != nil {
+		var sandboxErr *pdf.SandboxError
+		if errors.As(err, &sandboxErr) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Template exceeded a rendering limit", "rule": sandboxErr.Rule, "details": sandboxErr.Message})
+			return
+		}
+		log.Printf("Error sending invoice: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send invoice", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invoice sent", "email": sent})
+}
+
+// listInvoiceEmails lists the emails sent for an invoice with their
+// delivery status.
+func listInvoiceEmails(c *gin.Context) {
+	invoice, ok := loadOwnedInvoice(c, "view emails of")
+	if !ok {
+		return
+	}
+
+	emails, err := storage.GetSentEmailsByInvoiceID(invoice.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve emails", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"emails": emails})
+}
+
+// listEmailTemplates lists the email template of every kind, customised or
+// built in, with the placeholders they may use.
+func listEmailTemplates(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	custom, err := storage.GetEmailTemplates(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve email templates", "details": err.Error()})
+		return
+	}
+	templates := make([]models.EmailTemplate, 0, len(mail.Kinds()))
+	for _, kind := range mail.Kinds() {
+		if t, ok := custom[kind]; ok {
+			templates = append(templates, t)
+		} else {
+			templates = append(templates, mail.DefaultTemplate(kind))
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": templates, "placeholders": mail.Placeholders})
+}
+
+// getEmailTemplate returns the email template of the :kind URL parameter.
+func getEmailTemplate(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	kind, ok := emailTemplateKind(c)
+	if !ok {
+		return
+	}
+
+	t, err := mail.TemplateFor(userUUID, kind)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve email template", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
+
+// setEmailTemplate customises the email template of the :kind URL
+// parameter.
+func setEmailTemplate(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	kind, ok := emailTemplateKind(c)
+	if !ok {
+		return
+	}
+
+	var t models.EmailTemplate
+	if err := c.ShouldBindJSON(&t); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+	t.Kind = kind
+	t.Subject = strings.TrimSpace(t.Subject)
+	t.IsDefault = false
+	if err := mail.ValidateTemplate(t); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := storage.SetEmailTemplate(userUUID, &t); err != nil {
+		log.Printf("Error saving email template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save email template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
+
+// deleteEmailTemplate resets the email template of the :kind URL parameter
+// to the built-in text.
+func deleteEmailTemplate(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	kind, ok := emailTemplateKind(c)
+	if !ok {
+		return
+	}
+
+	deleted, err := storage.DeleteEmailTemplate(userUUID, kind)
+	if err != nil {
+		log.Printf("Error deleting email template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset email template"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Email template is not customised"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mail.DefaultTemplate(kind))
+}
+
+// emailTemplateKind validates the :kind URL parameter. It writes the error
+// response itself and returns false when it is unknown.
+func emailTemplateKind(c *gin.Context) (string, bool) {
+	kind := c.Param("kind")
+	if !mail.ValidKind(kind) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown email template kind", "kinds": mail.Kinds()})
+		return "", false
+	}
+	return kind, true
+}
@@ -0,0 +1,257 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"invoice-generator-go/export"
+	"invoice-generator-go/models"
+	"invoice-generator-go/pdf"
+	"invoice-generator-go/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// exportRequest selects the invoices of a bulk export by ID, by filter or
+// both.
+type exportRequest struct {
+	Format     string        `json:"format"`
+	InvoiceIDs []uuid.UUID   `json:"invoice_ids"`
+	Filter     *exportFilter `json:"filter"`
+}
+
+// exportFilter matches invoices by status, document type, customer and
+// invoice date range (YYYY-MM-DD, inclusive).
+type exportFilter struct {
+	Status        string `json:"status"`
+	DocumentType  string `json:"document_type"`
+	CustomerEmail string `json:"customer_email"`
+	From          string `json:"from"`
+	To            string `json:"to"`
+}
+
+// exportInvoices exports invoices as a ZIP of their PDFs with a manifest, or
+// as one merged PDF for printing. Small exports are returned directly;
+// larger ones, or any with ?async=true, are processed as a background job
+// and answered with 202 and the job to poll.
+func exportInvoices(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var input exportRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+	if input.Format == "" {
+		input.Format = export.FormatZIP
+	}
+	if !export.ValidFormat(input.Format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported format, expected zip or pdf"})
+		return
+	}
+	if len(input.InvoiceIDs) == 0 && input.Filter == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either invoice_ids or filter is required"})
+		return
+	}
+	if len(input.InvoiceIDs) > export.MaxInvoices {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d invoices can be exported at once", export.MaxInvoices)})
+		return
+	}
+
+	filter := storage.InvoiceFilter{IDs: input.InvoiceIDs}
+	if f := input.Filter; f != nil {
+		filter.Status = f.Status
+		filter.DocumentType = f.DocumentType
+		filter.CustomerEmail = f.CustomerEmail
+		var err error
+		if filter.From, err = optionalDate(f.From); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter.from, expected YYYY-MM-DD"})
+			return
+		}
+		if filter.To, err = optionalDate(f.To); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter.to, expected YYYY-MM-DD"})
+			return
+		}
+	}
+
+	invoices, err := storage.FindInvoices(userUUID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve invoices", "details": err.Error()})
+		return
+	}
+	if len(input.InvoiceIDs) > 0 && input.Filter == nil && len(invoices) < len(uniqueIDs(input.InvoiceIDs)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Some invoices were not found"})
+		return
+	}
+	if len(invoices) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No invoices match the export"})
+		return
+	}
+	if len(invoices) > export.MaxInvoices {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%d invoices match; at most %d can be exported at once", len(invoices), export.MaxInvoices)})
+		return
+	}
+
+	if len(invoices) > export.SyncLimit || c.Query("async") == "true" {
+		job := models.ExportJob{UserID: userUUID, Format: input.Format, Total: len(invoices)}
+		if err := storage.CreateExportJob(&job); err != nil {
+			log.Printf("Error creating export job: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start export"})
+			return
+		}
+		export.Start(job, invoices)
+		c.Header("Location", "/api/exports/"+job.ID.String())
+		c.JSON(http.StatusAccepted, gin.H{"message": "Export started", "job": job})
+		return
+	}
+
+	data, err := export.Build(c.Request.Context(), input.Format, invoices, nil)
+	if err != nil {
+		var sandboxErr *pdf.SandboxError
+		if errors.As(err, &sandboxErr) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Template exceeded a rendering limit", "rule": sandboxErr.Rule, "details": sandboxErr.Message})
+			return
+		}
+		log.Printf("Error exporting invoices: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export invoices", "details": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename="+export.FileName(input.Format, time.Now()))
+	c.Data(http.StatusOK, export.ContentType(input.Format), data)
+}
+
+// listExportJobs lists the user's export jobs.
+func listExportJobs(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	jobs, err := storage.GetExportJobs(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve exports", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"exports": jobs})
+}
+
+// getExportJob reports the status and progress of an export job.
+func getExportJob(c *gin.Context) {
+	job, ok := loadExportJob(c, "view")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// downloadExport downloads the file of a finished export job.
+func downloadExport(c *gin.Context) {
+	job, ok := loadExportJob(c, "download")
+	if !ok {
+		return
+	}
+	serveExportFile(c, job)
+}
+
+// serveExportFile writes the file of a finished export job.
+func serveExportFile(c *gin.Context, job *models.ExportJob) {
+	if job.Status != "done" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Export is not finished", "status": job.Status})
+		return
+	}
+
+	data, err := storage.Blobs.Get(job.BlobKey)
+	if err != nil {
+		log.Printf("Error loading export file: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export file not found"})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename="+job.FileName)
+	c.Data(http.StatusOK, export.ContentType(job.Format), data)
+}
+
+// deleteExportJob deletes a finished export job and its file.
+func deleteExportJob(c *gin.Context) {
+	job, ok := loadExportJob(c, "delete")
+	if !ok {
+		return
+	}
+	if job.Status == "queued" || job.Status == "running" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Export is still in progress"})
+		return
+	}
+
+	if err := storage.DeleteExportJob(job.ID); err != nil {
+		log.Printf("Error deleting export job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete export"})
+		return
+	}
+	if job.BlobKey != "" {
+		if err := storage.Blobs.Delete(job.BlobKey); err != nil {
+			log.Printf("Error deleting export file: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Export deleted"})
+}
+
+// loadExportJob loads the export job in the :id URL parameter and checks
+// that it belongs to the current user. It writes the error response itself
+// and returns false on failure.
+func loadExportJob(c *gin.Context, action string) (*models.ExportJob, bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID"})
+		return nil, false
+	}
+
+	job, err := storage.GetExportJob(jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve export", "details": err.Error()})
+		return nil, false
+	}
+	if job.UserID != userUUID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to " + action + " this export"})
+		return nil, false
+	}
+	return job, true
+}
+
+// optionalDate parses a YYYY-MM-DD date, returning nil for "".
+func optionalDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func uniqueIDs(ids []uuid.UUID) map[uuid.UUID]bool {
+	unique := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+	return unique
+}
@@ -1,7 +1,10 @@
 package api
 
 import (
+	"database/sql"
+	"errors"
 	"invoice-generator-go/models"
+	"invoice-generator-go/paymentterms"
 	"invoice-generator-go/storage"
 	"invoice-generator-go/utils"
 	"log"
@@ -88,6 +91,15 @@ func createInvoice(c *gin.Context) {
 		invoice.Notes = utils.SanitizeString(invoice.Notes, 1000)
 	}
 
+	// Validate document type (invoice or credit note)
+	if invoice.DocumentType == "" {
+		invoice.DocumentType = "invoice"
+	} else if err := utils.ValidateDocumentType(invoice.DocumentType); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	invoice.BuyerReference = utils.SanitizeString(invoice.BuyerReference, 255)
+
 	// Validate invoice items
 	for i, item := range invoice.Items {
 		if err := utils.ValidateRequiredString(item.Description, "item description"); err != nil {
@@ -110,6 +122,31 @@ func createInvoice(c *gin.Context) {
 		return
 	}
 
+	if !validCompanyProfile(invoice.CompanyProfileID, userUUID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company profile"})
+		return
+	}
+	if invoice.TemplateID != nil && !usableTemplate(*invoice.TemplateID, userUUID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template"})
+		return
+	}
+
+	// Pick the payment terms: the invoice's own, else, unless a due date is
+	// given, the customer's or account's default
+	var terms *models.PaymentTerms
+	if invoice.PaymentTermsID != nil {
+		if terms = usablePaymentTerms(*invoice.PaymentTermsID, userUUID); terms == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment terms"})
+			return
+		}
+	} else if invoice.DueDate.IsZero() {
+		if terms, err = storage.ResolvePaymentTerms(userUUID, invoice.CustomerEmail); err != nil {
+			log.Printf("Error resolving payment terms: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve payment terms"})
+			return
+		}
+	}
+
 	// Set up the invoice
 	invoice.UserID = userUUID
 	invoice.ID = uuid.New()
@@ -119,18 +156,15 @@ func createInvoice(c *gin.Context) {
 	if invoice.InvoiceDate.IsZero() {
 		invoice.InvoiceDate = time.Now()
 	}
-	if invoice.DueDate.IsZero() {
-		invoice.DueDate = invoice.InvoiceDate.AddDate(0, 1, 0) // Default due date: 1 month
+	// Terms and discounts only come from payment terms
+	invoice.PaymentTerms, invoice.DiscountPercent, invoice.DiscountDueDate = "", 0, nil
+	if terms != nil {
+		paymentterms.Apply(&invoice, *terms)
+	} else if invoice.DueDate.IsZero() {
+		invoice.DueDate = paymentterms.FallbackDueDate(invoice.InvoiceDate)
 	}
 
-	// Create invoice items if present
-	var items []models.InvoiceItem
-	if len(invoice.Items) > 0 {
-		items = invoice.Items
-		invoice.Items = nil // Clear items before saving invoice
-	}
-
-	// Save the invoice to the database
+	// Save the invoice and its items to the database
 	invoiceID, err := storage.CreateInvoice(&invoice)
 	if err != nil {
 		log.Printf("Error creating invoice: %v", err)
@@ -138,19 +172,6 @@ func createInvoice(c *gin.Context) {
 		return
 	}
 
-	// If there are items, save them
-	if len(items) > 0 {
-		invoiceUUID, _ := uuid.Parse(invoiceID)
-		for _, item := range items {
-			item.InvoiceID = invoiceUUID
-			item.ID = uuid.New()
-			if err := storage.CreateInvoiceItem(&item); err != nil {
-				log.Printf("Error creating invoice item: %v", err)
-				// Consider whether to rollback the invoice creation here
-			}
-		}
-	}
-
 	// Return the created invoice ID
 	c.JSON(http.StatusCreated, gin.H{
 		"message":    "Invoice created successfully",
@@ -319,6 +340,46 @@ func updateInvoice(c *gin.Context) {
 	invoice.ID = invoiceID
 	invoice.UserID = userUUID
 	invoice.UpdatedAt = time.Now()
+	if invoice.DocumentType == "" {
+		invoice.DocumentType = existingInvoice.DocumentType
+	} else if err := utils.ValidateDocumentType(invoice.DocumentType); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	invoice.BuyerReference = utils.SanitizeString(invoice.BuyerReference, 255)
+	if invoice.CompanyProfileID == nil {
+		invoice.CompanyProfileID = existingInvoice.CompanyProfileID
+	} else if !validCompanyProfile(invoice.CompanyProfileID, userUUID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company profile"})
+		return
+	}
+	if invoice.TemplateID != nil && !usableTemplate(*invoice.TemplateID, userUUID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template"})
+		return
+	}
+	// Naming payment terms, or moving the invoice date, reissues the
+	// invoice under its terms; otherwise it keeps the terms and discount it
+	// has
+	if invoice.InvoiceDate.IsZero() {
+		invoice.InvoiceDate = existingInvoice.InvoiceDate
+	}
+	var terms *models.PaymentTerms
+	if invoice.PaymentTermsID != nil {
+		if terms = usablePaymentTerms(*invoice.PaymentTermsID, userUUID); terms == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment terms"})
+			return
+		}
+	} else if existingInvoice.PaymentTermsID != nil {
+		terms, err = storage.GetPaymentTermsByID(*existingInvoice.PaymentTermsID)
+		if errors.Is(err, sql.ErrNoRows) {
+			terms = nil
+		} else if err != nil {
+			log.Printf("Error retrieving payment terms: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve payment terms"})
+			return
+		}
+	}
+	paymentterms.Reissue(&invoice, *existingInvoice, terms)
 
 	// Handle items if present
 	var items []models.InvoiceItem
@@ -355,3 +416,13 @@ func updateInvoice(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Invoice updated successfully"})
 }
+
+// validCompanyProfile reports whether the optional sender profile of an
+// invoice exists and belongs to the user.
+func validCompanyProfile(profileID *uuid.UUID, userID uuid.UUID) bool {
+	if profileID == nil {
+		return true
+	}
+	profile, err := storage.GetCompanyProfileByID(*profileID)
+	return err == nil && profile.UserID == userID
+}
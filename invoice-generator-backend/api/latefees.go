@@ -0,0 +1,173 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"invoice-generator-go/models"
+	"invoice-generator-go/overdue"
+	"invoice-generator-go/paymentterms"
+	"invoice-generator-go/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// getLateFeeRule returns the account's late fee rule, or the default, which
+// charges nothing, when it has none.
+func getLateFeeRule(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	rule, err := lateFeeRule(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve late fee rule", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// setLateFeeRule replaces the account's late fee rule.
+func setLateFeeRule(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var rule models.LateFeeRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+	if err := overdue.Validate(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := storage.SetLateFeeRule(userUUID, &rule); err != nil {
+		log.Printf("Error saving late fee rule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save late fee rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// getInvoiceLateFees returns the late payment charges an invoice owes as of
+// ?as_of= (YYYY-MM-DD, default today) beyond those already billed.
+func getInvoiceLateFees(c *gin.Context) {
+	invoice, ok := loadOwnedInvoice(c, "view late fees of")
+	if !ok {
+		return
+	}
+
+	asOf, err := optionalDate(c.Query("as_of"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "as_of must be a date in YYYY-MM-DD format"})
+		return
+	}
+	if asOf == nil {
+		now := time.Now()
+		asOf = &now
+	}
+
+	assessment, ok := assessLateFees(c, invoice, *asOf)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, assessment)
+}
+
+// createLateFeeInvoice bills the late payment charges an invoice owes today
+// on a new draft invoice to the same customer.
+func createLateFeeInvoice(c *gin.Context) {
+	invoice, ok := loadOwnedInvoice(c, "charge late fees on")
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	assessment, ok := assessLateFees(c, invoice, now)
+	if !ok {
+		return
+	}
+	if assessment.Total <= 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This invoice owes no late payment charges", "late_fees": assessment})
+		return
+	}
+
+	charges, items, charge := overdue.ChargeInvoice(invoice, assessment, now)
+	terms, err := storage.ResolvePaymentTerms(invoice.UserID, invoice.CustomerEmail)
+	if err != nil {
+		log.Printf("Error resolving payment terms: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create late fee invoice"})
+		return
+	}
+	if terms != nil {
+		paymentterms.Apply(&charges, *terms)
+	} else if charges.DueDate.IsZero() {
+		charges.DueDate = paymentterms.FallbackDueDate(charges.InvoiceDate)
+	}
+
+	err = storage.CreateLateFeeInvoice(&charges, items, &charge, assessment.ChargedTo)
+	if errors.Is(err, storage.ErrLateFeesChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Late payment charges for this invoice were billed in the meantime"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating late fee invoice: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create late fee invoice"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Late fee invoice created successfully",
+		"invoice_id": charges.ID,
+		"charge":     charge,
+		"late_fees":  assessment,
+	})
+}
+
+// assessLateFees prices an issued invoice's late payment under its owner's
+// rule, writing the error response when it can't.
+func assessLateFees(c *gin.Context, invoice *models.Invoice, asOf time.Time) (models.LateFeeAssessment, bool) {
+	if invoice.DocumentType != "invoice" || invoice.Status == "draft" || invoice.Status == "void" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only issued invoices accrue late payment charges"})
+		return models.LateFeeAssessment{}, false
+	}
+
+	rule, err := lateFeeRule(invoice.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve late fee rule", "details": err.Error()})
+		return models.LateFeeAssessment{}, false
+	}
+	payments, err := storage.GetInvoicePayments(invoice.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve payments", "details": err.Error()})
+		return models.LateFeeAssessment{}, false
+	}
+	charges, err := storage.GetLateFeeCharges(invoice.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve late fee charges", "details": err.Error()})
+		return models.LateFeeAssessment{}, false
+	}
+
+	return overdue.Assess(invoice, payments, *rule, charges, asOf), true
+}
+
+// lateFeeRule returns a user's late fee rule, or the default.
+func lateFeeRule(userID uuid.UUID) (*models.LateFeeRule, error) {
+	rule, err := storage.GetLateFeeRule(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		def := overdue.DefaultRule()
+		return &def, nil
+	}
+	return rule, err
+}
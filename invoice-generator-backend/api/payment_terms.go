@@ -0,0 +1,299 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"invoice-generator-go/models"
+	"invoice-generator-go/paymentterms"
+	"invoice-generator-go/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// listPaymentTerms lists the payment terms available to the user: the
+// shared system terms and their own.
+func listPaymentTerms(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	list, err := storage.GetPaymentTermsByUserID(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve payment terms", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payment_terms": list})
+}
+
+// createPaymentTerms adds payment terms to the account.
+func createPaymentTerms(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var terms models.PaymentTerms
+	if err := c.ShouldBindJSON(&terms); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+	if err := paymentterms.Validate(&terms); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	terms.UserID = userUUID
+	terms.IsSystem = false
+
+	err := storage.CreatePaymentTerms(&terms)
+	if errors.Is(err, storage.ErrDuplicatePaymentTerms) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment terms with this name already exist"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating payment terms: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment terms"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, terms)
+}
+
+// getPaymentTerms returns one set of payment terms.
+func getPaymentTerms(c *gin.Context) {
+	terms, ok := loadPaymentTermsForUser(c, "view")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, terms)
+}
+
+// updatePaymentTerms replaces the account's payment terms. Invoices already
+// issued under them keep their due date and discount.
+func updatePaymentTerms(c *gin.Context) {
+	terms, ok := loadOwnedPaymentTerms(c, "update")
+	if !ok {
+		return
+	}
+
+	var input models.PaymentTerms
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+	if err := paymentterms.Validate(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.ID, input.UserID, input.CreatedAt = terms.ID, terms.UserID, terms.CreatedAt
+
+	err := storage.UpdatePaymentTerms(&input)
+	if errors.Is(err, storage.ErrDuplicatePaymentTerms) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment terms with this name already exist"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating payment terms: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment terms"})
+		return
+	}
+
+	c.JSON(http.StatusOK, input)
+}
+
+// deletePaymentTerms deletes the account's payment terms.
+func deletePaymentTerms(c *gin.Context) {
+	terms, ok := loadOwnedPaymentTerms(c, "delete")
+	if !ok {
+		return
+	}
+
+	if err := storage.DeletePaymentTerms(terms.ID); err != nil {
+		log.Printf("Error deleting payment terms: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete payment terms"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payment terms deleted successfully"})
+}
+
+// getDefaultPaymentTerms returns the account's default payment terms, nil
+// when invoices fall back to the system default.
+func getDefaultPaymentTerms(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	termsID, err := storage.GetDefaultPaymentTermsID(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve default payment terms", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payment_terms_id": termsID})
+}
+
+// setDefaultPaymentTerms sets the payment terms of the account's invoices
+// whose customer has none. {"payment_terms_id": null} reverts to the system
+// default.
+func setDefaultPaymentTerms(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		PaymentTermsID *uuid.UUID `json:"payment_terms_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if input.PaymentTermsID != nil && usablePaymentTerms(*input.PaymentTermsID, userUUID) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment terms"})
+		return
+	}
+
+	if err := storage.SetDefaultPaymentTermsID(userUUID, input.PaymentTermsID); err != nil {
+		log.Printf("Error setting default payment terms: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set default payment terms"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Default payment terms updated", "payment_terms_id": input.PaymentTermsID})
+}
+
+// listCustomerPaymentTerms lists the per-customer payment terms.
+func listCustomerPaymentTerms(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	assignments, err := storage.GetCustomerPaymentTerms(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve customer payment terms", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"customer_payment_terms": assignments})
+}
+
+// setCustomerPaymentTerms assigns payment terms to a customer, matched by
+// the customer email on invoices.
+func setCustomerPaymentTerms(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var assignment models.CustomerPaymentTerms
+	if err := c.ShouldBindJSON(&assignment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+	if usablePaymentTerms(assignment.PaymentTermsID, userUUID) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment terms"})
+		return
+	}
+	assignment.UserID = userUUID
+
+	if err := storage.SetCustomerPaymentTerms(&assignment); err != nil {
+		log.Printf("Error setting customer payment terms: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set customer payment terms"})
+		return
+	}
+
+	c.JSON(http.StatusOK, assignment)
+}
+
+// deleteCustomerPaymentTerms removes the payment terms of the customer given
+// by ?customer_email=.
+func deleteCustomerPaymentTerms(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	email := c.Query("customer_email")
+	if email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "customer_email is required"})
+		return
+	}
+
+	found, err := storage.DeleteCustomerPaymentTerms(userUUID, email)
+	if err != nil {
+		log.Printf("Error deleting customer payment terms: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete customer payment terms"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No payment terms assigned to this customer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Customer payment terms removed"})
+}
+
+// loadOwnedPaymentTerms is loadPaymentTermsForUser for changes, which the
+// shared system terms don't allow.
+func loadOwnedPaymentTerms(c *gin.Context, action string) (*models.PaymentTerms, bool) {
+	terms, ok := loadPaymentTermsForUser(c, action)
+	if !ok {
+		return nil, false
+	}
+	if terms.IsSystem {
+		c.JSON(http.StatusForbidden, gin.H{"error": "System payment terms are read-only; create your own instead"})
+		return nil, false
+	}
+	return terms, true
+}
+
+// loadPaymentTermsForUser fetches the payment terms named in the URL if the
+// user may use them: their own and the shared system terms. It writes the
+// error response itself and returns false on failure.
+func loadPaymentTermsForUser(c *gin.Context, action string) (*models.PaymentTerms, bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	termsID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment terms ID"})
+		return nil, false
+	}
+
+	terms, err := storage.GetPaymentTermsByID(termsID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment terms not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve payment terms", "details": err.Error()})
+		return nil, false
+	}
+
+	if !terms.IsSystem && terms.UserID != userUUID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to " + action + " these payment terms"})
+		return nil, false
+	}
+
+	return terms, true
+}
+
+// usablePaymentTerms returns the payment terms if they exist and the user
+// may issue invoices under them, nil otherwise.
+func usablePaymentTerms(termsID uuid.UUID, userID uuid.UUID) *models.PaymentTerms {
+	terms, err := storage.GetPaymentTermsByID(termsID)
+	if err != nil || (!terms.IsSystem && terms.UserID != userID) {
+		return nil
+	}
+	return terms
+}
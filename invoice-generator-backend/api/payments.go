@@ -0,0 +1,108 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"invoice-generator-go/models"
+	"invoice-generator-go/storage"
+	"invoice-generator-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// recordInvoicePayment records a payment received against an invoice. An
+// invoice paid in full is marked paid.
+func recordInvoicePayment(c *gin.Context) {
+	invoice, ok := loadOwnedInvoice(c, "record payments on")
+	if !ok {
+		return
+	}
+	if invoice.Status == "draft" || invoice.Status == "void" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot record a payment on a " + invoice.Status + " invoice"})
+		return
+	}
+	if invoice.DocumentType == "credit_note" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot record a payment on a credit note"})
+		return
+	}
+
+	var payment models.Payment
+	if err := c.ShouldBindJSON(&payment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment data", "details": err.Error()})
+		return
+	}
+	if err := utils.ValidateAmount(payment.Amount, "amount"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	payment.InvoiceID = invoice.ID
+	payment.Reference = utils.SanitizeString(payment.Reference, 255)
+	payment.Provider, payment.ProviderPaymentID = "", ""
+	if payment.PaidAt.IsZero() {
+		payment.PaidAt = time.Now()
+	}
+
+	updated, err := storage.RecordInvoicePayment(&payment)
+	if errors.Is(err, storage.ErrNotPayable) {
+		// The invoice was voided meanwhile
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot record a payment on this invoice"})
+		return
+	}
+	if errors.Is(err, storage.ErrOverpayment) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment exceeds the open balance of the invoice"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error recording invoice payment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Payment recorded", "payment": payment, "invoice": updated})
+}
+
+// listInvoicePayments lists the payments recorded against an invoice.
+func listInvoicePayments(c *gin.Context) {
+	invoice, ok := loadOwnedInvoice(c, "view payments of")
+	if !ok {
+		return
+	}
+
+	payments, err := storage.GetInvoicePayments(invoice.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve payments", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payments": payments})
+}
+
+// loadOwnedInvoice loads the invoice in the :id URL parameter and checks
+// that it belongs to the current user. It writes the error response itself
+// and returns false on failure.
+func loadOwnedInvoice(c *gin.Context, action string) (*models.Invoice, bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+	invoiceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return nil, false
+	}
+
+	invoice, err := storage.GetInvoiceByID(invoiceID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return nil, false
+	}
+	if invoice.UserID != userUUID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to " + action + " this invoice"})
+		return nil, false
+	}
+	return invoice, true
+}
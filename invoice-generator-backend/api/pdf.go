@@ -1,6 +1,8 @@
 package api
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,6 +10,8 @@ import (
 	"path/filepath"
 	"time"
 
+	"invoice-generator-go/einvoice"
+	"invoice-generator-go/i18n"
 	"invoice-generator-go/pdf"
 	"invoice-generator-go/storage"
 
@@ -49,15 +53,46 @@ func generatePDF(c *gin.Context) {
 		return
 	}
 
-	// Check if template_id is set
-	if invoice.TemplateID == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invoice does not have a template assigned"})
+	// Optional Factur-X XML embedded in the PDF
+	var opts pdf.Options
+	switch c.Query("format") {
+	case "", "pdf":
+	case "facturx", "zugferd":
+		opts.FacturX = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported format, expected pdf or facturx"})
 		return
 	}
 
+	// Optional language override, e.g. ?lang=fr
+	if lang := c.Query("lang"); lang != "" {
+		if !i18n.ValidLocale(lang) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid language, expected a code such as en or de-CH"})
+			return
+		}
+		opts.Language = lang
+	}
+
+	// Optional stamp override, e.g. ?watermark=none
+	watermark, ok := watermarkOverride(c, c.Query("watermark"))
+	if !ok {
+		return
+	}
+	opts.Watermark = watermark
+
 	// Generate the PDF
-	pdfPath, err := pdf.GeneratePDF(*invoice)
+	pdfPath, err := pdf.GeneratePDFWithOptions(*invoice, opts)
 	if err != nil {
+		var validationErr *einvoice.ValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invoice is not a valid e-invoice", "violations": validationErr.Violations})
+			return
+		}
+		var sandboxErr *pdf.SandboxError
+		if errors.As(err, &sandboxErr) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Template exceeded a rendering limit", "rule": sandboxErr.Rule, "details": sandboxErr.Message})
+			return
+		}
 		log.Printf("Error generating PDF: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate PDF", "details": err.Error()})
 		return
@@ -124,6 +159,17 @@ func downloadPDF(c *gin.Context) {
 		return
 	}
 
+	watermark, ok := watermarkOverride(c, c.Query("watermark"))
+	if !ok {
+		return
+	}
+	first, err := storage.MarkInvoiceDownloaded(invoice.ID)
+	if err != nil {
+		log.Printf("Error recording invoice download: %v", err)
+		// Treat it as the first download and serve the stored file
+		first = true
+	}
+
 	// Set headers for download
 	fileName := fmt.Sprintf("invoice_%s.pdf", invoice.InvoiceNumber)
 	c.Header("Content-Description", "File Transfer")
@@ -131,8 +177,41 @@ func downloadPDF(c *gin.Context) {
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
 	c.Header("Content-Type", "application/pdf")
 
-	// Serve the file
-	c.File(invoice.PdfPath)
+	// Serve the stored file the first time; later downloads of issued
+	// invoices, and downloads with a stamp override, are rendered afresh
+	// and stamped as copies.
+	if watermark == "" && (first || invoice.Status == "draft") {
+		c.File(invoice.PdfPath)
+		return
+	}
+	stored, err := os.ReadFile(invoice.PdfPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read PDF file"})
+		return
+	}
+	// Copies keep the format of the stored file
+	opts := pdf.Options{
+		FacturX:   bytes.Contains(stored, []byte(pdf.FacturXFileName)),
+		Watermark: watermark,
+		Copy:      true,
+	}
+	pdfBytes, err := pdf.RenderPDF(*invoice, opts)
+	if err != nil {
+		log.Printf("Error rendering invoice copy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate PDF", "details": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/pdf", pdfBytes)
+}
+
+// watermarkOverride validates a stamp override from a render request. It
+// writes the error response itself and returns false when it is invalid.
+func watermarkOverride(c *gin.Context, watermark string) (string, bool) {
+	if watermark != "" && !pdf.ValidWatermarkOverride(watermark) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid watermark, expected draft, paid, void, copy or none"})
+		return "", false
+	}
+	return watermark, true
 }
 
 // previewPDF serves the PDF for inline viewing in browser.
@@ -0,0 +1,387 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"invoice-generator-go/models"
+	"invoice-generator-go/payqr"
+	"invoice-generator-go/storage"
+	"invoice-generator-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxLogoSize caps the size of an uploaded company logo.
+const maxLogoSize = 2 << 20
+
+// logoExtensions lists the accepted logo image types.
+var logoExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+}
+
+var (
+	countryCodeRe = regexp.MustCompile(`^[A-Z]{2}$`)
+	bicRe         = regexp.MustCompile(`^[A-Z]{6}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+)
+
+// getProfile returns the authenticated user's default company profile.
+func getProfile(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	profile, err := storage.GetDefaultCompanyProfile(userUUID)
+	if err != nil {
+		log.Printf("Error fetching company profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve company profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// updateProfile replaces the details of the default company profile.
+func updateProfile(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	existing, err := storage.GetDefaultCompanyProfile(userUUID)
+	if err != nil {
+		log.Printf("Error fetching company profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve company profile"})
+		return
+	}
+	saveCompanyProfile(c, existing)
+}
+
+// uploadProfileLogo stores the logo of the default company profile.
+func uploadProfileLogo(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	profile, err := storage.GetDefaultCompanyProfile(userUUID)
+	if err != nil {
+		log.Printf("Error fetching company profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve company profile"})
+		return
+	}
+	saveCompanyLogo(c, profile)
+}
+
+// listProfiles returns all company profiles of the authenticated user.
+func listProfiles(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	// Make sure there is always a default profile to list.
+	if _, err := storage.GetDefaultCompanyProfile(userUUID); err != nil {
+		log.Printf("Error fetching company profile: %v", err)
+	}
+
+	profiles, err := storage.GetCompanyProfilesByUserID(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve company profiles", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profiles": profiles})
+}
+
+// createProfile adds another sender profile, e.g. for a second trading name.
+func createProfile(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var input models.CompanyProfile
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	input.UserID = userUUID
+	input.LogoKey = ""
+	if err := validateCompanyProfile(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profileID, err := storage.CreateCompanyProfile(&input)
+	if err != nil {
+		log.Printf("Error creating company profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create company profile"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Company profile created", "profile_id": profileID})
+}
+
+// getProfileByID returns one company profile.
+func getProfileByID(c *gin.Context) {
+	profile, ok := loadOwnedProfile(c, "view")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// updateProfileByID replaces the details of one company profile.
+func updateProfileByID(c *gin.Context) {
+	profile, ok := loadOwnedProfile(c, "update")
+	if !ok {
+		return
+	}
+	saveCompanyProfile(c, profile)
+}
+
+// deleteProfile deletes a company profile other than the default one.
+func deleteProfile(c *gin.Context) {
+	profile, ok := loadOwnedProfile(c, "delete")
+	if !ok {
+		return
+	}
+	if profile.IsDefault {
+		c.JSON(http.StatusConflict, gin.H{"error": "The default company profile cannot be deleted"})
+		return
+	}
+
+	if err := storage.DeleteCompanyProfile(profile.ID); err != nil {
+		log.Printf("Error deleting company profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete company profile"})
+		return
+	}
+	if profile.LogoKey != "" {
+		if err := storage.Blobs.Delete(profile.LogoKey); err != nil {
+			log.Printf("Error deleting company logo: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Company profile deleted successfully"})
+}
+
+// uploadProfileLogoByID stores the logo of one company profile.
+func uploadProfileLogoByID(c *gin.Context) {
+	profile, ok := loadOwnedProfile(c, "update")
+	if !ok {
+		return
+	}
+	saveCompanyLogo(c, profile)
+}
+
+// getProfileLogo serves the logo of a company profile.
+func getProfileLogo(c *gin.Context) {
+	profile, ok := loadOwnedProfile(c, "view")
+	if !ok {
+		return
+	}
+	if profile.LogoKey == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company profile has no logo"})
+		return
+	}
+
+	logo, err := storage.Blobs.Get(profile.LogoKey)
+	if err != nil {
+		log.Printf("Error reading company logo: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Logo not found"})
+		return
+	}
+	c.Data(http.StatusOK, http.DetectContentType(logo), logo)
+}
+
+// saveCompanyProfile binds the request body onto an existing profile and
+// stores it. The profile's identity, owner and logo cannot be changed this
+// way, and the default profile stays the default.
+func saveCompanyProfile(c *gin.Context, existing *models.CompanyProfile) {
+	var input models.CompanyProfile
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	input.ID = existing.ID
+	input.UserID = existing.UserID
+	input.LogoKey = existing.LogoKey
+	if existing.IsDefault {
+		input.IsDefault = true
+	}
+	if input.Name == "" {
+		input.Name = existing.Name
+	}
+	if err := validateCompanyProfile(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := storage.UpdateCompanyProfile(&input); err != nil {
+		log.Printf("Error updating company profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update company profile"})
+		return
+	}
+
+	updated, err := storage.GetCompanyProfileByID(input.ID)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Company profile updated"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// saveCompanyLogo stores the uploaded "logo" file in the blob store and
+// links it to the profile.
+func saveCompanyLogo(c *gin.Context, profile *models.CompanyProfile) {
+	file, err := c.FormFile("logo")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Logo file is required"})
+		return
+	}
+	if file.Size > maxLogoSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Logo is too large (max 2 MB)"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
+		return
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, maxLogoSize))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	ext, ok := logoExtensions[http.DetectContentType(data)]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Logo must be a PNG, JPEG or GIF image"})
+		return
+	}
+
+	key := fmt.Sprintf("logos/%s/%s%s", profile.UserID, profile.ID, ext)
+	if err := storage.Blobs.Put(key, data); err != nil {
+		log.Printf("Error storing company logo: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store logo"})
+		return
+	}
+
+	previous := profile.LogoKey
+	profile.LogoKey = key
+	if err := storage.UpdateCompanyProfile(profile); err != nil {
+		log.Printf("Error updating company profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update company profile"})
+		return
+	}
+	if previous != "" && previous != key {
+		if err := storage.Blobs.Delete(previous); err != nil {
+			log.Printf("Error deleting previous company logo: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logo uploaded"})
+}
+
+// validateCompanyProfile sanitises the profile in place and checks its
+// fields.
+func validateCompanyProfile(p *models.CompanyProfile) error {
+	p.Name = utils.SanitizeString(p.Name, 100)
+	if p.Name == "" {
+		p.Name = "Default"
+	}
+	p.CompanyName = utils.SanitizeString(p.CompanyName, 255)
+	if err := utils.ValidateRequiredString(p.CompanyName, "company name"); err != nil {
+		return err
+	}
+	p.AddressLine = utils.SanitizeString(p.AddressLine, 255)
+	p.PostalCode = utils.SanitizeString(p.PostalCode, 16)
+	p.City = utils.SanitizeString(p.City, 35)
+	p.Phone = utils.SanitizeString(p.Phone, 50)
+	p.Website = utils.SanitizeString(p.Website, 255)
+	p.TaxID = utils.SanitizeString(p.TaxID, 50)
+	p.BankName = utils.SanitizeString(p.BankName, 255)
+	p.LegalFooter = utils.SanitizeString(p.LegalFooter, 1000)
+
+	p.CountryCode = strings.ToUpper(strings.TrimSpace(p.CountryCode))
+	if p.CountryCode != "" && !countryCodeRe.MatchString(p.CountryCode) {
+		return fmt.Errorf("country code must be an ISO 3166-1 alpha-2 code")
+	}
+	if p.Email != "" {
+		if err := utils.ValidateEmail(p.Email); err != nil {
+			return err
+		}
+		p.Email = strings.ToLower(strings.TrimSpace(p.Email))
+	}
+	if p.IBAN != "" {
+		p.IBAN = payqr.NormalizeIBAN(p.IBAN)
+		if err := payqr.ValidateIBAN(p.IBAN); err != nil {
+			return err
+		}
+	}
+	if p.BIC != "" {
+		p.BIC = strings.ToUpper(strings.TrimSpace(p.BIC))
+		if !bicRe.MatchString(p.BIC) {
+			return fmt.Errorf("invalid BIC")
+		}
+	}
+	return nil
+}
+
+// loadOwnedProfile fetches the company profile named in the URL and
+// verifies that it belongs to the authenticated user. It writes the error
+// response itself and returns false on failure.
+func loadOwnedProfile(c *gin.Context, action string) (*models.CompanyProfile, bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	profileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company profile ID"})
+		return nil, false
+	}
+
+	profile, err := storage.GetCompanyProfileByID(profileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company profile not found"})
+		return nil, false
+	}
+
+	if profile.UserID != userUUID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to " + action + " this company profile"})
+		return nil, false
+	}
+
+	return profile, true
+}
+
+// currentUserID returns the authenticated user's ID. It writes the error
+// response itself and returns false on failure.
+func currentUserID(c *gin.Context) (uuid.UUID, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return uuid.Nil, false
+	}
+
+	userUUID, err := uuid.Parse(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return uuid.Nil, false
+	}
+	return userUUID, true
+}
@@ -79,12 +79,18 @@ func (rl *RateLimiter) isAllowed(ip string) bool {
 
 // RateLimitMiddleware creates a rate limiting middleware
 func RateLimitMiddleware(limit int, window time.Duration) gin.HandlerFunc {
+	return keyedRateLimitMiddleware(limit, window, func(c *gin.Context) string {
+		return c.ClientIP()
+	})
+}
+
+// keyedRateLimitMiddleware limits requests per key of a request rather than
+// per client IP.
+func keyedRateLimitMiddleware(limit int, window time.Duration, key func(*gin.Context) string) gin.HandlerFunc {
 	limiter := NewRateLimiter(limit, window)
 
 	return func(c *gin.Context) {
-		ip := c.ClientIP()
-
-		if !limiter.isAllowed(ip) {
+		if !limiter.isAllowed(key(c)) {
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
 				"error": "Rate limit exceeded. Please try again later.",
 			})
@@ -104,3 +110,11 @@ func StrictRateLimitMiddleware() gin.HandlerFunc {
 func GeneralRateLimitMiddleware() gin.HandlerFunc {
 	return RateLimitMiddleware(100, time.Minute) // 100 requests per minute
 }
+
+// PublicLinkRateLimitMiddleware for the unauthenticated share link routes,
+// per client IP and link token
+func PublicLinkRateLimitMiddleware() gin.HandlerFunc {
+	return keyedRateLimitMiddleware(20, time.Minute, func(c *gin.Context) string {
+		return c.ClientIP() + "|" + c.Param("token")
+	}) // 20 requests per minute
+}
@@ -11,6 +11,24 @@ func SetupRoutes(r *gin.Engine) {
 		api.POST("/register", StrictRateLimitMiddleware(), registerUser)
 		api.POST("/login", StrictRateLimitMiddleware(), loginUser)
 
+		// Share link routes for customers, who have no login. The links
+		// are handed out, so they live at /public rather than under /api
+		public := r.Group("/public")
+		public.Use(PublicLinkHeaders(), PublicLinkRateLimitMiddleware())
+		{
+			public.GET("/invoices/:token", getPublicInvoice)
+			public.POST("/invoices/:token/checkout", createPublicInvoiceCheckout)
+			public.GET("/customers/:token", getPublicCustomerAccount)
+			public.GET("/customers/:token/invoices/:id", getPublicCustomerInvoice)
+			public.POST("/customers/:token/invoices/:id/checkout", createPublicCustomerCheckout)
+			public.POST("/customers/:token/download", downloadPublicCustomerInvoices)
+			public.GET("/customers/:token/exports/:id", getPublicExportJob)
+			public.GET("/customers/:token/exports/:id/download", downloadPublicExport)
+		}
+
+		// Payment provider webhooks, authenticated by their signature
+		api.POST("/payments/webhook", paymentWebhook)
+
 		// Protected routes (require authentication)
 		protected := api.Group("/")
 		protected.Use(AuthMiddleware())
@@ -21,15 +39,133 @@ func SetupRoutes(r *gin.Engine) {
 			protected.GET("/invoices/:id", getInvoice)
 			protected.PUT("/invoices/:id", updateInvoice)
 			protected.DELETE("/invoices/:id", deleteInvoice)
+			protected.POST("/invoices/:id/payments", recordInvoicePayment)
+			protected.GET("/invoices/:id/payments", listInvoicePayments)
+			protected.POST("/invoices/:id/send", sendInvoice)
+			protected.GET("/invoices/:id/emails", listInvoiceEmails)
+			protected.GET("/invoices/:id/reminders", listInvoiceReminders)
+			protected.GET("/invoices/:id/late-fees", getInvoiceLateFees)
+			protected.POST("/invoices/:id/late-fees/invoice", createLateFeeInvoice)
+			protected.POST("/invoices/:id/share-links", createInvoiceShareLink)
+			protected.GET("/invoices/:id/share-links", listInvoiceShareLinks)
+
+			// Customer statement routes
+			protected.GET("/customers/:id/statement", getCustomerStatement)
+			protected.POST("/customers/:id/share-links", createCustomerShareLink)
+			protected.GET("/customers/:id/share-links", listCustomerShareLinks)
+
+			// Share link routes
+			protected.DELETE("/share-links/:id", revokeShareLink)
 
 			// PDF routes
 			protected.POST("/invoices/:id/generate-pdf", generatePDF)
 			protected.GET("/invoices/:id/download-pdf", downloadPDF)
 			protected.GET("/invoices/:id/preview-pdf", previewPDF)
 
+			// Bulk export routes
+			protected.POST("/invoices/export", exportInvoices)
+			protected.GET("/exports", listExportJobs)
+			protected.GET("/exports/:id", getExportJob)
+			protected.GET("/exports/:id/download", downloadExport)
+			protected.DELETE("/exports/:id", deleteExportJob)
+
+			// E-invoice export routes
+			protected.GET("/invoices/:id/export", exportEInvoice)
+			protected.GET("/invoices/:id/export/check", checkEInvoice)
+
+			// Bill (accounts payable) routes
+			protected.POST("/bills/import", importBill)
+			protected.GET("/bills", listBills)
+			protected.GET("/bills/:id", getBill)
+			protected.GET("/bills/:id/source", downloadBillSource)
+			protected.POST("/bills/:id/payments", recordBillPayment)
+			protected.POST("/bills/:id/void", voidBill)
+			protected.DELETE("/bills/:id", deleteBill)
+			protected.GET("/suppliers", listSuppliers)
+
+			// Company profile routes
+			protected.GET("/profile", getProfile)
+			protected.PUT("/profile", updateProfile)
+			protected.POST("/profile/logo", uploadProfileLogo)
+			protected.GET("/profiles", listProfiles)
+			protected.POST("/profiles", createProfile)
+			protected.GET("/profiles/:id", getProfileByID)
+			protected.PUT("/profiles/:id", updateProfileByID)
+			protected.DELETE("/profiles/:id", deleteProfile)
+			protected.POST("/profiles/:id/logo", uploadProfileLogoByID)
+			protected.GET("/profiles/:id/logo", getProfileLogo)
+
 			// Template routes
 			protected.POST("/templates", uploadTemplate)
 			protected.GET("/templates", listTemplates)
+			protected.POST("/templates/validate", validateTemplate)
+			protected.POST("/templates/preview", previewTemplateContent)
+			protected.GET("/templates/layout-schema", getLayoutSchema)
+			protected.GET("/templates/default", getDefaultTemplate)
+			protected.PUT("/templates/default", setDefaultTemplate)
+			protected.GET("/templates/customer-defaults", listCustomerTemplates)
+			protected.PUT("/templates/customer-defaults", setCustomerTemplate)
+			protected.DELETE("/templates/customer-defaults", deleteCustomerTemplate)
+			protected.GET("/templates/:id", getTemplate)
+			protected.PUT("/templates/:id", updateTemplate)
+			protected.DELETE("/templates/:id", deleteTemplate)
+			protected.POST("/templates/:id/clone", cloneTemplate)
+			protected.POST("/templates/:id/preview", previewTemplate)
+			protected.POST("/templates/:id/assets", uploadTemplateAsset)
+			protected.GET("/templates/:id/assets", listTemplateAssets)
+			protected.GET("/templates/:id/assets/:name", getTemplateAsset)
+			protected.DELETE("/templates/:id/assets/:name", deleteTemplateAsset)
+			protected.GET("/templates/:id/versions", listTemplateVersions)
+			protected.GET("/templates/:id/versions/:version", getTemplateVersion)
+			protected.POST("/templates/:id/versions/:version/restore", restoreTemplateVersion)
+
+			// Email template routes
+			protected.GET("/email-templates", listEmailTemplates)
+			protected.GET("/email-templates/:kind", getEmailTemplate)
+			protected.PUT("/email-templates/:kind", setEmailTemplate)
+			protected.DELETE("/email-templates/:kind", deleteEmailTemplate)
+
+			// Dunning routes
+			protected.GET("/dunning/policy", getDunningPolicy)
+			protected.PUT("/dunning/policy", setDunningPolicy)
+			protected.GET("/dunning/exclusions", listDunningExclusions)
+			protected.PUT("/dunning/exclusions", setDunningExclusion)
+			protected.DELETE("/dunning/exclusions", deleteDunningExclusion)
+
+			// Payment terms routes
+			protected.GET("/payment-terms", listPaymentTerms)
+			protected.POST("/payment-terms", createPaymentTerms)
+			protected.GET("/payment-terms/default", getDefaultPaymentTerms)
+			protected.PUT("/payment-terms/default", setDefaultPaymentTerms)
+			protected.GET("/payment-terms/customer-defaults", listCustomerPaymentTerms)
+			protected.PUT("/payment-terms/customer-defaults", setCustomerPaymentTerms)
+			protected.DELETE("/payment-terms/customer-defaults", deleteCustomerPaymentTerms)
+			protected.GET("/payment-terms/:id", getPaymentTerms)
+			protected.PUT("/payment-terms/:id", updatePaymentTerms)
+			protected.DELETE("/payment-terms/:id", deletePaymentTerms)
+
+			// Late fee routes
+			protected.GET("/late-fees/rule", getLateFeeRule)
+			protected.PUT("/late-fees/rule", setLateFeeRule)
+
+			// Webhook routes
+			protected.GET("/webhooks", listWebhooks)
+			protected.POST("/webhooks", createWebhook)
+			protected.GET("/webhooks/:id", getWebhook)
+			protected.PUT("/webhooks/:id", updateWebhook)
+			protected.DELETE("/webhooks/:id", deleteWebhook)
+			protected.GET("/webhooks/:id/deliveries", listWebhookDeliveries)
+			protected.GET("/webhooks/:id/deliveries/:delivery", getWebhookDelivery)
+			protected.POST("/webhooks/:id/deliveries/:delivery/redeliver", redeliverWebhook)
+
+			// Translation routes
+			protected.GET("/translations", listTranslationLocales)
+			protected.GET("/translations/:locale", getTranslations)
+			protected.PUT("/translations/:locale", setTranslations)
+			protected.DELETE("/translations/:locale", deleteTranslations)
+			protected.GET("/customer-languages", listCustomerLanguages)
+			protected.PUT("/customer-languages", setCustomerLanguage)
+			protected.DELETE("/customer-languages", deleteCustomerLanguage)
 		}
 	}
 }
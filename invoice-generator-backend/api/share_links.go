@@ -0,0 +1,508 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"invoice-generator-go/config"
+	"invoice-generator-go/export"
+	"invoice-generator-go/models"
+	"invoice-generator-go/share"
+	"invoice-generator-go/storage"
+	"invoice-generator-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// shareLinkRequest sets how long a new share link stays valid.
+type shareLinkRequest struct {
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+// createInvoiceShareLink creates a link that opens an issued invoice without
+// a login. The response carries the token and URL, which are not shown again.
+func createInvoiceShareLink(c *gin.Context) {
+	invoice, ok := loadOwnedInvoice(c, "share")
+	if !ok {
+		return
+	}
+	if !share.Visible(*invoice) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Draft invoices cannot be shared"})
+		return
+	}
+	expiresAt, ok := shareLinkExpiry(c)
+	if !ok {
+		return
+	}
+
+	link := models.ShareLink{UserID: invoice.UserID, InvoiceID: &invoice.ID, ExpiresAt: expiresAt}
+	token, ok := saveShareLink(c, &link)
+	if !ok {
+		return
+	}
+	link.URL = share.InvoiceURL(config.GetConfig().PublicURL, token)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Share link created", "share_link": link})
+}
+
+// listInvoiceShareLinks lists the share links of an invoice, without their
+// tokens.
+func listInvoiceShareLinks(c *gin.Context) {
+	invoice, ok := loadOwnedInvoice(c, "view share links of")
+	if !ok {
+		return
+	}
+
+	links, err := storage.GetInvoiceShareLinks(invoice.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve share links", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, links)
+}
+
+// createCustomerShareLink creates a link that lists all issued invoices of
+// the customer in the :id URL parameter, identified by email, and downloads
+// them.
+func createCustomerShareLink(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	customerEmail, ok := customerParam(c)
+	if !ok {
+		return
+	}
+	expiresAt, ok := shareLinkExpiry(c)
+	if !ok {
+		return
+	}
+
+	invoices, err := storage.FindInvoices(userUUID, storage.InvoiceFilter{CustomerEmail: customerEmail})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve invoices", "details": err.Error()})
+		return
+	}
+	if len(visibleInvoices(invoices)) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No issued invoices found for this customer"})
+		return
+	}
+
+	link := models.ShareLink{UserID: userUUID, CustomerEmail: customerEmail, ExpiresAt: expiresAt}
+	token, ok := saveShareLink(c, &link)
+	if !ok {
+		return
+	}
+	link.URL = share.CustomerURL(config.GetConfig().PublicURL, token)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Share link created", "share_link": link})
+}
+
+// listCustomerShareLinks lists the share links of the customer in the :id
+// URL parameter, without their tokens.
+func listCustomerShareLinks(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	customerEmail, ok := customerParam(c)
+	if !ok {
+		return
+	}
+
+	links, err := storage.GetCustomerShareLinks(userUUID, customerEmail)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve share links", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, links)
+}
+
+// revokeShareLink ends a share link before it expires.
+func revokeShareLink(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	linkID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid share link ID"})
+		return
+	}
+
+	link, err := storage.GetShareLinkByID(linkID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve share link", "details": err.Error()})
+		return
+	}
+	if link.UserID != userUUID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to revoke this share link"})
+		return
+	}
+
+	if err := storage.RevokeShareLink(link); err != nil {
+		log.Printf("Error revoking share link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke share link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share link revoked", "share_link": link})
+}
+
+// getPublicInvoice opens the invoice of an invoice share link: JSON, or its
+// PDF with ?format=pdf. Each view is counted on the invoice.
+func getPublicInvoice(c *gin.Context) {
+	link, token, ok := loadShareLink(c, false)
+	if !ok {
+		return
+	}
+
+	invoice, err := storage.GetInvoiceByID(*link.InvoiceID)
+	if err != nil || !share.Visible(*invoice) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return
+	}
+
+	respondPublicInvoice(c, invoice, share.InvoiceURL(config.GetConfig().PublicURL, token))
+}
+
+// getPublicCustomerAccount lists the issued invoices of a customer share
+// link's customer, newest first.
+func getPublicCustomerAccount(c *gin.Context) {
+	link, token, ok := loadShareLink(c, true)
+	if !ok {
+		return
+	}
+	invoices, ok := publicCustomerInvoices(c, link)
+	if !ok {
+		return
+	}
+
+	baseURL := share.CustomerURL(config.GetConfig().PublicURL, token)
+	account := models.PublicCustomerAccount{
+		CustomerEmail: link.CustomerEmail,
+		Invoices:      []models.PublicInvoice{},
+		DownloadURL:   baseURL + "/download",
+		ExpiresAt:     link.ExpiresAt,
+	}
+	for _, invoice := range invoices {
+		if account.CustomerName == "" {
+			account.CustomerName = invoice.CustomerName
+		}
+		account.Invoices = append(account.Invoices, publicInvoice(invoice, nil, nil, baseURL+"/invoices/"+invoice.ID.String()))
+	}
+	company, err := storage.GetDefaultCompanyProfile(link.UserID)
+	if err != nil {
+		log.Printf("Error retrieving company profile for share link: %v", err)
+		// Continue anyway, the seller is optional
+	}
+	account.Seller = share.Seller(company)
+
+	c.JSON(http.StatusOK, account)
+}
+
+// getPublicCustomerInvoice opens one of the invoices of a customer share
+// link's customer: JSON, or its PDF with ?format=pdf.
+func getPublicCustomerInvoice(c *gin.Context) {
+	link, token, ok := loadShareLink(c, true)
+	if !ok {
+		return
+	}
+	invoice, ok := loadPublicCustomerInvoice(c, link)
+	if !ok {
+		return
+	}
+
+	respondPublicInvoice(c, invoice, share.CustomerURL(config.GetConfig().PublicURL, token)+"/invoices/"+invoice.ID.String())
+}
+
+// downloadPublicCustomerInvoices starts exporting the PDFs of a customer
+// share link's issued invoices as a ZIP with a manifest. The export runs as
+// a background job, answered with 202 and the job to poll; while one is in
+// progress, starting another returns it instead.
+func downloadPublicCustomerInvoices(c *gin.Context) {
+	link, token, ok := loadShareLink(c, true)
+	if !ok {
+		return
+	}
+	jobsURL := share.CustomerURL(config.GetConfig().PublicURL, token) + "/exports/"
+
+	job, err := storage.GetActiveShareLinkExportJob(link.ID)
+	if err == nil {
+		c.Header("Location", jobsURL+job.ID.String())
+		c.JSON(http.StatusAccepted, gin.H{"message": "Download in progress", "job": job})
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error retrieving export job for share link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start download"})
+		return
+	}
+
+	invoices, ok := publicCustomerInvoices(c, link)
+	if !ok {
+		return
+	}
+	if len(invoices) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No invoices to download"})
+		return
+	}
+	if len(invoices) > export.MaxInvoices {
+		invoices = invoices[:export.MaxInvoices]
+	}
+
+	job = &models.ExportJob{UserID: link.UserID, ShareLinkID: &link.ID, Format: export.FormatZIP, Total: len(invoices)}
+	if err := storage.CreateExportJob(job); err != nil {
+		log.Printf("Error creating export job for share link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start download"})
+		return
+	}
+	export.Start(*job, invoices)
+	for _, invoice := range invoices {
+		recordInvoiceView(invoice.ID)
+	}
+
+	c.Header("Location", jobsURL+job.ID.String())
+	c.JSON(http.StatusAccepted, gin.H{"message": "Download started", "job": job})
+}
+
+// getPublicExportJob reports the status and progress of a download started
+// through a customer share link.
+func getPublicExportJob(c *gin.Context) {
+	job, ok := loadPublicExportJob(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// downloadPublicExport downloads the ZIP of a finished download started
+// through a customer share link.
+func downloadPublicExport(c *gin.Context) {
+	job, ok := loadPublicExportJob(c)
+	if !ok {
+		return
+	}
+	serveExportFile(c, job)
+}
+
+// loadPublicExportJob loads the export job in the :id URL parameter and
+// checks that it was started through the customer share link. It writes the
+// error response itself and returns false when it wasn't.
+func loadPublicExportJob(c *gin.Context) (*models.ExportJob, bool) {
+	link, _, ok := loadShareLink(c, true)
+	if !ok {
+		return nil, false
+	}
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID"})
+		return nil, false
+	}
+
+	job, err := storage.GetExportJob(jobID)
+	if err != nil || job.ShareLinkID == nil || *job.ShareLinkID != link.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return nil, false
+	}
+	return job, true
+}
+
+// PublicLinkHeaders keeps responses to share links out of caches and search
+// engines.
+func PublicLinkHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+		c.Header("X-Robots-Tag", "noindex, nofollow")
+		c.Next()
+	}
+}
+
+// respondPublicInvoice writes the customer-facing view of invoice, or its
+// PDF with ?format=pdf, and counts the view. invoiceURL is the address it
+// was opened at.
+func respondPublicInvoice(c *gin.Context, invoice *models.Invoice, invoiceURL string) {
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		items, err := storage.GetInvoiceItemsByInvoiceID(invoice.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve invoice items"})
+			return
+		}
+		company, err := storage.GetCompanyProfileForInvoice(invoice)
+		if err != nil {
+			log.Printf("Error retrieving company profile for share link: %v", err)
+			// Continue anyway, the seller is optional
+		}
+		recordInvoiceView(invoice.ID)
+		c.JSON(http.StatusOK, publicInvoice(*invoice, items, company, invoiceURL))
+	case "pdf":
+		// The stored PDF is served as it is; only one that is missing, or
+		// older than the invoice's status, is rendered and stored again.
+		if path, ok := export.StoredPDF(*invoice); ok {
+			recordInvoiceView(invoice.ID)
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=invoice_%s.pdf", invoice.InvoiceNumber))
+			c.File(path)
+			return
+		}
+		data, err := export.InvoicePDF(invoice)
+		if err != nil {
+			log.Printf("Error rendering invoice for share link: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate PDF"})
+			return
+		}
+		recordInvoiceView(invoice.ID)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=invoice_%s.pdf", invoice.InvoiceNumber))
+		c.Data(http.StatusOK, "application/pdf", data)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported format, expected json or pdf"})
+	}
+}
+
+// publicInvoice is the customer-facing view of invoice opened at
+// invoiceURL, with the addresses of its PDF and, when it can be paid
+// online, of its checkout.
+func publicInvoice(invoice models.Invoice, items []models.InvoiceItem, company *models.CompanyProfile, invoiceURL string) models.PublicInvoice {
+	view := share.PublicInvoice(invoice, items, company, invoiceURL+"?format=pdf")
+	if payableOnline(invoice) {
+		view.CheckoutURL = invoiceURL + "/checkout"
+	}
+	return view
+}
+
+// loadPublicCustomerInvoice loads the invoice in the :id URL parameter and
+// checks that it is an issued invoice of the customer share link's
+// customer. It writes the error response itself and returns false when it
+// isn't.
+func loadPublicCustomerInvoice(c *gin.Context, link *models.ShareLink) (*models.Invoice, bool) {
+	invoiceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return nil, false
+	}
+
+	invoice, err := storage.GetInvoiceByID(invoiceID)
+	if err != nil || invoice.UserID != link.UserID || !strings.EqualFold(invoice.CustomerEmail, link.CustomerEmail) || !share.Visible(*invoice) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return nil, false
+	}
+	return invoice, true
+}
+
+// loadShareLink resolves the :token URL parameter to a valid link for an
+// invoice or, with customer, for a customer. It writes the error response
+// itself and returns false when the link is unknown, of the other kind,
+// revoked or expired.
+func loadShareLink(c *gin.Context, customer bool) (*models.ShareLink, string, bool) {
+	token := c.Param("token")
+	link, err := storage.GetShareLinkByTokenHash(share.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (link.CustomerEmail != "") != customer) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		return nil, "", false
+	}
+	if err != nil {
+		log.Printf("Error retrieving share link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve link"})
+		return nil, "", false
+	}
+	if !share.Usable(*link, time.Now()) {
+		c.JSON(http.StatusGone, gin.H{"error": "This link has expired"})
+		return nil, "", false
+	}
+
+	if err := storage.TouchShareLink(link.ID); err != nil {
+		log.Printf("Error recording share link use: %v", err)
+	}
+	return link, token, true
+}
+
+// publicCustomerInvoices retrieves the issued invoices of a customer share
+// link's customer, newest first. It writes the error response itself and
+// returns false on failure.
+func publicCustomerInvoices(c *gin.Context, link *models.ShareLink) ([]models.Invoice, bool) {
+	invoices, err := storage.FindInvoices(link.UserID, storage.InvoiceFilter{CustomerEmail: link.CustomerEmail})
+	if err != nil {
+		log.Printf("Error retrieving invoices for share link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve invoices"})
+		return nil, false
+	}
+	invoices = visibleInvoices(invoices)
+	for i, j := 0, len(invoices)-1; i < j; i, j = i+1, j-1 {
+		invoices[i], invoices[j] = invoices[j], invoices[i]
+	}
+	return invoices, true
+}
+
+// visibleInvoices keeps the invoices a customer may see through a link.
+func visibleInvoices(invoices []models.Invoice) []models.Invoice {
+	var visible []models.Invoice
+	for _, invoice := range invoices {
+		if share.Visible(invoice) {
+			visible = append(visible, invoice)
+		}
+	}
+	return visible
+}
+
+func recordInvoiceView(invoiceID uuid.UUID) {
+	if err := storage.RecordInvoiceView(invoiceID); err != nil {
+		log.Printf("Error recording invoice view: %v", err)
+	}
+}
+
+// shareLinkExpiry reads the expiry of a new share link from the optional
+// request body. It writes the error response itself and returns false when
+// the request is invalid.
+func shareLinkExpiry(c *gin.Context) (time.Time, bool) {
+	var input shareLinkRequest
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return time.Time{}, false
+	}
+	expiresAt, err := share.ExpiresAt(time.Now(), input.ExpiresInDays)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return time.Time{}, false
+	}
+	return expiresAt, true
+}
+
+// saveShareLink issues a token for link and stores it. It writes the error
+// response itself and returns false on failure.
+func saveShareLink(c *gin.Context, link *models.ShareLink) (string, bool) {
+	token, hash, err := share.NewToken()
+	if err == nil {
+		err = storage.CreateShareLink(link, hash)
+	}
+	if err != nil {
+		log.Printf("Error creating share link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+		return "", false
+	}
+	link.Token = token
+	return token, true
+}
+
+// customerParam reads the customer's email from the :id URL parameter. It
+// writes the error response itself and returns false when it is invalid.
+func customerParam(c *gin.Context) (string, bool) {
+	customerEmail := strings.TrimSpace(c.Param("id"))
+	if err := utils.ValidateEmail(customerEmail); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer, expected the customer's email address"})
+		return "", false
+	}
+	return customerEmail, true
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"invoice-generator-go/i18n"
+	"invoice-generator-go/pdf"
+	"invoice-generator-go/statement"
+	"invoice-generator-go/storage"
+	"invoice-generator-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getCustomerStatement returns the account statement of the customer in the
+// :id URL parameter, identified by email, for ?from= to ?to= (YYYY-MM-DD,
+// inclusive; the year up to today by default). Customers billed in several
+// currencies need ?currency=. The statement is JSON, or a PDF with
+// ?format=pdf in the customer's language or ?lang=.
+func getCustomerStatement(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	customerEmail := strings.TrimSpace(c.Param("id"))
+	if err := utils.ValidateEmail(customerEmail); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer, expected the customer's email address"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "pdf" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported format, expected json or pdf"})
+		return
+	}
+	lang := c.Query("lang")
+	if lang != "" && !i18n.ValidLocale(lang) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid language, expected a code such as en or de-CH"})
+		return
+	}
+
+	to, err := optionalDate(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, expected YYYY-MM-DD"})
+		return
+	}
+	if to == nil {
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		to = &today
+	}
+	from, err := optionalDate(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, expected YYYY-MM-DD"})
+		return
+	}
+	if from == nil {
+		yearAgo := to.AddDate(-1, 0, 1)
+		from = &yearAgo
+	}
+	if from.After(*to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return
+	}
+
+	invoices, err := storage.FindInvoices(userUUID, storage.InvoiceFilter{CustomerEmail: customerEmail})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve invoices", "details": err.Error()})
+		return
+	}
+	currencies := statement.Currencies(invoices)
+	if len(currencies) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No issued invoices found for this customer"})
+		return
+	}
+
+	currency := strings.ToUpper(c.Query("currency"))
+	switch {
+	case currency == "" && len(currencies) > 1:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The customer is billed in several currencies, choose one with ?currency=", "currencies": currencies})
+		return
+	case currency == "":
+		currency = currencies[0]
+	case !containsString(currencies, currency):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No issued invoices in " + currency + " found for this customer", "currencies": currencies})
+		return
+	}
+
+	payments, err := storage.GetCustomerPayments(userUUID, customerEmail)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve payments", "details": err.Error()})
+		return
+	}
+	st := statement.Build(invoices, payments, currency, *from, *to)
+
+	if format == "json" {
+		c.JSON(http.StatusOK, st)
+		return
+	}
+
+	company, err := storage.GetDefaultCompanyProfile(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve company profile", "details": err.Error()})
+		return
+	}
+	data, err := pdf.RenderStatement(c.Request.Context(), st, company, pdf.StatementOptions{UserID: userUUID, Language: lang})
+	if err != nil {
+		var sandboxErr *pdf.SandboxError
+		if errors.As(err, &sandboxErr) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Statement exceeded a rendering limit", "rule": sandboxErr.Rule, "details": sandboxErr.Message})
+			return
+		}
+		log.Printf("Error rendering statement: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render statement", "details": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=statement_"+st.To.Format("2006-01-02")+".pdf")
+	c.Data(http.StatusOK, "application/pdf", data)
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"invoice-generator-go/models"
+	"invoice-generator-go/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxTemplateAssetSize caps the size of an uploaded template asset.
+const maxTemplateAssetSize = 5 << 20
+
+// templateAssetTypes lists the accepted asset types by sniffed content type.
+var templateAssetTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"font/ttf":   true,
+	"font/otf":   true,
+}
+
+// assetNameRe restricts asset names to plain file names, as used in
+// {{asset "logo.png"}}.
+var assetNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,99}$`)
+
+// uploadTemplateAsset stores the multipart "file" as an asset of the
+// template. The asset is named after the optional "name" form field or the
+// uploaded file name; uploading under an existing name replaces that asset.
+func uploadTemplateAsset(c *gin.Context) {
+	template, ok := loadOwnedTemplate(c, "update")
+	if !ok {
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Asset file is required"})
+		return
+	}
+	if file.Size > maxTemplateAssetSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Asset is too large (max 5 MB)"})
+		return
+	}
+
+	name := c.PostForm("name")
+	if name == "" {
+		name = path.Base(strings.ReplaceAll(file.Filename, "\\", "/"))
+	}
+	if !assetNameRe.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Asset name may only contain letters, digits, '.', '_' and '-'"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
+		return
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, maxTemplateAssetSize))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	contentType := http.DetectContentType(data)
+	if !templateAssetTypes[contentType] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Asset must be a PNG, JPEG or GIF image or a TTF or OTF font"})
+		return
+	}
+
+	asset := models.TemplateAsset{
+		TemplateID:  template.ID,
+		Name:        name,
+		ContentType: contentType,
+		Size:        len(data),
+		BlobKey:     fmt.Sprintf("template-assets/%s/%s", template.ID, uuid.New()),
+	}
+	if err := storage.Blobs.Put(asset.BlobKey, data); err != nil {
+		log.Printf("Error storing template asset: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store asset"})
+		return
+	}
+
+	previous, err := storage.SaveTemplateAsset(&asset)
+	if err != nil {
+		log.Printf("Error saving template asset: %v", err)
+		if err := storage.Blobs.Delete(asset.BlobKey); err != nil {
+			log.Printf("Error deleting template asset blob: %v", err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save asset"})
+		return
+	}
+	if previous != "" {
+		if err := storage.Blobs.Delete(previous); err != nil {
+			log.Printf("Error deleting replaced template asset: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Asset uploaded", "asset": asset})
+}
+
+// listTemplateAssets lists the assets uploaded for a template.
+func listTemplateAssets(c *gin.Context) {
+	template, ok := loadTemplateForUser(c, "view")
+	if !ok {
+		return
+	}
+
+	assets, err := storage.GetTemplateAssets(template.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve template assets", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"assets": assets})
+}
+
+// getTemplateAsset serves the contents of a template asset.
+func getTemplateAsset(c *gin.Context) {
+	template, ok := loadTemplateForUser(c, "view")
+	if !ok {
+		return
+	}
+
+	asset, err := storage.GetTemplateAsset(template.ID, c.Param("name"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve asset", "details": err.Error()})
+		return
+	}
+
+	data, err := storage.Blobs.Get(asset.BlobKey)
+	if err != nil {
+		log.Printf("Error loading template asset: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load asset"})
+		return
+	}
+
+	c.Header("Content-Disposition", "inline")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, asset.ContentType, data)
+}
+
+// deleteTemplateAsset removes a template asset. Templates still referring to
+// it fail to render until it is uploaded again.
+func deleteTemplateAsset(c *gin.Context) {
+	template, ok := loadOwnedTemplate(c, "update")
+	if !ok {
+		return
+	}
+
+	asset, err := storage.DeleteTemplateAsset(template.ID, c.Param("name"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting template asset: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete asset"})
+		return
+	}
+	if err := storage.Blobs.Delete(asset.BlobKey); err != nil {
+		log.Printf("Error deleting template asset blob: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Asset deleted successfully"})
+}
+
+// copyTemplateAssets copies every asset of one template to another, giving
+// the copies their own blobs.
+func copyTemplateAssets(from, to uuid.UUID) error {
+	assets, err := storage.GetTemplateAssets(from)
+	if err != nil {
+		return err
+	}
+	for _, asset := range assets {
+		data, err := storage.Blobs.Get(asset.BlobKey)
+		if err != nil {
+			return fmt.Errorf("failed to load template asset %q: %v", asset.Name, err)
+		}
+		asset.TemplateID = to
+		asset.BlobKey = fmt.Sprintf("template-assets/%s/%s", to, uuid.New())
+		if err := storage.Blobs.Put(asset.BlobKey, data); err != nil {
+			return fmt.Errorf("failed to store template asset %q: %v", asset.Name, err)
+		}
+		if _, err := storage.SaveTemplateAsset(&asset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteTemplateAssetBlobs removes the blobs of assets whose rows are gone.
+func deleteTemplateAssetBlobs(assets []models.TemplateAsset) {
+	for _, asset := range assets {
+		if err := storage.Blobs.Delete(asset.BlobKey); err != nil {
+			log.Printf("Error deleting template asset blob: %v", err)
+		}
+	}
+}
+
+// validTemplateImage reports whether a template's logo_url or background_url
+// is empty, the name of an asset, or an http(s) URL.
+func validTemplateImage(value *string) bool {
+	if value == nil || *value == "" {
+		return true
+	}
+	return assetNameRe.MatchString(*value) || strings.HasPrefix(*value, "https://") || strings.HasPrefix(*value, "http://")
+}
+
+// optionalFormValue returns the form field, or nil when it is absent or empty.
+func optionalFormValue(c *gin.Context, key string) *string {
+	value := strings.TrimSpace(c.PostForm(key))
+	if value == "" {
+		return nil
+	}
+	return &value
+}
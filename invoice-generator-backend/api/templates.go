@@ -1,13 +1,22 @@
 package api
 
 import (
+	"errors"
 	_ "fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"invoice-generator-go/i18n"
+	"invoice-generator-go/layout"
 	"invoice-generator-go/models"
+	"invoice-generator-go/pdf"
 	"invoice-generator-go/storage"
+	"invoice-generator-go/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -35,6 +44,11 @@ func uploadTemplate(c *gin.Context) {
 		return
 	}
 
+	if file.Size > pdf.MaxTemplateSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Template file is too large"})
+		return
+	}
+
 	// Read file content
 	src, err := file.Open()
 	if err != nil {
@@ -43,21 +57,53 @@ func uploadTemplate(c *gin.Context) {
 	}
 	defer src.Close()
 
-	fileBytes, err := ioutil.ReadAll(src)
+	fileBytes, err := ioutil.ReadAll(io.LimitReader(src, pdf.MaxTemplateSize+1))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
 		return
 	}
 
+	// Reject templates that would fail at PDF generation time
+	diagnostics := pdf.ValidateTemplate(string(fileBytes), c.PostForm("language"))
+	if pdf.HasErrors(diagnostics) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Template is invalid", "diagnostics": diagnostics})
+		return
+	}
+
+	// Logo and background name template assets (uploaded afterwards) or URLs
+	backgroundURL := optionalFormValue(c, "background_url")
+	logoURL := optionalFormValue(c, "logo_url")
+	if !validTemplateImage(backgroundURL) || !validTemplateImage(logoURL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "background_url and logo_url must be asset names or http(s) URLs"})
+		return
+	}
+
+	// Optional comma-separated list of the status stamps to show
+	var watermarks []string
+	if value, ok := c.GetPostForm("watermarks"); ok {
+		watermarks = []string{}
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				watermarks = append(watermarks, name)
+			}
+		}
+	}
+	if !validTemplateWatermarks(c, watermarks) {
+		return
+	}
+
 	// Create a new template
 	template := models.Template{
-		ID:        uuid.New(),
-		UserID:    userUUID,
-		Name:      c.PostForm("name"), // Get the template name from the form data
-		Language:  c.PostForm("language"),
-		Content:   string(fileBytes),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:            uuid.New(),
+		UserID:        userUUID,
+		Name:          c.PostForm("name"), // Get the template name from the form data
+		Language:      c.PostForm("language"),
+		BackgroundURL: backgroundURL,
+		LogoURL:       logoURL,
+		Content:       string(fileBytes),
+		Watermarks:    watermarks,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
 	}
 
 	// Save template to the database
@@ -67,7 +113,7 @@ func uploadTemplate(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Template uploaded", "template_id": templateID})
+	c.JSON(http.StatusCreated, gin.H{"message": "Template uploaded", "template_id": templateID, "diagnostics": nonNilDiagnostics(diagnostics)})
 }
 
 func listTemplates(c *gin.Context) {
@@ -94,3 +140,610 @@ func listTemplates(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"templates": templates})
 }
+
+// validateTemplate dry-runs template validation without saving anything. It
+// accepts the template either as a multipart "template" file, like
+// uploadTemplate, or as JSON {"content": ..., "language": ...}.
+func validateTemplate(c *gin.Context) {
+	var content, language string
+	if file, err := c.FormFile("template"); err == nil {
+		if file.Size > pdf.MaxTemplateSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Template file is too large"})
+			return
+		}
+		src, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
+			return
+		}
+		defer src.Close()
+
+		fileBytes, err := ioutil.ReadAll(io.LimitReader(src, pdf.MaxTemplateSize+1))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+			return
+		}
+		content = string(fileBytes)
+		language = c.PostForm("language")
+	} else {
+		var input struct {
+			Content  string `json:"content" binding:"required"`
+			Language string `json:"language"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Template file or content is required"})
+			return
+		}
+		content = input.Content
+		language = input.Language
+	}
+
+	diagnostics := pdf.ValidateTemplate(content, language)
+	c.JSON(http.StatusOK, gin.H{"valid": !pdf.HasErrors(diagnostics), "diagnostics": nonNilDiagnostics(diagnostics)})
+}
+
+// getLayoutSchema returns the JSON Schema of layout templates (language
+// "layout") for the template designer.
+func getLayoutSchema(c *gin.Context) {
+	c.Data(http.StatusOK, "application/schema+json", layout.Schema())
+}
+
+// nonNilDiagnostics makes an empty diagnostics list render as [] in JSON.
+func nonNilDiagnostics(diagnostics []pdf.Diagnostic) []pdf.Diagnostic {
+	if diagnostics == nil {
+		return []pdf.Diagnostic{}
+	}
+	return diagnostics
+}
+
+// previewRequest is the request body for template previews. Content and
+// Language are only used when previewing unsaved content; Lang overrides the
+// document language like ?lang= does.
+type previewRequest struct {
+	Content   string     `json:"content"`
+	Language  string     `json:"language"`
+	InvoiceID *uuid.UUID `json:"invoice_id"`
+	Format    string     `json:"format"`
+	Lang      string     `json:"lang"`
+	Watermark string     `json:"watermark"`
+}
+
+// previewTemplate renders a stored template against one of the user's
+// invoices, or sample data when no invoice_id is given, and returns the HTML
+// or PDF directly.
+func previewTemplate(c *gin.Context) {
+	template, ok := loadTemplateForUser(c, "preview")
+	if !ok {
+		return
+	}
+
+	var input previewRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+	}
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	renderPreview(c, userUUID, template, input)
+}
+
+// previewTemplateContent renders unsaved template content, so a template can
+// be designed without uploading it first.
+func previewTemplateContent(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var input previewRequest
+	if err := c.ShouldBindJSON(&input); err != nil || input.Content == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template content is required"})
+		return
+	}
+
+	diagnostics := pdf.ValidateTemplate(input.Content, input.Language)
+	if pdf.HasErrors(diagnostics) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Template is invalid", "diagnostics": diagnostics})
+		return
+	}
+	// Unsaved content has no assets yet; {{asset}} renders placeholders
+	renderPreview(c, userUUID, &models.Template{Language: input.Language, Content: input.Content}, input)
+}
+
+// renderPreview renders a template for a preview request and writes the
+// result.
+func renderPreview(c *gin.Context, userID uuid.UUID, template *models.Template, input previewRequest) {
+	format := input.Format
+	if format == "" {
+		format = c.DefaultQuery("format", pdf.PreviewHTML)
+	}
+	if format != pdf.PreviewHTML && format != pdf.PreviewPDF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported format, use html or pdf"})
+		return
+	}
+	lang := input.Lang
+	if lang == "" {
+		lang = c.Query("lang")
+	}
+	if lang != "" && !i18n.ValidLocale(lang) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid language, expected a code such as en or de-CH"})
+		return
+	}
+
+	watermark := input.Watermark
+	if watermark == "" {
+		watermark = c.Query("watermark")
+	}
+	watermark, ok := watermarkOverride(c, watermark)
+	if !ok {
+		return
+	}
+
+	var invoice *models.Invoice
+	if input.InvoiceID != nil {
+		var err error
+		invoice, err = storage.GetInvoiceByID(*input.InvoiceID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+			return
+		}
+		if invoice.UserID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to preview this invoice"})
+			return
+		}
+	}
+
+	output, err := pdf.Preview(c.Request.Context(), template, invoice, pdf.PreviewOptions{Format: format, Language: lang, UserID: userID, Watermark: watermark})
+	if err != nil {
+		var sandboxErr *pdf.SandboxError
+		if errors.As(err, &sandboxErr) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Template exceeded a rendering limit", "rule": sandboxErr.Rule, "details": sandboxErr.Message})
+			return
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Failed to render preview", "details": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", "inline")
+	if format == pdf.PreviewPDF {
+		c.Data(http.StatusOK, "application/pdf", output)
+		return
+	}
+	// The HTML is user-authored; keep it from running scripts on our origin.
+	c.Header("Content-Security-Policy", "sandbox")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", output)
+}
+
+// templateInput is the request body for updating a template.
+type templateInput struct {
+	Name          string   `json:"name" binding:"required"`
+	Language      string   `json:"language"`
+	Content       string   `json:"content" binding:"required"`
+	BackgroundURL *string  `json:"background_url"`
+	LogoURL       *string  `json:"logo_url"`
+	Watermarks    []string `json:"watermarks"`
+}
+
+// getTemplate returns a single template including its content.
+func getTemplate(c *gin.Context) {
+	template, ok := loadTemplateForUser(c, "view")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, template)
+}
+
+// updateTemplate replaces a template's details. Changed content is recorded
+// as a new version; invoices already issued keep rendering with the version
+// they were pinned to.
+func updateTemplate(c *gin.Context) {
+	template, ok := loadOwnedTemplate(c, "update")
+	if !ok {
+		return
+	}
+
+	var input templateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+	input.Name = utils.SanitizeString(input.Name, 255)
+	if err := utils.ValidateRequiredString(input.Name, "name"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validTemplateImage(input.BackgroundURL) || !validTemplateImage(input.LogoURL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "background_url and logo_url must be asset names or http(s) URLs"})
+		return
+	}
+	if !validTemplateWatermarks(c, input.Watermarks) {
+		return
+	}
+
+	diagnostics := pdf.ValidateTemplate(input.Content, input.Language)
+	if pdf.HasErrors(diagnostics) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Template is invalid", "diagnostics": diagnostics})
+		return
+	}
+
+	template.Name = input.Name
+	template.Language = utils.SanitizeString(input.Language, 50)
+	template.Content = input.Content
+	template.BackgroundURL = input.BackgroundURL
+	template.LogoURL = input.LogoURL
+	template.Watermarks = input.Watermarks
+
+	if err := storage.UpdateTemplate(template); err != nil {
+		log.Printf("Error updating template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template updated", "template": template, "diagnostics": nonNilDiagnostics(diagnostics)})
+}
+
+// deleteTemplate deletes a template and its assets unless issued invoices
+// still use it.
+func deleteTemplate(c *gin.Context) {
+	template, ok := loadOwnedTemplate(c, "delete")
+	if !ok {
+		return
+	}
+
+	assets, err := storage.GetTemplateAssets(template.ID)
+	if err != nil {
+		log.Printf("Error listing template assets: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete template"})
+		return
+	}
+
+	err = storage.DeleteTemplate(template.ID)
+	if errors.Is(err, storage.ErrTemplateInUse) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Template is used by issued invoices and cannot be deleted"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete template"})
+		return
+	}
+	// The asset rows went with the template; remove their blobs too
+	deleteTemplateAssetBlobs(assets)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted successfully"})
+}
+
+// cloneTemplate copies the current version of a template and its assets,
+// including a shared system template, into a new template owned by the user
+// with a fresh version history. The optional JSON body {"name": ...} names
+// the copy.
+func cloneTemplate(c *gin.Context) {
+	source, ok := loadTemplateForUser(c, "clone")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name string `json:"name"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+	}
+	name := utils.SanitizeString(input.Name, 255)
+	if name == "" {
+		name = utils.SanitizeString("Copy of "+source.Name, 255)
+	}
+
+	// Cloning a system template forks it into the user's own editable copy
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	clone := models.Template{
+		UserID:        userUUID,
+		Name:          name,
+		Language:      source.Language,
+		BackgroundURL: source.BackgroundURL,
+		LogoURL:       source.LogoURL,
+		Content:       source.Content,
+		Watermarks:    source.Watermarks,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	templateID, err := storage.CreateTemplate(&clone)
+	if err != nil {
+		log.Printf("Error cloning template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clone template"})
+		return
+	}
+	if err := copyTemplateAssets(source.ID, clone.ID); err != nil {
+		log.Printf("Error copying template assets: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Template cloned but its assets could not be copied", "template_id": templateID})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Template cloned", "template_id": templateID})
+}
+
+// listTemplateVersions lists the version history of a template.
+func listTemplateVersions(c *gin.Context) {
+	template, ok := loadTemplateForUser(c, "view")
+	if !ok {
+		return
+	}
+
+	versions, err := storage.GetTemplateVersions(template.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve template versions", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"current_version": template.CurrentVersion, "versions": versions})
+}
+
+// getTemplateVersion returns one version of a template with its content.
+func getTemplateVersion(c *gin.Context) {
+	template, ok := loadTemplateForUser(c, "view")
+	if !ok {
+		return
+	}
+	version, ok := loadTemplateVersion(c, template)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, version)
+}
+
+// restoreTemplateVersion makes an old version current again by recording its
+// content as a new version.
+func restoreTemplateVersion(c *gin.Context) {
+	template, ok := loadOwnedTemplate(c, "update")
+	if !ok {
+		return
+	}
+	version, ok := loadTemplateVersion(c, template)
+	if !ok {
+		return
+	}
+
+	template.Content = version.Content
+	template.Language = version.Language
+	if err := storage.UpdateTemplate(template); err != nil {
+		log.Printf("Error restoring template version: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore template version"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template version restored", "template": template})
+}
+
+// loadTemplateVersion fetches the version named in the URL. It writes the
+// error response itself and returns false on failure.
+func loadTemplateVersion(c *gin.Context, template *models.Template) (*models.TemplateVersion, bool) {
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil || number < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template version"})
+		return nil, false
+	}
+
+	version, err := storage.GetTemplateVersion(template.ID, number)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template version not found"})
+		return nil, false
+	}
+	return version, true
+}
+
+// loadOwnedTemplate fetches the template named in the URL and verifies that
+// it belongs to the authenticated user, for actions that modify it. action
+// completes the 403 message. It writes the error response itself and returns
+// false on failure.
+func loadOwnedTemplate(c *gin.Context, action string) (*models.Template, bool) {
+	template, ok := loadTemplateForUser(c, action)
+	if !ok {
+		return nil, false
+	}
+	if template.IsSystem {
+		c.JSON(http.StatusForbidden, gin.H{"error": "System templates are read-only; clone the template to edit your own copy"})
+		return nil, false
+	}
+	return template, true
+}
+
+// loadTemplateForUser fetches the template named in the URL if the
+// authenticated user may use it: their own templates and the shared system
+// templates. It writes the error response itself and returns false on
+// failure.
+func loadTemplateForUser(c *gin.Context, action string) (*models.Template, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	templateID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return nil, false
+	}
+
+	template, err := storage.GetTemplateByID(templateID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return nil, false
+	}
+
+	userUUID, err := uuid.Parse(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return nil, false
+	}
+
+	if !template.IsSystem && template.UserID != userUUID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to " + action + " this template"})
+		return nil, false
+	}
+
+	return template, true
+}
+
+// getDefaultTemplate returns the account's default template and the system
+// default used when the account has none.
+func getDefaultTemplate(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	templateID, err := storage.GetDefaultTemplateID(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve default template", "details": err.Error()})
+		return
+	}
+	systemID, err := storage.GetSystemDefaultTemplateID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve default template", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"template_id": templateID, "system_default_template_id": systemID})
+}
+
+// setDefaultTemplate sets the template used for the account's invoices that
+// have none of their own. {"template_id": null} reverts to the system
+// default.
+func setDefaultTemplate(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		TemplateID *uuid.UUID `json:"template_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if input.TemplateID != nil && !usableTemplate(*input.TemplateID, userUUID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template"})
+		return
+	}
+
+	if err := storage.SetDefaultTemplateID(userUUID, input.TemplateID); err != nil {
+		log.Printf("Error setting default template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set default template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Default template updated", "template_id": input.TemplateID})
+}
+
+// listCustomerTemplates lists the per-customer default templates.
+func listCustomerTemplates(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	assignments, err := storage.GetCustomerTemplates(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve customer templates", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"customer_templates": assignments})
+}
+
+// setCustomerTemplate assigns a default template to a customer, matched by
+// the customer email on invoices.
+func setCustomerTemplate(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var assignment models.CustomerTemplate
+	if err := c.ShouldBindJSON(&assignment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+	if !usableTemplate(assignment.TemplateID, userUUID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template"})
+		return
+	}
+	assignment.UserID = userUUID
+
+	if err := storage.SetCustomerTemplate(&assignment); err != nil {
+		log.Printf("Error setting customer template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set customer template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, assignment)
+}
+
+// deleteCustomerTemplate removes the default template of the customer given
+// by ?customer_email=.
+func deleteCustomerTemplate(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	email := c.Query("customer_email")
+	if email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "customer_email is required"})
+		return
+	}
+
+	found, err := storage.DeleteCustomerTemplate(userUUID, email)
+	if err != nil {
+		log.Printf("Error deleting customer template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete customer template"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No template assigned to this customer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Customer template removed"})
+}
+
+// usableTemplate reports whether the template exists and the user may render
+// with it: their own templates and the shared system templates.
+func usableTemplate(templateID uuid.UUID, userID uuid.UUID) bool {
+	template, err := storage.GetTemplateByID(templateID)
+	if err != nil {
+		return false
+	}
+	return template.IsSystem || template.UserID == userID
+}
+
+// validTemplateWatermarks checks the stamps enabled for a template. It writes
+// the error response itself and returns false when one is unknown.
+func validTemplateWatermarks(c *gin.Context, watermarks []string) bool {
+	for _, name := range watermarks {
+		if !pdf.ValidWatermark(name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid watermark " + name + ", expected draft, paid, void or copy"})
+			return false
+		}
+	}
+	return true
+}
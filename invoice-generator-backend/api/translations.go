@@ -0,0 +1,217 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"sort"
+
+	"invoice-generator-go/i18n"
+	"invoice-generator-go/models"
+	"invoice-generator-go/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxTranslationLength caps the length of a custom translation.
+const maxTranslationLength = 1000
+
+// listTranslationLocales lists the locales with a bundled catalog and those
+// the account has custom translations for.
+func listTranslationLocales(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	catalogs, err := storage.GetTranslations(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve translations", "details": err.Error()})
+		return
+	}
+	custom := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		custom = append(custom, locale)
+	}
+	sort.Strings(custom)
+
+	c.JSON(http.StatusOK, gin.H{"locales": i18n.Locales(), "custom_locales": custom, "default_locale": i18n.DefaultLocale})
+}
+
+// getTranslations returns the effective catalog for a locale, falling back
+// through its base language and the default locale, along with the
+// account's own translations for it.
+func getTranslations(c *gin.Context) {
+	userUUID, locale, ok := translationLocale(c)
+	if !ok {
+		return
+	}
+	writeTranslations(c, userUUID, locale)
+}
+
+// setTranslations stores custom translations for a locale from a JSON object
+// of key to text. An empty text removes the custom translation, reverting to
+// the bundled one.
+func setTranslations(c *gin.Context) {
+	userUUID, locale, ok := translationLocale(c)
+	if !ok {
+		return
+	}
+
+	var input map[string]string
+	if err := c.ShouldBindJSON(&input); err != nil || len(input) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a JSON object of translation keys to text"})
+		return
+	}
+	for key, value := range input {
+		if !i18n.ValidKey(key) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid translation key " + key + ", use lower-case letters, digits, '_' and '.'"})
+			return
+		}
+		if len(value) > maxTranslationLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Translation for " + key + " is too long"})
+			return
+		}
+	}
+
+	if err := storage.SetTranslations(userUUID, locale, input); err != nil {
+		log.Printf("Error setting translations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save translations"})
+		return
+	}
+
+	writeTranslations(c, userUUID, locale)
+}
+
+// deleteTranslations removes all custom translations for a locale.
+func deleteTranslations(c *gin.Context) {
+	userUUID, locale, ok := translationLocale(c)
+	if !ok {
+		return
+	}
+
+	n, err := storage.DeleteTranslations(userUUID, locale)
+	if err != nil {
+		log.Printf("Error deleting translations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete translations"})
+		return
+	}
+	if n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No custom translations for this locale"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Custom translations removed"})
+}
+
+// writeTranslations responds with the effective and custom catalogs of a
+// locale.
+func writeTranslations(c *gin.Context, userID uuid.UUID, locale string) {
+	catalogs, err := storage.GetTranslations(userID, i18n.Chain(locale)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve translations", "details": err.Error()})
+		return
+	}
+	custom := make(map[string]i18n.Catalog, len(catalogs))
+	for l, catalog := range catalogs {
+		custom[l] = catalog
+	}
+
+	own := custom[locale]
+	if own == nil {
+		own = i18n.Catalog{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"locale":       locale,
+		"translations": i18n.New(locale, custom).Merged(),
+		"custom":       own,
+	})
+}
+
+// translationLocale reads the user and the :locale URL parameter. It writes
+// the error response itself and returns false on failure.
+func translationLocale(c *gin.Context) (uuid.UUID, string, bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return uuid.Nil, "", false
+	}
+	locale := i18n.Normalize(c.Param("locale"))
+	if !i18n.ValidLocale(locale) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid locale, expected a code such as en or de-CH"})
+		return uuid.Nil, "", false
+	}
+	return userUUID, locale, true
+}
+
+// listCustomerLanguages lists the per-customer document languages.
+func listCustomerLanguages(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	languages, err := storage.GetCustomerLanguages(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve customer languages", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"customer_languages": languages})
+}
+
+// setCustomerLanguage sets the language a customer's documents are rendered
+// in, matched by the customer email on invoices.
+func setCustomerLanguage(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var language models.CustomerLanguage
+	if err := c.ShouldBindJSON(&language); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+	if !i18n.ValidLocale(language.Language) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid language, expected a code such as en or de-CH"})
+		return
+	}
+	language.Language = i18n.Normalize(language.Language)
+	language.UserID = userUUID
+
+	if err := storage.SetCustomerLanguage(&language); err != nil {
+		log.Printf("Error setting customer language: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set customer language"})
+		return
+	}
+
+	c.JSON(http.StatusOK, language)
+}
+
+// deleteCustomerLanguage removes the language of the customer given by
+// ?customer_email=.
+func deleteCustomerLanguage(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	email := c.Query("customer_email")
+	if email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "customer_email is required"})
+		return
+	}
+
+	found, err := storage.DeleteCustomerLanguage(userUUID, email)
+	if err != nil {
+		log.Printf("Error deleting customer language: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete customer language"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No language set for this customer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Customer language removed"})
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"invoice-generator-go/models"
+	"invoice-generator-go/storage"
+	"invoice-generator-go/webhooks"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxWebhookDeliveries bounds the delivery log listed at once.
+const maxWebhookDeliveries = 100
+
+// webhookRequest is the body that creates or replaces a webhook
+// subscription. Without a secret, a new subscription gets a generated one
+// and an existing one keeps its own.
+type webhookRequest struct {
+	URL        string   `json:"url" binding:"required"`
+	EventTypes []string `json:"event_types" binding:"required"`
+	Active     *bool    `json:"active"`
+	Secret     string   `json:"secret"`
+}
+
+// listWebhooks lists the account's webhook subscriptions.
+func listWebhooks(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	subs, err := storage.GetWebhookSubscriptionsByUserID(userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve webhooks", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": subs, "event_types": webhooks.EventTypes})
+}
+
+// createWebhook subscribes an endpoint to the account's invoice events. The
+// answer holds the signing secret, which isn't shown again.
+func createWebhook(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	sub, ok := bindWebhook(c)
+	if !ok {
+		return
+	}
+	sub.UserID = userUUID
+	if sub.Secret == "" {
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			log.Printf("Error generating webhook secret: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+			return
+		}
+		sub.Secret = secret
+	}
+
+	if err := storage.CreateWebhookSubscription(sub); err != nil {
+		log.Printf("Error creating webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, sub)
+}
+
+// getWebhook returns one webhook subscription, without its secret.
+func getWebhook(c *gin.Context) {
+	sub, ok := loadOwnedWebhook(c, "view")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+// updateWebhook replaces a webhook subscription. Deliveries already queued
+// go to the new endpoint; a subscription made inactive queues no more and
+// holds back those it has until it is active again.
+func updateWebhook(c *gin.Context) {
+	existing, ok := loadOwnedWebhook(c, "update")
+	if !ok {
+		return
+	}
+
+	sub, ok := bindWebhook(c)
+	if !ok {
+		return
+	}
+	sub.ID, sub.UserID, sub.CreatedAt = existing.ID, existing.UserID, existing.CreatedAt
+
+	if err := storage.UpdateWebhookSubscription(sub); err != nil {
+		log.Printf("Error updating webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// deleteWebhook deletes a webhook subscription and its delivery log.
+func deleteWebhook(c *gin.Context) {
+	sub, ok := loadOwnedWebhook(c, "delete")
+	if !ok {
+		return
+	}
+
+	if err := storage.DeleteWebhookSubscription(sub.ID); err != nil {
+		log.Printf("Error deleting webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// listWebhookDeliveries lists the latest deliveries to a webhook, newest
+// first, optionally filtered by ?status=pending, succeeded or failed.
+func listWebhookDeliveries(c *gin.Context) {
+	sub, ok := loadOwnedWebhook(c, "view deliveries of")
+	if !ok {
+		return
+	}
+
+	status := c.Query("status")
+	if status != "" && status != "pending" && status != "succeeded" && status != "failed" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status, expected pending, succeeded or failed"})
+		return
+	}
+
+	deliveries, err := storage.GetWebhookDeliveries(sub.ID, status, maxWebhookDeliveries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve webhook deliveries", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// getWebhookDelivery returns a delivery with the payload sent and the log of
+// its attempts.
+func getWebhookDelivery(c *gin.Context) {
+	_, delivery, ok := loadWebhookDelivery(c, "view deliveries of")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
+
+// redeliverWebhook queues a delivery, whatever its status, to be sent again
+// straight away with its retries started over. The event keeps its ID, so
+// receivers can tell it from a new one.
+func redeliverWebhook(c *gin.Context) {
+	sub, delivery, ok := loadWebhookDelivery(c, "redeliver to")
+	if !ok {
+		return
+	}
+	if !sub.Active {
+		c.JSON(http.StatusConflict, gin.H{"error": "Activate the webhook to redeliver to it"})
+		return
+	}
+
+	if err := storage.RedeliverWebhook(delivery.ID); err != nil {
+		log.Printf("Error redelivering webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeliver webhook"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Delivery queued", "delivery_id": delivery.ID})
+}
+
+// bindWebhook reads and validates a webhookRequest. It writes the error
+// response itself and returns false on failure.
+func bindWebhook(c *gin.Context) (*models.WebhookSubscription, bool) {
+	var input webhookRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return nil, false
+	}
+
+	sub := &models.WebhookSubscription{URL: input.URL, EventTypes: input.EventTypes, Active: true, Secret: input.Secret}
+	if input.Active != nil {
+		sub.Active = *input.Active
+	}
+	if err := webhooks.Validate(sub); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return sub, true
+}
+
+// loadOwnedWebhook fetches the webhook subscription named in the URL if it
+// belongs to the user. It writes the error response itself and returns false
+// on failure.
+func loadOwnedWebhook(c *gin.Context, action string) (*models.WebhookSubscription, bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	subID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return nil, false
+	}
+
+	sub, err := storage.GetWebhookSubscriptionByID(subID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve webhook", "details": err.Error()})
+		return nil, false
+	}
+
+	if sub.UserID != userUUID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to " + action + " this webhook"})
+		return nil, false
+	}
+
+	return sub, true
+}
+
+// loadWebhookDelivery fetches the delivery named in the URL if it was made to
+// the user's webhook, also named in the URL. It writes the error response
+// itself and returns false on failure.
+func loadWebhookDelivery(c *gin.Context, action string) (*models.WebhookSubscription, *models.WebhookDelivery, bool) {
+	sub, ok := loadOwnedWebhook(c, action)
+	if !ok {
+		return nil, nil, false
+	}
+
+	deliveryID, err := uuid.Parse(c.Param("delivery"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return nil, nil, false
+	}
+
+	delivery, err := storage.GetWebhookDelivery(deliveryID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && delivery.SubscriptionID != sub.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return nil, nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve delivery", "details": err.Error()})
+		return nil, nil, false
+	}
+
+	return sub, delivery, true
+}
@@ -9,7 +9,13 @@ import (
 	"github.com/joho/godotenv"
 	"invoice-generator-go/api"
 	"invoice-generator-go/config"
+	"invoice-generator-go/dunning"
+	"invoice-generator-go/mail"
+	"invoice-generator-go/overdue"
+	"invoice-generator-go/payments/provider"
 	"invoice-generator-go/storage"
+	"invoice-generator-go/templates"
+	"invoice-generator-go/webhooks"
 	"log"
 )
 
@@ -44,6 +50,68 @@ func main() {
 		log.Fatalf("Failed to connect to database after %d attempts: %v", maxRetries, err)
 	}
 
+	// Set up the blob store for uploaded files
+	if err := storage.ConnectBlobStore(appConfig.FileStoragePath); err != nil {
+		log.Fatalf("Failed to set up file storage: %v", err)
+	}
+
+	// Set up outgoing email
+	if err := mail.Configure(appConfig); err != nil {
+		log.Fatalf("Failed to set up email delivery: %v", err)
+	}
+
+	// Set up online payments
+	if err := provider.Configure(appConfig); err != nil {
+		log.Fatalf("Failed to set up online payments: %v", err)
+	}
+
+	// Load the bundled system templates shared by all accounts
+	if err := syncSystemTemplates(); err != nil {
+		log.Printf("Warning: failed to sync system templates: %v", err)
+	}
+
+	// Export jobs run in-process, so any left unfinished died with the
+	// previous process
+	if n, err := storage.FailInterruptedExportJobs(); err != nil {
+		log.Printf("Warning: failed to clean up export jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted export jobs as failed", n)
+	}
+
+	// Reminder steps left pending died with the previous process; retry them
+	if n, err := storage.FailInterruptedDunningEvents(); err != nil {
+		log.Printf("Warning: failed to clean up dunning events: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted reminder steps as failed", n)
+	}
+
+	// Send payment reminders in the background
+	if appConfig.DunningInterval != "off" {
+		interval, err := time.ParseDuration(appConfig.DunningInterval)
+		if err != nil || interval <= 0 {
+			log.Fatalf("Invalid DUNNING_INTERVAL %q, expected a duration such as 1h or off", appConfig.DunningInterval)
+		}
+		dunning.Start(interval)
+	}
+
+	// Mark unpaid invoices past their due date as overdue in the background
+	if appConfig.OverdueInterval != "off" {
+		interval, err := time.ParseDuration(appConfig.OverdueInterval)
+		if err != nil || interval <= 0 {
+			log.Fatalf("Invalid OVERDUE_INTERVAL %q, expected a duration such as 1h or off", appConfig.OverdueInterval)
+		}
+		overdue.Start(interval)
+	}
+
+	// Deliver webhook events to the accounts' endpoints in the background
+	if appConfig.WebhookInterval != "off" {
+		interval, err := time.ParseDuration(appConfig.WebhookInterval)
+		if err != nil || interval <= 0 {
+			log.Fatalf("Invalid WEBHOOK_INTERVAL %q, expected a duration such as 15s or off", appConfig.WebhookInterval)
+		}
+		webhooks.Start(interval)
+	}
+
 	// Set up Gin router without default middleware
 	r := gin.New()
 
@@ -98,3 +166,18 @@ func getAllowedOrigins() []string {
 
 	return origins
 }
+
+// syncSystemTemplates stores the templates embedded in the binary as system
+// templates, updating any whose bundled content changed.
+func syncSystemTemplates() error {
+	systemTemplates, err := templates.SystemTemplates()
+	if err != nil {
+		return err
+	}
+	for _, t := range systemTemplates {
+		if err := storage.SyncSystemTemplate(t.Key, t.Name, t.Language, t.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+// Package dunning chases unpaid invoices: a background scheduler walks each
+// account's dunning policy and emails escalating payment reminders as
+// invoices approach and pass their due date, recording every step.
+package dunning
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"invoice-generator-go/mail"
+	"invoice-generator-go/models"
+	"invoice-generator-go/storage"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxSteps caps the reminders in a policy.
+	MaxSteps = 10
+	// minDays and maxDays bound a step's offset from the due date.
+	minDays = -60
+	maxDays = 365
+)
+
+// reminderKinds are the email templates reminder steps may use.
+var reminderKinds = map[string]bool{
+	mail.KindReminderUpcoming: true,
+	mail.KindReminderOverdue:  true,
+	mail.KindReminderFinal:    true,
+}
+
+// DefaultPolicy is the policy suggested to accounts without one: a note 3
+// days before the due date, reminders 7 and 14 days after it and a final
+// notice with the invoice attached after 30 days. It starts disabled.
+func DefaultPolicy() models.DunningPolicy {
+	return models.DunningPolicy{
+		Steps: []models.DunningStep{
+			{Days: -3, Template: mail.KindReminderUpcoming},
+			{Days: 7, Template: mail.KindReminderOverdue},
+			{Days: 14, Template: mail.KindReminderOverdue},
+			{Days: 30, Template: mail.KindReminderFinal, AttachPDF: true},
+		},
+	}
+}
+
+// Validate checks a policy's steps and sorts them by day.
+func Validate(policy *models.DunningPolicy) error {
+	if len(policy.Steps) > MaxSteps {
+		return fmt.Errorf("a policy has at most %d steps", MaxSteps)
+	}
+	if policy.Enabled && len(policy.Steps) == 0 {
+		return fmt.Errorf("an enabled policy needs at least one step")
+	}
+	sort.SliceStable(policy.Steps, func(i, j int) bool { return policy.Steps[i].Days < policy.Steps[j].Days })
+	for i, step := range policy.Steps {
+		if step.Days < minDays || step.Days > maxDays {
+			return fmt.Errorf("step days must be between %d and %d", minDays, maxDays)
+		}
+		if i > 0 && step.Days == policy.Steps[i-1].Days {
+			return fmt.Errorf("two steps fall on day %d", step.Days)
+		}
+		if !reminderKinds[step.Template] {
+			return fmt.Errorf("unknown reminder template %q, expected %s, %s or %s", step.Template, mail.KindReminderUpcoming, mail.KindReminderOverdue, mail.KindReminderFinal)
+		}
+	}
+	return nil
+}
+
+// Start runs the scheduler in the background, once straight away and then
+// every interval.
+func Start(interval time.Duration) {
+	go func() {
+		for {
+			Run(time.Now())
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Run sends the reminders due at now under every enabled policy.
+func Run(now time.Time) {
+	policies, err := storage.GetEnabledDunningPolicies()
+	if err != nil {
+		log.Printf("Dunning run failed: %v", err)
+		return
+	}
+	for userID, policy := range policies {
+		if err := runPolicy(userID, policy, now); err != nil {
+			log.Printf("Dunning run for user %s failed: %v", userID, err)
+		}
+	}
+}
+
+// runPolicy sends each of a user's unpaid invoices the latest reminder step
+// it has reached, unless that step or a later one was already sent. Steps
+// missed while the invoice was paid down or the policy was off are skipped
+// rather than sent in a burst.
+func runPolicy(userID uuid.UUID, policy models.DunningPolicy, now time.Time) error {
+	if len(policy.Steps) == 0 {
+		return nil
+	}
+	today := day(now)
+	invoices, err := storage.FindDunningCandidates(userID, today.AddDate(0, 0, 1-policy.Steps[0].Days))
+	if err != nil {
+		return err
+	}
+	taken, err := storage.GetTakenDunningSteps(userID)
+	if err != nil {
+		return err
+	}
+
+	for i := range invoices {
+		invoice := &invoices[i]
+		step := dueStep(policy.Steps, DaysOverdue(invoice.DueDate, now))
+		if step == 0 || taken[invoice.ID] >= step {
+			continue
+		}
+		if err := sendStep(userID, invoice, step, policy.Steps[step-1]); err != nil {
+			log.Printf("Dunning step %d for invoice %s failed: %v", step, invoice.InvoiceNumber, err)
+		}
+	}
+	return nil
+}
+
+// sendStep claims a reminder step, sends it and records the outcome.
+func sendStep(userID uuid.UUID, invoice *models.Invoice, step int, s models.DunningStep) error {
+	event := models.DunningEvent{InvoiceID: invoice.ID, Step: step, Days: s.Days, Template: s.Template}
+	claimed, err := storage.ClaimDunningStep(userID, &event)
+	if err != nil || !claimed {
+		return err
+	}
+
+	sent, sendErr := mail.SendReminder(invoice, s.Template, s.AttachPDF)
+	event.Status = "sent"
+	if sent != nil {
+		event.SentEmailID = &sent.ID
+	}
+	if sendErr != nil {
+		event.Status = "failed"
+		event.Error = sendErr.Error()
+	}
+	if err := storage.CompleteDunningEvent(&event); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// dueStep returns the 1-based position of the latest step reached by an
+// invoice daysOverdue days past due, or 0 before the first.
+func dueStep(steps []models.DunningStep, daysOverdue int) int {
+	step := 0
+	for i, s := range steps {
+		if daysOverdue >= s.Days {
+			step = i + 1
+		}
+	}
+	return step
+}
+
+// DaysOverdue returns the whole days from an invoice's due date to now,
+// negative before it.
+func DaysOverdue(dueDate, now time.Time) int {
+	return int(day(now).Sub(day(dueDate)).Hours() / 24)
+}
+
+// day truncates t to midnight UTC of its date.
+func day(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,289 @@
+package einvoice
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Namespaces of the UN/CEFACT Cross Industry Invoice D16B schema.
+const (
+	nsRSM = "urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100"
+	nsRAM = "urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100"
+	nsQDT = "urn:un:unece:uncefact:data:standard:QualifiedDataType:100"
+	nsUDT = "urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100"
+)
+
+// FacturXGuideline is the specification identifier of the Factur-X / ZUGFeRD
+// EN 16931 (COMFORT) profile.
+const FacturXGuideline = "urn:cen.eu:en16931:2017"
+
+// The structs below only model the subset of CII needed for the EN 16931
+// profile. Element order follows the XSD sequence and must not be changed.
+
+type ciiInvoice struct {
+	XMLName                     xml.Name                  `xml:"rsm:CrossIndustryInvoice"`
+	XmlnsRSM                    string                    `xml:"xmlns:rsm,attr"`
+	XmlnsRAM                    string                    `xml:"xmlns:ram,attr"`
+	XmlnsQDT                    string                    `xml:"xmlns:qdt,attr"`
+	XmlnsUDT                    string                    `xml:"xmlns:udt,attr"`
+	ExchangedDocumentContext    ciiDocumentContext        `xml:"rsm:ExchangedDocumentContext"`
+	ExchangedDocument           ciiExchangedDocument      `xml:"rsm:ExchangedDocument"`
+	SupplyChainTradeTransaction ciiSupplyChainTransaction `xml:"rsm:SupplyChainTradeTransaction"`
+}
+
+type ciiDocumentContext struct {
+	GuidelineID string `xml:"ram:GuidelineSpecifiedDocumentContextParameter>ram:ID"`
+}
+
+type ciiExchangedDocument struct {
+	ID            string       `xml:"ram:ID"`
+	TypeCode      string       `xml:"ram:TypeCode"`
+	IssueDateTime ciiDateTime  `xml:"ram:IssueDateTime"`
+	IncludedNote  []ciiContent `xml:"ram:IncludedNote,omitempty"`
+}
+
+type ciiContent struct {
+	Content string `xml:"ram:Content"`
+}
+
+type ciiDateTime struct {
+	DateTimeString ciiDateString `xml:"udt:DateTimeString"`
+}
+
+type ciiDateString struct {
+	Format string `xml:"format,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type ciiSupplyChainTransaction struct {
+	LineItems  []ciiLineItem       `xml:"ram:IncludedSupplyChainTradeLineItem"`
+	Agreement  ciiHeaderAgreement  `xml:"ram:ApplicableHeaderTradeAgreement"`
+	Delivery   struct{}            `xml:"ram:ApplicableHeaderTradeDelivery"`
+	Settlement ciiHeaderSettlement `xml:"ram:ApplicableHeaderTradeSettlement"`
+}
+
+type ciiLineItem struct {
+	LineID      string            `xml:"ram:AssociatedDocumentLineDocument>ram:LineID"`
+	ProductName string            `xml:"ram:SpecifiedTradeProduct>ram:Name"`
+	NetPrice    string            `xml:"ram:SpecifiedLineTradeAgreement>ram:NetPriceProductTradePrice>ram:ChargeAmount"`
+	Quantity    ciiQuantity       `xml:"ram:SpecifiedLineTradeDelivery>ram:BilledQuantity"`
+	Settlement  ciiLineSettlement `xml:"ram:SpecifiedLineTradeSettlement"`
+}
+
+type ciiQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ciiLineSettlement struct {
+	Tax             ciiLineTax `xml:"ram:ApplicableTradeTax"`
+	LineTotalAmount string     `xml:"ram:SpecifiedTradeSettlementLineMonetarySummation>ram:LineTotalAmount"`
+}
+
+type ciiLineTax struct {
+	TypeCode     string `xml:"ram:TypeCode"`
+	CategoryCode string `xml:"ram:CategoryCode"`
+	RatePercent  string `xml:"ram:RateApplicablePercent,omitempty"`
+}
+
+type ciiHeaderAgreement struct {
+	BuyerReference string   `xml:"ram:BuyerReference,omitempty"`
+	Seller         ciiParty `xml:"ram:SellerTradeParty"`
+	Buyer          ciiParty `xml:"ram:BuyerTradeParty"`
+}
+
+type ciiParty struct {
+	Name            string               `xml:"ram:Name"`
+	Address         ciiAddress           `xml:"ram:PostalTradeAddress"`
+	Email           *ciiURI              `xml:"ram:URIUniversalCommunication,omitempty"`
+	TaxRegistration []ciiTaxRegistration `xml:"ram:SpecifiedTaxRegistration,omitempty"`
+}
+
+type ciiAddress struct {
+	PostcodeCode string `xml:"ram:PostcodeCode,omitempty"`
+	LineOne      string `xml:"ram:LineOne,omitempty"`
+	CityName     string `xml:"ram:CityName,omitempty"`
+	CountryID    string `xml:"ram:CountryID"`
+}
+
+type ciiURI struct {
+	URIID ciiSchemeID `xml:"ram:URIID"`
+}
+
+type ciiTaxRegistration struct {
+	ID ciiSchemeID `xml:"ram:ID"`
+}
+
+type ciiSchemeID struct {
+	SchemeID string `xml:"schemeID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ciiHeaderSettlement struct {
+	CurrencyCode string               `xml:"ram:InvoiceCurrencyCode"`
+	PaymentMeans *ciiPaymentMeans     `xml:"ram:SpecifiedTradeSettlementPaymentMeans,omitempty"`
+	Taxes        []ciiHeaderTax       `xml:"ram:ApplicableTradeTax"`
+	PaymentTerms *ciiPaymentTerms     `xml:"ram:SpecifiedTradePaymentTerms,omitempty"`
+	Summation    ciiMonetarySummation `xml:"ram:SpecifiedTradeSettlementHeaderMonetarySummation"`
+}
+
+type ciiPaymentMeans struct {
+	TypeCode string               `xml:"ram:TypeCode"`
+	Account  *ciiFinancialAccount `xml:"ram:PayeePartyCreditorFinancialAccount,omitempty"`
+	Bank     *ciiFinancialBank    `xml:"ram:PayeeSpecifiedCreditorFinancialInstitution,omitempty"`
+}
+
+type ciiFinancialAccount struct {
+	IBANID string `xml:"ram:IBANID"`
+}
+
+type ciiFinancialBank struct {
+	BICID string `xml:"ram:BICID"`
+}
+
+type ciiHeaderTax struct {
+	CalculatedAmount string `xml:"ram:CalculatedAmount"`
+	TypeCode         string `xml:"ram:TypeCode"`
+	BasisAmount      string `xml:"ram:BasisAmount"`
+	CategoryCode     string `xml:"ram:CategoryCode"`
+	RatePercent      string `xml:"ram:RateApplicablePercent"`
+}
+
+type ciiPaymentTerms struct {
+	Description string      `xml:"ram:Description,omitempty"`
+	DueDate     ciiDateTime `xml:"ram:DueDateDateTime"`
+}
+
+type ciiMonetarySummation struct {
+	LineTotalAmount     string            `xml:"ram:LineTotalAmount"`
+	TaxBasisTotalAmount string            `xml:"ram:TaxBasisTotalAmount"`
+	TaxTotalAmount      ciiCurrencyAmount `xml:"ram:TaxTotalAmount"`
+	GrandTotalAmount    string            `xml:"ram:GrandTotalAmount"`
+	TotalPrepaidAmount  string            `xml:"ram:TotalPrepaidAmount,omitempty"`
+	DuePayableAmount    string            `xml:"ram:DuePayableAmount"`
+}
+
+type ciiCurrencyAmount struct {
+	CurrencyID string `xml:"currencyID,attr"`
+	Value      string `xml:",chardata"`
+}
+
+// MarshalCII renders the document as a Factur-X EN 16931 Cross Industry Invoice.
+func MarshalCII(doc Document) ([]byte, error) {
+	inv := ciiInvoice{
+		XmlnsRSM:                 nsRSM,
+		XmlnsRAM:                 nsRAM,
+		XmlnsQDT:                 nsQDT,
+		XmlnsUDT:                 nsUDT,
+		ExchangedDocumentContext: ciiDocumentContext{GuidelineID: FacturXGuideline},
+		ExchangedDocument: ciiExchangedDocument{
+			ID:            doc.Number,
+			TypeCode:      doc.TypeCode,
+			IssueDateTime: ciiDate(doc.IssueDate),
+		},
+	}
+	if doc.Note != "" {
+		inv.ExchangedDocument.IncludedNote = []ciiContent{{Content: doc.Note}}
+	}
+
+	tx := &inv.SupplyChainTradeTransaction
+	for _, line := range doc.Lines {
+		tx.LineItems = append(tx.LineItems, ciiLineItem{
+			LineID:      line.ID,
+			ProductName: line.Description,
+			NetPrice:    amount(line.UnitPrice),
+			Quantity:    ciiQuantity{UnitCode: "C62", Value: quantity(line.Quantity)},
+			Settlement: ciiLineSettlement{
+				Tax: ciiLineTax{
+					TypeCode:     "VAT",
+					CategoryCode: TaxCategory(line.TaxRate),
+					RatePercent:  percent(line.TaxRate),
+				},
+				LineTotalAmount: amount(line.NetAmount),
+			},
+		})
+	}
+
+	tx.Agreement = ciiHeaderAgreement{
+		BuyerReference: doc.BuyerReference,
+		Seller:         ciiPartyFrom(doc.Seller),
+		Buyer:          ciiPartyFrom(doc.Buyer),
+	}
+
+	settlement := &tx.Settlement
+	settlement.CurrencyCode = doc.Currency
+	if pm := doc.PaymentMeans; pm != nil {
+		settlement.PaymentMeans = &ciiPaymentMeans{TypeCode: pm.TypeCode}
+		if pm.IBAN != "" {
+			settlement.PaymentMeans.Account = &ciiFinancialAccount{IBANID: pm.IBAN}
+		}
+		if pm.BIC != "" {
+			settlement.PaymentMeans.Bank = &ciiFinancialBank{BICID: pm.BIC}
+		}
+	}
+	for _, tax := range doc.Taxes {
+		settlement.Taxes = append(settlement.Taxes, ciiHeaderTax{
+			CalculatedAmount: amount(tax.TaxAmount),
+			TypeCode:         "VAT",
+			BasisAmount:      amount(tax.TaxableAmount),
+			CategoryCode:     tax.CategoryCode,
+			RatePercent:      percent(tax.Rate),
+		})
+	}
+	if !doc.DueDate.IsZero() {
+		settlement.PaymentTerms = &ciiPaymentTerms{Description: doc.PaymentTerms, DueDate: ciiDate(doc.DueDate)}
+	}
+	settlement.Summation = ciiMonetarySummation{
+		LineTotalAmount:     amount(doc.LineTotal),
+		TaxBasisTotalAmount: amount(doc.LineTotal),
+		TaxTotalAmount:      ciiCurrencyAmount{CurrencyID: doc.Currency, Value: amount(doc.TaxTotal)},
+		GrandTotalAmount:    amount(doc.GrandTotal),
+		DuePayableAmount:    amount(doc.DuePayable),
+	}
+	if doc.Prepaid != 0 {
+		settlement.Summation.TotalPrepaidAmount = amount(doc.Prepaid)
+	}
+
+	out, err := xml.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal CII invoice: %v", err)
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+func ciiPartyFrom(p Party) ciiParty {
+	party := ciiParty{
+		Name: p.Name,
+		Address: ciiAddress{
+			PostcodeCode: p.PostalCode,
+			LineOne:      p.AddressLine,
+			CityName:     p.City,
+			CountryID:    p.CountryCode,
+		},
+	}
+	if p.Email != "" {
+		party.Email = &ciiURI{URIID: ciiSchemeID{SchemeID: "EM", Value: p.Email}}
+	}
+	if p.VATID != "" {
+		party.TaxRegistration = []ciiTaxRegistration{{ID: ciiSchemeID{SchemeID: "VA", Value: p.VATID}}}
+	}
+	return party
+}
+
+func ciiDate(t time.Time) ciiDateTime {
+	return ciiDateTime{DateTimeString: ciiDateString{Format: "102", Value: t.Format("20060102")}}
+}
+
+func amount(v float64) string {
+	return strconv.FormatFloat(round2(v), 'f', 2, 64)
+}
+
+func quantity(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func percent(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
@@ -0,0 +1,290 @@
+// Package einvoice converts invoices to and from the structured XML formats
+// used for electronic invoicing in the EU (EN 16931).
+package einvoice
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"invoice-generator-go/config"
+	"invoice-generator-go/models"
+)
+
+// Document type codes from UNTDID 1001.
+const (
+	TypeCodeInvoice    = "380"
+	TypeCodeCreditNote = "381"
+)
+
+// Party is a seller or buyer on an e-invoice.
+type Party struct {
+	Name        string
+	Email       string
+	AddressLine string
+	City        string
+	PostalCode  string
+	CountryCode string
+	VATID       string
+}
+
+// Line is a single invoice line.
+type Line struct {
+	ID          string
+	Description string
+	Quantity    float64
+	UnitPrice   float64
+	NetAmount   float64
+	TaxRate     float64
+}
+
+// TaxSubtotal is one entry of the VAT breakdown.
+type TaxSubtotal struct {
+	CategoryCode  string
+	Rate          float64
+	TaxableAmount float64
+	TaxAmount     float64
+}
+
+// PaymentMeans describes how the buyer is expected to pay.
+type PaymentMeans struct {
+	TypeCode string // UNTDID 4461, 58 = SEPA credit transfer
+	IBAN     string
+	BIC      string
+}
+
+// Document is the format-neutral representation of an e-invoice that the
+// CII and UBL writers are generated from.
+type Document struct {
+	Number         string
+	TypeCode       string
+	BuyerReference string
+	IssueDate      time.Time
+	DueDate        time.Time
+	PaymentTerms   string // BT-20, free text
+	Currency       string
+	Note           string
+	Seller         Party
+	Buyer          Party
+	Lines          []Line
+	Taxes          []TaxSubtotal
+	LineTotal      float64
+	TaxTotal       float64
+	GrandTotal     float64
+	Prepaid        float64 // BT-113, amounts already paid
+	DuePayable     float64
+	PaymentMeans   *PaymentMeans
+}
+
+// currencySymbols maps the symbols the frontend may store to ISO 4217 codes.
+var currencySymbols = map[string]string{
+	"$": "USD",
+	"€": "EUR",
+	"£": "GBP",
+	"¥": "JPY",
+}
+
+// CurrencyCode normalises an invoice currency to an ISO 4217 code.
+func CurrencyCode(currency string) string {
+	currency = strings.TrimSpace(currency)
+	if code, ok := currencySymbols[currency]; ok {
+		return code
+	}
+	return strings.ToUpper(currency)
+}
+
+// FromInvoice builds a Document from an invoice, its items and the sender
+// profile. The totals are the ones stored on the invoice, which is what the
+// customer was billed. When they disagree with the items by more than
+// rounding, the document is still returned along with a *ValidationError
+// listing the differences, and must not be exported.
+func FromInvoice(invoice models.Invoice, items []models.InvoiceItem, seller models.CompanyProfile) (Document, error) {
+	country := config.GetConfig().DefaultCountryCode
+
+	doc := Document{
+		Number:         invoice.InvoiceNumber,
+		TypeCode:       TypeCodeInvoice,
+		BuyerReference: invoice.BuyerReference,
+		IssueDate:      invoice.InvoiceDate,
+		DueDate:        invoice.DueDate,
+		PaymentTerms:   paymentTermsNote(invoice),
+		Currency:       CurrencyCode(invoice.Currency),
+		Note:           invoice.Notes,
+		Seller: Party{
+			Name:        seller.CompanyName,
+			Email:       seller.Email,
+			AddressLine: seller.AddressLine,
+			City:        seller.City,
+			PostalCode:  seller.PostalCode,
+			CountryCode: country,
+			VATID:       seller.TaxID,
+		},
+		Buyer: Party{
+			Name:        invoice.CustomerName,
+			Email:       invoice.CustomerEmail,
+			AddressLine: invoice.CustomerAddress,
+			CountryCode: country,
+		},
+		LineTotal:  round2(invoice.Subtotal),
+		TaxTotal:   round2(invoice.TaxAmount),
+		GrandTotal: round2(invoice.TotalAmount),
+		Prepaid:    round2(invoice.AmountPaid),
+	}
+	doc.DuePayable = round2(doc.GrandTotal - doc.Prepaid)
+	if invoice.DocumentType == "credit_note" {
+		doc.TypeCode = TypeCodeCreditNote
+	}
+	if doc.Seller.Name == "" {
+		doc.Seller.Name = seller.Email
+	}
+	if seller.CountryCode != "" {
+		doc.Seller.CountryCode = seller.CountryCode
+	}
+	if seller.IBAN != "" {
+		doc.PaymentMeans = &PaymentMeans{TypeCode: "58", IBAN: seller.IBAN, BIC: seller.BIC}
+	}
+
+	var lineSum float64
+	for i, item := range items {
+		net := item.TotalPrice
+		if net == 0 {
+			net = item.Quantity * item.UnitPrice
+		}
+		doc.Lines = append(doc.Lines, Line{
+			ID:          strconv.Itoa(i + 1),
+			Description: item.Description,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			NetAmount:   round2(net),
+			TaxRate:     invoice.TaxRate,
+		})
+		lineSum += round2(net)
+	}
+
+	// Invoices without items still need one line to be valid EN 16931.
+	if len(doc.Lines) == 0 {
+		doc.Lines = append(doc.Lines, Line{
+			ID:          "1",
+			Description: "Invoice " + invoice.InvoiceNumber,
+			Quantity:    1,
+			UnitPrice:   doc.LineTotal,
+			NetAmount:   doc.LineTotal,
+			TaxRate:     invoice.TaxRate,
+		})
+		lineSum = doc.LineTotal
+	}
+
+	doc.Taxes = []TaxSubtotal{{
+		CategoryCode:  TaxCategory(invoice.TaxRate),
+		Rate:          invoice.TaxRate,
+		TaxableAmount: doc.LineTotal,
+		TaxAmount:     doc.TaxTotal,
+	}}
+
+	var violations []Violation
+	if expected := round2(lineSum); !withinRounding(expected, doc.LineTotal) {
+		violations = append(violations, Violation{Rule: "BR-CO-10", Message: fmt.Sprintf("Invoice subtotal %.2f differs from the sum of its items %.2f", doc.LineTotal, expected)})
+	}
+	if expected := round2(doc.LineTotal * invoice.TaxRate / 100); !withinRounding(expected, doc.TaxTotal) {
+		violations = append(violations, Violation{Rule: "BR-CO-17", Message: fmt.Sprintf("Invoice tax %.2f differs from %g%% of the subtotal %.2f", doc.TaxTotal, invoice.TaxRate, expected)})
+	}
+	if expected := round2(doc.LineTotal + doc.TaxTotal); !withinRounding(expected, doc.GrandTotal) {
+		violations = append(violations, Violation{Rule: "BR-CO-15", Message: fmt.Sprintf("Invoice total %.2f differs from subtotal plus tax %.2f", doc.GrandTotal, expected)})
+	}
+	if len(violations) > 0 {
+		return doc, &ValidationError{Violations: violations}
+	}
+	return doc, nil
+}
+
+// ToBill maps an incoming document to a purchase bill and the supplier
+// that issued it. IDs, ownership and the source document are left for the
+// caller to fill in.
+func (doc Document) ToBill() (models.Bill, models.Supplier) {
+	bill := models.Bill{
+		BillNumber:   doc.Number,
+		DocumentType: "invoice",
+		Status:       "open",
+		BillDate:     doc.IssueDate,
+		Currency:     doc.Currency,
+		Subtotal:     round2(doc.LineTotal),
+		TaxAmount:    round2(doc.TaxTotal),
+		TotalAmount:  round2(doc.GrandTotal),
+		Notes:        doc.Note,
+	}
+	if doc.TypeCode == TypeCodeCreditNote {
+		bill.DocumentType = "credit_note"
+	}
+	if !doc.DueDate.IsZero() {
+		due := doc.DueDate
+		bill.DueDate = &due
+	}
+	// Amounts already settled by the sender (prepayments) reduce what is
+	// still owed.
+	paid := round2(doc.Prepaid)
+	if paid == 0 {
+		paid = round2(doc.GrandTotal - doc.DuePayable)
+	}
+	if paid > 0 {
+		bill.AmountPaid = paid
+		bill.Status = "partially_paid"
+		if doc.DuePayable <= 0 {
+			bill.Status = "paid"
+		}
+	}
+
+	for _, line := range doc.Lines {
+		bill.Items = append(bill.Items, models.BillItem{
+			Description: line.Description,
+			Quantity:    line.Quantity,
+			UnitPrice:   line.UnitPrice,
+			TaxRate:     line.TaxRate,
+			TotalPrice:  round2(line.NetAmount),
+		})
+	}
+
+	supplier := models.Supplier{
+		Name:        doc.Seller.Name,
+		Email:       doc.Seller.Email,
+		Address:     doc.Seller.AddressLine,
+		City:        doc.Seller.City,
+		PostalCode:  doc.Seller.PostalCode,
+		CountryCode: doc.Seller.CountryCode,
+		VATID:       doc.Seller.VATID,
+	}
+	return bill, supplier
+}
+
+// TaxCategory returns the UNCL 5305 VAT category for a rate.
+func TaxCategory(rate float64) string {
+	if rate > 0 {
+		return "S"
+	}
+	return "Z"
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// withinRounding reports whether two amounts differ by at most a cent, the
+// drift rounding per line or per total can introduce.
+func withinRounding(a, b float64) bool {
+	return math.Abs(a-b) < 0.015
+}
+
+// paymentTermsNote describes an invoice's payment terms and early payment
+// discount, empty when it has neither.
+func paymentTermsNote(invoice models.Invoice) string {
+	note := invoice.PaymentTerms
+	if invoice.DiscountPercent > 0 && invoice.DiscountDueDate != nil {
+		discount := fmt.Sprintf("%g%% discount if paid by %s", invoice.DiscountPercent, invoice.DiscountDueDate.Format("2006-01-02"))
+		if note == "" {
+			return discount
+		}
+		note += ", " + discount
+	}
+	return note
+}
@@ -0,0 +1,188 @@
+package einvoice
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"invoice-generator-go/config"
+	"invoice-generator-go/models"
+)
+
+func testInvoice() (models.Invoice, []models.InvoiceItem, models.CompanyProfile) {
+	config.LoadAppConfig()
+	invoice := models.Invoice{
+		InvoiceNumber:   "INV-0001",
+		BuyerReference:  "PO-42",
+		InvoiceDate:     time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		DueDate:         time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC),
+		Currency:        "€",
+		CustomerName:    "Buyer GmbH",
+		CustomerEmail:   "ap@buyer.example",
+		CustomerAddress: "Hauptstraße 1",
+		Subtotal:        150,
+		TaxRate:         19,
+		TaxAmount:       28.5,
+		TotalAmount:     178.5,
+	}
+	items := []models.InvoiceItem{
+		{Description: "Consulting", Quantity: 2, UnitPrice: 50, TotalPrice: 100},
+		{Description: "Travel", Quantity: 1, UnitPrice: 50, TotalPrice: 50},
+	}
+	seller := models.CompanyProfile{
+		CompanyName: "Seller SARL",
+		Email:       "billing@seller.example",
+		AddressLine: "1 rue de la Paix",
+		City:        "Paris",
+		PostalCode:  "75002",
+		CountryCode: "FR",
+		TaxID:       "FR12345678901",
+		IBAN:        "FR7630006000011234567890189",
+	}
+	return invoice, items, seller
+}
+
+func TestFromInvoiceUsesStoredTotals(t *testing.T) {
+	tests := []struct {
+		name       string
+		edit       func(*models.Invoice, *[]models.InvoiceItem)
+		grandTotal float64
+		prepaid    float64
+		duePayable float64
+		violations []string
+	}{
+		{
+			name:       "consistent",
+			grandTotal: 178.5, duePayable: 178.5,
+		},
+		{
+			name:       "partially paid",
+			edit:       func(inv *models.Invoice, _ *[]models.InvoiceItem) { inv.AmountPaid = 78.5 },
+			grandTotal: 178.5, prepaid: 78.5, duePayable: 100,
+		},
+		{
+			name: "a cent of rounding drift is kept",
+			edit: func(inv *models.Invoice, _ *[]models.InvoiceItem) {
+				inv.TaxAmount = 28.51
+				inv.TotalAmount = 178.51
+			},
+			grandTotal: 178.51, duePayable: 178.51,
+		},
+		{
+			name:       "no items",
+			edit:       func(_ *models.Invoice, items *[]models.InvoiceItem) { *items = nil },
+			grandTotal: 178.5, duePayable: 178.5,
+		},
+		{
+			name:       "items disagree with the subtotal",
+			edit:       func(_ *models.Invoice, items *[]models.InvoiceItem) { (*items)[1].TotalPrice = 60 },
+			grandTotal: 178.5, duePayable: 178.5,
+			violations: []string{"BR-CO-10"},
+		},
+		{
+			name:       "tax disagrees with the rate",
+			edit:       func(inv *models.Invoice, _ *[]models.InvoiceItem) { inv.TaxAmount = 30; inv.TotalAmount = 180 },
+			grandTotal: 180, duePayable: 180,
+			violations: []string{"BR-CO-17"},
+		},
+		{
+			name:       "total disagrees with subtotal plus tax",
+			edit:       func(inv *models.Invoice, _ *[]models.InvoiceItem) { inv.TotalAmount = 170 },
+			grandTotal: 170, duePayable: 170,
+			violations: []string{"BR-CO-15"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoice, items, seller := testInvoice()
+			if tt.edit != nil {
+				tt.edit(&invoice, &items)
+			}
+			doc, err := FromInvoice(invoice, items, seller)
+
+			var got []string
+			if err != nil {
+				verr, ok := err.(*ValidationError)
+				if !ok {
+					t.Fatalf("FromInvoice error = %v, want a *ValidationError", err)
+				}
+				for _, v := range verr.Violations {
+					got = append(got, v.Rule)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.violations, ",") {
+				t.Errorf("violations = %v, want %v", got, tt.violations)
+			}
+			if doc.GrandTotal != tt.grandTotal || doc.Prepaid != tt.prepaid || doc.DuePayable != tt.duePayable {
+				t.Errorf("totals = %.2f - %.2f = %.2f, want %.2f - %.2f = %.2f",
+					doc.GrandTotal, doc.Prepaid, doc.DuePayable, tt.grandTotal, tt.prepaid, tt.duePayable)
+			}
+			if doc.Currency != "EUR" {
+				t.Errorf("currency = %q, want EUR", doc.Currency)
+			}
+		})
+	}
+}
+
+func TestPrepaidAmountRoundTrips(t *testing.T) {
+	invoice, items, seller := testInvoice()
+	invoice.AmountPaid = 78.5
+	doc, err := FromInvoice(invoice, items, seller)
+	if err != nil {
+		t.Fatalf("FromInvoice: %v", err)
+	}
+	doc.Buyer.CountryCode = "DE"
+
+	for _, format := range []string{"ubl", "cii"} {
+		t.Run(format, func(t *testing.T) {
+			var data []byte
+			var err error
+			var violations []Violation
+			if format == "ubl" {
+				data, err = MarshalUBL(doc)
+				violations = CheckUBL(data)
+			} else {
+				data, err = MarshalCII(doc)
+				if verr, ok := CheckCIIStructure(data).(*ValidationError); ok {
+					violations = verr.Violations
+				}
+			}
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			if len(violations) > 0 {
+				t.Errorf("violations = %v", violations)
+			}
+			parsed, _, err := Parse(data)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if parsed.Prepaid != 78.5 || parsed.DuePayable != 100 {
+				t.Errorf("parsed prepaid %.2f due %.2f, want 78.50 and 100.00", parsed.Prepaid, parsed.DuePayable)
+			}
+			bill, _ := parsed.ToBill()
+			if bill.AmountPaid != 78.5 || bill.Status != "partially_paid" {
+				t.Errorf("bill paid %.2f status %q, want 78.50 partially_paid", bill.AmountPaid, bill.Status)
+			}
+		})
+	}
+}
+
+func TestCurrencyCode(t *testing.T) {
+	tests := map[string]string{
+		"$":     "USD",
+		" € ":   "EUR",
+		"£":     "GBP",
+		"¥":     "JPY",
+		"chf":   "CHF",
+		"EUR":   "EUR",
+		"":      "",
+		"euros": "EUROS",
+	}
+	for in, want := range tests {
+		if got := CurrencyCode(in); got != want {
+			t.Errorf("CurrencyCode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
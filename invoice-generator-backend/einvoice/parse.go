@@ -0,0 +1,331 @@
+package einvoice
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats recognised by Parse.
+const (
+	FormatUBL = "ubl"
+	FormatCII = "cii"
+)
+
+// importPrefixes covers both syntaxes so the root element can be inspected
+// before the format is known.
+var importPrefixes = map[string]string{
+	nsUBLInvoice:    "",
+	nsUBLCreditNote: "",
+	nsCAC:           "cac",
+	nsCBC:           "cbc",
+	nsRSM:           "rsm",
+	nsRAM:           "ram",
+	nsQDT:           "qdt",
+	nsUDT:           "udt",
+}
+
+// Parse reads an incoming UBL 2.1 Invoice/CreditNote or CII
+// CrossIndustryInvoice and returns it together with the detected format.
+// Only the fields needed to book the document as a purchase bill are read.
+func Parse(data []byte) (Document, string, error) {
+	root, err := parseXMLTree(data, importPrefixes)
+	if err != nil {
+		return Document{}, "", err
+	}
+
+	var (
+		doc    Document
+		format string
+	)
+	switch root.name {
+	case "Invoice":
+		doc, err = parseUBL(root, invoiceVariant)
+		format = FormatUBL
+	case "CreditNote":
+		doc, err = parseUBL(root, creditNoteVariant)
+		format = FormatUBL
+	case "rsm:CrossIndustryInvoice":
+		doc, err = parseCII(root)
+		format = FormatCII
+	default:
+		return Document{}, "", fmt.Errorf("unsupported document root %s, expected a UBL Invoice, UBL CreditNote or CII CrossIndustryInvoice", root.name)
+	}
+	if err != nil {
+		return Document{}, "", err
+	}
+
+	if err := requireFields(doc); err != nil {
+		return Document{}, "", err
+	}
+	return doc, format, nil
+}
+
+func parseUBL(root *xmlNode, v ublVariant) (Document, error) {
+	doc := Document{
+		Number:         root.value("cbc:ID"),
+		TypeCode:       root.value(v.typeCode),
+		BuyerReference: root.value("cbc:BuyerReference"),
+		Currency:       root.value("cbc:DocumentCurrencyCode"),
+		Note:           joinValues(root.findAll("cbc:Note")),
+		LineTotal:      root.amount("cac:LegalMonetaryTotal/cbc:LineExtensionAmount"),
+		GrandTotal:     root.amount("cac:LegalMonetaryTotal/cbc:TaxInclusiveAmount"),
+		Prepaid:        root.amount("cac:LegalMonetaryTotal/cbc:PrepaidAmount"),
+		DuePayable:     root.amount("cac:LegalMonetaryTotal/cbc:PayableAmount"),
+	}
+	if doc.TypeCode == "" {
+		doc.TypeCode = TypeCodeInvoice
+		if v == creditNoteVariant {
+			doc.TypeCode = TypeCodeCreditNote
+		}
+	}
+
+	var err error
+	if doc.IssueDate, err = parseDate(root.value("cbc:IssueDate"), "2006-01-02"); err != nil {
+		return Document{}, fmt.Errorf("invalid issue date: %v", err)
+	}
+	// Invoices carry the due date on the header, credit notes on the
+	// payment means.
+	due := root.value("cbc:DueDate")
+	if due == "" {
+		due = root.value("cac:PaymentMeans/cbc:PaymentDueDate")
+	}
+	if doc.DueDate, err = parseDate(due, "2006-01-02"); err != nil {
+		return Document{}, fmt.Errorf("invalid due date: %v", err)
+	}
+
+	if party := root.find("cac:AccountingSupplierParty/cac:Party"); party != nil {
+		doc.Seller = ublPartyOf(party)
+	}
+	if party := root.find("cac:AccountingCustomerParty/cac:Party"); party != nil {
+		doc.Buyer = ublPartyOf(party)
+	}
+
+	// A document may carry a second TaxTotal in the accounting currency
+	// without a breakdown; only the one in the document currency counts.
+	for _, total := range root.findAll("cac:TaxTotal") {
+		if amt := total.find("cbc:TaxAmount"); amt != nil && amt.attrs["currencyID"] != "" && amt.attrs["currencyID"] != doc.Currency {
+			continue
+		}
+		doc.TaxTotal += total.amount("cbc:TaxAmount")
+		for _, sub := range total.findAll("cac:TaxSubtotal") {
+			doc.Taxes = append(doc.Taxes, TaxSubtotal{
+				CategoryCode:  sub.value("cac:TaxCategory/cbc:ID"),
+				Rate:          sub.amount("cac:TaxCategory/cbc:Percent"),
+				TaxableAmount: sub.amount("cbc:TaxableAmount"),
+				TaxAmount:     sub.amount("cbc:TaxAmount"),
+			})
+		}
+	}
+
+	for _, line := range root.findAll(v.line) {
+		unitPrice := line.amount("cac:Price/cbc:PriceAmount")
+		if base := line.amount("cac:Price/cbc:BaseQuantity"); base > 0 {
+			unitPrice /= base
+		}
+		doc.Lines = append(doc.Lines, Line{
+			ID:          line.value("cbc:ID"),
+			Description: line.value("cac:Item/cbc:Name"),
+			Quantity:    line.amount(v.quantity),
+			UnitPrice:   unitPrice,
+			NetAmount:   line.amount("cbc:LineExtensionAmount"),
+			TaxRate:     line.amount("cac:Item/cac:ClassifiedTaxCategory/cbc:Percent"),
+		})
+	}
+
+	if pm := root.find("cac:PaymentMeans"); pm != nil {
+		doc.PaymentMeans = &PaymentMeans{
+			TypeCode: pm.value("cbc:PaymentMeansCode"),
+			IBAN:     pm.value("cac:PayeeFinancialAccount/cbc:ID"),
+			BIC:      pm.value("cac:PayeeFinancialAccount/cac:FinancialInstitutionBranch/cbc:ID"),
+		}
+	}
+
+	return doc, nil
+}
+
+func ublPartyOf(party *xmlNode) Party {
+	p := Party{
+		Name:        party.value("cac:PartyLegalEntity/cbc:RegistrationName"),
+		Email:       party.value("cac:Contact/cbc:ElectronicMail"),
+		AddressLine: party.value("cac:PostalAddress/cbc:StreetName"),
+		City:        party.value("cac:PostalAddress/cbc:CityName"),
+		PostalCode:  party.value("cac:PostalAddress/cbc:PostalZone"),
+		CountryCode: party.value("cac:PostalAddress/cac:Country/cbc:IdentificationCode"),
+	}
+	if p.Name == "" {
+		p.Name = party.value("cac:PartyName/cbc:Name")
+	}
+	if endpoint := party.find("cbc:EndpointID"); p.Email == "" && endpoint != nil && endpoint.attrs["schemeID"] == "EM" {
+		p.Email = strings.TrimSpace(endpoint.text)
+	}
+	for _, scheme := range party.findAll("cac:PartyTaxScheme") {
+		if scheme.value("cac:TaxScheme/cbc:ID") == "VAT" {
+			p.VATID = scheme.value("cbc:CompanyID")
+			break
+		}
+	}
+	return p
+}
+
+func parseCII(root *xmlNode) (Document, error) {
+	header := root.find("rsm:ExchangedDocument")
+	tx := root.find("rsm:SupplyChainTradeTransaction")
+	if header == nil || tx == nil {
+		return Document{}, fmt.Errorf("CII document is missing ExchangedDocument or SupplyChainTradeTransaction")
+	}
+	agreement := tx.find("ram:ApplicableHeaderTradeAgreement")
+	settlement := tx.find("ram:ApplicableHeaderTradeSettlement")
+	if agreement == nil || settlement == nil {
+		return Document{}, fmt.Errorf("CII document is missing the header trade agreement or settlement")
+	}
+
+	doc := Document{
+		Number:         header.value("ram:ID"),
+		TypeCode:       header.value("ram:TypeCode"),
+		Note:           joinValues(header.findAll("ram:IncludedNote/ram:Content")),
+		BuyerReference: agreement.value("ram:BuyerReference"),
+		Currency:       settlement.value("ram:InvoiceCurrencyCode"),
+		LineTotal:      settlement.amount("ram:SpecifiedTradeSettlementHeaderMonetarySummation/ram:LineTotalAmount"),
+		GrandTotal:     settlement.amount("ram:SpecifiedTradeSettlementHeaderMonetarySummation/ram:GrandTotalAmount"),
+		Prepaid:        settlement.amount("ram:SpecifiedTradeSettlementHeaderMonetarySummation/ram:TotalPrepaidAmount"),
+		DuePayable:     settlement.amount("ram:SpecifiedTradeSettlementHeaderMonetarySummation/ram:DuePayableAmount"),
+	}
+
+	var err error
+	if doc.IssueDate, err = parseDate(header.value("ram:IssueDateTime/udt:DateTimeString"), "20060102"); err != nil {
+		return Document{}, fmt.Errorf("invalid issue date: %v", err)
+	}
+	if doc.DueDate, err = parseDate(settlement.value("ram:SpecifiedTradePaymentTerms/ram:DueDateDateTime/udt:DateTimeString"), "20060102"); err != nil {
+		return Document{}, fmt.Errorf("invalid due date: %v", err)
+	}
+
+	if party := agreement.find("ram:SellerTradeParty"); party != nil {
+		doc.Seller = ciiPartyOf(party)
+	}
+	if party := agreement.find("ram:BuyerTradeParty"); party != nil {
+		doc.Buyer = ciiPartyOf(party)
+	}
+
+	// TaxTotalAmount repeats when the tax currency differs; take the one in
+	// the invoice currency.
+	for _, total := range settlement.findAll("ram:SpecifiedTradeSettlementHeaderMonetarySummation/ram:TaxTotalAmount") {
+		if cur := total.attrs["currencyID"]; cur == "" || cur == doc.Currency {
+			doc.TaxTotal, _ = strconv.ParseFloat(strings.TrimSpace(total.text), 64)
+			break
+		}
+	}
+	for _, tax := range settlement.findAll("ram:ApplicableTradeTax") {
+		doc.Taxes = append(doc.Taxes, TaxSubtotal{
+			CategoryCode:  tax.value("ram:CategoryCode"),
+			Rate:          tax.amount("ram:RateApplicablePercent"),
+			TaxableAmount: tax.amount("ram:BasisAmount"),
+			TaxAmount:     tax.amount("ram:CalculatedAmount"),
+		})
+	}
+
+	for _, item := range tx.findAll("ram:IncludedSupplyChainTradeLineItem") {
+		unitPrice := item.amount("ram:SpecifiedLineTradeAgreement/ram:NetPriceProductTradePrice/ram:ChargeAmount")
+		if base := item.amount("ram:SpecifiedLineTradeAgreement/ram:NetPriceProductTradePrice/ram:BasisQuantity"); base > 0 {
+			unitPrice /= base
+		}
+		doc.Lines = append(doc.Lines, Line{
+			ID:          item.value("ram:AssociatedDocumentLineDocument/ram:LineID"),
+			Description: item.value("ram:SpecifiedTradeProduct/ram:Name"),
+			Quantity:    item.amount("ram:SpecifiedLineTradeDelivery/ram:BilledQuantity"),
+			UnitPrice:   unitPrice,
+			NetAmount:   item.amount("ram:SpecifiedLineTradeSettlement/ram:SpecifiedTradeSettlementLineMonetarySummation/ram:LineTotalAmount"),
+			TaxRate:     item.amount("ram:SpecifiedLineTradeSettlement/ram:ApplicableTradeTax/ram:RateApplicablePercent"),
+		})
+	}
+
+	if pm := settlement.find("ram:SpecifiedTradeSettlementPaymentMeans"); pm != nil {
+		doc.PaymentMeans = &PaymentMeans{
+			TypeCode: pm.value("ram:TypeCode"),
+			IBAN:     pm.value("ram:PayeePartyCreditorFinancialAccount/ram:IBANID"),
+			BIC:      pm.value("ram:PayeeSpecifiedCreditorFinancialInstitution/ram:BICID"),
+		}
+	}
+
+	return doc, nil
+}
+
+func ciiPartyOf(party *xmlNode) Party {
+	p := Party{
+		Name:        party.value("ram:Name"),
+		Email:       party.value("ram:URIUniversalCommunication/ram:URIID"),
+		AddressLine: party.value("ram:PostalTradeAddress/ram:LineOne"),
+		City:        party.value("ram:PostalTradeAddress/ram:CityName"),
+		PostalCode:  party.value("ram:PostalTradeAddress/ram:PostcodeCode"),
+		CountryCode: party.value("ram:PostalTradeAddress/ram:CountryID"),
+	}
+	for _, reg := range party.findAll("ram:SpecifiedTaxRegistration/ram:ID") {
+		if reg.attrs["schemeID"] == "VA" {
+			p.VATID = strings.TrimSpace(reg.text)
+			break
+		}
+	}
+	return p
+}
+
+// requireFields rejects documents that lack the data a bill cannot be
+// booked without.
+func requireFields(doc Document) error {
+	var missing []string
+	if doc.Number == "" {
+		missing = append(missing, "document number")
+	}
+	if doc.IssueDate.IsZero() {
+		missing = append(missing, "issue date")
+	}
+	if !currencyCodeRe.MatchString(doc.Currency) {
+		missing = append(missing, "ISO 4217 currency code")
+	}
+	if doc.Seller.Name == "" {
+		missing = append(missing, "seller name")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("document is missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Check reports arithmetic inconsistencies in a parsed document. The
+// problems are not fatal for an import but worth showing to the user.
+func (doc Document) Check() []Violation {
+	var violations []Violation
+	var lineSum float64
+	for _, line := range doc.Lines {
+		lineSum += line.NetAmount
+	}
+	if len(doc.Lines) == 0 {
+		violations = append(violations, Violation{Rule: "BR-16", Message: "Document has no invoice lines"})
+	} else if !equalAmounts(lineSum, doc.LineTotal) {
+		violations = append(violations, Violation{Rule: "BR-CO-10", Message: fmt.Sprintf("Sum of line net amounts %.2f differs from the line total %.2f", lineSum, doc.LineTotal)})
+	}
+	if !equalAmounts(doc.LineTotal+doc.TaxTotal, doc.GrandTotal) {
+		violations = append(violations, Violation{Rule: "BR-CO-15", Message: fmt.Sprintf("Grand total %.2f differs from line total plus tax %.2f", doc.GrandTotal, doc.LineTotal+doc.TaxTotal)})
+	}
+	if doc.DuePayable > doc.GrandTotal+0.005 {
+		violations = append(violations, Violation{Rule: "BR-CO-16", Message: "Amount due exceeds the grand total"})
+	}
+	return violations
+}
+
+func parseDate(value, layout string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(layout, value)
+}
+
+func joinValues(nodes []*xmlNode) string {
+	values := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		if v := strings.TrimSpace(n.text); v != "" {
+			values = append(values, v)
+		}
+	}
+	return strings.Join(values, "\n")
+}
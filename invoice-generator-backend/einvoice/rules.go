@@ -0,0 +1,289 @@
+package einvoice
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ublPrefixes maps UBL namespaces to the prefixes used by the rule paths.
+// Both document roots map to the empty prefix.
+var ublPrefixes = map[string]string{
+	nsUBLInvoice:    "",
+	nsUBLCreditNote: "",
+	nsCAC:           "cac",
+	nsCBC:           "cbc",
+}
+
+// find returns the first descendant matching a slash separated path.
+func (n *xmlNode) find(path string) *xmlNode {
+	all := n.findAll(path)
+	if len(all) == 0 {
+		return nil
+	}
+	return all[0]
+}
+
+// findAll returns every descendant matching a slash separated path.
+func (n *xmlNode) findAll(path string) []*xmlNode {
+	nodes := []*xmlNode{n}
+	for _, step := range strings.Split(path, "/") {
+		var next []*xmlNode
+		for _, node := range nodes {
+			for _, child := range node.children {
+				if child.name == step {
+					next = append(next, child)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// value returns the trimmed text of the node at path, or "" if absent.
+func (n *xmlNode) value(path string) string {
+	if node := n.find(path); node != nil {
+		return strings.TrimSpace(node.text)
+	}
+	return ""
+}
+
+func (n *xmlNode) amount(path string) float64 {
+	v, _ := strconv.ParseFloat(n.value(path), 64)
+	return v
+}
+
+// Rule is a single business rule check, in the spirit of the EN 16931 and
+// Peppol schematron rules it is named after.
+type Rule struct {
+	ID      string
+	Message string
+	check   func(doc *xmlNode, v ublVariant) bool
+}
+
+// ublVariant captures the element names that differ between UBL Invoice
+// and CreditNote documents.
+type ublVariant struct {
+	typeCode string
+	line     string
+	quantity string
+}
+
+var (
+	invoiceVariant    = ublVariant{typeCode: "cbc:InvoiceTypeCode", line: "cac:InvoiceLine", quantity: "cbc:InvoicedQuantity"}
+	creditNoteVariant = ublVariant{typeCode: "cbc:CreditNoteTypeCode", line: "cac:CreditNoteLine", quantity: "cbc:CreditedQuantity"}
+
+	currencyCodeRe = regexp.MustCompile(`^[A-Z]{3}$`)
+	countryCodeRe  = regexp.MustCompile(`^[A-Z]{2}$`)
+	dateRe         = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+)
+
+func present(path string) func(*xmlNode, ublVariant) bool {
+	return func(doc *xmlNode, _ ublVariant) bool { return doc.value(path) != "" }
+}
+
+func equalAmounts(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
+}
+
+// PeppolRules are the offline checks applied to UBL documents. They cover
+// the EN 16931 core rules relevant to the data this application produces
+// and the Peppol BIS Billing 3.0 additions.
+var PeppolRules = []Rule{
+	{ID: "BR-01", Message: "An Invoice shall have a Specification identifier (BT-24)", check: present("cbc:CustomizationID")},
+	{ID: "BR-02", Message: "An Invoice shall have an Invoice number (BT-1)", check: present("cbc:ID")},
+	{ID: "BR-03", Message: "An Invoice shall have an Invoice issue date (BT-2) in YYYY-MM-DD format", check: func(doc *xmlNode, _ ublVariant) bool {
+		return dateRe.MatchString(doc.value("cbc:IssueDate"))
+	}},
+	{ID: "BR-04", Message: "An Invoice shall have an Invoice type code (BT-3)", check: func(doc *xmlNode, v ublVariant) bool {
+		return doc.value(v.typeCode) != ""
+	}},
+	{ID: "BR-05", Message: "An Invoice shall have an Invoice currency code (BT-5)", check: present("cbc:DocumentCurrencyCode")},
+	{ID: "BR-CL-04", Message: "Invoice currency code (BT-5) shall be an ISO 4217 alpha-3 code", check: func(doc *xmlNode, _ ublVariant) bool {
+		return currencyCodeRe.MatchString(doc.value("cbc:DocumentCurrencyCode"))
+	}},
+	{ID: "BR-06", Message: "An Invoice shall contain the Seller name (BT-27)", check: present("cac:AccountingSupplierParty/cac:Party/cac:PartyLegalEntity/cbc:RegistrationName")},
+	{ID: "BR-07", Message: "An Invoice shall contain the Buyer name (BT-44)", check: present("cac:AccountingCustomerParty/cac:Party/cac:PartyLegalEntity/cbc:RegistrationName")},
+	{ID: "BR-08", Message: "An Invoice shall contain the Seller postal address (BG-5)", check: func(doc *xmlNode, _ ublVariant) bool {
+		return doc.find("cac:AccountingSupplierParty/cac:Party/cac:PostalAddress") != nil
+	}},
+	{ID: "BR-09", Message: "The Seller postal address (BG-5) shall contain a Seller country code (BT-40)", check: func(doc *xmlNode, _ ublVariant) bool {
+		return countryCodeRe.MatchString(doc.value("cac:AccountingSupplierParty/cac:Party/cac:PostalAddress/cac:Country/cbc:IdentificationCode"))
+	}},
+	{ID: "BR-10", Message: "An Invoice shall contain the Buyer postal address (BG-8)", check: func(doc *xmlNode, _ ublVariant) bool {
+		return doc.find("cac:AccountingCustomerParty/cac:Party/cac:PostalAddress") != nil
+	}},
+	{ID: "BR-11", Message: "The Buyer postal address (BG-8) shall contain a Buyer country code (BT-55)", check: func(doc *xmlNode, _ ublVariant) bool {
+		return countryCodeRe.MatchString(doc.value("cac:AccountingCustomerParty/cac:Party/cac:PostalAddress/cac:Country/cbc:IdentificationCode"))
+	}},
+	{ID: "BR-12", Message: "An Invoice shall have the Sum of Invoice line net amount (BT-106)", check: present("cac:LegalMonetaryTotal/cbc:LineExtensionAmount")},
+	{ID: "BR-13", Message: "An Invoice shall have the Invoice total amount without VAT (BT-109)", check: present("cac:LegalMonetaryTotal/cbc:TaxExclusiveAmount")},
+	{ID: "BR-14", Message: "An Invoice shall have the Invoice total amount with VAT (BT-112)", check: present("cac:LegalMonetaryTotal/cbc:TaxInclusiveAmount")},
+	{ID: "BR-15", Message: "An Invoice shall have the Amount due for payment (BT-115)", check: present("cac:LegalMonetaryTotal/cbc:PayableAmount")},
+	{ID: "BR-16", Message: "An Invoice shall have at least one Invoice line (BG-25)", check: func(doc *xmlNode, v ublVariant) bool {
+		return len(doc.findAll(v.line)) > 0
+	}},
+	{ID: "BR-21", Message: "Each Invoice line (BG-25) shall have an Invoice line identifier (BT-126)", check: eachLine(func(line *xmlNode, _ ublVariant) bool {
+		return line.value("cbc:ID") != ""
+	})},
+	{ID: "BR-22", Message: "Each Invoice line (BG-25) shall have an Invoiced quantity (BT-129)", check: eachLine(func(line *xmlNode, v ublVariant) bool {
+		return line.value(v.quantity) != ""
+	})},
+	{ID: "BR-24", Message: "Each Invoice line (BG-25) shall have an Invoice line net amount (BT-131)", check: eachLine(func(line *xmlNode, _ ublVariant) bool {
+		return line.value("cbc:LineExtensionAmount") != ""
+	})},
+	{ID: "BR-25", Message: "Each Invoice line (BG-25) shall contain the Item name (BT-153)", check: eachLine(func(line *xmlNode, _ ublVariant) bool {
+		return line.value("cac:Item/cbc:Name") != ""
+	})},
+	{ID: "BR-26", Message: "Each Invoice line (BG-25) shall contain the Item net price (BT-146)", check: eachLine(func(line *xmlNode, _ ublVariant) bool {
+		return line.value("cac:Price/cbc:PriceAmount") != ""
+	})},
+	{ID: "BR-27", Message: "The Item net price (BT-146) shall NOT be negative", check: eachLine(func(line *xmlNode, _ ublVariant) bool {
+		return line.amount("cac:Price/cbc:PriceAmount") >= 0
+	})},
+	{ID: "BR-CO-10", Message: "Sum of Invoice line net amount (BT-106) = Σ Invoice line net amount (BT-131)", check: func(doc *xmlNode, v ublVariant) bool {
+		var sum float64
+		for _, line := range doc.findAll(v.line) {
+			sum += line.amount("cbc:LineExtensionAmount")
+		}
+		return equalAmounts(sum, doc.amount("cac:LegalMonetaryTotal/cbc:LineExtensionAmount"))
+	}},
+	{ID: "BR-CO-13", Message: "Invoice total amount without VAT (BT-109) = Σ Invoice line net amount (BT-131) - Sum of allowances (BT-107) + Sum of charges (BT-108)", check: func(doc *xmlNode, _ ublVariant) bool {
+		total := doc.find("cac:LegalMonetaryTotal")
+		if total == nil {
+			return false
+		}
+		expected := total.amount("cbc:LineExtensionAmount") - total.amount("cbc:AllowanceTotalAmount") + total.amount("cbc:ChargeTotalAmount")
+		return equalAmounts(expected, total.amount("cbc:TaxExclusiveAmount"))
+	}},
+	{ID: "BR-CO-15", Message: "Invoice total amount with VAT (BT-112) = Invoice total amount without VAT (BT-109) + Invoice total VAT amount (BT-110)", check: func(doc *xmlNode, _ ublVariant) bool {
+		return equalAmounts(doc.amount("cac:LegalMonetaryTotal/cbc:TaxExclusiveAmount")+doc.amount("cac:TaxTotal/cbc:TaxAmount"),
+			doc.amount("cac:LegalMonetaryTotal/cbc:TaxInclusiveAmount"))
+	}},
+	{ID: "BR-CO-16", Message: "Amount due for payment (BT-115) = Invoice total amount with VAT (BT-112) - Paid amount (BT-113) + Rounding amount (BT-114)", check: func(doc *xmlNode, _ ublVariant) bool {
+		total := doc.find("cac:LegalMonetaryTotal")
+		if total == nil {
+			return false
+		}
+		expected := total.amount("cbc:TaxInclusiveAmount") - total.amount("cbc:PrepaidAmount") + total.amount("cbc:PayableRoundingAmount")
+		return equalAmounts(expected, total.amount("cbc:PayableAmount"))
+	}},
+	{ID: "BR-CO-14", Message: "Invoice total VAT amount (BT-110) = Σ VAT category tax amount (BT-117)", check: func(doc *xmlNode, _ ublVariant) bool {
+		var sum float64
+		for _, sub := range doc.findAll("cac:TaxTotal/cac:TaxSubtotal") {
+			sum += sub.amount("cbc:TaxAmount")
+		}
+		return equalAmounts(sum, doc.amount("cac:TaxTotal/cbc:TaxAmount"))
+	}},
+	{ID: "BR-CO-17", Message: "VAT category tax amount (BT-117) = VAT category taxable amount (BT-116) x (VAT category rate (BT-119) / 100), rounded to two decimals", check: func(doc *xmlNode, _ ublVariant) bool {
+		for _, sub := range doc.findAll("cac:TaxTotal/cac:TaxSubtotal") {
+			expected := round2(sub.amount("cbc:TaxableAmount") * sub.amount("cac:TaxCategory/cbc:Percent") / 100)
+			if !equalAmounts(expected, sub.amount("cbc:TaxAmount")) {
+				return false
+			}
+		}
+		return true
+	}},
+	{ID: "BR-CO-18", Message: "An Invoice shall at least have one VAT breakdown group (BG-23)", check: func(doc *xmlNode, _ ublVariant) bool {
+		return len(doc.findAll("cac:TaxTotal/cac:TaxSubtotal")) > 0
+	}},
+	{ID: "BR-CO-25", Message: "In case the Amount due for payment (BT-115) is positive, either the Payment due date (BT-9) or the Payment terms (BT-20) shall be present", check: func(doc *xmlNode, _ ublVariant) bool {
+		if doc.amount("cac:LegalMonetaryTotal/cbc:PayableAmount") <= 0 {
+			return true
+		}
+		return doc.value("cbc:DueDate") != "" || doc.value("cac:PaymentTerms/cbc:Note") != ""
+	}},
+	{ID: "BR-S-02", Message: "An Invoice that contains an Invoice line where the Invoiced item VAT category code is \"Standard rated\" shall contain the Seller VAT Identifier (BT-31)", check: func(doc *xmlNode, v ublVariant) bool {
+		for _, line := range doc.findAll(v.line) {
+			if line.value("cac:Item/cac:ClassifiedTaxCategory/cbc:ID") == "S" {
+				return doc.value("cac:AccountingSupplierParty/cac:Party/cac:PartyTaxScheme/cbc:CompanyID") != ""
+			}
+		}
+		return true
+	}},
+	{ID: "BR-61", Message: "If the Payment means type code (BT-81) means SEPA credit transfer, Local credit transfer or Non-SEPA international credit transfer, the Payment account identifier (BT-84) shall be present", check: func(doc *xmlNode, _ ublVariant) bool {
+		for _, pm := range doc.findAll("cac:PaymentMeans") {
+			switch pm.value("cbc:PaymentMeansCode") {
+			case "30", "58":
+				if pm.value("cac:PayeeFinancialAccount/cbc:ID") == "" {
+					return false
+				}
+			}
+		}
+		return true
+	}},
+	{ID: "PEPPOL-EN16931-R001", Message: "Business process MUST be provided", check: present("cbc:ProfileID")},
+	{ID: "PEPPOL-EN16931-R003", Message: "A buyer reference or purchase order reference MUST be provided", check: func(doc *xmlNode, _ ublVariant) bool {
+		return doc.value("cbc:BuyerReference") != "" || doc.value("cac:OrderReference/cbc:ID") != ""
+	}},
+	{ID: "PEPPOL-EN16931-R004", Message: "Specification identifier MUST have the value 'urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0'", check: func(doc *xmlNode, _ ublVariant) bool {
+		return doc.value("cbc:CustomizationID") == PeppolCustomizationID
+	}},
+	{ID: "PEPPOL-EN16931-R010", Message: "Buyer electronic address MUST be provided", check: present("cac:AccountingCustomerParty/cac:Party/cbc:EndpointID")},
+	{ID: "PEPPOL-EN16931-R020", Message: "Seller electronic address MUST be provided", check: present("cac:AccountingSupplierParty/cac:Party/cbc:EndpointID")},
+	{ID: "PEPPOL-EN16931-R053", Message: "Only one tax total with tax subtotals MUST be provided", check: func(doc *xmlNode, _ ublVariant) bool {
+		withSubtotals := 0
+		for _, total := range doc.findAll("cac:TaxTotal") {
+			if len(total.findAll("cac:TaxSubtotal")) > 0 {
+				withSubtotals++
+			}
+		}
+		return withSubtotals == 1
+	}},
+	{ID: "PEPPOL-EN16931-P0100", Message: "Invoice type code MUST be set according to the profile (380, 381, 383, 384, 386, 389, 751)", check: func(doc *xmlNode, v ublVariant) bool {
+		switch doc.value(v.typeCode) {
+		case "380", "381", "383", "384", "386", "389", "751":
+			return true
+		}
+		return false
+	}},
+}
+
+func eachLine(check func(line *xmlNode, v ublVariant) bool) func(*xmlNode, ublVariant) bool {
+	return func(doc *xmlNode, v ublVariant) bool {
+		for _, line := range doc.findAll(v.line) {
+			if !check(line, v) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// CheckUBL runs the Peppol BIS Billing 3.0 rules against a UBL Invoice or
+// CreditNote and returns the rules that fail.
+func CheckUBL(data []byte) []Violation {
+	doc, err := parseXMLTree(data, ublPrefixes)
+	if err != nil {
+		return []Violation{{Rule: "XML", Message: err.Error()}}
+	}
+
+	var variant ublVariant
+	switch doc.name {
+	case "Invoice":
+		variant = invoiceVariant
+	case "CreditNote":
+		variant = creditNoteVariant
+	default:
+		return []Violation{{Rule: "UBL", Message: fmt.Sprintf("unexpected root element %s, expected Invoice or CreditNote", doc.name)}}
+	}
+
+	var violations []Violation
+	for _, rule := range PeppolRules {
+		if !rule.check(doc, variant) {
+			violations = append(violations, Violation{Rule: rule.ID, Message: rule.Message})
+		}
+	}
+	return violations
+}
+
+// ValidateUBL is CheckUBL returning a *ValidationError when any rule fails.
+func ValidateUBL(data []byte) error {
+	if violations := CheckUBL(data); len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
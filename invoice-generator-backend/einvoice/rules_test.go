@@ -0,0 +1,76 @@
+package einvoice
+
+import (
+	"strings"
+	"testing"
+)
+
+func testUBL(t *testing.T, creditNote bool) string {
+	t.Helper()
+	invoice, items, seller := testInvoice()
+	if creditNote {
+		invoice.DocumentType = "credit_note"
+	}
+	doc, err := FromInvoice(invoice, items, seller)
+	if err != nil {
+		t.Fatalf("FromInvoice: %v", err)
+	}
+	doc.Buyer.CountryCode = "DE"
+	data, err := MarshalUBL(doc)
+	if err != nil {
+		t.Fatalf("MarshalUBL: %v", err)
+	}
+	return string(data)
+}
+
+func TestCheckUBL(t *testing.T) {
+	tests := []struct {
+		name       string
+		creditNote bool
+		old, new   string
+		want       []string
+	}{
+		{name: "valid invoice"},
+		{name: "valid credit note", creditNote: true},
+		{name: "missing number", old: "<cbc:ID>INV-0001</cbc:ID>", new: "", want: []string{"BR-02"}},
+		{name: "bad issue date", old: "2026-03-01", new: "01.03.2026", want: []string{"BR-03"}},
+		{name: "currency symbol", old: "<cbc:DocumentCurrencyCode>EUR<", new: "<cbc:DocumentCurrencyCode>€<", want: []string{"BR-CL-04"}},
+		{name: "seller country", old: "<cbc:IdentificationCode>FR<", new: "<cbc:IdentificationCode>France<", want: []string{"BR-09"}},
+		{name: "line sum", old: `<cbc:LineExtensionAmount currencyID="EUR">50.00<`, new: `<cbc:LineExtensionAmount currencyID="EUR">60.00<`, want: []string{"BR-CO-10"}},
+		{name: "grand total", old: `<cbc:TaxInclusiveAmount currencyID="EUR">178.50<`, new: `<cbc:TaxInclusiveAmount currencyID="EUR">180.00<`, want: []string{"BR-CO-15", "BR-CO-16"}},
+		{name: "prepaid amount", old: "<cbc:PayableAmount", new: `<cbc:PrepaidAmount currencyID="EUR">78.50</cbc:PrepaidAmount><cbc:PayableAmount`, want: []string{"BR-CO-16"}},
+		{name: "tax rate", old: "<cbc:Percent>19.00</cbc:Percent>", new: "<cbc:Percent>20.00</cbc:Percent>", want: []string{"BR-CO-17"}},
+		{name: "seller VAT ID", old: "<cbc:CompanyID>FR12345678901</cbc:CompanyID>", new: "", want: []string{"BR-S-02"}},
+		{name: "missing account", old: "<cbc:ID>FR7630006000011234567890189</cbc:ID>", new: "", want: []string{"BR-61"}},
+		{name: "no buyer reference", old: "<cbc:BuyerReference>PO-42</cbc:BuyerReference>", new: "", want: []string{"PEPPOL-EN16931-R003"}},
+		{name: "wrong customization", old: "poacc:billing:3.0<", new: "poacc:billing:2.0<", want: []string{"PEPPOL-EN16931-R004"}},
+		{name: "type code", old: "<cbc:InvoiceTypeCode>380<", new: "<cbc:InvoiceTypeCode>999<", want: []string{"PEPPOL-EN16931-P0100"}},
+		{name: "credit note type code", creditNote: true, old: "<cbc:CreditNoteTypeCode>381<", new: "<cbc:CreditNoteTypeCode>999<", want: []string{"PEPPOL-EN16931-P0100"}},
+		{name: "unexpected root", old: "", new: "", want: []string{"UBL"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testUBL(t, tt.creditNote)
+			if tt.name == "unexpected root" {
+				data = `<Order xmlns="urn:oasis:names:specification:ubl:schema:xsd:Order-2"/>`
+			} else if tt.old != "" {
+				if !strings.Contains(data, tt.old) {
+					t.Fatalf("document lacks %q", tt.old)
+				}
+				data = strings.Replace(data, tt.old, tt.new, -1)
+			}
+
+			var got []string
+			for _, v := range CheckUBL([]byte(data)) {
+				got = append(got, v.Rule)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("failed rules = %v, want %v", got, tt.want)
+			}
+			if err := ValidateUBL([]byte(data)); (err != nil) != (len(tt.want) > 0) {
+				t.Errorf("ValidateUBL = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package einvoice
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//go:embed structure/*.structure
+var structureFS embed.FS
+
+// Violation is a single problem found while validating an e-invoice.
+type Violation struct {
+	Rule    string `json:"rule,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	if v.Rule != "" {
+		return fmt.Sprintf("[%s] %s", v.Rule, v.Message)
+	}
+	return fmt.Sprintf("%s: %s", v.Path, v.Message)
+}
+
+// ValidationError is returned when a document fails validation.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, v.String())
+	}
+	return fmt.Sprintf("e-invoice validation failed: %s", strings.Join(msgs, "; "))
+}
+
+// structureElement is one element declaration from a bundled .structure file.
+type structureElement struct {
+	path     string
+	min, max int // max < 0 means unbounded
+	pattern  *regexp.Regexp
+	children []*structureElement
+}
+
+// Structure is a compiled outline of the elements a document may contain,
+// their order, cardinality and value patterns. Checking a document against
+// it catches mistakes in the writers before a document is embedded or
+// exported. It is a sanity check and not schema validation: the outlines are
+// maintained by hand, cover only the elements this application uses, and a
+// document that passes may still be rejected by the official XSD.
+type Structure struct {
+	root     *structureElement
+	prefixes map[string]string // namespace URI -> prefix used in the outline
+}
+
+var ciiStructure = mustLoadStructure("structure/cii-en16931.structure", map[string]string{
+	nsRSM: "rsm",
+	nsRAM: "ram",
+	nsQDT: "qdt",
+	nsUDT: "udt",
+})
+
+func mustLoadStructure(name string, prefixes map[string]string) *Structure {
+	data, err := structureFS.ReadFile(name)
+	if err != nil {
+		panic(fmt.Sprintf("einvoice: missing bundled structure %s: %v", name, err))
+	}
+	s, err := parseStructure(data, prefixes)
+	if err != nil {
+		panic(fmt.Sprintf("einvoice: invalid bundled structure %s: %v", name, err))
+	}
+	return s
+}
+
+func parseStructure(data []byte, prefixes map[string]string) (*Structure, error) {
+	s := &Structure{prefixes: prefixes}
+	byPath := map[string]*structureElement{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 || len(fields) > 4 {
+			return nil, fmt.Errorf("line %d: expected <path> <min> <max> [pattern]", lineNo)
+		}
+
+		el := &structureElement{path: fields[0]}
+		var err error
+		if el.min, err = strconv.Atoi(fields[1]); err != nil {
+			return nil, fmt.Errorf("line %d: invalid min: %v", lineNo, err)
+		}
+		if fields[2] == "n" {
+			el.max = -1
+		} else if el.max, err = strconv.Atoi(fields[2]); err != nil {
+			return nil, fmt.Errorf("line %d: invalid max: %v", lineNo, err)
+		}
+		if len(fields) == 4 {
+			if el.pattern, err = regexp.Compile("^(?:" + fields[3] + ")$"); err != nil {
+				return nil, fmt.Errorf("line %d: invalid pattern: %v", lineNo, err)
+			}
+		}
+
+		parentPath := ""
+		if i := strings.LastIndex(el.path, "/"); i >= 0 {
+			parentPath = el.path[:i]
+		}
+		if parentPath == "" {
+			if s.root != nil {
+				return nil, fmt.Errorf("line %d: structure has more than one root", lineNo)
+			}
+			s.root = el
+		} else {
+			parent, ok := byPath[parentPath]
+			if !ok {
+				return nil, fmt.Errorf("line %d: parent %s not declared", lineNo, parentPath)
+			}
+			parent.children = append(parent.children, el)
+		}
+		byPath[el.path] = el
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if s.root == nil {
+		return nil, fmt.Errorf("structure is empty")
+	}
+	return s, nil
+}
+
+// xmlNode is a minimal DOM used by the structure check, the rules and the
+// importers.
+type xmlNode struct {
+	name     string // prefix:local using the outline's prefixes
+	attrs    map[string]string
+	text     string
+	children []*xmlNode
+}
+
+func parseXMLTree(data []byte, prefixes map[string]string) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*xmlNode
+	var root *xmlNode
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed XML: %v", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: qualifiedName(t.Name, prefixes), attrs: map[string]string{}}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+					continue
+				}
+				node.attrs[a.Name.Local] = a.Value
+			}
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, fmt.Errorf("malformed XML: multiple root elements")
+				}
+				root = node
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("malformed XML: no root element")
+	}
+	return root, nil
+}
+
+func qualifiedName(name xml.Name, prefixes map[string]string) string {
+	if prefix, ok := prefixes[name.Space]; ok {
+		if prefix == "" {
+			return name.Local
+		}
+		return prefix + ":" + name.Local
+	}
+	if name.Space == "" {
+		return name.Local
+	}
+	return "{" + name.Space + "}" + name.Local
+}
+
+// Check compares an XML document with the outline and returns every
+// deviation found. A nil result means none were found.
+func (s *Structure) Check(data []byte) []Violation {
+	root, err := parseXMLTree(data, s.prefixes)
+	if err != nil {
+		return []Violation{{Message: err.Error()}}
+	}
+	if root.name != s.root.path {
+		return []Violation{{Path: root.name, Message: fmt.Sprintf("root element must be %s", s.root.path)}}
+	}
+	var violations []Violation
+	s.checkNode(root, s.root, root.name, &violations)
+	return violations
+}
+
+func (s *Structure) checkNode(node *xmlNode, decl *structureElement, path string, violations *[]Violation) {
+	if decl.pattern != nil {
+		text := strings.TrimSpace(node.text)
+		if !decl.pattern.MatchString(text) {
+			*violations = append(*violations, Violation{Path: path, Message: fmt.Sprintf("value %q does not match %s", text, decl.pattern.String())})
+		}
+	}
+
+	counts := make(map[*structureElement]int)
+	lastIndex := -1
+	for _, child := range node.children {
+		idx, childDecl := -1, (*structureElement)(nil)
+		for i, c := range decl.children {
+			if c.path[strings.LastIndex(c.path, "/")+1:] == child.name {
+				idx, childDecl = i, c
+				break
+			}
+		}
+		childPath := path + "/" + child.name
+		if childDecl == nil {
+			*violations = append(*violations, Violation{Path: childPath, Message: "element is not allowed here"})
+			continue
+		}
+		if idx < lastIndex {
+			*violations = append(*violations, Violation{Path: childPath, Message: "element is out of order"})
+		}
+		lastIndex = idx
+		counts[childDecl]++
+		s.checkNode(child, childDecl, childPath, violations)
+	}
+
+	for _, c := range decl.children {
+		n := counts[c]
+		name := path + "/" + c.path[strings.LastIndex(c.path, "/")+1:]
+		if n < c.min {
+			*violations = append(*violations, Violation{Path: name, Message: "required element is missing"})
+		}
+		if c.max >= 0 && n > c.max {
+			*violations = append(*violations, Violation{Path: name, Message: fmt.Sprintf("element occurs %d times, at most %d allowed", n, c.max)})
+		}
+	}
+}
+
+// CheckCIIStructure compares a Cross Industry Invoice with the bundled
+// outline of the Factur-X EN 16931 profile. See Structure for what this does
+// and does not establish.
+func CheckCIIStructure(data []byte) error {
+	if violations := ciiStructure.Check(data); len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package einvoice
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseStructure(t *testing.T) {
+	tests := []struct {
+		name    string
+		outline string
+		err     string
+	}{
+		{name: "valid", outline: "a  1  1\na/b  0  n  [0-9]+\n"},
+		{name: "comments and blank lines", outline: "# outline\n\na  1  1\n"},
+		{name: "empty", outline: "# nothing\n", err: "structure is empty"},
+		{name: "two roots", outline: "a  1  1\nb  1  1\n", err: "more than one root"},
+		{name: "undeclared parent", outline: "a  1  1\nb/c  1  1\n", err: "parent b not declared"},
+		{name: "bad min", outline: "a  x  1\n", err: "invalid min"},
+		{name: "bad max", outline: "a  1  y\n", err: "invalid max"},
+		{name: "bad pattern", outline: "a  1  1  (\n", err: "invalid pattern"},
+		{name: "missing fields", outline: "a  1\n", err: "expected <path> <min> <max> [pattern]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseStructure([]byte(tt.outline), nil)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("parseStructure: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("parseStructure error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestStructureCheck(t *testing.T) {
+	s, err := parseStructure([]byte(`
+r  1  1
+r/id  1  1  [A-Z]+-[0-9]+
+r/line  1  n
+r/line/amount  1  1  -?[0-9]+(\.[0-9]{1,2})?
+r/note  0  1
+`), nil)
+	if err != nil {
+		t.Fatalf("parseStructure: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		xml  string
+		want []string
+	}{
+		{name: "valid", xml: `<r><id>INV-1</id><line><amount>1.50</amount></line><line><amount>-2</amount></line><note>x</note></r>`},
+		{name: "wrong root", xml: `<s/>`, want: []string{"s: root element must be r"}},
+		{name: "missing required", xml: `<r><id>INV-1</id></r>`, want: []string{"r/line: required element is missing"}},
+		{name: "too many", xml: `<r><id>INV-1</id><line><amount>1</amount></line><note/><note/></r>`, want: []string{"r/note: element occurs 2 times, at most 1 allowed"}},
+		{name: "out of order", xml: `<r><line><amount>1</amount></line><id>INV-1</id></r>`, want: []string{"r/id: element is out of order"}},
+		{name: "unknown element", xml: `<r><id>INV-1</id><line><amount>1</amount></line><extra/></r>`, want: []string{"r/extra: element is not allowed here"}},
+		{name: "pattern", xml: `<r><id>INV-1</id><line><amount>1.005</amount></line></r>`, want: []string{`r/line/amount: value "1.005" does not match`}},
+		{name: "malformed", xml: `<r><id>`, want: []string{": malformed XML"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := s.Check([]byte(tt.xml))
+			if len(violations) != len(tt.want) {
+				t.Fatalf("violations = %v, want %d", violations, len(tt.want))
+			}
+			for i, v := range violations {
+				if !strings.HasPrefix(v.String(), tt.want[i]) {
+					t.Errorf("violation %d = %q, want prefix %q", i, v.String(), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckCIIStructure(t *testing.T) {
+	invoice, items, seller := testInvoice()
+	doc, err := FromInvoice(invoice, items, seller)
+	if err != nil {
+		t.Fatalf("FromInvoice: %v", err)
+	}
+	doc.Buyer.CountryCode = "DE"
+	data, err := MarshalCII(doc)
+	if err != nil {
+		t.Fatalf("MarshalCII: %v", err)
+	}
+	if err := CheckCIIStructure(data); err != nil {
+		t.Fatalf("generated CII fails the structure check: %v", err)
+	}
+
+	broken := strings.Replace(string(data), "<ram:InvoiceCurrencyCode>EUR</ram:InvoiceCurrencyCode>", "", 1)
+	verr, ok := CheckCIIStructure([]byte(broken)).(*ValidationError)
+	if !ok || len(verr.Violations) != 1 || !strings.HasSuffix(verr.Violations[0].Path, "ram:InvoiceCurrencyCode") {
+		t.Fatalf("check without currency = %v, want the missing currency reported", verr)
+	}
+}
@@ -0,0 +1,269 @@
+package einvoice
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// Namespaces of the OASIS UBL 2.1 schemas.
+const (
+	nsUBLInvoice    = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	nsUBLCreditNote = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+	nsCAC           = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	nsCBC           = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+)
+
+// Peppol BIS Billing 3.0 identifiers.
+const (
+	PeppolCustomizationID = "urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0"
+	PeppolProfileID       = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"
+)
+
+// ublDocument models both the UBL Invoice and CreditNote roots. The two
+// differ only in a handful of element names, so the variant-specific
+// elements are pointers and left nil for the other document type.
+type ublDocument struct {
+	XMLName            xml.Name
+	Xmlns              string           `xml:"xmlns,attr"`
+	XmlnsCAC           string           `xml:"xmlns:cac,attr"`
+	XmlnsCBC           string           `xml:"xmlns:cbc,attr"`
+	CustomizationID    string           `xml:"cbc:CustomizationID"`
+	ProfileID          string           `xml:"cbc:ProfileID"`
+	ID                 string           `xml:"cbc:ID"`
+	IssueDate          string           `xml:"cbc:IssueDate"`
+	DueDate            string           `xml:"cbc:DueDate,omitempty"`
+	InvoiceTypeCode    string           `xml:"cbc:InvoiceTypeCode,omitempty"`
+	CreditNoteTypeCode string           `xml:"cbc:CreditNoteTypeCode,omitempty"`
+	Note               string           `xml:"cbc:Note,omitempty"`
+	CurrencyCode       string           `xml:"cbc:DocumentCurrencyCode"`
+	BuyerReference     string           `xml:"cbc:BuyerReference,omitempty"`
+	Supplier           ublPartyWrapper  `xml:"cac:AccountingSupplierParty"`
+	Customer           ublPartyWrapper  `xml:"cac:AccountingCustomerParty"`
+	PaymentMeans       *ublPaymentMeans `xml:"cac:PaymentMeans,omitempty"`
+	PaymentTerms       *ublPaymentTerms `xml:"cac:PaymentTerms,omitempty"`
+	TaxTotal           ublTaxTotal      `xml:"cac:TaxTotal"`
+	MonetaryTotal      ublMonetaryTotal `xml:"cac:LegalMonetaryTotal"`
+	InvoiceLines       []ublLine        `xml:"cac:InvoiceLine,omitempty"`
+	CreditNoteLines    []ublLine        `xml:"cac:CreditNoteLine,omitempty"`
+}
+
+type ublPartyWrapper struct {
+	Party ublParty `xml:"cac:Party"`
+}
+
+type ublParty struct {
+	EndpointID  *ublIdentifier `xml:"cbc:EndpointID,omitempty"`
+	Name        string         `xml:"cac:PartyName>cbc:Name"`
+	Address     ublAddress     `xml:"cac:PostalAddress"`
+	TaxScheme   *ublPartyTax   `xml:"cac:PartyTaxScheme,omitempty"`
+	LegalEntity string         `xml:"cac:PartyLegalEntity>cbc:RegistrationName"`
+	Contact     *ublContact    `xml:"cac:Contact,omitempty"`
+}
+
+type ublIdentifier struct {
+	SchemeID string `xml:"schemeID,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+type ublAddress struct {
+	StreetName  string `xml:"cbc:StreetName,omitempty"`
+	CityName    string `xml:"cbc:CityName,omitempty"`
+	PostalZone  string `xml:"cbc:PostalZone,omitempty"`
+	CountryCode string `xml:"cac:Country>cbc:IdentificationCode"`
+}
+
+type ublPartyTax struct {
+	CompanyID string `xml:"cbc:CompanyID"`
+	TaxScheme string `xml:"cac:TaxScheme>cbc:ID"`
+}
+
+type ublContact struct {
+	Email string `xml:"cbc:ElectronicMail,omitempty"`
+}
+
+type ublPaymentMeans struct {
+	Code    string               `xml:"cbc:PaymentMeansCode"`
+	Account *ublFinancialAccount `xml:"cac:PayeeFinancialAccount,omitempty"`
+}
+
+type ublFinancialAccount struct {
+	ID     string `xml:"cbc:ID"`
+	Branch string `xml:"cac:FinancialInstitutionBranch>cbc:ID,omitempty"`
+}
+
+type ublPaymentTerms struct {
+	Note string `xml:"cbc:Note"`
+}
+
+type ublAmount struct {
+	CurrencyID string `xml:"currencyID,attr"`
+	Value      string `xml:",chardata"`
+}
+
+type ublTaxTotal struct {
+	TaxAmount ublAmount        `xml:"cbc:TaxAmount"`
+	Subtotals []ublTaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+type ublTaxSubtotal struct {
+	TaxableAmount ublAmount      `xml:"cbc:TaxableAmount"`
+	TaxAmount     ublAmount      `xml:"cbc:TaxAmount"`
+	Category      ublTaxCategory `xml:"cac:TaxCategory"`
+}
+
+type ublTaxCategory struct {
+	ID        string `xml:"cbc:ID"`
+	Percent   string `xml:"cbc:Percent"`
+	TaxScheme string `xml:"cac:TaxScheme>cbc:ID"`
+}
+
+type ublMonetaryTotal struct {
+	LineExtensionAmount ublAmount  `xml:"cbc:LineExtensionAmount"`
+	TaxExclusiveAmount  ublAmount  `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusiveAmount  ublAmount  `xml:"cbc:TaxInclusiveAmount"`
+	PrepaidAmount       *ublAmount `xml:"cbc:PrepaidAmount,omitempty"`
+	PayableAmount       ublAmount  `xml:"cbc:PayableAmount"`
+}
+
+type ublLine struct {
+	ID                  string       `xml:"cbc:ID"`
+	InvoicedQuantity    *ublQuantity `xml:"cbc:InvoicedQuantity,omitempty"`
+	CreditedQuantity    *ublQuantity `xml:"cbc:CreditedQuantity,omitempty"`
+	LineExtensionAmount ublAmount    `xml:"cbc:LineExtensionAmount"`
+	Item                ublItem      `xml:"cac:Item"`
+	Price               ublPrice     `xml:"cac:Price"`
+}
+
+type ublQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublItem struct {
+	Name        string         `xml:"cbc:Name"`
+	TaxCategory ublTaxCategory `xml:"cac:ClassifiedTaxCategory"`
+}
+
+type ublPrice struct {
+	PriceAmount ublAmount `xml:"cbc:PriceAmount"`
+}
+
+// MarshalUBL renders the document as a Peppol BIS Billing 3.0 UBL 2.1
+// Invoice, or CreditNote when the document type code is 381.
+func MarshalUBL(doc Document) ([]byte, error) {
+	creditNote := doc.TypeCode == TypeCodeCreditNote
+	cur := func(v float64) ublAmount { return ublAmount{CurrencyID: doc.Currency, Value: amount(v)} }
+
+	out := ublDocument{
+		XmlnsCAC:        nsCAC,
+		XmlnsCBC:        nsCBC,
+		CustomizationID: PeppolCustomizationID,
+		ProfileID:       PeppolProfileID,
+		ID:              doc.Number,
+		IssueDate:       doc.IssueDate.Format("2006-01-02"),
+		Note:            doc.Note,
+		CurrencyCode:    doc.Currency,
+		BuyerReference:  doc.BuyerReference,
+		Supplier:        ublPartyWrapper{Party: ublPartyFrom(doc.Seller)},
+		Customer:        ublPartyWrapper{Party: ublPartyFrom(doc.Buyer)},
+		TaxTotal:        ublTaxTotal{TaxAmount: cur(doc.TaxTotal)},
+		MonetaryTotal: ublMonetaryTotal{
+			LineExtensionAmount: cur(doc.LineTotal),
+			TaxExclusiveAmount:  cur(doc.LineTotal),
+			TaxInclusiveAmount:  cur(doc.GrandTotal),
+			PayableAmount:       cur(doc.DuePayable),
+		},
+	}
+	if doc.Prepaid != 0 {
+		prepaid := cur(doc.Prepaid)
+		out.MonetaryTotal.PrepaidAmount = &prepaid
+	}
+
+	if creditNote {
+		out.XMLName = xml.Name{Local: "CreditNote"}
+		out.Xmlns = nsUBLCreditNote
+		out.CreditNoteTypeCode = doc.TypeCode
+		// UBL 2.1 CreditNote has no DueDate element; Peppol carries it as
+		// a payment terms note instead.
+		if !doc.DueDate.IsZero() {
+			out.PaymentTerms = &ublPaymentTerms{Note: "Due " + doc.DueDate.Format("2006-01-02")}
+			if doc.PaymentTerms != "" {
+				out.PaymentTerms.Note += "; " + doc.PaymentTerms
+			}
+		}
+	} else {
+		out.XMLName = xml.Name{Local: "Invoice"}
+		out.Xmlns = nsUBLInvoice
+		out.InvoiceTypeCode = doc.TypeCode
+		if !doc.DueDate.IsZero() {
+			out.DueDate = doc.DueDate.Format("2006-01-02")
+		}
+		if doc.PaymentTerms != "" {
+			out.PaymentTerms = &ublPaymentTerms{Note: doc.PaymentTerms}
+		}
+	}
+
+	if pm := doc.PaymentMeans; pm != nil {
+		out.PaymentMeans = &ublPaymentMeans{Code: pm.TypeCode}
+		if pm.IBAN != "" {
+			out.PaymentMeans.Account = &ublFinancialAccount{ID: pm.IBAN, Branch: pm.BIC}
+		}
+	}
+
+	for _, tax := range doc.Taxes {
+		out.TaxTotal.Subtotals = append(out.TaxTotal.Subtotals, ublTaxSubtotal{
+			TaxableAmount: cur(tax.TaxableAmount),
+			TaxAmount:     cur(tax.TaxAmount),
+			Category:      ublTaxCategory{ID: tax.CategoryCode, Percent: percent(tax.Rate), TaxScheme: "VAT"},
+		})
+	}
+
+	for _, line := range doc.Lines {
+		l := ublLine{
+			ID:                  line.ID,
+			LineExtensionAmount: cur(line.NetAmount),
+			Item: ublItem{
+				Name:        line.Description,
+				TaxCategory: ublTaxCategory{ID: TaxCategory(line.TaxRate), Percent: percent(line.TaxRate), TaxScheme: "VAT"},
+			},
+			Price: ublPrice{PriceAmount: cur(line.UnitPrice)},
+		}
+		qty := &ublQuantity{UnitCode: "C62", Value: quantity(line.Quantity)}
+		if creditNote {
+			l.CreditedQuantity = qty
+			out.CreditNoteLines = append(out.CreditNoteLines, l)
+		} else {
+			l.InvoicedQuantity = qty
+			out.InvoiceLines = append(out.InvoiceLines, l)
+		}
+	}
+
+	data, err := xml.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal UBL document: %v", err)
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+func ublPartyFrom(p Party) ublParty {
+	party := ublParty{
+		Name: p.Name,
+		Address: ublAddress{
+			StreetName:  p.AddressLine,
+			CityName:    p.City,
+			PostalZone:  p.PostalCode,
+			CountryCode: p.CountryCode,
+		},
+		LegalEntity: p.Name,
+	}
+	// The e-mail address doubles as the electronic address (EAS code EM)
+	// until a party has a registered Peppol participant identifier.
+	if p.Email != "" {
+		party.EndpointID = &ublIdentifier{SchemeID: "EM", Value: p.Email}
+		party.Contact = &ublContact{Email: p.Email}
+	}
+	if p.VATID != "" {
+		party.TaxScheme = &ublPartyTax{CompanyID: p.VATID, TaxScheme: "VAT"}
+	}
+	return party
+}
@@ -0,0 +1,57 @@
+package einvoice
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+
+	"invoice-generator-go/config"
+)
+
+// xmllintErrorRe matches a schema validity error reported by xmllint for a
+// document read from standard input.
+var xmllintErrorRe = regexp.MustCompile(`(?m)^-:(\d+): .*?Schemas validity error : (.*)$`)
+
+// ValidateCIISchema validates a Cross Industry Invoice against the XSD at
+// schemaPath with xmllint, which must be installed. Schema violations are
+// returned as a *ValidationError with the line they were found on; other
+// errors mean the document could not be validated.
+func ValidateCIISchema(data []byte, schemaPath string) error {
+	cmd := exec.Command("xmllint", "--noout", "--nonet", "--schema", schemaPath, "-")
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+
+	// xmllint exits with 3 or 4 when the document is invalid
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || (exitErr.ExitCode() != 3 && exitErr.ExitCode() != 4) {
+		return fmt.Errorf("failed to validate against %s: %v: %s", schemaPath, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	var violations []Violation
+	for _, m := range xmllintErrorRe.FindAllSubmatch(stderr.Bytes(), -1) {
+		violations = append(violations, Violation{Path: "line " + string(m[1]), Message: string(m[2])})
+	}
+	if len(violations) == 0 {
+		violations = append(violations, Violation{Message: string(bytes.TrimSpace(stderr.Bytes()))})
+	}
+	return &ValidationError{Violations: violations}
+}
+
+// ValidateCII checks a Cross Industry Invoice against the bundled outline
+// and, when CII_SCHEMA_PATH names the official XSD, validates it against
+// that too. Failures are returned as a *ValidationError.
+func ValidateCII(data []byte) error {
+	if err := CheckCIIStructure(data); err != nil {
+		return err
+	}
+	if schemaPath := config.GetConfig().CIISchemaPath; schemaPath != "" {
+		return ValidateCIISchema(data, schemaPath)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package einvoice
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateCIISchema(t *testing.T) {
+	if _, err := exec.LookPath("xmllint"); err != nil {
+		t.Skip("xmllint is not installed")
+	}
+	schema := filepath.Join("testdata", "minimal-cii.xsd")
+
+	invoice, items, seller := testInvoice()
+	doc, err := FromInvoice(invoice, items, seller)
+	if err != nil {
+		t.Fatalf("FromInvoice: %v", err)
+	}
+	data, err := MarshalCII(doc)
+	if err != nil {
+		t.Fatalf("MarshalCII: %v", err)
+	}
+	if err := ValidateCIISchema(data, schema); err != nil {
+		t.Fatalf("generated CII fails the schema: %v", err)
+	}
+
+	start := strings.Index(string(data), "<rsm:ExchangedDocument>")
+	end := strings.Index(string(data), "</rsm:ExchangedDocument>") + len("</rsm:ExchangedDocument>")
+	broken := string(data[:start]) + string(data[end:])
+	verr, ok := ValidateCIISchema([]byte(broken), schema).(*ValidationError)
+	if !ok || len(verr.Violations) == 0 || !strings.HasPrefix(verr.Violations[0].Path, "line ") {
+		t.Fatalf("document without ExchangedDocument = %v, want a schema violation with its line", verr)
+	}
+
+	if _, ok := ValidateCIISchema(data, filepath.Join("testdata", "missing.xsd")).(*ValidationError); ok {
+		t.Error("missing schema reported as a schema violation, want an error")
+	}
+}
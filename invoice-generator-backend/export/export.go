@@ -0,0 +1,194 @@
+// Package export builds bulk exports of invoice PDFs: a ZIP of the
+// individual PDFs with a CSV manifest, or one merged PDF for printing.
+// Larger exports run as background jobs that record their progress.
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"invoice-generator-go/models"
+	"invoice-generator-go/pdf"
+	"invoice-generator-go/storage"
+)
+
+// Export formats.
+const (
+	FormatZIP = "zip"
+	FormatPDF = "pdf"
+)
+
+const (
+	// SyncLimit is the largest export built within the request; larger
+	// ones run as background jobs.
+	SyncLimit = 10
+	// MaxInvoices caps the invoices in one export.
+	MaxInvoices = 500
+	// maxConcurrentJobs bounds the jobs rendering at the same time; others
+	// wait queued.
+	maxConcurrentJobs = 2
+)
+
+// ValidFormat reports whether format is FormatZIP or FormatPDF.
+func ValidFormat(format string) bool {
+	return format == FormatZIP || format == FormatPDF
+}
+
+// FileName is the name of the export file for format.
+func FileName(format string, at time.Time) string {
+	if format == FormatPDF {
+		return "invoices_" + at.Format("2006-01-02") + ".pdf"
+	}
+	return "invoices_" + at.Format("2006-01-02") + ".zip"
+}
+
+// ContentType is the MIME type of the export file for format.
+func ContentType(format string) string {
+	if format == FormatPDF {
+		return "application/pdf"
+	}
+	return "application/zip"
+}
+
+// Build produces the export of invoices in format, calling progress after
+// each invoice. ZIP exports contain the stored PDFs, rendering and storing
+// those not generated yet; merged PDFs render every invoice afresh.
+func Build(ctx context.Context, format string, invoices []models.Invoice, progress func(done int)) ([]byte, error) {
+	switch format {
+	case FormatZIP:
+		return buildZIP(ctx, invoices, progress)
+	case FormatPDF:
+		return pdf.RenderPrintBatch(ctx, invoices, progress)
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// manifestHeader lists the columns of manifest.csv.
+var manifestHeader = []string{"file", "invoice_number", "document_type", "status", "customer_name", "customer_email", "invoice_date", "due_date", "currency", "total_amount"}
+
+func buildZIP(ctx context.Context, invoices []models.Invoice, progress func(done int)) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	var manifest bytes.Buffer
+	cw := csv.NewWriter(&manifest)
+	cw.Write(manifestHeader)
+
+	names := make(map[string]bool, len(invoices))
+	for i, invoice := range invoices {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		data, err := InvoicePDF(&invoice)
+		if err != nil {
+			return nil, fmt.Errorf("invoice %s: %v", invoice.InvoiceNumber, err)
+		}
+
+		name := entryName(invoice, names)
+		w, err := zw.Create(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s to ZIP: %v", name, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to write %s to ZIP: %v", name, err)
+		}
+
+		cw.Write([]string{
+			name,
+			invoice.InvoiceNumber,
+			invoice.DocumentType,
+			invoice.Status,
+			invoice.CustomerName,
+			invoice.CustomerEmail,
+			invoice.InvoiceDate.Format("2006-01-02"),
+			invoice.DueDate.Format("2006-01-02"),
+			invoice.Currency,
+			strconv.FormatFloat(invoice.TotalAmount, 'f', 2, 64),
+		})
+		if progress != nil {
+			progress(i + 1)
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %v", err)
+	}
+	w, err := zw.Create("manifest.csv")
+	if err != nil {
+		return nil, fmt.Errorf("failed to add manifest to ZIP: %v", err)
+	}
+	if _, err := w.Write(manifest.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to write manifest to ZIP: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish ZIP: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// StoredPDF returns the path of an invoice's stored PDF, and false when it
+// has none or the stored file predates the invoice's last status change, so
+// its status stamp may be stale.
+func StoredPDF(invoice models.Invoice) (string, bool) {
+	if invoice.PdfPath == "" {
+		return "", false
+	}
+	info, err := os.Stat(invoice.PdfPath)
+	if err != nil {
+		return "", false
+	}
+	if invoice.StatusChangedAt != nil && info.ModTime().Before(*invoice.StatusChangedAt) {
+		return "", false
+	}
+	return invoice.PdfPath, true
+}
+
+// InvoicePDF returns an invoice's stored PDF, generating and recording it
+// first when it is missing or stale.
+func InvoicePDF(invoice *models.Invoice) ([]byte, error) {
+	if path, ok := StoredPDF(*invoice); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PDF file: %v", err)
+		}
+		return data, nil
+	}
+
+	pdfPath, err := pdf.GeneratePDF(*invoice)
+	if err != nil {
+		return nil, err
+	}
+	invoice.PdfPath = pdfPath
+	invoice.UpdatedAt = time.Now()
+	if err := storage.UpdateInvoice(invoice); err != nil {
+		log.Printf("Error updating invoice with PDF path: %v", err)
+		// Continue anyway, PDF was generated
+	}
+	return os.ReadFile(pdfPath)
+}
+
+var unsafeNameRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// entryName is the ZIP entry of an invoice, made unique within the archive.
+func entryName(invoice models.Invoice, taken map[string]bool) string {
+	base := unsafeNameRe.ReplaceAllString(invoice.InvoiceNumber, "_")
+	if base == "" {
+		base = invoice.ID.String()
+	}
+	name := base + ".pdf"
+	for n := 2; taken[name]; n++ {
+		name = fmt.Sprintf("%s_%d.pdf", base, n)
+	}
+	taken[name] = true
+	return name
+}
@@ -0,0 +1,41 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"invoice-generator-go/models"
+)
+
+func TestStoredPDF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invoice.pdf")
+	if err := os.WriteFile(path, []byte("%PDF-1.4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	written := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, written, written); err != nil {
+		t.Fatal(err)
+	}
+	before, after := written.Add(-time.Minute), written.Add(time.Minute)
+
+	tests := []struct {
+		name    string
+		invoice models.Invoice
+		want    bool
+	}{
+		{"none stored", models.Invoice{}, false},
+		{"missing file", models.Invoice{PdfPath: path + ".missing"}, false},
+		{"status never changed", models.Invoice{PdfPath: path}, true},
+		{"status changed before", models.Invoice{PdfPath: path, StatusChangedAt: &before}, true},
+		{"status changed after", models.Invoice{PdfPath: path, StatusChangedAt: &after}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := StoredPDF(tt.invoice); ok != tt.want {
+				t.Errorf("StoredPDF = %t, want %t", ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"invoice-generator-go/models"
+	"invoice-generator-go/storage"
+)
+
+// slots limits the export jobs running at the same time.
+var slots = make(chan struct{}, maxConcurrentJobs)
+
+// Start runs a stored export job in the background. The job records its
+// progress as it goes; the finished file is put in the blob store under
+// exports/<user>/<job>.
+func Start(job models.ExportJob, invoices []models.Invoice) {
+	go run(job, invoices)
+}
+
+func run(job models.ExportJob, invoices []models.Invoice) {
+	slots <- struct{}{}
+	defer func() { <-slots }()
+
+	if err := storage.UpdateExportJobProgress(job.ID, 0); err != nil {
+		log.Printf("Error starting export job %s: %v", job.ID, err)
+	}
+	progress := func(done int) {
+		if err := storage.UpdateExportJobProgress(job.ID, done); err != nil {
+			log.Printf("Error recording export job %s progress: %v", job.ID, err)
+		}
+	}
+
+	data, err := Build(context.Background(), job.Format, invoices, progress)
+	if err == nil {
+		key := BlobKey(job)
+		if err = storage.Blobs.Put(key, data); err == nil {
+			err = storage.CompleteExportJob(job.ID, FileName(job.Format, job.CreatedAt), key)
+		} else {
+			err = fmt.Errorf("failed to store export: %v", err)
+		}
+	}
+	if err != nil {
+		log.Printf("Export job %s failed: %v", job.ID, err)
+		if err := storage.FailExportJob(job.ID, err.Error()); err != nil {
+			log.Printf("Error recording export job %s failure: %v", job.ID, err)
+		}
+	}
+}
+
+// BlobKey is where a job's finished file is stored.
+func BlobKey(job models.ExportJob) string {
+	return fmt.Sprintf("exports/%s/%s", job.UserID, job.ID)
+}
@@ -0,0 +1,166 @@
+// Package i18n provides the translation catalogs used to render invoice
+// documents in the customer's language.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultLocale is used when no language is configured, and as the last
+// fallback for keys missing from a catalog.
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// Catalog maps translation keys, e.g. "due_date", to text.
+type Catalog map[string]string
+
+// builtin holds the bundled catalogs by locale.
+var builtin = loadBuiltin()
+
+func loadBuiltin() map[string]Catalog {
+	files, err := localeFS.ReadDir("locales")
+	if err != nil {
+		panic(fmt.Sprintf("i18n: failed to read bundled catalogs: %v", err))
+	}
+	catalogs := make(map[string]Catalog, len(files))
+	for _, f := range files {
+		data, err := localeFS.ReadFile(path.Join("locales", f.Name()))
+		if err != nil {
+			panic(fmt.Sprintf("i18n: failed to read %s: %v", f.Name(), err))
+		}
+		var catalog Catalog
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Sprintf("i18n: invalid catalog %s: %v", f.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(f.Name(), ".json")] = catalog
+	}
+	return catalogs
+}
+
+var (
+	localeRe = regexp.MustCompile(`^[a-z]{2,3}(?:-[a-z0-9]{2,8})?$`)
+	keyRe    = regexp.MustCompile(`^[a-z0-9_.]{1,100}$`)
+)
+
+// Normalize lower-cases a locale and uses "-" as separator, so "de_CH" and
+// "de-ch" are the same locale.
+func Normalize(locale string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(locale)), "_", "-")
+}
+
+// ValidLocale reports whether locale looks like a language code such as
+// "de" or "de-CH".
+func ValidLocale(locale string) bool {
+	return localeRe.MatchString(Normalize(locale))
+}
+
+// ValidKey reports whether key can be used as a translation key.
+func ValidKey(key string) bool {
+	return keyRe.MatchString(key)
+}
+
+// Locales lists the locales with a bundled catalog.
+func Locales() []string {
+	locales := make([]string, 0, len(builtin))
+	for locale := range builtin {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Chain returns the locales consulted for locale, most specific first: the
+// locale itself, its base language and DefaultLocale.
+func Chain(locale string) []string {
+	locale = Normalize(locale)
+	chain := []string{}
+	if locale != "" {
+		chain = append(chain, locale)
+		if base, _, found := strings.Cut(locale, "-"); found {
+			chain = append(chain, base)
+		}
+	}
+	if len(chain) == 0 || chain[len(chain)-1] != DefaultLocale {
+		chain = append(chain, DefaultLocale)
+	}
+	return chain
+}
+
+// rtlLanguages are the base languages written right to left.
+var rtlLanguages = map[string]bool{
+	"ar": true, "fa": true, "he": true, "ps": true, "ur": true, "yi": true,
+}
+
+// Direction returns "rtl" for locales of right-to-left languages such as
+// Arabic and Hebrew, and "ltr" otherwise.
+func Direction(locale string) string {
+	base, _, _ := strings.Cut(Normalize(locale), "-")
+	if rtlLanguages[base] {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// Translator looks up text for one locale. Account-specific catalogs take
+// precedence over the bundled ones at every step of the locale chain.
+type Translator struct {
+	locale   string
+	catalogs []Catalog
+}
+
+// New returns a translator for locale. custom holds account-specific
+// catalogs by normalised locale and may be nil.
+func New(locale string, custom map[string]Catalog) *Translator {
+	chain := Chain(locale)
+	t := &Translator{locale: chain[0]}
+	for _, l := range chain {
+		if c, ok := custom[l]; ok {
+			t.catalogs = append(t.catalogs, c)
+		}
+		if c, ok := builtin[l]; ok {
+			t.catalogs = append(t.catalogs, c)
+		}
+	}
+	return t
+}
+
+// Locale returns the translator's normalised locale.
+func (t *Translator) Locale() string {
+	return t.locale
+}
+
+// T returns the text for key, or the key itself when no catalog has it. With
+// args a text containing fmt verbs is used as a format, e.g. T("days", 30).
+func (t *Translator) T(key string, args ...interface{}) string {
+	text := key
+	for _, c := range t.catalogs {
+		if v, ok := c[key]; ok {
+			text = v
+			break
+		}
+	}
+	if len(args) > 0 && strings.Contains(text, "%") {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// Merged returns the effective catalog of the translator: every key known to
+// any of its catalogs with the text T would return.
+func (t *Translator) Merged() Catalog {
+	merged := Catalog{}
+	for i := len(t.catalogs) - 1; i >= 0; i-- {
+		for k, v := range t.catalogs[i] {
+			merged[k] = v
+		}
+	}
+	return merged
+}
@@ -0,0 +1,277 @@
+package layout
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Defaults used for values a spec leaves out.
+const (
+	defaultPrimaryColor = "#2c3e50"
+	defaultTextColor    = "#333333"
+	defaultFontFamily   = "Helvetica, Arial"
+	defaultFontSize     = 10
+	defaultMarginMM     = 15
+	defaultDateFormat   = "2006-01-02"
+)
+
+// defaultColumns is the item table used when a spec lists no columns.
+var defaultColumns = []Column{
+	{Field: "description"},
+	{Field: "quantity", Align: "right"},
+	{Field: "unit_price", Align: "right"},
+	{Field: "total", Align: "right"},
+}
+
+// columnValues are the cell expressions of each column, evaluated with an
+// invoice item as dot.
+var columnValues = map[string]string{
+	"description": `{{.Description}}`,
+	"quantity":    `{{.Quantity}}`,
+	"unit_price":  `{{printf "%.2f" .UnitPrice}}`,
+	"total":       `{{printf "%.2f" .TotalPrice}}`,
+}
+
+// Compile turns a validated spec into invoice template content for the HTML
+// renderer. Text from the spec is emitted as template string literals, so it
+// is escaped at render time like any other value; labels the spec leaves out
+// are translated into the document language with {{t}}.
+func Compile(spec *Spec) string {
+	c := compiler{spec: spec}
+	c.document()
+	return c.b.String()
+}
+
+type compiler struct {
+	spec *Spec
+	b    strings.Builder
+}
+
+func (c *compiler) w(format string, args ...interface{}) {
+	fmt.Fprintf(&c.b, format, args...)
+	c.b.WriteByte('\n')
+}
+
+// text returns a template action printing s.
+func text(s string) string {
+	return "{{" + strconv.Quote(s) + "}}"
+}
+
+// label returns a template action printing value, or the translation of key
+// when value is empty.
+func label(value, key string) string {
+	if value == "" {
+		return "{{t " + strconv.Quote(key) + "}}"
+	}
+	return text(value)
+}
+
+// title is the document title: the spec's header title, or "Invoice" or
+// "Credit Note" in the document language.
+func (c *compiler) title() string {
+	if c.spec.Header.Title != "" {
+		return text(c.spec.Header.Title)
+	}
+	return `{{if eq .Invoice.DocumentType "credit_note"}}{{t "credit_note"}}{{else}}{{t "invoice"}}{{end}}`
+}
+
+// alignClass maps a spec alignment to a class. Left and right are the start
+// and end of a line, so right-to-left documents are mirrored.
+func alignClass(align string) string {
+	switch align {
+	case "right":
+		return "end"
+	case "center":
+		return "center"
+	default:
+		return "start"
+	}
+}
+
+func or(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func (c *compiler) document() {
+	s := c.spec
+	c.w(`<!DOCTYPE html>`)
+	c.w(`<html lang="{{.Language}}" dir="{{.Direction}}">`)
+	c.w(`<head>`)
+	c.w(`<meta charset="utf-8">`)
+	c.w(`<title>%s {{.Invoice.InvoiceNumber}}</title>`, c.title())
+	c.styles()
+	c.w(`</head>`)
+	c.w(`<body{{if .BackgroundURL}} style="background-image: url({{.BackgroundURL}}); background-size: cover;"{{end}}>`)
+
+	if !s.Header.Hidden {
+		c.header()
+	}
+	if !s.Details.Hidden {
+		c.details()
+	}
+	if !s.Addresses.Hidden {
+		c.addresses()
+	}
+	c.items()
+	if !s.Totals.Hidden {
+		c.totals()
+	}
+	if !s.Notes.Hidden {
+		c.w(`{{if .Invoice.Notes}}<div class="notes"><h3>%s</h3><p class="multiline">{{.Invoice.Notes}}</p></div>{{end}}`, label(s.Notes.Title, "notes"))
+	}
+	if !s.Payment.Hidden {
+		c.payment()
+	}
+	if !s.Footer.Hidden {
+		c.footer()
+	}
+
+	c.w(`</body>`)
+	c.w(`</html>`)
+}
+
+func (c *compiler) styles() {
+	t := c.spec.Theme
+	margin := float64(defaultMarginMM)
+	if c.spec.Page.MarginMM != nil {
+		margin = *c.spec.Page.MarginMM
+	}
+	fontSize := t.FontSizePT
+	if fontSize == 0 {
+		fontSize = defaultFontSize
+	}
+	family := or(t.FontFamily, defaultFontFamily)
+	primary := or(t.PrimaryColor, defaultPrimaryColor)
+
+	c.w(`<style>`)
+	c.w(`@page { size: %s; margin: %gmm; }`, or(c.spec.Page.Size, "A4"), margin)
+	if t.FontAsset != "" {
+		c.w(`@font-face { font-family: "LayoutFont"; src: url({{asset %s}}); }`, strconv.Quote(t.FontAsset))
+		family = "LayoutFont, " + family
+	}
+	c.w(`body { font-family: %s, {{.ScriptFonts}}; font-size: %gpt; color: %s; margin: 0; }`, family, fontSize, or(t.TextColor, defaultTextColor))
+	c.w(`h1, h3 { color: %s; }`, primary)
+	c.w(`.start { text-align: {{.Start}}; } .center { text-align: center; } .end { text-align: {{.End}}; }`)
+	c.w(`.header { margin-bottom: 8mm; }`)
+	c.w(`.logo { max-width: 50mm; max-height: 25mm; }`)
+	c.w(`.details, .addresses, .totals, .notes, .payment { margin-bottom: 6mm; }`)
+	c.w(`.addresses td { vertical-align: top; width: 50%%; }`)
+	c.w(`.multiline { white-space: pre-line; }`)
+	c.w(`table { width: 100%%; border-collapse: collapse; }`)
+	c.w(`.items { margin-bottom: 6mm; }`)
+	c.w(`.items th { background: %s; color: #ffffff; padding: 2mm; }`, primary)
+	c.w(`.items td { border-bottom: 1px solid #dddddd; padding: 2mm; }`)
+	c.w(`.totals td { padding: 1mm 2mm; text-align: {{.End}}; }`)
+	c.w(`.totals .grand-total td { font-weight: bold; border-top: 2px solid %s; }`, primary)
+	c.w(`.footer { margin-top: 10mm; text-align: center; font-size: 0.85em; color: #777777; }`)
+	c.w(`</style>`)
+}
+
+func (c *compiler) header() {
+	h := c.spec.Header
+	c.w(`<div class="header %s">`, alignClass(h.Align))
+	switch or(h.Logo, "company") {
+	case "company":
+		c.w(`{{if .CompanyLogoURL}}<img class="logo" src="{{.CompanyLogoURL}}" alt="">{{end}}`)
+	case "template":
+		c.w(`{{if .LogoURL}}<img class="logo" src="{{.LogoURL}}" alt="">{{end}}`)
+	}
+	c.w(`<h1>%s</h1>`, c.title())
+	c.w(`</div>`)
+}
+
+func (c *compiler) details() {
+	d := c.spec.Details
+	format := strconv.Quote(or(d.DateFormat, defaultDateFormat))
+	c.w(`<table class="details">`)
+	c.w(`<tr><td>%s</td><td>{{.Invoice.InvoiceNumber}}</td></tr>`, label(d.NumberLabel, "invoice_number"))
+	c.w(`<tr><td>%s</td><td>{{.Invoice.InvoiceDate.Format %s}}</td></tr>`, label(d.DateLabel, "date"), format)
+	c.w(`<tr><td>%s</td><td>{{.Invoice.DueDate.Format %s}}</td></tr>`, label(d.DueDateLabel, "due_date"), format)
+	c.w(`{{if .Invoice.BuyerReference}}<tr><td>%s</td><td>{{.Invoice.BuyerReference}}</td></tr>{{end}}`, label(d.ReferenceLabel, "reference"))
+	c.w(`{{if .Invoice.PaymentTerms}}<tr><td>%s</td><td>{{.Invoice.PaymentTerms}}</td></tr>{{end}}`, label("", "payment_terms"))
+	c.w(`</table>`)
+}
+
+func (c *compiler) addresses() {
+	a := c.spec.Addresses
+	c.w(`<table class="addresses"><tr>`)
+	c.w(`<td><h3>%s</h3>`, label(a.SenderLabel, "from"))
+	c.w(`<div>{{.Company.CompanyName}}</div>`)
+	c.w(`{{if .Company.AddressLine}}<div>{{.Company.AddressLine}}</div>{{end}}`)
+	c.w(`<div>{{.Company.PostalCode}} {{.Company.City}}</div>`)
+	c.w(`{{if .Company.Email}}<div>{{.Company.Email}}</div>{{end}}`)
+	c.w(`{{if .Company.TaxID}}<div>{{.Company.TaxID}}</div>{{end}}`)
+	c.w(`</td>`)
+	c.w(`<td><h3>%s</h3>`, label(a.RecipientLabel, "bill_to"))
+	c.w(`<div>{{.Invoice.CustomerName}}</div>`)
+	c.w(`<div class="multiline">{{.Invoice.CustomerAddress}}</div>`)
+	c.w(`</td>`)
+	c.w(`</tr></table>`)
+}
+
+func (c *compiler) items() {
+	columns := c.spec.Items.Columns
+	if len(columns) == 0 {
+		columns = defaultColumns
+	}
+
+	c.w(`<table class="items">`)
+	c.w(`<thead><tr>`)
+	for _, col := range columns {
+		width := ""
+		if col.WidthPercent > 0 {
+			width = fmt.Sprintf(` style="width: %g%%;"`, col.WidthPercent)
+		}
+		c.w(`<th class="%s"%s>%s</th>`, alignClass(col.Align), width, label(col.Label, col.Field))
+	}
+	c.w(`</tr></thead>`)
+	c.w(`<tbody>`)
+	c.w(`{{range .InvoiceItems}}<tr>`)
+	for _, col := range columns {
+		c.w(`<td class="%s">%s</td>`, alignClass(col.Align), columnValues[col.Field])
+	}
+	c.w(`</tr>{{end}}`)
+	c.w(`</tbody>`)
+	c.w(`</table>`)
+}
+
+func (c *compiler) totals() {
+	t := c.spec.Totals
+	c.w(`<table class="totals">`)
+	c.w(`<tr><td>%s</td><td>{{printf "%%.2f" .Invoice.Subtotal}} {{.Invoice.Currency}}</td></tr>`, label(t.SubtotalLabel, "subtotal"))
+	c.w(`<tr><td>%s ({{.Invoice.TaxRate}}%%)</td><td>{{printf "%%.2f" .Invoice.TaxAmount}} {{.Invoice.Currency}}</td></tr>`, label(t.TaxLabel, "tax"))
+	c.w(`<tr class="grand-total"><td>%s</td><td>{{printf "%%.2f" .Invoice.TotalAmount}} {{.Invoice.Currency}}</td></tr>`, label(t.TotalLabel, "total"))
+	c.w(`</table>`)
+	format := strconv.Quote(or(c.spec.Details.DateFormat, defaultDateFormat))
+	c.w(`{{with .Discount}}<p class="end">{{t "early_payment_discount" .Percent (.DueDate.Format %s) .AmountDue}} {{$.Invoice.Currency}}</p>{{end}}`, format)
+}
+
+func (c *compiler) payment() {
+	p := c.spec.Payment
+	c.w(`{{if .Company.IBAN}}<div class="payment">`)
+	c.w(`<h3>%s</h3>`, label(p.Title, "payment_details"))
+	c.w(`{{if .Company.BankName}}<div>{{.Company.BankName}}</div>{{end}}`)
+	c.w(`<div>IBAN: {{.Company.IBAN}}</div>`)
+	c.w(`{{if .Company.BIC}}<div>BIC: {{.Company.BIC}}</div>{{end}}`)
+	c.w(`{{with paymentReference}}<div>{{.}}</div>{{end}}`)
+	if p.QR == "epc" {
+		c.w(`{{epcQRCode}}`)
+	}
+	c.w(`</div>{{end}}`)
+	if p.QR == "swiss" {
+		c.w(`{{swissQRBill}}`)
+	}
+}
+
+func (c *compiler) footer() {
+	c.w(`<div class="footer">`)
+	if c.spec.Footer.Text != "" {
+		c.w(`<p class="multiline">%s</p>`, text(c.spec.Footer.Text))
+	}
+	c.w(`{{if .Company.LegalFooter}}<p>{{.Company.LegalFooter}}</p>{{end}}`)
+	c.w(`</div>`)
+}
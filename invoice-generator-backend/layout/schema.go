@@ -0,0 +1,14 @@
+package layout
+
+import _ "embed"
+
+// schema is the JSON Schema of Spec, published for the template designer.
+// Keep it in step with Spec and Spec.Validate.
+//
+//go:embed schema.json
+var schema []byte
+
+// Schema returns the JSON Schema describing layout specs.
+func Schema() []byte {
+	return schema
+}
@@ -0,0 +1,359 @@
+// Package layout implements the declarative template language: a JSON or
+// YAML spec describing the blocks of an invoice, compiled by the server into
+// an HTML template for the regular renderer.
+package layout
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Language is the models.Template.Language value that marks a template's
+// content as a layout spec instead of an HTML template.
+const Language = "layout"
+
+// IsLayout reports whether a template language denotes a layout spec.
+func IsLayout(language string) bool {
+	return strings.EqualFold(strings.TrimSpace(language), Language)
+}
+
+// Spec is a layout template. Every block is optional and falls back to
+// sensible defaults; blocks can be switched off with "hidden": true.
+type Spec struct {
+	Version int `json:"version,omitempty" yaml:"version,omitempty"`
+	// Locale is the default document language, e.g. "de", used unless the
+	// customer has a language of their own or the request overrides it.
+	Locale    string    `json:"locale,omitempty" yaml:"locale,omitempty"`
+	Page      Page      `json:"page,omitempty" yaml:"page,omitempty"`
+	Theme     Theme     `json:"theme,omitempty" yaml:"theme,omitempty"`
+	Header    Header    `json:"header,omitempty" yaml:"header,omitempty"`
+	Details   Details   `json:"details,omitempty" yaml:"details,omitempty"`
+	Addresses Addresses `json:"addresses,omitempty" yaml:"addresses,omitempty"`
+	Items     Items     `json:"items,omitempty" yaml:"items,omitempty"`
+	Totals    Totals    `json:"totals,omitempty" yaml:"totals,omitempty"`
+	Notes     Notes     `json:"notes,omitempty" yaml:"notes,omitempty"`
+	Payment   Payment   `json:"payment,omitempty" yaml:"payment,omitempty"`
+	Footer    Footer    `json:"footer,omitempty" yaml:"footer,omitempty"`
+}
+
+// Page sets the paper size and margins.
+type Page struct {
+	Size     string   `json:"size,omitempty" yaml:"size,omitempty"`
+	MarginMM *float64 `json:"margin_mm,omitempty" yaml:"margin_mm,omitempty"`
+}
+
+// Theme sets colours and fonts.
+type Theme struct {
+	PrimaryColor string `json:"primary_color,omitempty" yaml:"primary_color,omitempty"`
+	TextColor    string `json:"text_color,omitempty" yaml:"text_color,omitempty"`
+	FontFamily   string `json:"font_family,omitempty" yaml:"font_family,omitempty"`
+	// FontAsset names a TTF/OTF template asset used as the document font.
+	FontAsset  string  `json:"font_asset,omitempty" yaml:"font_asset,omitempty"`
+	FontSizePT float64 `json:"font_size_pt,omitempty" yaml:"font_size_pt,omitempty"`
+}
+
+// Header is the document title and logo.
+type Header struct {
+	Hidden bool   `json:"hidden,omitempty" yaml:"hidden,omitempty"`
+	Title  string `json:"title,omitempty" yaml:"title,omitempty"`
+	// Logo is "company" (the profile logo), "template" (the template's
+	// logo_url) or "none".
+	Logo  string `json:"logo,omitempty" yaml:"logo,omitempty"`
+	Align string `json:"align,omitempty" yaml:"align,omitempty"`
+}
+
+// Details lists the invoice number, dates and buyer reference.
+type Details struct {
+	Hidden         bool   `json:"hidden,omitempty" yaml:"hidden,omitempty"`
+	NumberLabel    string `json:"number_label,omitempty" yaml:"number_label,omitempty"`
+	DateLabel      string `json:"date_label,omitempty" yaml:"date_label,omitempty"`
+	DueDateLabel   string `json:"due_date_label,omitempty" yaml:"due_date_label,omitempty"`
+	ReferenceLabel string `json:"reference_label,omitempty" yaml:"reference_label,omitempty"`
+	// DateFormat is a Go time layout, e.g. "02.01.2006".
+	DateFormat string `json:"date_format,omitempty" yaml:"date_format,omitempty"`
+}
+
+// Addresses is the sender and recipient block.
+type Addresses struct {
+	Hidden         bool   `json:"hidden,omitempty" yaml:"hidden,omitempty"`
+	SenderLabel    string `json:"sender_label,omitempty" yaml:"sender_label,omitempty"`
+	RecipientLabel string `json:"recipient_label,omitempty" yaml:"recipient_label,omitempty"`
+}
+
+// Items is the line item table.
+type Items struct {
+	Columns []Column `json:"columns,omitempty" yaml:"columns,omitempty"`
+}
+
+// Column is a line item table column.
+type Column struct {
+	Field        string  `json:"field" yaml:"field"`
+	Label        string  `json:"label,omitempty" yaml:"label,omitempty"`
+	Align        string  `json:"align,omitempty" yaml:"align,omitempty"`
+	WidthPercent float64 `json:"width_percent,omitempty" yaml:"width_percent,omitempty"`
+}
+
+// Totals is the subtotal, tax and total block.
+type Totals struct {
+	Hidden        bool   `json:"hidden,omitempty" yaml:"hidden,omitempty"`
+	SubtotalLabel string `json:"subtotal_label,omitempty" yaml:"subtotal_label,omitempty"`
+	TaxLabel      string `json:"tax_label,omitempty" yaml:"tax_label,omitempty"`
+	TotalLabel    string `json:"total_label,omitempty" yaml:"total_label,omitempty"`
+}
+
+// Notes shows the invoice notes when there are any.
+type Notes struct {
+	Hidden bool   `json:"hidden,omitempty" yaml:"hidden,omitempty"`
+	Title  string `json:"title,omitempty" yaml:"title,omitempty"`
+}
+
+// Payment shows bank details and optionally a payment QR code.
+type Payment struct {
+	Hidden bool   `json:"hidden,omitempty" yaml:"hidden,omitempty"`
+	Title  string `json:"title,omitempty" yaml:"title,omitempty"`
+	// QR is "none", "epc" (SEPA QR code) or "swiss" (Swiss QR-bill).
+	QR string `json:"qr,omitempty" yaml:"qr,omitempty"`
+}
+
+// Footer is free text above the company's legal footer.
+type Footer struct {
+	Hidden bool   `json:"hidden,omitempty" yaml:"hidden,omitempty"`
+	Text   string `json:"text,omitempty" yaml:"text,omitempty"`
+}
+
+// Violation is a problem found in a layout spec. Line and Column are 1-based
+// and zero when unknown; Path is the dotted path of the offending value.
+type Violation struct {
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	if v.Path != "" {
+		return v.Path + ": " + v.Message
+	}
+	return v.Message
+}
+
+// ValidationError is returned when a spec can't be parsed or is invalid.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, v.String())
+	}
+	return "invalid layout: " + strings.Join(msgs, "; ")
+}
+
+// Column fields.
+var columnFields = map[string]bool{"description": true, "quantity": true, "unit_price": true, "total": true}
+
+var (
+	colorRe      = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+	fontFamilyRe = regexp.MustCompile(`^[A-Za-z0-9 ,-]{1,100}$`)
+	assetNameRe  = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,99}$`)
+	localeRe     = regexp.MustCompile(`^[A-Za-z]{2,3}(?:[-_][A-Za-z0-9]{2,8})?$`)
+	yamlLineRe   = regexp.MustCompile(`^line (\d+): `)
+
+	jsonUnknownFieldRe = regexp.MustCompile(`^unknown field ("[^"]*")`)
+)
+
+// maxLabelLength caps the length of text set in a spec.
+const maxLabelLength = 500
+
+// Parse decodes a JSON or YAML spec and validates it. Unknown fields are
+// rejected so typos don't go unnoticed. Problems are returned as a
+// *ValidationError.
+func Parse(content string) (*Spec, error) {
+	var spec Spec
+	trimmed := strings.TrimSpace(content)
+	if trimmed == "" {
+		return nil, &ValidationError{Violations: []Violation{{Message: "layout is empty"}}}
+	}
+
+	if strings.HasPrefix(trimmed, "{") {
+		dec := json.NewDecoder(strings.NewReader(content))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&spec); err != nil {
+			return nil, &ValidationError{Violations: []Violation{jsonViolation(content, err)}}
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			return nil, &ValidationError{Violations: []Violation{{Message: "unexpected data after the layout object"}}}
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader([]byte(content)))
+		dec.KnownFields(true)
+		if err := dec.Decode(&spec); err != nil {
+			return nil, &ValidationError{Violations: yamlViolations(err)}
+		}
+	}
+
+	if violations := spec.Validate(); len(violations) > 0 {
+		return nil, &ValidationError{Violations: violations}
+	}
+	return &spec, nil
+}
+
+// jsonViolation turns a JSON decoding error into a positioned violation.
+func jsonViolation(content string, err error) Violation {
+	var offset int64 = -1
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	}
+	v := Violation{Message: strings.TrimPrefix(err.Error(), "json: ")}
+	if typeErr != nil && typeErr.Field != "" {
+		v.Path = typeErr.Field
+	}
+	// Unknown field errors carry no offset; point at the field's first use.
+	if m := jsonUnknownFieldRe.FindStringSubmatch(v.Message); m != nil {
+		offset = int64(strings.Index(content, m[1]))
+	}
+	if offset >= 0 && offset <= int64(len(content)) {
+		before := content[:offset]
+		v.Line = strings.Count(before, "\n") + 1
+		v.Column = int(offset) - strings.LastIndex(before, "\n")
+	}
+	return v
+}
+
+// yamlViolations turns a YAML decoding error, which may list several
+// problems, into violations.
+func yamlViolations(err error) []Violation {
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		violations := make([]Violation, 0, len(typeErr.Errors))
+		for _, msg := range typeErr.Errors {
+			violations = append(violations, yamlViolation(msg))
+		}
+		return violations
+	}
+	return []Violation{yamlViolation(strings.TrimPrefix(err.Error(), "yaml: "))}
+}
+
+func yamlViolation(msg string) Violation {
+	v := Violation{Message: msg}
+	if m := yamlLineRe.FindStringSubmatch(msg); m != nil {
+		v.Line, _ = strconv.Atoi(m[1])
+		v.Message = msg[len(m[0]):]
+	}
+	return v
+}
+
+// Validate checks the spec's values and returns every problem found.
+func (s *Spec) Validate() []Violation {
+	var violations []Violation
+	fail := func(path, format string, args ...interface{}) {
+		violations = append(violations, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	oneOf := func(path, value string, allowed ...string) {
+		if value == "" {
+			return
+		}
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		fail(path, "must be one of %s", strings.Join(allowed, ", "))
+	}
+	label := func(path, value string) {
+		if len(value) > maxLabelLength {
+			fail(path, "must be at most %d characters", maxLabelLength)
+		}
+	}
+
+	if s.Version != 0 && s.Version != 1 {
+		fail("version", "unsupported layout version %d", s.Version)
+	}
+	if s.Locale != "" && !localeRe.MatchString(s.Locale) {
+		fail("locale", "must be a language code such as \"en\" or \"de-CH\"")
+	}
+
+	oneOf("page.size", s.Page.Size, "A4", "Letter")
+	if m := s.Page.MarginMM; m != nil && (*m < 0 || *m > 50) {
+		fail("page.margin_mm", "must be between 0 and 50")
+	}
+
+	if c := s.Theme.PrimaryColor; c != "" && !colorRe.MatchString(c) {
+		fail("theme.primary_color", "must be a hex colour such as #1a2b3c")
+	}
+	if c := s.Theme.TextColor; c != "" && !colorRe.MatchString(c) {
+		fail("theme.text_color", "must be a hex colour such as #1a2b3c")
+	}
+	if f := s.Theme.FontFamily; f != "" && !fontFamilyRe.MatchString(f) {
+		fail("theme.font_family", "may only contain letters, digits, spaces, commas and hyphens")
+	}
+	if a := s.Theme.FontAsset; a != "" && !assetNameRe.MatchString(a) {
+		fail("theme.font_asset", "must be the name of a template asset")
+	}
+	if size := s.Theme.FontSizePT; size != 0 && (size < 6 || size > 16) {
+		fail("theme.font_size_pt", "must be between 6 and 16")
+	}
+
+	label("header.title", s.Header.Title)
+	oneOf("header.logo", s.Header.Logo, "company", "template", "none")
+	oneOf("header.align", s.Header.Align, "left", "center", "right")
+
+	label("details.number_label", s.Details.NumberLabel)
+	label("details.date_label", s.Details.DateLabel)
+	label("details.due_date_label", s.Details.DueDateLabel)
+	label("details.reference_label", s.Details.ReferenceLabel)
+	if f := s.Details.DateFormat; f != "" && (len(f) > 50 || !strings.ContainsAny(f, "0126")) {
+		fail("details.date_format", "must be a Go date layout such as 2006-01-02")
+	}
+
+	label("addresses.sender_label", s.Addresses.SenderLabel)
+	label("addresses.recipient_label", s.Addresses.RecipientLabel)
+
+	seen := map[string]bool{}
+	var width float64
+	for i, col := range s.Items.Columns {
+		path := fmt.Sprintf("items.columns[%d]", i)
+		switch {
+		case !columnFields[col.Field]:
+			fail(path+".field", "must be one of description, quantity, unit_price, total")
+		case seen[col.Field]:
+			fail(path+".field", "column %q appears more than once", col.Field)
+		}
+		seen[col.Field] = true
+		label(path+".label", col.Label)
+		oneOf(path+".align", col.Align, "left", "center", "right")
+		if col.WidthPercent < 0 || col.WidthPercent > 100 {
+			fail(path+".width_percent", "must be between 0 and 100")
+		}
+		width += col.WidthPercent
+	}
+	if width > 100 {
+		fail("items.columns", "column widths add up to more than 100%%")
+	}
+
+	label("totals.subtotal_label", s.Totals.SubtotalLabel)
+	label("totals.tax_label", s.Totals.TaxLabel)
+	label("totals.total_label", s.Totals.TotalLabel)
+	label("notes.title", s.Notes.Title)
+	label("payment.title", s.Payment.Title)
+	oneOf("payment.qr", s.Payment.QR, "none", "epc", "swiss")
+	if len(s.Footer.Text) > 2000 {
+		fail("footer.text", "must be at most 2000 characters")
+	}
+
+	return violations
+}
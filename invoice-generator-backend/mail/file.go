@@ -0,0 +1,36 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileTransport writes each message to an .eml file in a directory instead
+// of delivering it, for development and demos.
+type FileTransport struct {
+	dir string
+}
+
+// NewFileTransport creates dir if needed and returns a transport writing
+// there.
+func NewFileTransport(dir string) (*FileTransport, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create mail outbox directory: %v", err)
+	}
+	return &FileTransport{dir: dir}, nil
+}
+
+// Send writes msg to <dir>/<time>_<message id>.eml.
+func (t *FileTransport) Send(msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%s.eml", time.Now().UTC().Format("20060102T150405"), msg.MessageID)
+	if err := os.WriteFile(filepath.Join(t.dir, name), data, 0644); err != nil {
+		return fmt.Errorf("failed to write message to outbox: %v", err)
+	}
+	return nil
+}
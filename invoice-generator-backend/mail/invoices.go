@@ -0,0 +1,209 @@
+package mail
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+	"time"
+
+	"invoice-generator-go/config"
+	"invoice-generator-go/export"
+	"invoice-generator-go/models"
+	"invoice-generator-go/pdf"
+	"invoice-generator-go/storage"
+
+	"github.com/google/uuid"
+)
+
+// ErrDelivery is returned, wrapped, when the transport failed to deliver a
+// message. The failure is logged in sent_emails.
+var ErrDelivery = errors.New("email delivery failed")
+
+// SendOptions are the recipients of an email and optional replacements for
+// the template's subject and body, which may use placeholders too.
+type SendOptions struct {
+	To      []string
+	Cc      []string
+	Subject string
+	Body    string
+}
+
+// TemplateFor returns the user's email template of kind, or the built-in
+// one when the user hasn't customised it.
+func TemplateFor(userID uuid.UUID, kind string) (models.EmailTemplate, error) {
+	t, err := storage.GetEmailTemplate(userID, kind)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DefaultTemplate(kind), nil
+	}
+	if err != nil {
+		return models.EmailTemplate{}, fmt.Errorf("failed to get email template: %v", err)
+	}
+	return *t, nil
+}
+
+// SendInvoice emails an invoice with its PDF attached and logs the attempt.
+// Draft invoices are issued: they are rendered without the draft stamp and
+// move to sent once delivered. The PDF counts as handed out, so later
+// downloads are stamped as copies.
+func SendInvoice(invoice *models.Invoice, opts SendOptions) (*models.SentEmail, error) {
+	company, err := storage.GetCompanyProfileForInvoice(invoice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get company profile: %v", err)
+	}
+	tmpl, err := TemplateFor(invoice.UserID, KindInvoice)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Subject != "" {
+		tmpl.Subject = opts.Subject
+	}
+	if opts.Body != "" {
+		tmpl.Body = opts.Body
+	}
+
+	issued := *invoice
+	if issued.Status == "draft" {
+		// A PDF stored while drafting carries the draft stamp
+		issued.Status = "sent"
+		issued.PdfPath = ""
+	}
+	data, stored, err := invoiceAttachment(issued)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := InvoiceVars(issued, *company)
+	msg := newMessage(company, opts.To, opts.Cc, Render(tmpl.Subject, vars), Render(tmpl.Body, vars))
+	msg.Attachments = []Attachment{invoicePDFAttachment(issued, data)}
+
+	sent, sendErr := deliver(msg, invoice.UserID, &invoice.ID, KindInvoice)
+	if sent == nil {
+		return nil, sendErr
+	}
+	if sendErr != nil {
+		return sent, sendErr
+	}
+
+	if !stored {
+		issued.PdfPath = pdf.StoredPDFPath(issued)
+	}
+	if issued.Status != invoice.Status || issued.PdfPath != invoice.PdfPath {
+		issued.UpdatedAt = time.Now()
+		if err := storage.UpdateInvoice(&issued); err != nil {
+			log.Printf("Error updating sent invoice: %v", err)
+		}
+	}
+	// Written after the status change so the file doesn't look stale; a
+	// missing file is rendered again on the next download
+	if !stored {
+		if err := os.WriteFile(issued.PdfPath, data, 0644); err != nil {
+			log.Printf("Error storing sent invoice PDF: %v", err)
+		}
+	}
+	if _, err := storage.MarkInvoiceDownloaded(invoice.ID); err != nil {
+		log.Printf("Error recording invoice hand-out: %v", err)
+	}
+	return sent, nil
+}
+
+// SendReminder emails a payment reminder of kind about an invoice to its
+// customer and logs it. With attachPDF the invoice's PDF is attached.
+func SendReminder(invoice *models.Invoice, kind string, attachPDF bool) (*models.SentEmail, error) {
+	company, err := storage.GetCompanyProfileForInvoice(invoice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get company profile: %v", err)
+	}
+	tmpl, err := TemplateFor(invoice.UserID, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := InvoiceVars(*invoice, *company)
+	msg := newMessage(company, []string{invoice.CustomerEmail}, nil, Render(tmpl.Subject, vars), Render(tmpl.Body, vars))
+	if attachPDF {
+		data, _, err := invoiceAttachment(*invoice)
+		if err != nil {
+			return nil, err
+		}
+		msg.Attachments = []Attachment{invoicePDFAttachment(*invoice, data)}
+	}
+	return deliver(msg, invoice.UserID, &invoice.ID, kind)
+}
+
+// newMessage addresses a message from the configured sender address under
+// the company's name, with replies going to the company's email.
+func newMessage(company *models.CompanyProfile, to, cc []string, subject, text string) *Message {
+	msg := &Message{
+		From:    mail.Address{Name: company.CompanyName, Address: config.GetConfig().MailFrom},
+		To:      to,
+		Cc:      cc,
+		Subject: subject,
+		Text:    text,
+	}
+	if company.Email != "" {
+		msg.ReplyTo = &mail.Address{Name: company.CompanyName, Address: company.Email}
+	}
+	return msg
+}
+
+func invoicePDFAttachment(invoice models.Invoice, data []byte) Attachment {
+	return Attachment{
+		FileName:    "invoice_" + invoice.InvoiceNumber + ".pdf",
+		ContentType: "application/pdf",
+		Data:        data,
+	}
+}
+
+// invoiceAttachment returns the PDF to attach: the stored file of an issued
+// invoice unless it is stale, or a fresh rendering, reporting which.
+func invoiceAttachment(invoice models.Invoice) ([]byte, bool, error) {
+	if path, ok := export.StoredPDF(invoice); ok && invoice.Status != "draft" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return data, true, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, false, fmt.Errorf("failed to read PDF file: %v", err)
+		}
+	}
+	data, err := pdf.RenderPDF(invoice, pdf.Options{})
+	if err != nil {
+		return nil, false, err
+	}
+	return data, false, nil
+}
+
+// deliver sends msg with Default and logs the attempt. It returns the log
+// entry, and an error wrapping ErrDelivery when delivery failed; the entry
+// is nil only when logging failed.
+func deliver(msg *Message, userID uuid.UUID, invoiceID *uuid.UUID, kind string) (*models.SentEmail, error) {
+	entry := models.SentEmail{
+		UserID:     userID,
+		InvoiceID:  invoiceID,
+		Kind:       kind,
+		Recipients: msg.Recipients(),
+		Subject:    msg.Subject,
+		Status:     "sent",
+	}
+	sendErr := Default.Send(msg)
+	entry.MessageID = msg.MessageID
+	if sendErr != nil {
+		entry.Status = "failed"
+		entry.Error = sendErr.Error()
+	}
+	if err := storage.CreateSentEmail(&entry); err != nil {
+		if sendErr != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDelivery, sendErr)
+		}
+		// The message went out; only the log entry is missing
+		log.Printf("Error logging sent email: %v", err)
+		return &entry, nil
+	}
+	if sendErr != nil {
+		return &entry, fmt.Errorf("%w: %v", ErrDelivery, sendErr)
+	}
+	return &entry, nil
+}
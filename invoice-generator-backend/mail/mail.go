@@ -0,0 +1,162 @@
+// Package mail sends email: invoices and reminders to customers. Messages
+// are delivered over SMTP, or written to an outbox directory during
+// development. Email texts come from editable templates with placeholders.
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"invoice-generator-go/config"
+
+	"github.com/google/uuid"
+)
+
+// Message is an email to send.
+type Message struct {
+	From    mail.Address
+	ReplyTo *mail.Address
+	To      []string
+	Cc      []string
+	Subject string
+	// Text is the plain text body.
+	Text        string
+	Attachments []Attachment
+	// MessageID is set when the message is built, without angle brackets.
+	MessageID string
+}
+
+// Attachment is a file attached to a message.
+type Attachment struct {
+	FileName    string
+	ContentType string
+	Data        []byte
+}
+
+// Recipients returns the To and Cc addresses.
+func (m *Message) Recipients() []string {
+	return append(append([]string{}, m.To...), m.Cc...)
+}
+
+// Transport delivers messages.
+type Transport interface {
+	Send(msg *Message) error
+}
+
+// Default is the transport used by the application. It is set up by
+// Configure.
+var Default Transport
+
+// Configure initialises Default from the configuration: an SMTP transport,
+// or a file transport writing to the outbox directory.
+func Configure(cfg *config.AppConfig) error {
+	switch cfg.MailTransport {
+	case "smtp":
+		Default = &SMTPTransport{Host: cfg.SMTPHost, Port: cfg.SMTPPort, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword}
+	case "file":
+		transport, err := NewFileTransport(cfg.MailOutboxDir)
+		if err != nil {
+			return err
+		}
+		Default = transport
+	default:
+		return fmt.Errorf("unknown mail transport %q, expected smtp or file", cfg.MailTransport)
+	}
+	return nil
+}
+
+// Bytes builds the RFC 5322 message: a plain text body followed by the
+// attachments as a multipart/mixed message. It assigns MessageID if unset.
+func (m *Message) Bytes() ([]byte, error) {
+	if len(m.To) == 0 {
+		return nil, fmt.Errorf("message has no recipients")
+	}
+	if m.MessageID == "" {
+		m.MessageID = uuid.New().String() + "@" + domain(m.From.Address)
+	}
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", m.From.String())
+	if m.ReplyTo != nil {
+		header("Reply-To", m.ReplyTo.String())
+	}
+	header("To", strings.Join(m.To, ", "))
+	if len(m.Cc) > 0 {
+		header("Cc", strings.Join(m.Cc, ", "))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+m.MessageID+">")
+	header("MIME-Version", "1.0")
+
+	w := multipart.NewWriter(&buf)
+	header("Content-Type", `multipart/mixed; boundary="`+w.Boundary()+`"`)
+	buf.WriteString("\r\n")
+
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write message body: %v", err)
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(m.Text, "\n", "\r\n"))); err != nil {
+		return nil, fmt.Errorf("failed to write message body: %v", err)
+	}
+	if err := qp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write message body: %v", err)
+	}
+
+	for _, a := range m.Attachments {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.FileName})},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to attach %s: %v", a.FileName, err)
+		}
+		if err := writeBase64(part, a.Data); err != nil {
+			return nil, fmt.Errorf("failed to attach %s: %v", a.FileName, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish message: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBase64 writes data base64 encoded in lines of 76 characters.
+func writeBase64(w interface{ Write([]byte) (int, error) }, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		n := 76
+		if len(encoded) < n {
+			n = len(encoded)
+		}
+		if _, err := w.Write([]byte(encoded[:n] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+func domain(address string) string {
+	if i := strings.LastIndex(address, "@"); i >= 0 && i < len(address)-1 {
+		return address[i+1:]
+	}
+	return "localhost"
+}
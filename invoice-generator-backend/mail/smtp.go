@@ -0,0 +1,77 @@
+package mail
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+const (
+	dialTimeout = 10 * time.Second
+	sendTimeout = 60 * time.Second
+)
+
+// SMTPTransport delivers messages to an SMTP server, upgrading to TLS when
+// the server offers STARTTLS and authenticating when a username is set.
+// Development stand-ins such as MailHog accept mail on port 1025 without
+// either.
+type SMTPTransport struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+// Send delivers msg to its recipients.
+func (t *SMTPTransport) Send(msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(t.Host, t.Port), dialTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(sendTimeout))
+
+	client, err := smtp.NewClient(conn, t.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %v", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: t.Host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %v", err)
+		}
+	}
+	if t.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", t.Username, t.Password, t.Host)); err != nil {
+			return fmt.Errorf("failed to authenticate with SMTP server: %v", err)
+		}
+	}
+
+	if err := client.Mail(msg.From.Address); err != nil {
+		return fmt.Errorf("SMTP server rejected sender: %v", err)
+	}
+	for _, rcpt := range msg.Recipients() {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("SMTP server rejected recipient %s: %v", rcpt, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send message: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to send message: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected message: %v", err)
+	}
+	return client.Quit()
+}
@@ -0,0 +1,172 @@
+package mail
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"invoice-generator-go/models"
+)
+
+// Email template kinds.
+const (
+	// KindInvoice is the email an invoice is sent with.
+	KindInvoice = "invoice"
+	// KindReminderUpcoming, KindReminderOverdue and KindReminderFinal are
+	// the payment reminders sent by dunning policies, from a friendly note
+	// before the due date to the final notice.
+	KindReminderUpcoming = "reminder_upcoming"
+	KindReminderOverdue  = "reminder_overdue"
+	KindReminderFinal    = "reminder_final"
+)
+
+// defaultTemplates are used for kinds the account hasn't customised.
+var defaultTemplates = map[string]models.EmailTemplate{
+	KindInvoice: {
+		Subject: "Invoice {{invoice_number}} from {{company_name}}",
+		Body: `Dear {{customer_name}},
+
+please find attached invoice {{invoice_number}} of {{invoice_date}} for {{currency}} {{total}}, due on {{due_date}}.
+
+Kind regards,
+{{company_name}}`,
+	},
+	KindReminderUpcoming: {
+		Subject: "Upcoming payment: invoice {{invoice_number}} is due on {{due_date}}",
+		Body: `Dear {{customer_name}},
+
+this is a friendly reminder that invoice {{invoice_number}} of {{invoice_date}} over {{currency}} {{balance_due}} is due on {{due_date}}.
+
+If you have already paid, please disregard this message.
+
+Kind regards,
+{{company_name}}`,
+	},
+	KindReminderOverdue: {
+		Subject: "Payment reminder: invoice {{invoice_number}} is overdue",
+		Body: `Dear {{customer_name}},
+
+our records show that invoice {{invoice_number}} of {{invoice_date}} was due on {{due_date}} and {{currency}} {{balance_due}} is still open, {{days_overdue}} days past due.
+
+Please arrange payment at your earliest convenience. If you have already paid, please disregard this message.
+
+Kind regards,
+{{company_name}}`,
+	},
+	KindReminderFinal: {
+		Subject: "Final notice: invoice {{invoice_number}}",
+		Body: `Dear {{customer_name}},
+
+despite our earlier reminders, invoice {{invoice_number}} of {{invoice_date}} remains unpaid: {{currency}} {{balance_due}} has been due since {{due_date}} ({{days_overdue}} days).
+
+Please pay the open amount within 7 days. Otherwise we will have to take further steps to collect it.
+
+Kind regards,
+{{company_name}}`,
+	},
+}
+
+// Placeholders lists the placeholders email templates may use, with what
+// they are replaced by.
+var Placeholders = map[string]string{
+	"invoice_number": "the invoice number",
+	"invoice_date":   "the invoice date, YYYY-MM-DD",
+	"due_date":       "the due date, YYYY-MM-DD",
+	"customer_name":  "the customer's name",
+	"company_name":   "the sender's company name",
+	"currency":       "the invoice currency code",
+	"total":          "the invoice total",
+	"balance_due":    "the amount still open",
+	"days_overdue":   "the days since the due date, 0 before it",
+}
+
+var placeholderRe = regexp.MustCompile(`\{\{\s*([a-z_]+)\s*\}\}`)
+
+// ValidKind reports whether kind is an email template kind.
+func ValidKind(kind string) bool {
+	_, ok := defaultTemplates[kind]
+	return ok
+}
+
+// Kinds lists the email template kinds, sorted.
+func Kinds() []string {
+	kinds := make([]string, 0, len(defaultTemplates))
+	for kind := range defaultTemplates {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// DefaultTemplate returns the built-in template of kind.
+func DefaultTemplate(kind string) models.EmailTemplate {
+	t := defaultTemplates[kind]
+	t.Kind = kind
+	t.IsDefault = true
+	return t
+}
+
+// ValidateTemplate checks that a template's subject and body are set, fit
+// their columns and only use known placeholders.
+func ValidateTemplate(t models.EmailTemplate) error {
+	if strings.TrimSpace(t.Subject) == "" || strings.TrimSpace(t.Body) == "" {
+		return fmt.Errorf("subject and body are required")
+	}
+	return ValidateOverrides(t.Subject, t.Body)
+}
+
+// ValidateOverrides checks a subject and body replacing a template's for one
+// email; either may be empty to keep the template's.
+func ValidateOverrides(subject, body string) error {
+	if len(subject) > 255 {
+		return fmt.Errorf("subject exceeds 255 characters")
+	}
+	if strings.ContainsAny(subject, "\r\n") {
+		return fmt.Errorf("subject must be a single line")
+	}
+	if len(body) > 20000 {
+		return fmt.Errorf("body exceeds 20000 characters")
+	}
+	for _, text := range []string{subject, body} {
+		for _, m := range placeholderRe.FindAllStringSubmatch(text, -1) {
+			if _, ok := Placeholders[m[1]]; !ok {
+				return fmt.Errorf("unknown placeholder {{%s}}", m[1])
+			}
+		}
+	}
+	return nil
+}
+
+// Render fills in the placeholders of text from vars. Unknown placeholders
+// are left as they are.
+func Render(text string, vars map[string]string) string {
+	return placeholderRe.ReplaceAllStringFunc(text, func(m string) string {
+		name := placeholderRe.FindStringSubmatch(m)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return m
+	})
+}
+
+// InvoiceVars returns the placeholder values for an invoice sent by company.
+func InvoiceVars(invoice models.Invoice, company models.CompanyProfile) map[string]string {
+	overdue := int(time.Since(invoice.DueDate).Hours() / 24)
+	if overdue < 0 {
+		overdue = 0
+	}
+	return map[string]string{
+		"invoice_number": invoice.InvoiceNumber,
+		"invoice_date":   invoice.InvoiceDate.Format("2006-01-02"),
+		"due_date":       invoice.DueDate.Format("2006-01-02"),
+		"customer_name":  invoice.CustomerName,
+		"company_name":   company.CompanyName,
+		"currency":       invoice.Currency,
+		"total":          strconv.FormatFloat(invoice.TotalAmount, 'f', 2, 64),
+		"balance_due":    strconv.FormatFloat(invoice.TotalAmount-invoice.AmountPaid, 'f', 2, 64),
+		"days_overdue":   strconv.Itoa(overdue),
+	}
+}
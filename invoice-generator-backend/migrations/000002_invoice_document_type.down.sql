@@ -0,0 +1,4 @@
+-- migrations/000002_invoice_document_type.down.sql
+ALTER TABLE invoices
+    DROP COLUMN IF EXISTS buyer_reference,
+    DROP COLUMN IF EXISTS document_type;
@@ -0,0 +1,5 @@
+-- migrations/000002_invoice_document_type.up.sql
+ALTER TABLE invoices
+    ADD COLUMN IF NOT EXISTS document_type VARCHAR(20) NOT NULL DEFAULT 'invoice'
+        CHECK (document_type IN ('invoice', 'credit_note')),
+    ADD COLUMN IF NOT EXISTS buyer_reference VARCHAR(255);
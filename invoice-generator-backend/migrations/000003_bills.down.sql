@@ -0,0 +1,9 @@
+-- migrations/000003_bills.down.sql
+DROP TRIGGER IF EXISTS update_bill_items_updated_at ON bill_items;
+DROP TRIGGER IF EXISTS update_bills_updated_at ON bills;
+DROP TRIGGER IF EXISTS update_suppliers_updated_at ON suppliers;
+
+DROP TABLE IF EXISTS bill_payments;
+DROP TABLE IF EXISTS bill_items;
+DROP TABLE IF EXISTS bills;
+DROP TABLE IF EXISTS suppliers;
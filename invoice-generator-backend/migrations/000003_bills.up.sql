@@ -0,0 +1,83 @@
+-- migrations/000003_bills.up.sql
+CREATE TABLE IF NOT EXISTS suppliers (
+                                         id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                         user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                         name VARCHAR(255) NOT NULL,
+                                         email VARCHAR(255),
+                                         address TEXT,
+                                         city VARCHAR(255),
+                                         postal_code VARCHAR(50),
+                                         country_code VARCHAR(2),
+                                         vat_id VARCHAR(50),
+                                         created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                         updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS bills (
+                                     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                     supplier_id UUID NOT NULL REFERENCES suppliers(id) ON DELETE RESTRICT,
+                                     bill_number VARCHAR(100) NOT NULL,
+                                     document_type VARCHAR(20) NOT NULL DEFAULT 'invoice'
+                                         CHECK (document_type IN ('invoice', 'credit_note')),
+                                     status VARCHAR(20) NOT NULL DEFAULT 'open'
+                                         CHECK (status IN ('open', 'partially_paid', 'paid', 'void')),
+                                     bill_date TIMESTAMP WITH TIME ZONE NOT NULL,
+                                     due_date TIMESTAMP WITH TIME ZONE,
+                                     currency VARCHAR(3) NOT NULL,
+                                     subtotal DECIMAL(15,2) NOT NULL CHECK (subtotal >= 0),
+                                     tax_amount DECIMAL(15,2) NOT NULL DEFAULT 0 CHECK (tax_amount >= 0),
+                                     total_amount DECIMAL(15,2) NOT NULL CHECK (total_amount >= 0),
+                                     amount_paid DECIMAL(15,2) NOT NULL DEFAULT 0 CHECK (amount_paid >= 0),
+                                     notes TEXT,
+                                     source_format VARCHAR(10) NOT NULL CHECK (source_format IN ('ubl', 'cii')),
+                                     source_document TEXT NOT NULL,
+                                     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                     UNIQUE(user_id, supplier_id, bill_number)
+);
+
+CREATE TABLE IF NOT EXISTS bill_items (
+                                          id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                          bill_id UUID NOT NULL REFERENCES bills(id) ON DELETE CASCADE,
+                                          description TEXT NOT NULL,
+                                          quantity DECIMAL(15,4) NOT NULL,
+                                          unit_price DECIMAL(15,4) NOT NULL,
+                                          tax_rate DECIMAL(5,2) NOT NULL DEFAULT 0,
+                                          total_price DECIMAL(15,2) NOT NULL,
+                                          created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                          updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS bill_payments (
+                                             id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                             bill_id UUID NOT NULL REFERENCES bills(id) ON DELETE CASCADE,
+                                             amount DECIMAL(15,2) NOT NULL CHECK (amount > 0),
+                                             paid_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                                             reference VARCHAR(255),
+                                             created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_suppliers_user_id ON suppliers(user_id);
+CREATE INDEX IF NOT EXISTS idx_suppliers_user_vat ON suppliers(user_id, vat_id);
+CREATE INDEX IF NOT EXISTS idx_bills_user_id ON bills(user_id);
+CREATE INDEX IF NOT EXISTS idx_bills_supplier_id ON bills(supplier_id);
+CREATE INDEX IF NOT EXISTS idx_bills_status ON bills(status);
+CREATE INDEX IF NOT EXISTS idx_bills_due_date ON bills(due_date);
+CREATE INDEX IF NOT EXISTS idx_bill_items_bill_id ON bill_items(bill_id);
+CREATE INDEX IF NOT EXISTS idx_bill_payments_bill_id ON bill_payments(bill_id);
+
+CREATE TRIGGER update_suppliers_updated_at
+    BEFORE UPDATE ON suppliers
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_bills_updated_at
+    BEFORE UPDATE ON bills
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_bill_items_updated_at
+    BEFORE UPDATE ON bill_items
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
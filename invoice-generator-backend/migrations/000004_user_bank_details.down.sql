@@ -0,0 +1,8 @@
+-- migrations/000004_user_bank_details.down.sql
+ALTER TABLE users
+    DROP COLUMN IF EXISTS bic,
+    DROP COLUMN IF EXISTS iban,
+    DROP COLUMN IF EXISTS country_code,
+    DROP COLUMN IF EXISTS city,
+    DROP COLUMN IF EXISTS postal_code,
+    DROP COLUMN IF EXISTS address_line;
@@ -0,0 +1,8 @@
+-- migrations/000004_user_bank_details.up.sql
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS address_line VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS postal_code VARCHAR(16),
+    ADD COLUMN IF NOT EXISTS city VARCHAR(35),
+    ADD COLUMN IF NOT EXISTS country_code VARCHAR(2),
+    ADD COLUMN IF NOT EXISTS iban VARCHAR(34),
+    ADD COLUMN IF NOT EXISTS bic VARCHAR(11);
@@ -0,0 +1,24 @@
+-- migrations/000005_company_profiles.down.sql
+ALTER TABLE invoices
+    DROP COLUMN IF EXISTS company_profile_id;
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS address_line VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS postal_code VARCHAR(16),
+    ADD COLUMN IF NOT EXISTS city VARCHAR(35),
+    ADD COLUMN IF NOT EXISTS country_code VARCHAR(2),
+    ADD COLUMN IF NOT EXISTS iban VARCHAR(34),
+    ADD COLUMN IF NOT EXISTS bic VARCHAR(11);
+
+UPDATE users u
+SET address_line = p.address_line,
+    postal_code = p.postal_code,
+    city = p.city,
+    country_code = p.country_code,
+    iban = p.iban,
+    bic = p.bic
+FROM company_profiles p
+WHERE p.user_id = u.id AND p.is_default;
+
+DROP TRIGGER IF EXISTS update_company_profiles_updated_at ON company_profiles;
+DROP TABLE IF EXISTS company_profiles;
@@ -0,0 +1,48 @@
+-- migrations/000005_company_profiles.up.sql
+CREATE TABLE IF NOT EXISTS company_profiles (
+                                                id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                                user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                                name VARCHAR(100) NOT NULL,
+                                                is_default BOOLEAN NOT NULL DEFAULT FALSE,
+                                                company_name VARCHAR(255) NOT NULL,
+                                                address_line VARCHAR(255),
+                                                postal_code VARCHAR(16),
+                                                city VARCHAR(35),
+                                                country_code VARCHAR(2),
+                                                email VARCHAR(255),
+                                                phone VARCHAR(50),
+                                                website VARCHAR(255),
+                                                tax_id VARCHAR(50),
+                                                bank_name VARCHAR(255),
+                                                iban VARCHAR(34),
+                                                bic VARCHAR(11),
+                                                legal_footer TEXT,
+                                                logo_key VARCHAR(255),
+                                                created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                                updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_company_profiles_user_id ON company_profiles(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_company_profiles_one_default ON company_profiles(user_id) WHERE is_default;
+
+CREATE TRIGGER update_company_profiles_updated_at
+    BEFORE UPDATE ON company_profiles
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- Every existing account gets a default profile carrying its current
+-- sender and bank details.
+INSERT INTO company_profiles (user_id, name, is_default, company_name, address_line, postal_code, city, country_code, email, iban, bic)
+SELECT id, 'Default', TRUE, COALESCE(NULLIF(company_name, ''), email), address_line, postal_code, city, country_code, email, iban, bic
+FROM users;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS bic,
+    DROP COLUMN IF EXISTS iban,
+    DROP COLUMN IF EXISTS country_code,
+    DROP COLUMN IF EXISTS city,
+    DROP COLUMN IF EXISTS postal_code,
+    DROP COLUMN IF EXISTS address_line;
+
+ALTER TABLE invoices
+    ADD COLUMN IF NOT EXISTS company_profile_id UUID REFERENCES company_profiles(id) ON DELETE SET NULL;
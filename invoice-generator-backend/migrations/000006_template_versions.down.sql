@@ -0,0 +1,8 @@
+-- migrations/000006_template_versions.down.sql
+ALTER TABLE invoices
+    DROP COLUMN IF EXISTS template_version;
+
+DROP TABLE IF EXISTS template_versions;
+
+ALTER TABLE templates
+    DROP COLUMN IF EXISTS current_version;
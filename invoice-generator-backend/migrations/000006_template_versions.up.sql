@@ -0,0 +1,28 @@
+-- migrations/000006_template_versions.up.sql
+ALTER TABLE templates
+    ADD COLUMN IF NOT EXISTS current_version INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS template_versions (
+                                                 id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                                 template_id UUID NOT NULL REFERENCES templates(id) ON DELETE CASCADE,
+                                                 version INTEGER NOT NULL CHECK (version > 0),
+                                                 language VARCHAR(50),
+                                                 content TEXT NOT NULL,
+                                                 created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                                 UNIQUE(template_id, version)
+);
+
+-- Invoices record the template version they were issued under once they
+-- leave draft; NULL means "render with the current version".
+ALTER TABLE invoices
+    ADD COLUMN IF NOT EXISTS template_version INTEGER;
+
+-- Existing template content becomes version 1, and invoices already issued
+-- are pinned to it.
+INSERT INTO template_versions (template_id, version, language, content, created_at)
+SELECT id, 1, language, content, updated_at
+FROM templates;
+
+UPDATE invoices
+SET template_version = 1
+WHERE template_id IS NOT NULL AND status <> 'draft';
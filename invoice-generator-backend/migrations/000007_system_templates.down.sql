@@ -0,0 +1,13 @@
+-- migrations/000007_system_templates.down.sql
+-- System templates still used by issued invoices would lose their owner, so
+-- the invoices are detached first.
+UPDATE invoices
+SET template_id = NULL, template_version = NULL
+WHERE template_id IN (SELECT id FROM templates WHERE user_id IS NULL);
+
+DELETE FROM templates WHERE user_id IS NULL;
+
+ALTER TABLE templates
+    DROP CONSTRAINT IF EXISTS templates_owner_check,
+    DROP COLUMN IF EXISTS system_key,
+    ALTER COLUMN user_id SET NOT NULL;
@@ -0,0 +1,8 @@
+-- migrations/000007_system_templates.up.sql
+-- System templates have no owner and are shared by all accounts. They are
+-- synced from the templates bundled with the backend at startup, keyed by
+-- system_key.
+ALTER TABLE templates
+    ALTER COLUMN user_id DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS system_key VARCHAR(100) UNIQUE,
+    ADD CONSTRAINT templates_owner_check CHECK ((user_id IS NULL) = (system_key IS NOT NULL));
@@ -0,0 +1,6 @@
+-- migrations/000008_default_templates.down.sql
+DROP TRIGGER IF EXISTS update_customer_templates_updated_at ON customer_templates;
+DROP TABLE IF EXISTS customer_templates;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS default_template_id;
@@ -0,0 +1,23 @@
+-- migrations/000008_default_templates.up.sql
+-- Invoices without a template fall back to the customer's default template,
+-- then the account's default, then the system default.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS default_template_id UUID REFERENCES templates(id) ON DELETE SET NULL;
+
+-- Customers are identified by the (lower-cased) email on their invoices.
+CREATE TABLE IF NOT EXISTS customer_templates (
+                                                  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                                  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                                  customer_email VARCHAR(255) NOT NULL,
+                                                  template_id UUID NOT NULL REFERENCES templates(id) ON DELETE CASCADE,
+                                                  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                                  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                                  UNIQUE(user_id, customer_email)
+);
+
+CREATE INDEX IF NOT EXISTS idx_customer_templates_template_id ON customer_templates(template_id);
+
+CREATE TRIGGER update_customer_templates_updated_at
+    BEFORE UPDATE ON customer_templates
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,3 @@
+-- migrations/000009_template_assets.down.sql
+DROP TRIGGER IF EXISTS update_template_assets_updated_at ON template_assets;
+DROP TABLE IF EXISTS template_assets;
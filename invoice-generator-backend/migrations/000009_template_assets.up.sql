@@ -0,0 +1,19 @@
+-- migrations/000009_template_assets.up.sql
+-- Images and fonts uploaded for a template. The file contents live in the
+-- blob store under blob_key; templates refer to assets by name.
+CREATE TABLE IF NOT EXISTS template_assets (
+                                               id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                               template_id UUID NOT NULL REFERENCES templates(id) ON DELETE CASCADE,
+                                               name VARCHAR(100) NOT NULL,
+                                               content_type VARCHAR(100) NOT NULL,
+                                               size INTEGER NOT NULL CHECK (size >= 0),
+                                               blob_key VARCHAR(255) NOT NULL,
+                                               created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                               updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                               UNIQUE(template_id, name)
+);
+
+CREATE TRIGGER update_template_assets_updated_at
+    BEFORE UPDATE ON template_assets
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,5 @@
+-- migrations/000010_translations.down.sql
+DROP TRIGGER IF EXISTS update_customer_languages_updated_at ON customer_languages;
+DROP TABLE IF EXISTS customer_languages;
+DROP TRIGGER IF EXISTS update_translations_updated_at ON translations;
+DROP TABLE IF EXISTS translations;
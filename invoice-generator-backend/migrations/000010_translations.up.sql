@@ -0,0 +1,35 @@
+-- migrations/000010_translations.up.sql
+-- Account-specific translations override the bundled catalogs per locale and
+-- key.
+CREATE TABLE IF NOT EXISTS translations (
+                                            id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                            user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                            locale VARCHAR(20) NOT NULL,
+                                            key VARCHAR(100) NOT NULL,
+                                            value TEXT NOT NULL,
+                                            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                            updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                            UNIQUE(user_id, locale, key)
+);
+
+CREATE TRIGGER update_translations_updated_at
+    BEFORE UPDATE ON translations
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- The language a customer, identified by the (lower-cased) email on their
+-- invoices, receives documents in.
+CREATE TABLE IF NOT EXISTS customer_languages (
+                                                  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                                  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                                  customer_email VARCHAR(255) NOT NULL,
+                                                  language VARCHAR(20) NOT NULL,
+                                                  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                                  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                                  UNIQUE(user_id, customer_email)
+);
+
+CREATE TRIGGER update_customer_languages_updated_at
+    BEFORE UPDATE ON customer_languages
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
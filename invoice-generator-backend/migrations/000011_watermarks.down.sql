@@ -0,0 +1,7 @@
+-- migrations/000011_watermarks.down.sql
+ALTER TABLE templates DROP COLUMN IF EXISTS watermarks;
+DROP TRIGGER IF EXISTS set_invoices_paid_at ON invoices;
+DROP FUNCTION IF EXISTS set_invoice_paid_at();
+ALTER TABLE invoices
+    DROP COLUMN IF EXISTS downloaded_at,
+    DROP COLUMN IF EXISTS paid_at;
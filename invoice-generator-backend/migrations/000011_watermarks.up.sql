@@ -0,0 +1,29 @@
+-- migrations/000011_watermarks.up.sql
+-- paid_at dates the PAID stamp; downloaded_at marks invoices whose PDF was
+-- handed out, so later downloads are stamped as copies.
+ALTER TABLE invoices
+    ADD COLUMN IF NOT EXISTS paid_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS downloaded_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE invoices SET paid_at = updated_at WHERE status = 'paid';
+
+CREATE OR REPLACE FUNCTION set_invoice_paid_at()
+    RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.status = 'paid' THEN
+        NEW.paid_at = COALESCE(NEW.paid_at, CURRENT_TIMESTAMP);
+    ELSE
+        NEW.paid_at = NULL;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER set_invoices_paid_at
+    BEFORE INSERT OR UPDATE OF status ON invoices
+    FOR EACH ROW
+EXECUTE FUNCTION set_invoice_paid_at();
+
+-- The status stamps a template shows; NULL shows all of them.
+ALTER TABLE templates
+    ADD COLUMN IF NOT EXISTS watermarks TEXT[];
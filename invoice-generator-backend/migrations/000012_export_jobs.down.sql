@@ -0,0 +1,3 @@
+-- migrations/000012_export_jobs.down.sql
+DROP TRIGGER IF EXISTS update_export_jobs_updated_at ON export_jobs;
+DROP TABLE IF EXISTS export_jobs;
@@ -0,0 +1,24 @@
+-- migrations/000012_export_jobs.up.sql
+-- Bulk PDF exports processed in the background. The finished ZIP or PDF
+-- lives in the blob store under blob_key.
+CREATE TABLE IF NOT EXISTS export_jobs (
+                                           id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                           user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                           format VARCHAR(10) NOT NULL CHECK (format IN ('zip', 'pdf')),
+                                           status VARCHAR(20) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'done', 'failed')),
+                                           total INTEGER NOT NULL CHECK (total >= 0),
+                                           processed INTEGER NOT NULL DEFAULT 0 CHECK (processed >= 0),
+                                           error TEXT,
+                                           file_name VARCHAR(255),
+                                           blob_key VARCHAR(255),
+                                           created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                           updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                           finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_export_jobs_user_id ON export_jobs(user_id);
+
+CREATE TRIGGER update_export_jobs_updated_at
+    BEFORE UPDATE ON export_jobs
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_invoices_customer_email;
+DROP TABLE IF EXISTS invoice_payments;
+ALTER TABLE invoices DROP COLUMN IF EXISTS amount_paid;
@@ -0,0 +1,25 @@
+-- Payments received against invoices, mirroring bill_payments. amount_paid
+-- is kept in step with the payments so open balances need no aggregate.
+ALTER TABLE invoices
+    ADD COLUMN IF NOT EXISTS amount_paid DECIMAL(15,2) NOT NULL DEFAULT 0 CHECK (amount_paid >= 0);
+
+CREATE TABLE IF NOT EXISTS invoice_payments (
+                                                id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                                invoice_id UUID NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+                                                amount DECIMAL(15,2) NOT NULL CHECK (amount > 0),
+                                                paid_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                                                reference VARCHAR(255),
+                                                created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoice_payments_invoice_id ON invoice_payments(invoice_id);
+CREATE INDEX IF NOT EXISTS idx_invoices_customer_email ON invoices(user_id, LOWER(customer_email));
+
+-- Invoices marked paid before payments were tracked are settled in full on
+-- the date they were paid, so account statements balance.
+INSERT INTO invoice_payments (invoice_id, amount, paid_at)
+SELECT id, total_amount, COALESCE(paid_at, updated_at)
+FROM invoices
+WHERE status = 'paid' AND document_type = 'invoice' AND total_amount > 0;
+
+UPDATE invoices SET amount_paid = total_amount WHERE status = 'paid' AND document_type = 'invoice';
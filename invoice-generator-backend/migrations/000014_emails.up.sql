@@ -0,0 +1,33 @@
+-- Email texts an account has customised; kinds without a row use the
+-- built-in text.
+CREATE TABLE IF NOT EXISTS email_templates (
+                                               user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                               kind VARCHAR(50) NOT NULL,
+                                               subject VARCHAR(255) NOT NULL,
+                                               body TEXT NOT NULL,
+                                               created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                               updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                               PRIMARY KEY (user_id, kind)
+);
+
+CREATE TRIGGER update_email_templates_updated_at
+    BEFORE UPDATE ON email_templates
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- Log of the emails sent to customers and whether delivery succeeded.
+CREATE TABLE IF NOT EXISTS sent_emails (
+                                           id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                           user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                           invoice_id UUID REFERENCES invoices(id) ON DELETE SET NULL,
+                                           kind VARCHAR(50) NOT NULL,
+                                           recipients TEXT[] NOT NULL,
+                                           subject VARCHAR(255) NOT NULL,
+                                           status VARCHAR(20) NOT NULL CHECK (status IN ('sent', 'failed')),
+                                           error TEXT,
+                                           message_id VARCHAR(255),
+                                           created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sent_emails_user_id ON sent_emails(user_id);
+CREATE INDEX IF NOT EXISTS idx_sent_emails_invoice_id ON sent_emails(invoice_id);
@@ -0,0 +1,43 @@
+-- Per-account dunning policy: the reminder steps, as JSON
+-- [{"days": -3, "template": "reminder_upcoming", "attach_pdf": false}, ...]
+-- with days relative to the due date.
+CREATE TABLE IF NOT EXISTS dunning_policies (
+                                                user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+                                                enabled BOOLEAN NOT NULL DEFAULT FALSE,
+                                                steps JSONB NOT NULL DEFAULT '[]',
+                                                created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                                updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_dunning_policies_updated_at
+    BEFORE UPDATE ON dunning_policies
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- Customers, by email, that never get reminders.
+CREATE TABLE IF NOT EXISTS dunning_exclusions (
+                                                  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                                  customer_email VARCHAR(255) NOT NULL,
+                                                  reason TEXT,
+                                                  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                                  PRIMARY KEY (user_id, customer_email)
+);
+
+-- Each reminder step taken for an invoice. A step is claimed as pending
+-- before its email goes out, so it is sent at most once; failed steps are
+-- retried on the next run.
+CREATE TABLE IF NOT EXISTS dunning_events (
+                                              id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                              user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                              invoice_id UUID NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+                                              step INTEGER NOT NULL,
+                                              days INTEGER NOT NULL,
+                                              template VARCHAR(50) NOT NULL,
+                                              status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+                                              sent_email_id UUID REFERENCES sent_emails(id) ON DELETE SET NULL,
+                                              error TEXT,
+                                              created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dunning_events_step ON dunning_events(invoice_id, step) WHERE status IN ('pending', 'sent');
+CREATE INDEX IF NOT EXISTS idx_dunning_events_user_id ON dunning_events(user_id);
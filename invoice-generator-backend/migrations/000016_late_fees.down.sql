@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_invoices_overdue;
+DROP TABLE IF EXISTS late_fee_charges;
+DROP TABLE IF EXISTS late_fee_rules;
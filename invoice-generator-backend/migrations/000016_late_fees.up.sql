@@ -0,0 +1,35 @@
+-- Per-account late payment charges: a fixed fee once an invoice is overdue
+-- and interest on the open balance, either simple at annual_rate or
+-- statutory at a reference rate plus margin.
+CREATE TABLE IF NOT EXISTS late_fee_rules (
+                                              user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+                                              fixed_fee DECIMAL(15,2) NOT NULL DEFAULT 0 CHECK (fixed_fee >= 0),
+                                              interest_type VARCHAR(20) NOT NULL DEFAULT 'none' CHECK (interest_type IN ('none', 'simple', 'statutory')),
+                                              annual_rate DECIMAL(7,4) NOT NULL DEFAULT 0 CHECK (annual_rate >= 0),
+                                              margin DECIMAL(7,4) NOT NULL DEFAULT 8 CHECK (margin >= 0),
+                                              base_rate DECIMAL(7,4),
+                                              grace_days INTEGER NOT NULL DEFAULT 0 CHECK (grace_days >= 0),
+                                              created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                              updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_late_fee_rules_updated_at
+    BEFORE UPDATE ON late_fee_rules
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- Late payment charges billed for an invoice on a follow-up invoice.
+-- Interest up to interest_to has been charged; deleting or voiding the
+-- follow-up invoice releases the charge.
+CREATE TABLE IF NOT EXISTS late_fee_charges (
+                                                id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                                invoice_id UUID NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+                                                charge_invoice_id UUID NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+                                                interest_to TIMESTAMP WITH TIME ZONE NOT NULL,
+                                                fixed_fee DECIMAL(15,2) NOT NULL DEFAULT 0,
+                                                interest DECIMAL(15,2) NOT NULL DEFAULT 0,
+                                                created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_late_fee_charges_invoice_id ON late_fee_charges(invoice_id);
+CREATE INDEX IF NOT EXISTS idx_invoices_overdue ON invoices(due_date) WHERE status IN ('sent', 'overdue');
@@ -0,0 +1,9 @@
+ALTER TABLE invoice_payments DROP COLUMN IF EXISTS discount;
+ALTER TABLE invoices
+    DROP COLUMN IF EXISTS discount_due_date,
+    DROP COLUMN IF EXISTS discount_percent,
+    DROP COLUMN IF EXISTS payment_terms,
+    DROP COLUMN IF EXISTS payment_terms_id;
+DROP TABLE IF EXISTS customer_payment_terms;
+ALTER TABLE users DROP COLUMN IF EXISTS default_payment_terms_id;
+DROP TABLE IF EXISTS payment_terms;
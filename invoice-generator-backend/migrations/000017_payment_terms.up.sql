@@ -0,0 +1,62 @@
+-- Named payment terms decide when an invoice is due and whether paying early
+-- earns a discount. System terms have no owner and are shared by all
+-- accounts; invoices without terms of their own use the customer's, then the
+-- account's default, then Net 30.
+CREATE TABLE IF NOT EXISTS payment_terms (
+                                             id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                             user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+                                             system_key VARCHAR(50) UNIQUE,
+                                             name VARCHAR(100) NOT NULL,
+                                             due_days INTEGER NOT NULL CHECK (due_days >= 0 AND due_days <= 365),
+                                             end_of_month BOOLEAN NOT NULL DEFAULT FALSE,
+                                             discount_percent DECIMAL(5,2) NOT NULL DEFAULT 0 CHECK (discount_percent >= 0 AND discount_percent < 100),
+                                             discount_days INTEGER NOT NULL DEFAULT 0 CHECK (discount_days >= 0),
+                                             created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                             updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                             CONSTRAINT payment_terms_owner_check CHECK ((user_id IS NULL) = (system_key IS NOT NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_terms_name ON payment_terms(user_id, LOWER(name));
+
+CREATE TRIGGER update_payment_terms_updated_at
+    BEFORE UPDATE ON payment_terms
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO payment_terms (system_key, name, due_days, end_of_month, discount_percent, discount_days)
+VALUES ('net_15', 'Net 15', 15, FALSE, 0, 0),
+       ('net_30', 'Net 30', 30, FALSE, 0, 0),
+       ('eom_30', 'End of month + 30', 30, TRUE, 0, 0),
+       ('2_10_net_30', '2/10 Net 30', 30, FALSE, 2, 10)
+ON CONFLICT (system_key) DO NOTHING;
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS default_payment_terms_id UUID REFERENCES payment_terms(id) ON DELETE SET NULL;
+
+-- Customers are identified by the (lower-cased) email on their invoices.
+CREATE TABLE IF NOT EXISTS customer_payment_terms (
+                                                      id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                                      user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                                      customer_email VARCHAR(255) NOT NULL,
+                                                      payment_terms_id UUID NOT NULL REFERENCES payment_terms(id) ON DELETE CASCADE,
+                                                      created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                                      updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                                      UNIQUE(user_id, customer_email)
+);
+
+CREATE TRIGGER update_customer_payment_terms_updated_at
+    BEFORE UPDATE ON customer_payment_terms
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- Invoices keep the name and discount of their terms as issued, so editing
+-- the terms later doesn't change them.
+ALTER TABLE invoices
+    ADD COLUMN IF NOT EXISTS payment_terms_id UUID REFERENCES payment_terms(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS payment_terms VARCHAR(100),
+    ADD COLUMN IF NOT EXISTS discount_percent DECIMAL(5,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS discount_due_date TIMESTAMP WITH TIME ZONE;
+
+-- The early payment discount a payment settled on top of its amount.
+ALTER TABLE invoice_payments
+    ADD COLUMN IF NOT EXISTS discount DECIMAL(15,2) NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+ALTER TABLE invoices
+    DROP COLUMN IF EXISTS view_count,
+    DROP COLUMN IF EXISTS first_viewed_at;
+DROP TABLE IF EXISTS share_links;
@@ -0,0 +1,24 @@
+-- Links that let customers, who have no login, view their invoices. A link
+-- opens either one invoice or all issued invoices of one customer
+-- (identified by the lower-cased email on their invoices). Only a SHA-256
+-- hash of the token is stored; the token itself is shown once.
+CREATE TABLE IF NOT EXISTS share_links (
+                                           id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                           user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                           invoice_id UUID REFERENCES invoices(id) ON DELETE CASCADE,
+                                           customer_email VARCHAR(255),
+                                           token_hash CHAR(64) NOT NULL UNIQUE,
+                                           expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                                           revoked_at TIMESTAMP WITH TIME ZONE,
+                                           last_used_at TIMESTAMP WITH TIME ZONE,
+                                           created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                           CONSTRAINT share_links_scope_check CHECK ((invoice_id IS NULL) <> (customer_email IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_links_invoice_id ON share_links(invoice_id);
+CREATE INDEX IF NOT EXISTS idx_share_links_customer ON share_links(user_id, customer_email);
+
+-- Views of an invoice through a share link.
+ALTER TABLE invoices
+    ADD COLUMN IF NOT EXISTS first_viewed_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS view_count INTEGER NOT NULL DEFAULT 0;
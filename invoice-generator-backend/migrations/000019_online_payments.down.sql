@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_invoice_payments_provider_payment;
+ALTER TABLE invoice_payments
+    DROP COLUMN IF EXISTS provider_payment_id,
+    DROP COLUMN IF EXISTS provider;
+DROP TABLE IF EXISTS payment_events;
+DROP TABLE IF EXISTS checkout_sessions;
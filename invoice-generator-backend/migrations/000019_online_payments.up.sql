@@ -0,0 +1,40 @@
+-- Hosted checkout sessions started with the online payment provider for
+-- customers paying an invoice.
+CREATE TABLE IF NOT EXISTS checkout_sessions (
+                                                 id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                                 invoice_id UUID NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+                                                 provider VARCHAR(20) NOT NULL,
+                                                 provider_session_id VARCHAR(255) NOT NULL,
+                                                 amount DECIMAL(15,2) NOT NULL CHECK (amount > 0),
+                                                 currency VARCHAR(3) NOT NULL,
+                                                 url TEXT NOT NULL,
+                                                 status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'paid', 'failed', 'expired')),
+                                                 created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                                 updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                                 UNIQUE(provider, provider_session_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_checkout_sessions_invoice_id ON checkout_sessions(invoice_id);
+
+CREATE TRIGGER update_checkout_sessions_updated_at
+    BEFORE UPDATE ON checkout_sessions
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- Webhook events already processed, so redelivered ones are skipped.
+CREATE TABLE IF NOT EXISTS payment_events (
+                                              provider VARCHAR(20) NOT NULL,
+                                              event_id VARCHAR(255) NOT NULL,
+                                              type VARCHAR(50) NOT NULL,
+                                              received_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                              PRIMARY KEY (provider, event_id)
+);
+
+-- Payments taken online name the provider's payment, which is recorded at
+-- most once.
+ALTER TABLE invoice_payments
+    ADD COLUMN IF NOT EXISTS provider VARCHAR(20),
+    ADD COLUMN IF NOT EXISTS provider_payment_id VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invoice_payments_provider_payment
+    ON invoice_payments(provider, provider_payment_id) WHERE provider_payment_id IS NOT NULL;
@@ -0,0 +1,73 @@
+-- Endpoints an account has subscribed to its invoice events. The secret
+-- signs the payloads sent, so it is kept as is.
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+                                                     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                                     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                                     url TEXT NOT NULL,
+                                                     secret VARCHAR(255) NOT NULL,
+                                                     event_types TEXT[] NOT NULL,
+                                                     active BOOLEAN NOT NULL DEFAULT TRUE,
+                                                     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                                     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_user_id ON webhook_subscriptions(user_id);
+
+CREATE TRIGGER update_webhook_subscriptions_updated_at
+    BEFORE UPDATE ON webhook_subscriptions
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- Outbox of invoice events, written in the same transaction as the change
+-- they report. The payload is the JSON body sent to subscribers. Events are
+-- dispatched once deliveries to the matching subscriptions are queued. They
+-- outlive the invoice, so invoice_id is no foreign key.
+CREATE TABLE IF NOT EXISTS webhook_events (
+                                              id UUID PRIMARY KEY,
+                                              user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                              type VARCHAR(50) NOT NULL,
+                                              invoice_id UUID NOT NULL,
+                                              payload JSONB NOT NULL,
+                                              created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                              dispatched_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_events_undispatched ON webhook_events(created_at) WHERE dispatched_at IS NULL;
+
+-- One event to one subscription, attempted until the endpoint accepts it or
+-- the retries run out. A pending delivery is attempted at next_attempt_at.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+                                                  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                                  subscription_id UUID NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+                                                  event_id UUID NOT NULL REFERENCES webhook_events(id) ON DELETE CASCADE,
+                                                  status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+                                                  attempts INTEGER NOT NULL DEFAULT 0,
+                                                  next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                                  last_attempt_at TIMESTAMP WITH TIME ZONE,
+                                                  response_status INTEGER,
+                                                  last_error TEXT,
+                                                  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                                  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                                  UNIQUE(subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription ON webhook_deliveries(subscription_id, created_at);
+
+CREATE TRIGGER update_webhook_deliveries_updated_at
+    BEFORE UPDATE ON webhook_deliveries
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- Log of every attempt at a delivery, with the endpoint's answer.
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+                                                         id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                                         delivery_id UUID NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+                                                         attempted_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                                                         duration_ms INTEGER NOT NULL,
+                                                         response_status INTEGER,
+                                                         response_body TEXT,
+                                                         error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_attempts_delivery_id ON webhook_delivery_attempts(delivery_id, attempted_at);
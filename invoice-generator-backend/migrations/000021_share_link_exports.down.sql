@@ -0,0 +1,4 @@
+-- migrations/000021_share_link_exports.down.sql
+DROP INDEX IF EXISTS idx_export_jobs_share_link_id;
+ALTER TABLE export_jobs
+    DROP COLUMN IF EXISTS share_link_id;
@@ -0,0 +1,7 @@
+-- Downloads through customer share links run as export jobs of the link's
+-- owner. share_link_id scopes such a job to its link; the owner's own jobs
+-- leave it NULL.
+ALTER TABLE export_jobs
+    ADD COLUMN IF NOT EXISTS share_link_id UUID REFERENCES share_links(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_export_jobs_share_link_id ON export_jobs(share_link_id);
@@ -0,0 +1,5 @@
+-- migrations/000022_invoice_status_changed_at.down.sql
+DROP TRIGGER IF EXISTS set_invoices_status_changed_at ON invoices;
+DROP FUNCTION IF EXISTS set_invoice_status_changed_at();
+ALTER TABLE invoices
+    DROP COLUMN IF EXISTS status_changed_at;
@@ -0,0 +1,24 @@
+-- migrations/000022_invoice_status_changed_at.up.sql
+-- status_changed_at dates an invoice's last status change. A stored PDF
+-- older than that may carry a stale stamp, such as DRAFT on a sent invoice,
+-- and is rendered again.
+ALTER TABLE invoices
+    ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP WITH TIME ZONE;
+
+-- Issued invoices may have been stored while still drafts
+UPDATE invoices SET status_changed_at = updated_at WHERE status <> 'draft';
+
+CREATE OR REPLACE FUNCTION set_invoice_status_changed_at()
+    RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.status IS DISTINCT FROM OLD.status THEN
+        NEW.status_changed_at = CURRENT_TIMESTAMP;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER set_invoices_status_changed_at
+    BEFORE UPDATE OF status ON invoices
+    FOR EACH ROW
+EXECUTE FUNCTION set_invoice_status_changed_at();
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,41 +17,488 @@ type User struct {
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+// CompanyProfile holds the sender details printed on invoices. An account
+// can have several profiles, e.g. for different trading names; exactly one
+// of them is the default.
+type CompanyProfile struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;default:uuid_generate_v4()"`
+	UserID      uuid.UUID `json:"user_id" gorm:"type:uuid;not null"`
+	Name        string    `json:"name" gorm:"not null"`
+	IsDefault   bool      `json:"is_default"`
+	CompanyName string    `json:"company_name" gorm:"not null"`
+	AddressLine string    `json:"address_line,omitempty"`
+	PostalCode  string    `json:"postal_code,omitempty"`
+	City        string    `json:"city,omitempty"`
+	CountryCode string    `json:"country_code,omitempty" gorm:"type:varchar(2)"`
+	Email       string    `json:"email,omitempty"`
+	Phone       string    `json:"phone,omitempty"`
+	Website     string    `json:"website,omitempty"`
+	TaxID       string    `json:"tax_id,omitempty"`
+	BankName    string    `json:"bank_name,omitempty"`
+	IBAN        string    `json:"iban,omitempty"`
+	BIC         string    `json:"bic,omitempty"`
+	LegalFooter string    `json:"legal_footer,omitempty"`
+	LogoKey     string    `json:"-"`
+	HasLogo     bool      `json:"has_logo" gorm:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
 // Template represents an invoice template in the system.
 type Template struct {
 	ID            uuid.UUID `json:"id" gorm:"type:uuid;default:uuid_generate_v4()"`
-	UserID        uuid.UUID `json:"user_id" gorm:"type:uuid"`
+	UserID        uuid.UUID `json:"user_id" gorm:"type:uuid"` // uuid.Nil for system templates
+	IsSystem      bool      `json:"is_system" gorm:"-"`       // Bundled with the app and shared by all accounts; read-only
 	Name          string    `json:"name"`
 	Language      string    `json:"language"`
 	BackgroundURL *string   `json:"background_url,omitempty"`
 	LogoURL       *string   `json:"logo_url,omitempty"`
 	Content       string    `json:"content"`
+	// Watermarks lists the status stamps the template shows: "draft",
+	// "paid", "void" and "copy". Nil shows all of them.
+	Watermarks []string `json:"watermarks"`
+	// CurrentVersion is the number of the latest entry in the template's
+	// version history.
+	CurrentVersion int       `json:"current_version"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// TemplateVersion is a snapshot of a template's content. A new version is
+// recorded whenever the content changes.
+type TemplateVersion struct {
+	ID         uuid.UUID `json:"id"`
+	TemplateID uuid.UUID `json:"template_id"`
+	Version    int       `json:"version"`
+	Language   string    `json:"language"`
+	Content    string    `json:"content,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TemplateAsset is an image or font uploaded for a template and referenced
+// from its content with {{asset "name"}}.
+type TemplateAsset struct {
+	ID          uuid.UUID `json:"id"`
+	TemplateID  uuid.UUID `json:"template_id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	BlobKey     string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CustomerTemplate assigns a default template to a customer, identified by
+// the email address on their invoices.
+type CustomerTemplate struct {
+	ID            uuid.UUID `json:"id"`
+	UserID        uuid.UUID `json:"user_id"`
+	CustomerEmail string    `json:"customer_email" binding:"required,email"`
+	TemplateID    uuid.UUID `json:"template_id" binding:"required"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// PaymentTerms decide when an invoice is due: DueDays after the invoice
+// date, or after the end of its month with EndOfMonth. Paying within
+// DiscountDays of the invoice date earns a DiscountPercent discount.
+type PaymentTerms struct {
+	ID              uuid.UUID `json:"id"`
+	UserID          uuid.UUID `json:"user_id"`   // uuid.Nil for system terms
+	IsSystem        bool      `json:"is_system"` // Shared by all accounts; read-only
+	Name            string    `json:"name" binding:"required"`
+	DueDays         int       `json:"due_days"`
+	EndOfMonth      bool      `json:"end_of_month"`
+	DiscountPercent float64   `json:"discount_percent"`
+	DiscountDays    int       `json:"discount_days"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// CustomerPaymentTerms assigns default payment terms to a customer,
+// identified by the email address on their invoices.
+type CustomerPaymentTerms struct {
+	ID             uuid.UUID `json:"id"`
+	UserID         uuid.UUID `json:"user_id"`
+	CustomerEmail  string    `json:"customer_email" binding:"required,email"`
+	PaymentTermsID uuid.UUID `json:"payment_terms_id" binding:"required"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// CustomerLanguage sets the language documents for a customer, identified
+// by the email address on their invoices, are rendered in.
+type CustomerLanguage struct {
+	ID            uuid.UUID `json:"id"`
+	UserID        uuid.UUID `json:"user_id"`
+	CustomerEmail string    `json:"customer_email" binding:"required,email"`
+	Language      string    `json:"language" binding:"required"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 // Invoice represents an invoice in the system.
 type Invoice struct {
-	ID              uuid.UUID     `json:"id,omitempty" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
-	UserID          uuid.UUID     `json:"user_id,omitempty" gorm:"type:uuid;not null"`
-	TemplateID      *uuid.UUID    `json:"template_id,omitempty" gorm:"type:uuid"` // Made optional
-	InvoiceNumber   string        `json:"invoice_number" binding:"required" gorm:"not null"`
-	Status          string        `json:"status" gorm:"type:varchar(20);default:'draft';check:status in ('draft','sent','paid','overdue','void')"`
-	CustomerName    string        `json:"customer_name" binding:"required" gorm:"not null"`
-	CustomerEmail   string        `json:"customer_email" binding:"omitempty,email"`
-	CustomerAddress string        `json:"customer_address"`
-	InvoiceDate     time.Time     `json:"invoice_date" binding:"required" gorm:"not null"`
-	DueDate         time.Time     `json:"due_date" binding:"required" gorm:"not null"`
-	Currency        string        `json:"currency" gorm:"type:varchar(3);default:'USD'"`
-	Subtotal        float64       `json:"subtotal" binding:"required,min=0" gorm:"type:decimal(15,2);not null;check:subtotal >= 0"`
-	TaxRate         float64       `json:"tax_rate" binding:"min=0,max=100" gorm:"type:decimal(5,2);check:tax_rate >= 0 AND tax_rate <= 100"`
-	TaxAmount       float64       `json:"tax_amount" binding:"min=0" gorm:"type:decimal(15,2);check:tax_amount >= 0"`
-	TotalAmount     float64       `json:"total_amount" binding:"required,min=0" gorm:"type:decimal(15,2);not null;check:total_amount >= 0"`
-	Notes           string        `json:"notes,omitempty"`
-	PdfPath         string        `json:"pdf_path,omitempty"`
-	Items           []InvoiceItem `json:"items,omitempty" gorm:"-"` // Transient field for items
-	CreatedAt       time.Time     `json:"created_at,omitempty" gorm:"default:CURRENT_TIMESTAMP"`
-	UpdatedAt       time.Time     `json:"updated_at,omitempty" gorm:"default:CURRENT_TIMESTAMP"`
+	ID               uuid.UUID     `json:"id,omitempty" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	UserID           uuid.UUID     `json:"user_id,omitempty" gorm:"type:uuid;not null"`
+	TemplateID       *uuid.UUID    `json:"template_id,omitempty" gorm:"type:uuid"`         // Made optional
+	TemplateVersion  *int          `json:"template_version,omitempty" gorm:"type:integer"` // Pinned once the invoice leaves draft
+	CompanyProfileID *uuid.UUID    `json:"company_profile_id,omitempty" gorm:"type:uuid"`  // Defaults to the user's default profile
+	InvoiceNumber    string        `json:"invoice_number" binding:"required" gorm:"not null"`
+	Status           string        `json:"status" gorm:"type:varchar(20);default:'draft';check:status in ('draft','sent','paid','overdue','void')"`
+	DocumentType     string        `json:"document_type" gorm:"type:varchar(20);default:'invoice';check:document_type in ('invoice','credit_note')"`
+	BuyerReference   string        `json:"buyer_reference,omitempty"`
+	CustomerName     string        `json:"customer_name" binding:"required" gorm:"not null"`
+	CustomerEmail    string        `json:"customer_email" binding:"omitempty,email"`
+	CustomerAddress  string        `json:"customer_address"`
+	InvoiceDate      time.Time     `json:"invoice_date" binding:"required" gorm:"not null"`
+	DueDate          time.Time     `json:"due_date" binding:"required" gorm:"not null"`
+	PaymentTermsID   *uuid.UUID    `json:"payment_terms_id,omitempty" gorm:"type:uuid"`
+	PaymentTerms     string        `json:"payment_terms,omitempty"`     // Name of the terms as issued
+	DiscountPercent  float64       `json:"discount_percent,omitempty"`  // Early payment discount
+	DiscountDueDate  *time.Time    `json:"discount_due_date,omitempty"` // Last day the discount applies
+	Currency         string        `json:"currency" gorm:"type:varchar(3);default:'USD'"`
+	Subtotal         float64       `json:"subtotal" binding:"required,min=0" gorm:"type:decimal(15,2);not null;check:subtotal >= 0"`
+	TaxRate          float64       `json:"tax_rate" binding:"min=0,max=100" gorm:"type:decimal(5,2);check:tax_rate >= 0 AND tax_rate <= 100"`
+	TaxAmount        float64       `json:"tax_amount" binding:"min=0" gorm:"type:decimal(15,2);check:tax_amount >= 0"`
+	TotalAmount      float64       `json:"total_amount" binding:"required,min=0" gorm:"type:decimal(15,2);not null;check:total_amount >= 0"`
+	Notes            string        `json:"notes,omitempty"`
+	PdfPath          string        `json:"pdf_path,omitempty"`
+	AmountPaid       float64       `json:"amount_paid"`                 // Sum of the recorded payments and discounts
+	PaidAt           *time.Time    `json:"paid_at,omitempty"`           // Set by the database when the status becomes paid
+	StatusChangedAt  *time.Time    `json:"status_changed_at,omitempty"` // Set by the database when the status changes
+	FirstViewedAt    *time.Time    `json:"first_viewed_at,omitempty"`   // First view through a share link
+	ViewCount        int           `json:"view_count"`                  // Views through share links
+	Items            []InvoiceItem `json:"items,omitempty" gorm:"-"`    // Transient field for items
+	CreatedAt        time.Time     `json:"created_at,omitempty" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt        time.Time     `json:"updated_at,omitempty" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// Payment records a payment received against an invoice.
+type Payment struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;default:uuid_generate_v4()"`
+	InvoiceID uuid.UUID `json:"invoice_id" gorm:"type:uuid;not null"`
+	Amount    float64   `json:"amount" binding:"required,gt=0" gorm:"type:decimal(15,2);not null"`
+	PaidAt    time.Time `json:"paid_at"`
+	Reference string    `json:"reference,omitempty"`
+	// Discount is the early payment discount the payment was granted on top
+	// of its amount; it is worked out when the payment is recorded.
+	Discount float64 `json:"discount,omitempty"`
+	// Provider and ProviderPaymentID identify payments taken online.
+	Provider          string    `json:"provider,omitempty"`
+	ProviderPaymentID string    `json:"provider_payment_id,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// CheckoutSession is a hosted payment page started with the online payment
+// provider for a customer to pay an invoice.
+type CheckoutSession struct {
+	ID                uuid.UUID `json:"id"`
+	InvoiceID         uuid.UUID `json:"invoice_id"`
+	Provider          string    `json:"provider"`
+	ProviderSessionID string    `json:"provider_session_id"`
+	Amount            float64   `json:"amount"`
+	Currency          string    `json:"currency"`
+	URL               string    `json:"url"`
+	Status            string    `json:"status"` // open, paid, failed or expired
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Statement is a customer's account statement for a period in one
+// currency. Amounts are positive when the customer owes them.
+type Statement struct {
+	CustomerName    string           `json:"customer_name"`
+	CustomerEmail   string           `json:"customer_email"`
+	CustomerAddress string           `json:"customer_address,omitempty"`
+	Currency        string           `json:"currency"`
+	From            time.Time        `json:"from"`
+	To              time.Time        `json:"to"`
+	OpeningBalance  float64          `json:"opening_balance"`
+	Entries         []StatementEntry `json:"entries"`
+	ClosingBalance  float64          `json:"closing_balance"`
+	Aging           StatementAging   `json:"aging"`
+}
+
+// StatementEntry is an invoice, credit note or payment on a statement.
+type StatementEntry struct {
+	Date          time.Time  `json:"date"`
+	Type          string     `json:"type"` // invoice, credit_note or payment
+	InvoiceID     uuid.UUID  `json:"invoice_id"`
+	InvoiceNumber string     `json:"invoice_number"`
+	Reference     string     `json:"reference,omitempty"`
+	DueDate       *time.Time `json:"due_date,omitempty"`
+	// Amount is what the entry adds to the balance: negative for credit
+	// notes and payments.
+	Amount  float64 `json:"amount"`
+	Balance float64 `json:"balance"`
+}
+
+// StatementAging splits the closing balance by how long invoices are past
+// their due date. Unapplied credits reduce Current.
+type StatementAging struct {
+	Current    float64 `json:"current"`
+	Days1To30  float64 `json:"days_1_30"`
+	Days31To60 float64 `json:"days_31_60"`
+	Days61To90 float64 `json:"days_61_90"`
+	Over90     float64 `json:"over_90"`
+}
+
+// EmailTemplate is the subject and body of an email kind, e.g. "invoice",
+// with {{placeholder}}s filled in when it is sent.
+type EmailTemplate struct {
+	Kind    string `json:"kind"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	// IsDefault marks the built-in text of a kind the account hasn't
+	// customised.
+	IsDefault bool       `json:"is_default"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// SentEmail is the log entry of an email sent to a customer.
+type SentEmail struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	InvoiceID  *uuid.UUID `json:"invoice_id,omitempty"`
+	Kind       string     `json:"kind"`
+	Recipients []string   `json:"recipients"`
+	Subject    string     `json:"subject"`
+	Status     string     `json:"status"` // sent or failed
+	Error      string     `json:"error,omitempty"`
+	MessageID  string     `json:"message_id,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// DunningPolicy is an account's schedule of payment reminders for unpaid
+// invoices.
+type DunningPolicy struct {
+	Enabled   bool          `json:"enabled"`
+	Steps     []DunningStep `json:"steps"`
+	UpdatedAt *time.Time    `json:"updated_at,omitempty"`
+}
+
+// DunningStep is a reminder sent Days after an invoice's due date, or before
+// it when negative, using the email template Template.
+type DunningStep struct {
+	Days      int    `json:"days"`
+	Template  string `json:"template"`
+	AttachPDF bool   `json:"attach_pdf"`
+}
+
+// DunningExclusion exempts a customer from reminders.
+type DunningExclusion struct {
+	CustomerEmail string    `json:"customer_email" binding:"required,email"`
+	Reason        string    `json:"reason,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// DunningEvent records a reminder step taken for an invoice.
+type DunningEvent struct {
+	ID          uuid.UUID  `json:"id"`
+	InvoiceID   uuid.UUID  `json:"invoice_id"`
+	Step        int        `json:"step"` // 1-based position in the policy
+	Days        int        `json:"days"`
+	Template    string     `json:"template"`
+	Status      string     `json:"status"` // pending, sent or failed
+	SentEmailID *uuid.UUID `json:"sent_email_id,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// LateFeeRule is an account's charges on invoices paid late: a fixed fee
+// once an invoice is overdue and interest on its open balance.
+type LateFeeRule struct {
+	FixedFee     float64    `json:"fixed_fee"`
+	InterestType string     `json:"interest_type"`       // none, simple or statutory
+	AnnualRate   float64    `json:"annual_rate"`         // Percent a year, for simple interest
+	Margin       float64    `json:"margin"`              // Points over the reference rate, for statutory interest
+	BaseRate     *float64   `json:"base_rate,omitempty"` // Replaces the bundled ECB reference rate
+	GraceDays    int        `json:"grace_days"`          // Days after the due date before charges start
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+}
+
+// LateFeeAssessment is what an invoice owes in late payment charges as of a
+// date, less what was already billed on follow-up invoices.
+type LateFeeAssessment struct {
+	InvoiceID   uuid.UUID        `json:"invoice_id"`
+	Currency    string           `json:"currency"`
+	AsOf        time.Time        `json:"as_of"`
+	DaysOverdue int              `json:"days_overdue"`
+	OpenBalance float64          `json:"open_balance"`
+	FixedFee    float64          `json:"fixed_fee"`
+	Interest    float64          `json:"interest"`
+	Total       float64          `json:"total"`
+	Periods     []InterestPeriod `json:"periods"`
+	// ChargedTo is the end of the interest already billed, if any.
+	ChargedTo *time.Time `json:"charged_to,omitempty"`
+}
+
+// InterestPeriod is a stretch of days with the same open balance and rate.
+type InterestPeriod struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Days     int       `json:"days"`
+	Balance  float64   `json:"balance"`
+	Rate     float64   `json:"rate"` // Percent a year
+	Interest float64   `json:"interest"`
+}
+
+// LateFeeCharge records late payment charges billed on a follow-up invoice.
+type LateFeeCharge struct {
+	ID              uuid.UUID `json:"id"`
+	InvoiceID       uuid.UUID `json:"invoice_id"`
+	ChargeInvoiceID uuid.UUID `json:"charge_invoice_id"`
+	InterestTo      time.Time `json:"interest_to"`
+	FixedFee        float64   `json:"fixed_fee"`
+	Interest        float64   `json:"interest"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// ShareLink gives customers, who have no login, access to one invoice or,
+// when CustomerEmail is set, to all issued invoices of one customer. The
+// token is only returned when the link is created.
+type ShareLink struct {
+	ID            uuid.UUID  `json:"id"`
+	UserID        uuid.UUID  `json:"user_id"`
+	InvoiceID     *uuid.UUID `json:"invoice_id,omitempty"`
+	CustomerEmail string     `json:"customer_email,omitempty"`
+	Token         string     `json:"token,omitempty"`
+	URL           string     `json:"url,omitempty"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt    *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// PublicInvoice is the customer-facing view of an invoice opened through a
+// share link. It leaves out the account's internal fields.
+type PublicInvoice struct {
+	ID              uuid.UUID           `json:"id"`
+	InvoiceNumber   string              `json:"invoice_number"`
+	DocumentType    string              `json:"document_type"`
+	Status          string              `json:"status"`
+	BuyerReference  string              `json:"buyer_reference,omitempty"`
+	CustomerName    string              `json:"customer_name"`
+	CustomerAddress string              `json:"customer_address"`
+	InvoiceDate     time.Time           `json:"invoice_date"`
+	DueDate         time.Time           `json:"due_date"`
+	PaymentTerms    string              `json:"payment_terms,omitempty"`
+	DiscountPercent float64             `json:"discount_percent,omitempty"`
+	DiscountDueDate *time.Time          `json:"discount_due_date,omitempty"`
+	Currency        string              `json:"currency"`
+	Subtotal        float64             `json:"subtotal"`
+	TaxRate         float64             `json:"tax_rate"`
+	TaxAmount       float64             `json:"tax_amount"`
+	TotalAmount     float64             `json:"total_amount"`
+	AmountPaid      float64             `json:"amount_paid"`
+	AmountDue       float64             `json:"amount_due"`
+	Notes           string              `json:"notes,omitempty"`
+	Items           []PublicInvoiceItem `json:"items,omitempty"`
+	Seller          *PublicSeller       `json:"seller,omitempty"`
+	PDFURL          string              `json:"pdf_url"`
+	// CheckoutURL is where to POST to pay the invoice online, when it can be.
+	CheckoutURL string `json:"checkout_url,omitempty"`
+}
+
+// PublicInvoiceItem is a line of a PublicInvoice.
+type PublicInvoiceItem struct {
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	TotalPrice  float64 `json:"total_price"`
+}
+
+// PublicSeller is the sender of a PublicInvoice, from its company profile.
+type PublicSeller struct {
+	CompanyName string `json:"company_name"`
+	AddressLine string `json:"address_line,omitempty"`
+	PostalCode  string `json:"postal_code,omitempty"`
+	City        string `json:"city,omitempty"`
+	CountryCode string `json:"country_code,omitempty"`
+	Email       string `json:"email,omitempty"`
+	Phone       string `json:"phone,omitempty"`
+	Website     string `json:"website,omitempty"`
+	TaxID       string `json:"tax_id,omitempty"`
+	BankName    string `json:"bank_name,omitempty"`
+	IBAN        string `json:"iban,omitempty"`
+	BIC         string `json:"bic,omitempty"`
+}
+
+// PublicCustomerAccount is what a customer's share link opens: their issued
+// invoices, newest first.
+type PublicCustomerAccount struct {
+	CustomerName  string          `json:"customer_name"`
+	CustomerEmail string          `json:"customer_email"`
+	Seller        *PublicSeller   `json:"seller,omitempty"`
+	Invoices      []PublicInvoice `json:"invoices"`
+	DownloadURL   string          `json:"download_url"`
+	ExpiresAt     time.Time       `json:"expires_at"`
+}
+
+// WebhookSubscription sends an account's invoice events of the chosen
+// types to an endpoint of its own systems, signed with Secret.
+type WebhookSubscription struct {
+	ID         uuid.UUID `json:"id"`
+	UserID     uuid.UUID `json:"user_id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"` // Only shown when it is set
+	EventTypes []string  `json:"event_types"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is the delivery of one event to one subscription,
+// attempted until the endpoint accepts it or the retries run out.
+type WebhookDelivery struct {
+	ID             uuid.UUID        `json:"id"`
+	SubscriptionID uuid.UUID        `json:"subscription_id"`
+	EventID        uuid.UUID        `json:"event_id"`
+	EventType      string           `json:"event_type"`
+	InvoiceID      uuid.UUID        `json:"invoice_id"`
+	Status         string           `json:"status"` // pending, succeeded or failed
+	Attempts       int              `json:"attempts"`
+	NextAttemptAt  *time.Time       `json:"next_attempt_at,omitempty"` // While pending
+	LastAttemptAt  *time.Time       `json:"last_attempt_at,omitempty"`
+	ResponseStatus *int             `json:"response_status,omitempty"`
+	LastError      string           `json:"last_error,omitempty"`
+	Payload        json.RawMessage  `json:"payload,omitempty"`     // The body sent
+	AttemptLog     []WebhookAttempt `json:"attempt_log,omitempty"` // Oldest first
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+// WebhookAttempt logs one attempt at a webhook delivery and the endpoint's
+// answer, if any.
+type WebhookAttempt struct {
+	ID             uuid.UUID `json:"id"`
+	DeliveryID     uuid.UUID `json:"delivery_id"`
+	AttemptedAt    time.Time `json:"attempted_at"`
+	DurationMS     int       `json:"duration_ms"`
+	ResponseStatus *int      `json:"response_status,omitempty"`
+	ResponseBody   string    `json:"response_body,omitempty"` // Truncated
+	Error          string    `json:"error,omitempty"`
+}
+
+// ExportJob is a bulk PDF export processed in the background.
+type ExportJob struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	// ShareLinkID is set on jobs started through a customer share link,
+	// whose customer polls and downloads them.
+	ShareLinkID *uuid.UUID `json:"-"`
+	Format      string     `json:"format"` // "zip" or "pdf"
+	Status      string     `json:"status"` // queued, running, done or failed
+	// Total and Processed report progress in invoices.
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Error      string     `json:"error,omitempty"`
+	FileName   string     `json:"file_name,omitempty"`
+	BlobKey    string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
 }
 
 // InvoiceItem represents an item in an invoice.
@@ -64,3 +512,65 @@ type InvoiceItem struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
+
+// Supplier represents a vendor that sends bills to a user.
+type Supplier struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;default:uuid_generate_v4()"`
+	UserID      uuid.UUID `json:"user_id" gorm:"type:uuid;not null"`
+	Name        string    `json:"name" gorm:"not null"`
+	Email       string    `json:"email,omitempty"`
+	Address     string    `json:"address,omitempty"`
+	City        string    `json:"city,omitempty"`
+	PostalCode  string    `json:"postal_code,omitempty"`
+	CountryCode string    `json:"country_code,omitempty" gorm:"type:varchar(2)"`
+	VATID       string    `json:"vat_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Bill represents an incoming purchase invoice (accounts payable).
+type Bill struct {
+	ID             uuid.UUID     `json:"id,omitempty" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	UserID         uuid.UUID     `json:"user_id,omitempty" gorm:"type:uuid;not null"`
+	SupplierID     uuid.UUID     `json:"supplier_id" gorm:"type:uuid;not null"`
+	BillNumber     string        `json:"bill_number" gorm:"not null"`
+	DocumentType   string        `json:"document_type" gorm:"type:varchar(20);default:'invoice';check:document_type in ('invoice','credit_note')"`
+	Status         string        `json:"status" gorm:"type:varchar(20);default:'open';check:status in ('open','partially_paid','paid','void')"`
+	BillDate       time.Time     `json:"bill_date" gorm:"not null"`
+	DueDate        *time.Time    `json:"due_date,omitempty"`
+	Currency       string        `json:"currency" gorm:"type:varchar(3);not null"`
+	Subtotal       float64       `json:"subtotal" gorm:"type:decimal(15,2);not null;check:subtotal >= 0"`
+	TaxAmount      float64       `json:"tax_amount" gorm:"type:decimal(15,2);check:tax_amount >= 0"`
+	TotalAmount    float64       `json:"total_amount" gorm:"type:decimal(15,2);not null;check:total_amount >= 0"`
+	AmountPaid     float64       `json:"amount_paid" gorm:"type:decimal(15,2);check:amount_paid >= 0"`
+	Notes          string        `json:"notes,omitempty"`
+	SourceFormat   string        `json:"source_format" gorm:"type:varchar(10);check:source_format in ('ubl','cii')"`
+	SourceDocument string        `json:"-"`
+	Items          []BillItem    `json:"items,omitempty" gorm:"-"`    // Transient field for items
+	Payments       []BillPayment `json:"payments,omitempty" gorm:"-"` // Transient field for payments
+	CreatedAt      time.Time     `json:"created_at,omitempty" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time     `json:"updated_at,omitempty" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// BillItem represents a line on a bill.
+type BillItem struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;default:uuid_generate_v4()"`
+	BillID      uuid.UUID `json:"bill_id" gorm:"type:uuid"`
+	Description string    `json:"description"`
+	Quantity    float64   `json:"quantity"`
+	UnitPrice   float64   `json:"unit_price"`
+	TaxRate     float64   `json:"tax_rate"`
+	TotalPrice  float64   `json:"total_price"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// BillPayment records a payment made against a bill.
+type BillPayment struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;default:uuid_generate_v4()"`
+	BillID    uuid.UUID `json:"bill_id" gorm:"type:uuid;not null"`
+	Amount    float64   `json:"amount" binding:"required,gt=0" gorm:"type:decimal(15,2);not null"`
+	PaidAt    time.Time `json:"paid_at"`
+	Reference string    `json:"reference,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
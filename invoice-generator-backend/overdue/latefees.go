@@ -0,0 +1,202 @@
+package overdue
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"invoice-generator-go/models"
+	"invoice-generator-go/utils"
+)
+
+// Interest types of a late fee rule.
+const (
+	InterestNone      = "none"
+	InterestSimple    = "simple"
+	InterestStatutory = "statutory"
+)
+
+// StatutoryMargin is the margin over the reference rate the EU late payment
+// directive sets for commercial transactions.
+const StatutoryMargin = 8
+
+// DefaultRule is the rule of accounts without one: no charges, with the
+// statutory margin suggested should interest be turned on.
+func DefaultRule() models.LateFeeRule {
+	return models.LateFeeRule{InterestType: InterestNone, Margin: StatutoryMargin}
+}
+
+// Validate checks a rule, defaulting an empty interest type to none.
+func Validate(rule *models.LateFeeRule) error {
+	if rule.InterestType == "" {
+		rule.InterestType = InterestNone
+	}
+	switch rule.InterestType {
+	case InterestNone:
+	case InterestSimple:
+		if rule.AnnualRate <= 0 || rule.AnnualRate > 100 {
+			return fmt.Errorf("annual_rate must be above 0 and at most 100 for simple interest")
+		}
+	case InterestStatutory:
+		if rule.Margin < 0 || rule.Margin > 100 {
+			return fmt.Errorf("margin must be between 0 and 100")
+		}
+		if rule.BaseRate != nil && (*rule.BaseRate < -10 || *rule.BaseRate > 100) {
+			return fmt.Errorf("base_rate must be between -10 and 100")
+		}
+	default:
+		return fmt.Errorf("unknown interest_type %q, expected %s, %s or %s", rule.InterestType, InterestNone, InterestSimple, InterestStatutory)
+	}
+	if rule.FixedFee < 0 {
+		return fmt.Errorf("fixed_fee must not be negative")
+	}
+	if rule.GraceDays < 0 || rule.GraceDays > 365 {
+		return fmt.Errorf("grace_days must be between 0 and 365")
+	}
+	return nil
+}
+
+// Assess prices an invoice's late payment under rule as of asOf's date.
+// Charges start once the invoice is grace days past due with a balance
+// open. The fixed fee is due once per invoice; interest accrues from the
+// day after, or after the end of the interest already charged, on each
+// day's opening balance at the rate in force that day, counting 365 days a
+// year. Payments are those recorded for the invoice; an invoice marked paid
+// without them counts as settled on its paid date.
+func Assess(invoice *models.Invoice, payments []models.Payment, rule models.LateFeeRule, charges []models.LateFeeCharge, asOf time.Time) models.LateFeeAssessment {
+	end := day(asOf)
+	start := day(invoice.DueDate).AddDate(0, 0, rule.GraceDays)
+
+	payments = append([]models.Payment(nil), payments...)
+	sort.Slice(payments, func(i, j int) bool { return payments[i].PaidAt.Before(payments[j].PaidAt) })
+	balance := func(d time.Time) float64 {
+		if invoice.PaidAt != nil && !day(*invoice.PaidAt).After(d) {
+			return 0
+		}
+		open := invoice.TotalAmount
+		for _, p := range payments {
+			if day(p.PaidAt).After(d) {
+				break
+			}
+			open -= p.Amount + p.Discount
+		}
+		return math.Max(round(open), 0)
+	}
+
+	a := models.LateFeeAssessment{
+		InvoiceID:   invoice.ID,
+		Currency:    invoice.Currency,
+		AsOf:        end,
+		DaysOverdue: int(math.Max(0, end.Sub(day(invoice.DueDate)).Hours()/24)),
+		OpenBalance: balance(end),
+		Periods:     []models.InterestPeriod{},
+	}
+
+	from := start
+	fixedCharged := false
+	for i := range charges {
+		ch := &charges[i]
+		fixedCharged = fixedCharged || ch.FixedFee > 0
+		if to := day(ch.InterestTo); to.After(from) {
+			from = to
+		}
+		a.ChargedTo = &ch.InterestTo
+	}
+	if !end.After(start) || balance(start) == 0 {
+		return a
+	}
+	if !fixedCharged {
+		a.FixedFee = rule.FixedFee
+	}
+
+	if rule.InterestType != InterestNone {
+		var period *models.InterestPeriod
+		for d := from.AddDate(0, 0, 1); !d.After(end); d = d.AddDate(0, 0, 1) {
+			open := balance(d.AddDate(0, 0, -1))
+			if open == 0 {
+				period = nil
+				continue
+			}
+			rate := annualRate(rule, d)
+			if period == nil || period.Balance != open || period.Rate != rate {
+				a.Periods = append(a.Periods, models.InterestPeriod{From: d, Balance: open, Rate: rate})
+				period = &a.Periods[len(a.Periods)-1]
+			}
+			period.To = d
+			period.Days++
+		}
+	}
+	for i := range a.Periods {
+		p := &a.Periods[i]
+		p.Interest = round(p.Balance * p.Rate / 100 * float64(p.Days) / 365)
+		a.Interest += p.Interest
+	}
+
+	a.Interest = round(a.Interest)
+	a.Total = round(a.FixedFee + a.Interest)
+	return a
+}
+
+// annualRate returns the interest rate a rule charges on d, percent a year.
+func annualRate(rule models.LateFeeRule, d time.Time) float64 {
+	if rule.InterestType == InterestSimple {
+		return rule.AnnualRate
+	}
+	base := ReferenceRate(d)
+	if rule.BaseRate != nil {
+		base = *rule.BaseRate
+	}
+	return math.Max(base+rule.Margin, 0)
+}
+
+// ChargeInvoice drafts the follow-up invoice billing an assessment of
+// invoice's late payment charges, with the charge record to store with it.
+// The draft has no due date yet; it is due under the customer's payment
+// terms.
+func ChargeInvoice(invoice *models.Invoice, a models.LateFeeAssessment, now time.Time) (models.Invoice, []models.InvoiceItem, models.LateFeeCharge) {
+	var items []models.InvoiceItem
+	if a.FixedFee > 0 {
+		items = append(items, chargeItem(fmt.Sprintf("Late payment fee for invoice %s", invoice.InvoiceNumber), a.FixedFee))
+	}
+	for _, p := range a.Periods {
+		items = append(items, chargeItem(fmt.Sprintf("Interest on invoice %s: %.2f at %.2f%% p.a. from %s to %s (%d days)",
+			invoice.InvoiceNumber, p.Balance, p.Rate, p.From.Format("2006-01-02"), p.To.Format("2006-01-02"), p.Days), p.Interest))
+	}
+
+	charges := models.Invoice{
+		UserID:           invoice.UserID,
+		TemplateID:       invoice.TemplateID,
+		CompanyProfileID: invoice.CompanyProfileID,
+		InvoiceNumber:    utils.GenerateInvoiceNumber(),
+		Status:           "draft",
+		DocumentType:     "invoice",
+		BuyerReference:   invoice.BuyerReference,
+		CustomerName:     invoice.CustomerName,
+		CustomerEmail:    invoice.CustomerEmail,
+		CustomerAddress:  invoice.CustomerAddress,
+		InvoiceDate:      now,
+		Currency:         invoice.Currency,
+		Subtotal:         a.Total,
+		TotalAmount:      a.Total,
+		Notes:            fmt.Sprintf("Late payment charges on invoice %s, due on %s.", invoice.InvoiceNumber, invoice.DueDate.Format("2006-01-02")),
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	charge := models.LateFeeCharge{
+		InvoiceID:  invoice.ID,
+		InterestTo: a.AsOf,
+		FixedFee:   a.FixedFee,
+		Interest:   a.Interest,
+	}
+	return charges, items, charge
+}
+
+func chargeItem(description string, amount float64) models.InvoiceItem {
+	return models.InvoiceItem{Description: description, Quantity: 1, UnitPrice: amount, TotalPrice: amount}
+}
+
+// round rounds an amount to cents.
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
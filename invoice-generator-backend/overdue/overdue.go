@@ -0,0 +1,42 @@
+// Package overdue handles invoices paid late: a background job marks unpaid
+// invoices past their due date as overdue, and each account's late fee rule
+// prices the delay as a fixed fee and interest, which can be billed on a
+// follow-up invoice.
+package overdue
+
+import (
+	"log"
+	"time"
+
+	"invoice-generator-go/storage"
+)
+
+// Start runs the overdue check in the background, once straight away and
+// then every interval.
+func Start(interval time.Duration) {
+	go func() {
+		for {
+			Run(time.Now())
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Run marks the invoices due before now's date that aren't paid in full as
+// overdue, and puts overdue invoices whose due date was pushed back to sent.
+func Run(now time.Time) {
+	marked, reopened, err := storage.MarkOverdueInvoices(day(now))
+	if err != nil {
+		log.Printf("Overdue check failed: %v", err)
+		return
+	}
+	if marked > 0 || reopened > 0 {
+		log.Printf("Marked %d invoices overdue, %d back to sent", marked, reopened)
+	}
+}
+
+// day truncates t to midnight UTC of its date.
+func day(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
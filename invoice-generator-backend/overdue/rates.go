@@ -0,0 +1,41 @@
+package overdue
+
+import "time"
+
+// referenceRate is the ECB main refinancing rate in force on the first day
+// of a half-year, which the EU late payment directive (2011/7/EU) uses as
+// the reference rate for that half-year.
+type referenceRate struct {
+	From time.Time
+	Rate float64 // Percent a year
+}
+
+// referenceRates lists the reference rates, oldest first. Half-years after
+// the last entry reuse its rate until the table is extended; accounts that
+// need another base rate, such as a national one, set it on their rule.
+var referenceRates = []referenceRate{
+	{date(2016, time.July, 1), 0},
+	{date(2023, time.January, 1), 2.50},
+	{date(2023, time.July, 1), 4.00},
+	{date(2024, time.January, 1), 4.50},
+	{date(2024, time.July, 1), 4.25},
+	{date(2025, time.January, 1), 3.15},
+	{date(2025, time.July, 1), 2.15},
+}
+
+// ReferenceRate returns the reference rate for the half-year containing t.
+// Dates before the table use its first rate.
+func ReferenceRate(t time.Time) float64 {
+	rate := referenceRates[0].Rate
+	for _, r := range referenceRates {
+		if t.Before(r.From) {
+			break
+		}
+		rate = r.Rate
+	}
+	return rate
+}
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
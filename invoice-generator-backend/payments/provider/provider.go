@@ -0,0 +1,136 @@
+// Package provider connects online payment providers: it starts hosted
+// checkout sessions in which customers pay an invoice, and turns the
+// provider's signed webhook notifications into payment events.
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"invoice-generator-go/config"
+
+	"github.com/google/uuid"
+)
+
+// Event types a provider's notifications are mapped to.
+const (
+	// EventPaymentSucceeded reports that a checkout session was paid.
+	EventPaymentSucceeded = "payment_succeeded"
+	// EventPaymentFailed reports that a delayed payment was declined.
+	EventPaymentFailed = "payment_failed"
+	// EventSessionExpired reports that a session ended unpaid.
+	EventSessionExpired = "session_expired"
+)
+
+// ErrInvalidSignature is returned for webhook requests whose signature
+// doesn't match.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// CheckoutRequest describes the payment of an invoice.
+type CheckoutRequest struct {
+	InvoiceID     uuid.UUID
+	InvoiceNumber string
+	Description   string
+	Amount        float64
+	Currency      string
+	CustomerEmail string
+	// SuccessURL and CancelURL are where the customer is sent back to.
+	SuccessURL string
+	CancelURL  string
+}
+
+// CheckoutSession is a hosted payment page started with the provider.
+type CheckoutSession struct {
+	ID  string
+	URL string
+}
+
+// Event is a webhook notification mapped from the provider's format. Type
+// is empty for notifications of no interest.
+type Event struct {
+	ID        string
+	Type      string
+	SessionID string
+	// PaymentID identifies the payment with the provider.
+	PaymentID string
+	Amount    float64
+	Currency  string
+	Created   time.Time
+}
+
+// Provider is an online payment provider.
+type Provider interface {
+	// Name identifies the provider in stored sessions and payments.
+	Name() string
+	// CreateCheckoutSession starts a hosted payment page for req.
+	CreateCheckoutSession(ctx context.Context, req CheckoutRequest) (*CheckoutSession, error)
+	// VerifyWebhook checks the signature of a webhook request, returning
+	// ErrInvalidSignature when it doesn't match.
+	VerifyWebhook(payload []byte, header http.Header) error
+	// ParseEvent maps the payload of a verified webhook request.
+	ParseEvent(payload []byte) (*Event, error)
+}
+
+// Default is the provider used by the application, nil when online
+// payments are off. It is set up by Configure.
+var Default Provider
+
+// Configure initialises Default from the configuration: the Stripe
+// compatible provider, the fake provider, or none.
+func Configure(cfg *config.AppConfig) error {
+	switch cfg.PaymentProvider {
+	case "":
+		Default = nil
+	case "stripe":
+		if cfg.PaymentAPIKey == "" || cfg.PaymentWebhookSecret == "" {
+			return fmt.Errorf("the stripe payment provider needs PAYMENT_API_KEY and PAYMENT_WEBHOOK_SECRET")
+		}
+		Default = &Stripe{BaseURL: cfg.PaymentAPIURL, APIKey: cfg.PaymentAPIKey, WebhookSecret: cfg.PaymentWebhookSecret}
+	case "fake":
+		// Unsigned fake events would let anyone mark invoices paid
+		if cfg.PaymentWebhookSecret == "" {
+			return fmt.Errorf("the fake payment provider needs PAYMENT_WEBHOOK_SECRET")
+		}
+		Default = &Fake{WebhookSecret: cfg.PaymentWebhookSecret}
+	default:
+		return fmt.Errorf("unknown payment provider %q, expected stripe or fake", cfg.PaymentProvider)
+	}
+	return nil
+}
+
+// zeroDecimalCurrencies have no minor unit.
+var zeroDecimalCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "JPY": true, "KMF": true, "KRW": true, "MGA": true,
+	"PYG": true, "RWF": true, "UGX": true, "VND": true, "VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+// threeDecimalCurrencies have a minor unit of a thousandth.
+var threeDecimalCurrencies = map[string]bool{"BHD": true, "JOD": true, "KWD": true, "OMR": true, "TND": true}
+
+// minorUnits is the number of minor units in a unit of currency.
+func minorUnits(currency string) float64 {
+	currency = strings.ToUpper(currency)
+	switch {
+	case zeroDecimalCurrencies[currency]:
+		return 1
+	case threeDecimalCurrencies[currency]:
+		return 1000
+	default:
+		return 100
+	}
+}
+
+// ToMinor converts amount to the smallest unit of currency.
+func ToMinor(amount float64, currency string) int64 {
+	return int64(math.Round(amount * minorUnits(currency)))
+}
+
+// FromMinor converts an amount in the smallest unit of currency.
+func FromMinor(amount int64, currency string) float64 {
+	return float64(amount) / minorUnits(currency)
+}
@@ -0,0 +1,154 @@
+package provider
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"invoice-generator-go/config"
+)
+
+const testSecret = "whsec_test"
+
+func stripeSignature(secret string, at time.Time, payload []byte) string {
+	t := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(payload)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestStripeVerifyWebhook(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"checkout.session.completed"}`)
+	now := time.Now()
+	valid := stripeSignature(testSecret, now, payload)
+	tests := []struct {
+		name      string
+		signature string
+		payload   []byte
+		wantErr   bool
+	}{
+		{"valid", valid, payload, false},
+		{"within the tolerance", stripeSignature(testSecret, now.Add(-stripeTolerance+time.Minute), payload), payload, false},
+		{"clock slightly ahead", stripeSignature(testSecret, now.Add(stripeTolerance-time.Minute), payload), payload, false},
+		{"too old", stripeSignature(testSecret, now.Add(-stripeTolerance-time.Minute), payload), payload, true},
+		{"too far ahead", stripeSignature(testSecret, now.Add(stripeTolerance+time.Minute), payload), payload, true},
+		{"another secret", stripeSignature("whsec_other", now, payload), payload, true},
+		{"tampered payload", valid, []byte(`{"id":"evt_2","type":"checkout.session.completed"}`), true},
+		{"one of several signatures", valid + ",v1=00ff", payload, false},
+		{"no signature", "t=" + strconv.FormatInt(now.Unix(), 10), payload, true},
+		{"no timestamp", valid[strings.Index(valid, "v1="):], payload, true},
+		{"malformed signature", "t=" + strconv.FormatInt(now.Unix(), 10) + ",v1=zz", payload, true},
+		{"missing header", "", payload, true},
+	}
+	s := &Stripe{WebhookSecret: testSecret}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Stripe-Signature", tt.signature)
+			err := s.VerifyWebhook(tt.payload, header)
+			if tt.wantErr && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("VerifyWebhook = %v, want ErrInvalidSignature", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("VerifyWebhook = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestFakeVerifyWebhook(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"payment_succeeded"}`)
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write(payload)
+	valid := hex.EncodeToString(mac.Sum(nil))
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		wantErr   bool
+	}{
+		{"valid", testSecret, valid, false},
+		{"another secret", "whsec_other", valid, true},
+		{"unsigned", testSecret, "", true},
+		{"no secret", "", "", true},
+		{"no secret, signed", "", valid, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.signature != "" {
+				header.Set(FakeSignatureHeader, tt.signature)
+			}
+			err := (&Fake{WebhookSecret: tt.secret}).VerifyWebhook(payload, header)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyWebhook = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.AppConfig
+		want    string
+		wantErr bool
+	}{
+		{"off", config.AppConfig{}, "", false},
+		{"stripe", config.AppConfig{PaymentProvider: "stripe", PaymentAPIKey: "sk_test", PaymentWebhookSecret: testSecret}, "stripe", false},
+		{"stripe without a secret", config.AppConfig{PaymentProvider: "stripe", PaymentAPIKey: "sk_test"}, "", true},
+		{"stripe without a key", config.AppConfig{PaymentProvider: "stripe", PaymentWebhookSecret: testSecret}, "", true},
+		{"fake", config.AppConfig{PaymentProvider: "fake", PaymentWebhookSecret: testSecret}, "fake", false},
+		{"fake without a secret", config.AppConfig{PaymentProvider: "fake"}, "", true},
+		{"unknown", config.AppConfig{PaymentProvider: "paypal"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Default = nil
+			defer func() { Default = nil }()
+			err := Configure(&tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Configure error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := ""
+			if Default != nil {
+				got = Default.Name()
+			}
+			if got != tt.want {
+				t.Errorf("Default = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		currency string
+		want     int64
+	}{
+		{119, "EUR", 11900},
+		{0.1 + 0.2, "usd", 30},
+		{1500, "JPY", 1500},
+		{12.345, "KWD", 12345},
+	}
+	for _, tt := range tests {
+		got := ToMinor(tt.amount, tt.currency)
+		if got != tt.want {
+			t.Errorf("ToMinor(%v, %s) = %d, want %d", tt.amount, tt.currency, got, tt.want)
+		}
+		if back := FromMinor(got, tt.currency); ToMinor(back, tt.currency) != got {
+			t.Errorf("FromMinor(%d, %s) = %v does not round-trip", got, tt.currency, back)
+		}
+	}
+}
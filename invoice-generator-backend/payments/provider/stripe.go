@@ -0,0 +1,190 @@
+package provider
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultStripeURL is the API used when no other Stripe compatible
+	// one is configured.
+	DefaultStripeURL = "https://api.stripe.com"
+	// stripeTolerance bounds the age of a signed webhook request, against
+	// replays.
+	stripeTolerance = 5 * time.Minute
+	stripeTimeout   = 30 * time.Second
+)
+
+// Stripe takes payments through Stripe Checkout, or any API compatible
+// with it at BaseURL.
+type Stripe struct {
+	BaseURL       string
+	APIKey        string
+	WebhookSecret string
+	// Client defaults to one with a 30 second timeout.
+	Client *http.Client
+}
+
+// Name implements Provider.
+func (s *Stripe) Name() string {
+	return "stripe"
+}
+
+// CreateCheckoutSession implements Provider with a one-off payment of the
+// amount as a single line.
+func (s *Stripe) CreateCheckoutSession(ctx context.Context, req CheckoutRequest) (*CheckoutSession, error) {
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("success_url", req.SuccessURL)
+	form.Set("cancel_url", req.CancelURL)
+	form.Set("client_reference_id", req.InvoiceID.String())
+	form.Set("metadata[invoice_id]", req.InvoiceID.String())
+	form.Set("payment_intent_data[metadata][invoice_id]", req.InvoiceID.String())
+	if req.CustomerEmail != "" {
+		form.Set("customer_email", req.CustomerEmail)
+	}
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", strings.ToLower(req.Currency))
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(ToMinor(req.Amount, req.Currency), 10))
+	form.Set("line_items[0][price_data][product_data][name]", req.Description)
+
+	baseURL := s.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultStripeURL
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+"/v1/checkout/sessions", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build checkout request: %v", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+s.APIKey)
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: stripeTimeout}
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkout session: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkout session: %v", err)
+	}
+
+	var result struct {
+		ID    string `json:"id"`
+		URL   string `json:"url"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode checkout session (HTTP %d): %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to create checkout session (HTTP %d): %s", resp.StatusCode, result.Error.Message)
+	}
+	if result.ID == "" || result.URL == "" {
+		return nil, fmt.Errorf("checkout session response lacks an id or url")
+	}
+	return &CheckoutSession{ID: result.ID, URL: result.URL}, nil
+}
+
+// VerifyWebhook implements Provider with the Stripe-Signature header: an
+// HMAC-SHA256 of the timestamp and payload under the webhook secret.
+func (s *Stripe) VerifyWebhook(payload []byte, header http.Header) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > stripeTolerance || age < -stripeTolerance {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.WebhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+	for _, signature := range signatures {
+		if sig, err := hex.DecodeString(signature); err == nil && hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// ParseEvent implements Provider for Checkout session events. Sessions
+// completed with a delayed payment method are not paid until their
+// async_payment_succeeded event.
+func (s *Stripe) ParseEvent(payload []byte) (*Event, error) {
+	var raw struct {
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+		Created int64  `json:"created"`
+		Data    struct {
+			Object struct {
+				ID            string `json:"id"`
+				Object        string `json:"object"`
+				PaymentStatus string `json:"payment_status"`
+				AmountTotal   int64  `json:"amount_total"`
+				Currency      string `json:"currency"`
+				PaymentIntent string `json:"payment_intent"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook event: %v", err)
+	}
+	if raw.ID == "" {
+		return nil, fmt.Errorf("webhook event lacks an id")
+	}
+
+	event := &Event{ID: raw.ID, Created: time.Unix(raw.Created, 0)}
+	session := raw.Data.Object
+	if session.Object != "checkout.session" {
+		return event, nil
+	}
+	switch raw.Type {
+	case "checkout.session.completed":
+		if session.PaymentStatus == "paid" {
+			event.Type = EventPaymentSucceeded
+		}
+	case "checkout.session.async_payment_succeeded":
+		event.Type = EventPaymentSucceeded
+	case "checkout.session.async_payment_failed":
+		event.Type = EventPaymentFailed
+	case "checkout.session.expired":
+		event.Type = EventSessionExpired
+	}
+	event.SessionID = session.ID
+	event.PaymentID = session.PaymentIntent
+	if event.PaymentID == "" {
+		event.PaymentID = session.ID
+	}
+	event.Currency = strings.ToUpper(session.Currency)
+	event.Amount = FromMinor(session.AmountTotal, session.Currency)
+	return event, nil
+}
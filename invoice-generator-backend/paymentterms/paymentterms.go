@@ -0,0 +1,160 @@
+// Package paymentterms works out when an invoice is due and what paying it
+// early is worth from the payment terms it is issued under.
+package paymentterms
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"invoice-generator-go/models"
+
+	"github.com/google/uuid"
+)
+
+// maxDays bounds the days in terms.
+const maxDays = 365
+
+// Validate checks terms and tidies their name.
+func Validate(terms *models.PaymentTerms) error {
+	terms.Name = strings.TrimSpace(terms.Name)
+	if terms.Name == "" || len(terms.Name) > 100 {
+		return fmt.Errorf("name is required and at most 100 characters")
+	}
+	if terms.DueDays < 0 || terms.DueDays > maxDays {
+		return fmt.Errorf("due_days must be between 0 and %d", maxDays)
+	}
+	if terms.DiscountPercent < 0 || terms.DiscountPercent >= 100 {
+		return fmt.Errorf("discount_percent must be at least 0 and below 100")
+	}
+	if terms.DiscountPercent > 0 && terms.DiscountDays <= 0 {
+		return fmt.Errorf("a discount needs discount_days")
+	}
+	if terms.DiscountDays < 0 || terms.DiscountDays > maxDays {
+		return fmt.Errorf("discount_days must be between 0 and %d", maxDays)
+	}
+	if terms.DiscountPercent > 0 && !terms.EndOfMonth && terms.DiscountDays > terms.DueDays {
+		return fmt.Errorf("discount_days must not exceed due_days")
+	}
+	if terms.DiscountPercent == 0 {
+		terms.DiscountDays = 0
+	}
+	return nil
+}
+
+// Choose picks the terms a new invoice that names none is issued under: the
+// customer's, else the account's default, else the system default. It
+// returns nil when none of them is set.
+func Choose(customer, account, system *uuid.UUID) *uuid.UUID {
+	for _, id := range []*uuid.UUID{customer, account, system} {
+		if id != nil {
+			return id
+		}
+	}
+	return nil
+}
+
+// FallbackDueDate is the due date of an invoice dated invoiceDate when no
+// payment terms apply to it: one month later.
+func FallbackDueDate(invoiceDate time.Time) time.Time {
+	return invoiceDate.AddDate(0, 1, 0)
+}
+
+// DueDate returns the due date of an invoice dated invoiceDate under terms.
+func DueDate(terms models.PaymentTerms, invoiceDate time.Time) time.Time {
+	start := invoiceDate
+	if terms.EndOfMonth {
+		// Day 0 of the next month is the last day of this one
+		start = time.Date(invoiceDate.Year(), invoiceDate.Month()+1, 0,
+			invoiceDate.Hour(), invoiceDate.Minute(), invoiceDate.Second(), invoiceDate.Nanosecond(), invoiceDate.Location())
+	}
+	return start.AddDate(0, 0, terms.DueDays)
+}
+
+// Apply issues invoice under terms: it records the terms and their early
+// payment discount, and sets the due date unless one was given.
+func Apply(invoice *models.Invoice, terms models.PaymentTerms) {
+	invoice.PaymentTermsID = &terms.ID
+	invoice.PaymentTerms = terms.Name
+	invoice.DiscountPercent = terms.DiscountPercent
+	invoice.DiscountDueDate = nil
+	if terms.DiscountPercent > 0 {
+		due := invoice.InvoiceDate.AddDate(0, 0, terms.DiscountDays)
+		invoice.DiscountDueDate = &due
+	}
+	if invoice.DueDate.IsZero() {
+		invoice.DueDate = DueDate(terms, invoice.InvoiceDate)
+	}
+}
+
+// Reissue works out the terms of invoice, an update of previous. terms are
+// the ones the update names, or else those previous was issued under; nil
+// when neither applies. Naming terms, or changing the invoice date, issues
+// the invoice again: its due and discount dates are worked out afresh, and
+// only a due date the update changes is kept. Otherwise the invoice keeps
+// the terms, discount and dates it has.
+func Reissue(invoice *models.Invoice, previous models.Invoice, terms *models.PaymentTerms) {
+	named := invoice.PaymentTermsID != nil
+	if !named {
+		invoice.PaymentTermsID = previous.PaymentTermsID
+		invoice.PaymentTerms = previous.PaymentTerms
+		invoice.DiscountPercent = previous.DiscountPercent
+		invoice.DiscountDueDate = previous.DiscountDueDate
+	}
+	if !named && invoice.InvoiceDate.Equal(previous.InvoiceDate) {
+		if invoice.DueDate.IsZero() {
+			invoice.DueDate = previous.DueDate
+		}
+		return
+	}
+	if invoice.DueDate.Equal(previous.DueDate) {
+		invoice.DueDate = time.Time{}
+	}
+
+	if terms != nil {
+		Apply(invoice, *terms)
+		return
+	}
+	// The terms are gone: the discount keeps its days from the invoice date
+	if previous.DiscountDueDate != nil {
+		due := invoice.InvoiceDate.Add(previous.DiscountDueDate.Sub(previous.InvoiceDate))
+		invoice.DiscountDueDate = &due
+	}
+	if invoice.DueDate.IsZero() {
+		invoice.DueDate = FallbackDueDate(invoice.InvoiceDate)
+	}
+}
+
+// Discount returns the early payment discount on invoice's total, 0 when it
+// offers none.
+func Discount(invoice models.Invoice) float64 {
+	if invoice.DiscountPercent <= 0 || invoice.DiscountDueDate == nil {
+		return 0
+	}
+	return math.Round(invoice.TotalAmount*invoice.DiscountPercent) / 100
+}
+
+// AmountDue is what settles invoice when paid on the day of on: its open
+// balance, less the early payment discount while that applies. Dates are
+// compared in UTC, as when the payment is recorded. Nothing is due on credit
+// notes, or on paid or void invoices.
+func AmountDue(invoice models.Invoice, on time.Time) float64 {
+	if invoice.DocumentType == "credit_note" || invoice.Status == "paid" || invoice.Status == "void" {
+		return 0
+	}
+	open := math.Round((invoice.TotalAmount-invoice.AmountPaid)*100) / 100
+	if open <= 0 {
+		return 0
+	}
+	discount := Discount(invoice)
+	if discount > 0 && open > discount && !utcDay(on).After(utcDay(*invoice.DiscountDueDate)) {
+		return math.Round((open-discount)*100) / 100
+	}
+	return open
+}
+
+func utcDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,212 @@
+package paymentterms
+
+import (
+	"testing"
+	"time"
+
+	"invoice-generator-go/models"
+
+	"github.com/google/uuid"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestChoose(t *testing.T) {
+	customer, account, system := uuid.New(), uuid.New(), uuid.New()
+	tests := []struct {
+		name                      string
+		customer, account, system *uuid.UUID
+		want                      *uuid.UUID
+	}{
+		{"customer terms win", &customer, &account, &system, &customer},
+		{"customer terms without an account default", &customer, nil, &system, &customer},
+		{"account default", nil, &account, &system, &account},
+		{"system default", nil, nil, &system, &system},
+		{"none", nil, nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Choose(tt.customer, tt.account, tt.system)
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("Choose = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFallbackDueDate(t *testing.T) {
+	tests := []struct{ invoiceDate, want time.Time }{
+		{date(2026, 3, 1), date(2026, 4, 1)},
+		{date(2026, 12, 15), date(2027, 1, 15)},
+		// AddDate normalises, so the 31st runs into the following month
+		{date(2026, 1, 31), date(2026, 3, 3)},
+	}
+	for _, tt := range tests {
+		if got := FallbackDueDate(tt.invoiceDate); !got.Equal(tt.want) {
+			t.Errorf("FallbackDueDate(%s) = %s, want %s", tt.invoiceDate.Format("2006-01-02"), got.Format("2006-01-02"), tt.want.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestDueDate(t *testing.T) {
+	tests := []struct {
+		name        string
+		terms       models.PaymentTerms
+		invoiceDate time.Time
+		want        time.Time
+	}{
+		{"due on receipt", models.PaymentTerms{DueDays: 0}, date(2026, 3, 10), date(2026, 3, 10)},
+		{"net 30", models.PaymentTerms{DueDays: 30}, date(2026, 3, 10), date(2026, 4, 9)},
+		{"net 30 over a leap day", models.PaymentTerms{DueDays: 30}, date(2028, 2, 15), date(2028, 3, 16)},
+		{"net 15 over the year end", models.PaymentTerms{DueDays: 15}, date(2026, 12, 20), date(2027, 1, 4)},
+		{"end of month", models.PaymentTerms{EndOfMonth: true}, date(2026, 2, 3), date(2026, 2, 28)},
+		{"end of month + 30", models.PaymentTerms{DueDays: 30, EndOfMonth: true}, date(2026, 1, 31), date(2026, 3, 2)},
+		{"end of month + 30 in a leap year", models.PaymentTerms{DueDays: 30, EndOfMonth: true}, date(2028, 2, 1), date(2028, 3, 30)},
+		{"end of december", models.PaymentTerms{DueDays: 10, EndOfMonth: true}, date(2026, 12, 5), date(2027, 1, 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DueDate(tt.terms, tt.invoiceDate); !got.Equal(tt.want) {
+				t.Errorf("DueDate = %s, want %s", got.Format("2006-01-02"), tt.want.Format("2006-01-02"))
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	terms := models.PaymentTerms{ID: uuid.New(), Name: "2/10 Net 30", DueDays: 30, DiscountPercent: 2, DiscountDays: 10}
+
+	invoice := models.Invoice{InvoiceDate: date(2026, 3, 1), DiscountPercent: 5}
+	Apply(&invoice, terms)
+	if invoice.PaymentTerms != "2/10 Net 30" || *invoice.PaymentTermsID != terms.ID || invoice.DiscountPercent != 2 {
+		t.Errorf("Apply recorded %q %v %v%%", invoice.PaymentTerms, invoice.PaymentTermsID, invoice.DiscountPercent)
+	}
+	if !invoice.DueDate.Equal(date(2026, 3, 31)) || invoice.DiscountDueDate == nil || !invoice.DiscountDueDate.Equal(date(2026, 3, 11)) {
+		t.Errorf("Apply set due %s, discount due %v", invoice.DueDate.Format("2006-01-02"), invoice.DiscountDueDate)
+	}
+
+	given := models.Invoice{InvoiceDate: date(2026, 3, 1), DueDate: date(2026, 5, 1)}
+	Apply(&given, models.PaymentTerms{Name: "Net 15", DueDays: 15})
+	if !given.DueDate.Equal(date(2026, 5, 1)) || given.DiscountDueDate != nil {
+		t.Errorf("Apply replaced the given due date: %s, discount due %v", given.DueDate.Format("2006-01-02"), given.DiscountDueDate)
+	}
+}
+
+func TestReissue(t *testing.T) {
+	terms := models.PaymentTerms{ID: uuid.New(), Name: "2/10 Net 30", DueDays: 30, DiscountPercent: 2, DiscountDays: 10}
+	net15 := models.PaymentTerms{ID: uuid.New(), Name: "Net 15", DueDays: 15}
+	discountDue := date(2026, 3, 11)
+	previous := models.Invoice{
+		InvoiceDate:     date(2026, 3, 1),
+		DueDate:         date(2026, 3, 31),
+		PaymentTermsID:  &terms.ID,
+		PaymentTerms:    terms.Name,
+		DiscountPercent: 2,
+		DiscountDueDate: &discountDue,
+	}
+	untermed := models.Invoice{InvoiceDate: date(2026, 3, 1), DueDate: date(2026, 4, 1)}
+
+	tests := []struct {
+		name         string
+		previous     models.Invoice
+		update       models.Invoice
+		terms        *models.PaymentTerms
+		wantTerms    string
+		wantDue      time.Time
+		wantDiscount *time.Time
+	}{
+		{"unchanged", previous, models.Invoice{InvoiceDate: date(2026, 3, 1), DueDate: date(2026, 3, 31)}, &terms, "2/10 Net 30", date(2026, 3, 31), &discountDue},
+		{"due date left out", previous, models.Invoice{InvoiceDate: date(2026, 3, 1)}, &terms, "2/10 Net 30", date(2026, 3, 31), &discountDue},
+		{"due date moved", previous, models.Invoice{InvoiceDate: date(2026, 3, 1), DueDate: date(2026, 4, 15)}, &terms, "2/10 Net 30", date(2026, 4, 15), &discountDue},
+		{"invoice date moved", previous, models.Invoice{InvoiceDate: date(2026, 4, 1), DueDate: date(2026, 3, 31)}, &terms, "2/10 Net 30", date(2026, 5, 1), ptr(date(2026, 4, 11))},
+		{"invoice date moved, due date left out", previous, models.Invoice{InvoiceDate: date(2026, 4, 1)}, &terms, "2/10 Net 30", date(2026, 5, 1), ptr(date(2026, 4, 11))},
+		{"invoice and due date moved", previous, models.Invoice{InvoiceDate: date(2026, 4, 1), DueDate: date(2026, 6, 1)}, &terms, "2/10 Net 30", date(2026, 6, 1), ptr(date(2026, 4, 11))},
+		{"other terms named", previous, models.Invoice{InvoiceDate: date(2026, 3, 1), DueDate: date(2026, 3, 31), PaymentTermsID: &net15.ID}, &net15, "Net 15", date(2026, 3, 16), nil},
+		{"terms deleted, invoice date moved", models.Invoice{InvoiceDate: previous.InvoiceDate, DueDate: previous.DueDate, PaymentTerms: terms.Name, DiscountPercent: 2, DiscountDueDate: &discountDue}, models.Invoice{InvoiceDate: date(2026, 4, 1), DueDate: date(2026, 3, 31)}, nil, "2/10 Net 30", date(2026, 5, 1), ptr(date(2026, 4, 11))},
+		{"no terms, invoice date moved", untermed, models.Invoice{InvoiceDate: date(2026, 5, 10), DueDate: date(2026, 4, 1)}, nil, "", date(2026, 6, 10), nil},
+		{"no terms, due date given", untermed, models.Invoice{InvoiceDate: date(2026, 5, 10), DueDate: date(2026, 5, 20)}, nil, "", date(2026, 5, 20), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoice := tt.update
+			Reissue(&invoice, tt.previous, tt.terms)
+			if invoice.PaymentTerms != tt.wantTerms {
+				t.Errorf("terms = %q, want %q", invoice.PaymentTerms, tt.wantTerms)
+			}
+			if !invoice.DueDate.Equal(tt.wantDue) {
+				t.Errorf("due date = %s, want %s", invoice.DueDate.Format("2006-01-02"), tt.wantDue.Format("2006-01-02"))
+			}
+			if (invoice.DiscountDueDate == nil) != (tt.wantDiscount == nil) || (tt.wantDiscount != nil && !invoice.DiscountDueDate.Equal(*tt.wantDiscount)) {
+				t.Errorf("discount due date = %v, want %v", invoice.DiscountDueDate, tt.wantDiscount)
+			}
+		})
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestAmountDue(t *testing.T) {
+	discountDate := date(2026, 3, 11)
+	discounted := models.Invoice{TotalAmount: 1234.56, DiscountPercent: 2, DiscountDueDate: &discountDate}
+	tests := []struct {
+		name     string
+		invoice  models.Invoice
+		on       time.Time
+		discount float64
+		want     float64
+	}{
+		{"no discount", models.Invoice{TotalAmount: 100}, date(2026, 3, 1), 0, 100},
+		{"partially paid", models.Invoice{TotalAmount: 100, AmountPaid: 40.25}, date(2026, 3, 1), 0, 59.75},
+		{"settled", models.Invoice{TotalAmount: 100, AmountPaid: 100}, date(2026, 3, 1), 0, 0},
+		{"overpaid", models.Invoice{TotalAmount: 100, AmountPaid: 120}, date(2026, 3, 1), 0, 0},
+		{"within the discount period", discounted, date(2026, 3, 5), 24.69, 1209.87},
+		{"on the discount date", discounted, time.Date(2026, 3, 11, 23, 59, 0, 0, time.UTC), 24.69, 1209.87},
+		{"discount date in another zone", discounted, time.Date(2026, 3, 12, 0, 30, 0, 0, time.FixedZone("CET", 3600)), 24.69, 1209.87},
+		{"after the discount date", discounted, date(2026, 3, 12), 24.69, 1234.56},
+		{"only the discount left open", models.Invoice{TotalAmount: 1234.56, AmountPaid: 1209.87, DiscountPercent: 2, DiscountDueDate: &discountDate}, date(2026, 3, 5), 24.69, 24.69},
+		{"discount without a date", models.Invoice{TotalAmount: 100, DiscountPercent: 2}, date(2026, 3, 1), 0, 100},
+		{"paid with the discount", models.Invoice{Status: "paid", TotalAmount: 1234.56, AmountPaid: 1209.87, DiscountPercent: 2, DiscountDueDate: &discountDate}, date(2026, 3, 5), 24.69, 0},
+		{"void", models.Invoice{Status: "void", TotalAmount: 100}, date(2026, 3, 1), 0, 0},
+		{"credit note", models.Invoice{Status: "sent", DocumentType: "credit_note", TotalAmount: 100}, date(2026, 3, 1), 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Discount(tt.invoice); got != tt.discount {
+				t.Errorf("Discount = %v, want %v", got, tt.discount)
+			}
+			if got := AmountDue(tt.invoice, tt.on); got != tt.want {
+				t.Errorf("AmountDue = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		terms models.PaymentTerms
+		ok    bool
+	}{
+		{"net 30", models.PaymentTerms{Name: " Net 30 ", DueDays: 30}, true},
+		{"discount", models.PaymentTerms{Name: "2/10 Net 30", DueDays: 30, DiscountPercent: 2, DiscountDays: 10}, true},
+		{"end of month discount past due days", models.PaymentTerms{Name: "EOM", DueDays: 5, EndOfMonth: true, DiscountPercent: 2, DiscountDays: 10}, true},
+		{"no name", models.PaymentTerms{DueDays: 30}, false},
+		{"negative days", models.PaymentTerms{Name: "x", DueDays: -1}, false},
+		{"too many days", models.PaymentTerms{Name: "x", DueDays: 366}, false},
+		{"discount of 100%", models.PaymentTerms{Name: "x", DueDays: 30, DiscountPercent: 100, DiscountDays: 10}, false},
+		{"discount without days", models.PaymentTerms{Name: "x", DueDays: 30, DiscountPercent: 2}, false},
+		{"discount after due date", models.PaymentTerms{Name: "x", DueDays: 10, DiscountPercent: 2, DiscountDays: 20}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			terms := tt.terms
+			if err := Validate(&terms); (err == nil) != tt.ok {
+				t.Errorf("Validate = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
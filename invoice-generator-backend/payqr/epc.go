@@ -0,0 +1,78 @@
+package payqr
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxEPCPayload is the largest payload EPC069-12 allows, in bytes.
+const maxEPCPayload = 331
+
+// EPCTransfer holds the fields of an EPC069-12 ("GiroCode") SEPA credit
+// transfer QR code.
+type EPCTransfer struct {
+	BIC           string // optional within the EEA
+	Name          string // beneficiary, max 70 characters
+	IBAN          string
+	Amount        float64 // in EUR, 0.01 to 999999999.99
+	Purpose       string  // optional ISO 20022 purpose code
+	Reference     string  // structured ISO 11649 creditor reference
+	RemittanceTxt string  // unstructured remittance, used when Reference is empty
+}
+
+// Payload returns the EPC069-12 version 002 payload using UTF-8.
+func (t EPCTransfer) Payload() (string, error) {
+	iban := NormalizeIBAN(t.IBAN)
+	if err := ValidateIBAN(iban); err != nil {
+		return "", err
+	}
+	name := strings.TrimSpace(t.Name)
+	if name == "" || utf8.RuneCountInString(name) > 70 {
+		return "", fmt.Errorf("beneficiary name must have 1 to 70 characters")
+	}
+	if t.Amount < 0.01 || t.Amount > 999999999.99 {
+		return "", fmt.Errorf("amount must be between 0.01 and 999999999.99 EUR")
+	}
+	if t.Reference != "" && !ValidCreditorReference(t.Reference) {
+		return "", fmt.Errorf("invalid creditor reference %q", t.Reference)
+	}
+	if utf8.RuneCountInString(t.RemittanceTxt) > 140 {
+		return "", fmt.Errorf("remittance information must not exceed 140 characters")
+	}
+
+	// Structured and unstructured remittance are mutually exclusive.
+	remittance := t.RemittanceTxt
+	if t.Reference != "" {
+		remittance = ""
+	}
+
+	lines := []string{
+		"BCD",
+		"002",
+		"1", // UTF-8
+		"SCT",
+		strings.ToUpper(strings.TrimSpace(t.BIC)),
+		name,
+		iban,
+		fmt.Sprintf("EUR%.2f", t.Amount),
+		t.Purpose,
+		t.Reference,
+		remittance,
+	}
+	payload := strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	if len(payload) > maxEPCPayload {
+		return "", fmt.Errorf("EPC payload exceeds %d bytes", maxEPCPayload)
+	}
+	return payload, nil
+}
+
+// EPCCode encodes the transfer as a QR code at error correction level M, as
+// required by EPC069-12.
+func EPCCode(t EPCTransfer) (*Code, error) {
+	payload, err := t.Payload()
+	if err != nil {
+		return nil, err
+	}
+	return Encode([]byte(payload), LevelM)
+}
@@ -0,0 +1,128 @@
+package payqr
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The symbols in testdata/qr were made by another encoder,
+// github.com/skip2/go-qrcode, which picked mask patterns by its own penalty
+// scoring. Each file gives the level, the mask and the quoted data,
+// followed by the modules, # for dark.
+type goldenQR struct {
+	level   Level
+	mask    int
+	data    []byte
+	modules []string
+}
+
+func readGoldenQR(t *testing.T, path string) goldenQR {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var g goldenQR
+	var level, data string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for _, field := range []string{"level", "mask", "data"} {
+		if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), field+" ") {
+			t.Fatalf("%s: missing %s line", path, field)
+		}
+		value := strings.TrimPrefix(scanner.Text(), field+" ")
+		switch field {
+		case "level":
+			level = value
+		case "mask":
+			g.mask, err = strconv.Atoi(value)
+		case "data":
+			data, err = strconv.Unquote(value)
+		}
+		if err != nil {
+			t.Fatalf("%s: invalid %s line: %v", path, field, err)
+		}
+	}
+	g.level = Level(strings.Index("LMQH", level))
+	g.data = []byte(data)
+	for scanner.Scan() {
+		g.modules = append(g.modules, scanner.Text())
+	}
+	return g
+}
+
+// matrix renders the code like the golden files.
+func matrix(c *Code) []string {
+	rows := make([]string, c.Size)
+	for y := range rows {
+		var row strings.Builder
+		for x := 0; x < c.Size; x++ {
+			if c.Black(x, y) {
+				row.WriteByte('#')
+			} else {
+				row.WriteByte('.')
+			}
+		}
+		rows[y] = row.String()
+	}
+	return rows
+}
+
+func diffMatrix(got, want []string) string {
+	if len(got) != len(want) {
+		return fmt.Sprintf("size %d, want %d", len(got), len(want))
+	}
+	for y := range want {
+		if got[y] != want[y] {
+			return fmt.Sprintf("row %d is\n%s\nwant\n%s", y, got[y], want[y])
+		}
+	}
+	return ""
+}
+
+func TestEncodeGolden(t *testing.T) {
+	// The other encoder's penalty scoring picks the same mask for these
+	sameMask := map[string]bool{
+		"v1-M": true, "v2-H": true, "v4-L": true, "v7-H": true,
+		"v11-L": true, "v13-M": true, "v16-Q": true, "v18-H": true, "v35-M": true,
+	}
+	paths, err := filepath.Glob(filepath.Join("testdata", "qr", "*.txt"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no golden QR codes: %v", err)
+	}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".txt")
+		t.Run(name, func(t *testing.T) {
+			g := readGoldenQR(t, path)
+
+			c, err := encode(g.data, g.level, g.mask)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "v" + strconv.Itoa(c.Version) + "-"; !strings.HasPrefix(name, want) {
+				t.Errorf("version %d, want %s", c.Version, name)
+			}
+			if diff := diffMatrix(matrix(c), g.modules); diff != "" {
+				t.Errorf("mask %d: %s", g.mask, diff)
+			}
+
+			if !sameMask[name] {
+				return
+			}
+			c, err = Encode(g.data, g.level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := diffMatrix(matrix(c), g.modules); diff != "" {
+				t.Errorf("chosen mask: %s", diff)
+			}
+		})
+	}
+}
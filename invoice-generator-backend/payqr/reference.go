@@ -0,0 +1,148 @@
+package payqr
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+var (
+	ibanRe  = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]{11,30}$`)
+	alnumRe = regexp.MustCompile(`[^A-Z0-9]`)
+	digitRe = regexp.MustCompile(`[^0-9]`)
+)
+
+// NormalizeIBAN strips spaces and upper-cases an IBAN.
+func NormalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(iban), ""))
+}
+
+// ValidateIBAN checks the format and ISO 13616 mod-97 checksum of an IBAN.
+func ValidateIBAN(iban string) error {
+	iban = NormalizeIBAN(iban)
+	if !ibanRe.MatchString(iban) {
+		return fmt.Errorf("invalid IBAN format")
+	}
+	if mod97(iban[4:]+iban[:4]) != 1 {
+		return fmt.Errorf("invalid IBAN checksum")
+	}
+	return nil
+}
+
+// FormatIBAN groups an IBAN in blocks of four characters for printing.
+func FormatIBAN(iban string) string {
+	return group(NormalizeIBAN(iban), 4, false)
+}
+
+// IsQRIBAN reports whether a Swiss or Liechtenstein IBAN is a QR-IBAN,
+// i.e. its institution ID lies in the reserved range 30000-31999. Payments
+// to a QR-IBAN must carry a QR reference.
+func IsQRIBAN(iban string) bool {
+	iban = NormalizeIBAN(iban)
+	if len(iban) != 21 || (iban[:2] != "CH" && iban[:2] != "LI") {
+		return false
+	}
+	iid := iban[4:9]
+	return iid >= "30000" && iid <= "31999"
+}
+
+// CreditorReference builds an ISO 11649 structured creditor reference
+// ("RF" + two check digits + up to 21 alphanumerics) from base, which is
+// stripped of everything but letters and digits.
+func CreditorReference(base string) (string, error) {
+	base = alnumRe.ReplaceAllString(strings.ToUpper(base), "")
+	if base == "" || len(base) > 21 {
+		return "", fmt.Errorf("creditor reference base must have 1 to 21 alphanumeric characters")
+	}
+	check := 98 - mod97(base+"RF00")
+	return fmt.Sprintf("RF%02d%s", check, base), nil
+}
+
+// ValidCreditorReference checks the check digits of an ISO 11649 reference.
+func ValidCreditorReference(ref string) bool {
+	ref = strings.ToUpper(strings.Join(strings.Fields(ref), ""))
+	if len(ref) < 5 || len(ref) > 25 || !strings.HasPrefix(ref, "RF") || alnumRe.MatchString(ref) {
+		return false
+	}
+	return mod97(ref[4:]+ref[:4]) == 1
+}
+
+// QRReference builds a 27 digit Swiss QR reference from the digits in base,
+// left padded with zeros and followed by a recursive mod-10 check digit.
+func QRReference(base string) (string, error) {
+	digits := digitRe.ReplaceAllString(base, "")
+	if len(digits) > 26 {
+		return "", fmt.Errorf("QR reference base has more than 26 digits")
+	}
+	if strings.Trim(digits, "0") == "" {
+		return "", fmt.Errorf("QR reference base must contain a non-zero digit")
+	}
+	digits = strings.Repeat("0", 26-len(digits)) + digits
+	return digits + string(rune('0'+mod10Recursive(digits))), nil
+}
+
+// ValidQRReference checks the length and check digit of a QR reference.
+func ValidQRReference(ref string) bool {
+	ref = strings.Join(strings.Fields(ref), "")
+	if len(ref) != 27 || digitRe.MatchString(ref) {
+		return false
+	}
+	return mod10Recursive(ref[:26]) == int(ref[26]-'0')
+}
+
+// FormatReference groups a QR reference in blocks of five from the right
+// (2 + 5x5 digits) and a creditor reference in blocks of four from the left,
+// as printed on payment slips.
+func FormatReference(ref string) string {
+	if strings.HasPrefix(ref, "RF") {
+		return group(ref, 4, false)
+	}
+	return group(ref, 5, true)
+}
+
+// mod10Recursive computes the check digit of the Swiss recursive modulo 10
+// algorithm used for ESR/QR references.
+func mod10Recursive(digits string) int {
+	table := [10]int{0, 9, 4, 6, 8, 2, 7, 1, 3, 5}
+	carry := 0
+	for _, d := range digits {
+		carry = table[(carry+int(d-'0'))%10]
+	}
+	return (10 - carry) % 10
+}
+
+// mod97 converts letters to numbers (A=10 ... Z=35) and returns the value
+// modulo 97, as used by IBAN and ISO 11649 check digits.
+func mod97(s string) int {
+	var numeric strings.Builder
+	for _, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			fmt.Fprintf(&numeric, "%d", r-'A'+10)
+		} else {
+			numeric.WriteRune(r)
+		}
+	}
+	n, ok := new(big.Int).SetString(numeric.String(), 10)
+	if !ok {
+		return -1
+	}
+	return int(new(big.Int).Mod(n, big.NewInt(97)).Int64())
+}
+
+// group inserts a space every n characters, counting from the right
+// when fromRight is set.
+func group(s string, n int, fromRight bool) string {
+	var b strings.Builder
+	offset := 0
+	if fromRight {
+		offset = len(s) % n
+	}
+	for i, r := range s {
+		if i > 0 && (i-offset)%n == 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
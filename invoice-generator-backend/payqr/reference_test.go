@@ -0,0 +1,141 @@
+package payqr
+
+import "testing"
+
+func TestValidateIBAN(t *testing.T) {
+	tests := []struct {
+		iban  string
+		valid bool
+	}{
+		{"DE89370400440532013000", true},
+		{"de89 3704 0044 0532 0130 00", true},
+		{"GB82 WEST 1234 5698 7654 32", true},
+		{"CH9300762011623852957", true},
+		{"CH4431999123000889012", true},
+		{"DE88370400440532013000", false},
+		{"GB82 WEST 1234 5698 7654 33", false},
+		{"DE8937040044", false},
+		{"1289370400440532013000", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateIBAN(tt.iban); (err == nil) != tt.valid {
+			t.Errorf("ValidateIBAN(%q) = %v, want valid %v", tt.iban, err, tt.valid)
+		}
+	}
+}
+
+func TestIsQRIBAN(t *testing.T) {
+	tests := map[string]bool{
+		"CH4431999123000889012":      true,
+		"CH44 3199 9123 0008 8901 2": true,
+		"LI2130000000000000001":      true,
+		"CH9300762011623852957":      false,
+		"DE89370400440532013000":     false,
+	}
+	for iban, want := range tests {
+		if got := IsQRIBAN(iban); got != want {
+			t.Errorf("IsQRIBAN(%q) = %v, want %v", iban, got, want)
+		}
+	}
+}
+
+func TestCreditorReference(t *testing.T) {
+	tests := []struct {
+		base, want string
+	}{
+		{"539007547034", "RF18539007547034"},
+		{"5390 0754 7034", "RF18539007547034"},
+		{"INV-2026-0001", "RF16INV20260001"},
+		{"a", "RF25A"},
+	}
+	for _, tt := range tests {
+		got, err := CreditorReference(tt.base)
+		if err != nil || got != tt.want {
+			t.Errorf("CreditorReference(%q) = %q, %v, want %q", tt.base, got, err, tt.want)
+		}
+		if !ValidCreditorReference(got) {
+			t.Errorf("ValidCreditorReference(%q) = false", got)
+		}
+	}
+
+	for _, base := range []string{"", "--", "1234567890123456789012"} {
+		if _, err := CreditorReference(base); err == nil {
+			t.Errorf("CreditorReference(%q) succeeded, want an error", base)
+		}
+	}
+}
+
+func TestValidCreditorReference(t *testing.T) {
+	tests := map[string]bool{
+		"RF18539007547034":           true,
+		"RF18 5390 0754 7034":        true,
+		"rf18539007547034":           true,
+		"RF19539007547034":           false,
+		"RF18539007547035":           false,
+		"RF18":                       false,
+		"XX18539007547034":           false,
+		"RF18-5390-0754-7034":        false,
+		"RF185390075470341234567890": false,
+	}
+	for ref, want := range tests {
+		if got := ValidCreditorReference(ref); got != want {
+			t.Errorf("ValidCreditorReference(%q) = %v, want %v", ref, got, want)
+		}
+	}
+}
+
+func TestQRReference(t *testing.T) {
+	tests := []struct {
+		base, want string
+	}{
+		{"21000000000313947143000901", "210000000003139471430009017"},
+		{"1", "000000000000000000000000011"},
+		{"INV-2026-0001", "000000000000000000202600013"},
+	}
+	for _, tt := range tests {
+		got, err := QRReference(tt.base)
+		if err != nil || got != tt.want {
+			t.Errorf("QRReference(%q) = %q, %v, want %q", tt.base, got, err, tt.want)
+		}
+		if !ValidQRReference(got) {
+			t.Errorf("ValidQRReference(%q) = false", got)
+		}
+	}
+
+	for _, base := range []string{"", "000", "123456789012345678901234567"} {
+		if _, err := QRReference(base); err == nil {
+			t.Errorf("QRReference(%q) succeeded, want an error", base)
+		}
+	}
+}
+
+func TestValidQRReference(t *testing.T) {
+	tests := map[string]bool{
+		"210000000003139471430009017":      true,
+		"21 00000 00003 13947 14300 09017": true,
+		"210000000003139471430009018":      false,
+		"21000000000313947143000901":       false,
+		"21000000000313947143000901A":      false,
+	}
+	for ref, want := range tests {
+		if got := ValidQRReference(ref); got != want {
+			t.Errorf("ValidQRReference(%q) = %v, want %v", ref, got, want)
+		}
+	}
+}
+
+func TestFormatReference(t *testing.T) {
+	tests := map[string]string{
+		"210000000003139471430009017": "21 00000 00003 13947 14300 09017",
+		"RF18539007547034":            "RF18 5390 0754 7034",
+	}
+	for ref, want := range tests {
+		if got := FormatReference(ref); got != want {
+			t.Errorf("FormatReference(%q) = %q, want %q", ref, got, want)
+		}
+	}
+	if got := FormatIBAN("ch9300762011623852957"); got != "CH93 0076 2011 6238 5295 7" {
+		t.Errorf("FormatIBAN = %q", got)
+	}
+}
@@ -0,0 +1,335 @@
+package payqr
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"image"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSwissPayload is the largest payload the Swiss Implementation
+// Guidelines for the QR-bill allow, in characters.
+const maxSwissPayload = 997
+
+// Reference types of the Swiss QR-bill.
+const (
+	ReferenceQRR  = "QRR"  // 27 digit QR reference, required for QR-IBANs
+	ReferenceSCOR = "SCOR" // ISO 11649 creditor reference
+	ReferenceNone = "NON"
+)
+
+// Address is a structured (type "S") QR-bill address.
+type Address struct {
+	Name           string // max 70 characters
+	Street         string // max 70 characters
+	BuildingNumber string // max 16 characters
+	PostalCode     string // max 16 characters
+	Town           string // max 35 characters
+	Country        string // ISO 3166-1 alpha-2
+}
+
+func (a Address) validate(role string) error {
+	if a.Name == "" || a.PostalCode == "" || a.Town == "" || len(a.Country) != 2 {
+		return fmt.Errorf("%s address needs a name, postal code, town and country", role)
+	}
+	for _, f := range []struct {
+		value string
+		max   int
+	}{{a.Name, 70}, {a.Street, 70}, {a.BuildingNumber, 16}, {a.PostalCode, 16}, {a.Town, 35}} {
+		if utf8.RuneCountInString(f.value) > f.max {
+			return fmt.Errorf("%s address field %q exceeds %d characters", role, f.value, f.max)
+		}
+	}
+	return nil
+}
+
+func (a Address) fields() []string {
+	return []string{"S", a.Name, a.Street, a.BuildingNumber, a.PostalCode, a.Town, strings.ToUpper(a.Country)}
+}
+
+// lines returns the address as printed on the payment part.
+func (a Address) lines() []string {
+	lines := []string{a.Name}
+	if street := strings.TrimSpace(a.Street + " " + a.BuildingNumber); street != "" {
+		lines = append(lines, street)
+	}
+	return append(lines, strings.ToUpper(a.Country)+"-"+a.PostalCode+" "+a.Town)
+}
+
+// SwissBill holds the data of a Swiss QR-bill payment part.
+type SwissBill struct {
+	Account         string // CH or LI IBAN or QR-IBAN
+	Creditor        Address
+	Amount          float64  // 0 leaves the amount open
+	Currency        string   // CHF or EUR
+	Debtor          *Address // nil leaves the debtor open
+	Reference       string   // QR reference or creditor reference
+	Message         string   // unstructured message, max 140 characters
+	BillInformation string   // structured bill information, e.g. Swico S1
+}
+
+// ReferenceType derives the reference type from the reference itself.
+func (b SwissBill) ReferenceType() string {
+	switch {
+	case b.Reference == "":
+		return ReferenceNone
+	case strings.HasPrefix(strings.ToUpper(b.Reference), "RF"):
+		return ReferenceSCOR
+	default:
+		return ReferenceQRR
+	}
+}
+
+// Validate checks the bill against the rules of the Swiss Implementation
+// Guidelines.
+func (b SwissBill) Validate() error {
+	account := NormalizeIBAN(b.Account)
+	if err := ValidateIBAN(account); err != nil {
+		return err
+	}
+	if account[:2] != "CH" && account[:2] != "LI" {
+		return fmt.Errorf("QR-bill account must be a Swiss or Liechtenstein IBAN")
+	}
+	if b.Currency != "CHF" && b.Currency != "EUR" {
+		return fmt.Errorf("QR-bill currency must be CHF or EUR")
+	}
+	if b.Amount < 0 || b.Amount > 999999999.99 {
+		return fmt.Errorf("QR-bill amount must be between 0.01 and 999999999.99")
+	}
+	if err := b.Creditor.validate("creditor"); err != nil {
+		return err
+	}
+	if b.Debtor != nil {
+		if err := b.Debtor.validate("debtor"); err != nil {
+			return err
+		}
+	}
+
+	switch b.ReferenceType() {
+	case ReferenceQRR:
+		if !IsQRIBAN(account) {
+			return fmt.Errorf("a QR reference requires a QR-IBAN")
+		}
+		if !ValidQRReference(b.Reference) {
+			return fmt.Errorf("invalid QR reference %q", b.Reference)
+		}
+	case ReferenceSCOR:
+		if IsQRIBAN(account) {
+			return fmt.Errorf("a QR-IBAN requires a QR reference")
+		}
+		if !ValidCreditorReference(b.Reference) {
+			return fmt.Errorf("invalid creditor reference %q", b.Reference)
+		}
+	default:
+		if IsQRIBAN(account) {
+			return fmt.Errorf("a QR-IBAN requires a QR reference")
+		}
+	}
+
+	if utf8.RuneCountInString(b.Message)+utf8.RuneCountInString(b.BillInformation) > 140 {
+		return fmt.Errorf("message and bill information must not exceed 140 characters together")
+	}
+	return nil
+}
+
+// Payload returns the Swiss Payments Code (SPC) version 0200 payload.
+func (b SwissBill) Payload() (string, error) {
+	if err := b.Validate(); err != nil {
+		return "", err
+	}
+
+	fields := []string{"SPC", "0200", "1", NormalizeIBAN(b.Account)}
+	fields = append(fields, b.Creditor.fields()...)
+	fields = append(fields, "", "", "", "", "", "", "") // ultimate creditor, reserved
+	if b.Amount > 0 {
+		fields = append(fields, fmt.Sprintf("%.2f", b.Amount))
+	} else {
+		fields = append(fields, "")
+	}
+	fields = append(fields, b.Currency)
+	if b.Debtor != nil {
+		fields = append(fields, b.Debtor.fields()...)
+	} else {
+		fields = append(fields, "", "", "", "", "", "", "")
+	}
+	fields = append(fields, b.ReferenceType(), strings.Join(strings.Fields(b.Reference), ""), b.Message, "EPD")
+	if b.BillInformation != "" {
+		fields = append(fields, b.BillInformation)
+	}
+
+	payload := strings.Join(fields, "\n")
+	if utf8.RuneCountInString(payload) > maxSwissPayload {
+		return "", fmt.Errorf("QR-bill payload exceeds %d characters", maxSwissPayload)
+	}
+	return payload, nil
+}
+
+// SwissCode encodes the bill as a Swiss QR Code: error correction level M
+// with the Swiss cross in the centre.
+func SwissCode(b SwissBill) (*Code, error) {
+	payload, err := b.Payload()
+	if err != nil {
+		return nil, err
+	}
+	code, err := Encode([]byte(payload), LevelM)
+	if err != nil {
+		return nil, err
+	}
+	if code.Version > 25 {
+		return nil, fmt.Errorf("QR-bill payload needs QR version %d, at most 25 allowed", code.Version)
+	}
+	return code, nil
+}
+
+// SwissDataURL renders the Swiss QR Code, including the Swiss cross, as a
+// base64 PNG data: URL. The image has no quiet zone of its own; the payment
+// part layout provides the 5 mm margin around it.
+func (c *Code) SwissDataURL(scale int) (string, error) {
+	data, err := c.renderPNG(scale, 0, drawSwissCross)
+	if err != nil {
+		return "", err
+	}
+	return pngDataURL(data), nil
+}
+
+// drawSwissCross overlays the 7 x 7 mm Swiss cross on the 46 x 46 mm code:
+// a white frame, a black square and a white cross in flag proportions.
+func drawSwissCross(img *image.Paletted, origin, width int) {
+	centre := origin + width/2
+	fill := func(half, index int) {
+		for y := centre - half; y < centre+half; y++ {
+			for x := centre - half; x < centre+half; x++ {
+				img.SetColorIndex(x, y, uint8(index))
+			}
+		}
+	}
+	outer := width * 7 / 46 / 2
+	fill(outer, 0)
+	inner := width * 6 / 46 / 2
+	fill(inner, 1)
+
+	// The cross arms are 6/32 of the square wide and the cross spans 20/32.
+	arm := inner * 2 * 6 / 32 / 2
+	span := inner * 2 * 20 / 32 / 2
+	for y := centre - span; y < centre+span; y++ {
+		for x := centre - arm; x < centre+arm; x++ {
+			img.SetColorIndex(x, y, 0)
+			img.SetColorIndex(centre+(y-centre), centre+(x-centre), 0)
+		}
+	}
+}
+
+// labels holds the fixed captions of the payment part in the languages the
+// Swiss Implementation Guidelines define.
+var labels = map[string]map[string]string{
+	"en": {"receipt": "Receipt", "paymentPart": "Payment part", "account": "Account / Payable to", "reference": "Reference", "info": "Additional information", "payableBy": "Payable by", "payableByBlank": "Payable by (name/address)", "currency": "Currency", "amount": "Amount", "acceptance": "Acceptance point"},
+	"de": {"receipt": "Empfangsschein", "paymentPart": "Zahlteil", "account": "Konto / Zahlbar an", "reference": "Referenz", "info": "Zusätzliche Informationen", "payableBy": "Zahlbar durch", "payableByBlank": "Zahlbar durch (Name/Adresse)", "currency": "Währung", "amount": "Betrag", "acceptance": "Annahmestelle"},
+	"fr": {"receipt": "Récépissé", "paymentPart": "Section paiement", "account": "Compte / Payable à", "reference": "Référence", "info": "Informations supplémentaires", "payableBy": "Payable par", "payableByBlank": "Payable par (nom/adresse)", "currency": "Monnaie", "amount": "Montant", "acceptance": "Point de dépôt"},
+	"it": {"receipt": "Ricevuta", "paymentPart": "Sezione pagamento", "account": "Conto / Pagabile a", "reference": "Riferimento", "info": "Informazioni supplementari", "payableBy": "Pagabile da", "payableByBlank": "Pagabile da (nome/indirizzo)", "currency": "Valuta", "amount": "Importo", "acceptance": "Punto di accettazione"},
+}
+
+// paymentPartTemplate lays out the receipt (62 mm) and payment part
+// (148 mm) on an A4-wide, 105 mm high strip. Tables are used instead of
+// flexbox because wkhtmltopdf's WebKit does not support it.
+var paymentPartTemplate = template.Must(template.New("qrbill").Parse(`<div class="swiss-qr-bill" style="page-break-inside:avoid;width:210mm;height:105mm;border-top:1px dashed #000;font-family:Helvetica,Arial,sans-serif;color:#000;">
+<table style="border-collapse:collapse;width:210mm;height:105mm;table-layout:fixed;"><tr>
+<td style="width:52mm;padding:5mm;vertical-align:top;border-right:1px dashed #000;">
+  <div style="font-size:11pt;font-weight:bold;height:7mm;">{{.L.receipt}}</div>
+  <div style="height:56mm;font-size:8pt;line-height:9pt;">
+    <div style="font-size:6pt;font-weight:bold;line-height:9pt;">{{.L.account}}</div>
+    <div>{{.Account}}</div>{{range .Creditor}}<div>{{.}}</div>{{end}}
+    {{if .Reference}}<div style="font-size:6pt;font-weight:bold;line-height:9pt;margin-top:9pt;">{{.L.reference}}</div><div>{{.Reference}}</div>{{end}}
+    {{if .Debtor}}<div style="font-size:6pt;font-weight:bold;line-height:9pt;margin-top:9pt;">{{.L.payableBy}}</div>{{range .Debtor}}<div>{{.}}</div>{{end}}
+    {{else}}<div style="font-size:6pt;font-weight:bold;line-height:9pt;margin-top:9pt;">{{.L.payableByBlank}}</div><div style="width:52mm;height:20mm;border:1px solid #000;"></div>{{end}}
+  </div>
+  <table style="border-collapse:collapse;font-size:8pt;height:14mm;"><tr>
+    <td style="width:13mm;vertical-align:top;"><div style="font-size:6pt;font-weight:bold;">{{.L.currency}}</div>{{.Currency}}</td>
+    <td style="vertical-align:top;"><div style="font-size:6pt;font-weight:bold;">{{.L.amount}}</div>{{if .Amount}}{{.Amount}}{{else}}<div style="width:30mm;height:10mm;border:1px solid #000;"></div>{{end}}</td>
+  </tr></table>
+  <div style="font-size:6pt;font-weight:bold;text-align:right;">{{.L.acceptance}}</div>
+</td>
+<td style="width:138mm;padding:5mm;vertical-align:top;">
+  <table style="border-collapse:collapse;table-layout:fixed;width:138mm;"><tr>
+  <td style="width:51mm;vertical-align:top;">
+    <div style="font-size:11pt;font-weight:bold;height:7mm;">{{.L.paymentPart}}</div>
+    <img src="{{.QRCode}}" alt="Swiss QR Code" style="width:46mm;height:46mm;margin:5mm 5mm 5mm 0;">
+    <table style="border-collapse:collapse;font-size:10pt;"><tr>
+      <td style="width:15mm;vertical-align:top;"><div style="font-size:8pt;font-weight:bold;">{{.L.currency}}</div>{{.Currency}}</td>
+      <td style="vertical-align:top;"><div style="font-size:8pt;font-weight:bold;">{{.L.amount}}</div>{{if .Amount}}{{.Amount}}{{else}}<div style="width:40mm;height:15mm;border:1px solid #000;"></div>{{end}}</td>
+    </tr></table>
+  </td>
+  <td style="vertical-align:top;font-size:10pt;line-height:11pt;">
+    <div style="font-size:8pt;font-weight:bold;line-height:11pt;">{{.L.account}}</div>
+    <div>{{.Account}}</div>{{range .Creditor}}<div>{{.}}</div>{{end}}
+    {{if .Reference}}<div style="font-size:8pt;font-weight:bold;line-height:11pt;margin-top:11pt;">{{.L.reference}}</div><div>{{.Reference}}</div>{{end}}
+    {{if .Info}}<div style="font-size:8pt;font-weight:bold;line-height:11pt;margin-top:11pt;">{{.L.info}}</div>{{range .Info}}<div>{{.}}</div>{{end}}{{end}}
+    {{if .Debtor}}<div style="font-size:8pt;font-weight:bold;line-height:11pt;margin-top:11pt;">{{.L.payableBy}}</div>{{range .Debtor}}<div>{{.}}</div>{{end}}
+    {{else}}<div style="font-size:8pt;font-weight:bold;line-height:11pt;margin-top:11pt;">{{.L.payableByBlank}}</div><div style="width:65mm;height:25mm;border:1px solid #000;"></div>{{end}}
+  </td>
+  </tr></table>
+</td>
+</tr></table>
+</div>`))
+
+// PaymentPartHTML renders the receipt and payment part of the bill with
+// captions in lang (en, de, fr or it; anything else falls back to en).
+func (b SwissBill) PaymentPartHTML(lang string) (template.HTML, error) {
+	code, err := SwissCode(b)
+	if err != nil {
+		return "", err
+	}
+	qr, err := code.SwissDataURL(8)
+	if err != nil {
+		return "", err
+	}
+
+	l, ok := labels[lang]
+	if !ok {
+		l = labels["en"]
+	}
+	data := struct {
+		L         map[string]string
+		QRCode    template.URL
+		Account   string
+		Creditor  []string
+		Reference string
+		Info      []string
+		Debtor    []string
+		Currency  string
+		Amount    string
+	}{
+		L:         l,
+		QRCode:    template.URL(qr),
+		Account:   FormatIBAN(b.Account),
+		Creditor:  b.Creditor.lines(),
+		Reference: FormatReference(strings.Join(strings.Fields(b.Reference), "")),
+		Currency:  b.Currency,
+	}
+	if b.Debtor != nil {
+		data.Debtor = b.Debtor.lines()
+	}
+	for _, s := range []string{b.Message, b.BillInformation} {
+		if s != "" {
+			data.Info = append(data.Info, s)
+		}
+	}
+	if b.Amount > 0 {
+		data.Amount = formatSwissAmount(b.Amount)
+	}
+
+	var buf bytes.Buffer
+	if err := paymentPartTemplate.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render QR-bill payment part: %v", err)
+	}
+	return template.HTML(buf.String()), nil
+}
+
+// formatSwissAmount prints an amount with a space as thousands separator,
+// e.g. "1 949.75".
+func formatSwissAmount(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	intPart, frac := s[:len(s)-3], s[len(s)-3:]
+	return group(intPart, 3, true) + frac
+}
@@ -0,0 +1,89 @@
+package pdf
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"strings"
+
+	"invoice-generator-go/storage"
+
+	"github.com/google/uuid"
+)
+
+// assetLoader resolves a template asset name to a URL the rendered HTML can
+// use without network access.
+type assetLoader func(name string) (template.URL, error)
+
+// placeholderAsset is a transparent 1x1 GIF.
+const placeholderAsset = template.URL("data:image/gif;base64,R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7")
+
+// placeholderAssets stands in for assets when there is no stored template to
+// load them from: during validation and when previewing unsaved content.
+func placeholderAssets(name string) (template.URL, error) {
+	return placeholderAsset, nil
+}
+
+// templateAssets returns a loader for the assets uploaded for a stored
+// template. Assets are inlined as data: URLs, so wkhtmltopdf never has to
+// fetch them, and each one is loaded at most once per render.
+func templateAssets(templateID uuid.UUID) assetLoader {
+	if templateID == uuid.Nil {
+		return placeholderAssets
+	}
+	cache := make(map[string]template.URL)
+	return func(name string) (template.URL, error) {
+		if url, ok := cache[name]; ok {
+			return url, nil
+		}
+		asset, err := storage.GetTemplateAsset(templateID, name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("template asset %q not found", name)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to get template asset %q: %v", name, err)
+		}
+		data, err := storage.Blobs.Get(asset.BlobKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to load template asset %q: %v", name, err)
+		}
+		url := dataURL(asset.ContentType, data)
+		cache[name] = url
+		return url, nil
+	}
+}
+
+// assetFuncs provides {{asset "name"}}, which yields the named asset as a
+// URL usable in src attributes and CSS url(), e.g. for @font-face.
+func assetFuncs(assets assetLoader) template.FuncMap {
+	return template.FuncMap{
+		"asset": func(name string) (template.URL, error) {
+			return assets(name)
+		},
+	}
+}
+
+// resolveTemplateURL resolves a template's logo or background setting. A
+// plain name refers to one of the template's assets; http(s) URLs are used
+// as given.
+func resolveTemplateURL(value *string, assets assetLoader) template.URL {
+	if value == nil || *value == "" {
+		return ""
+	}
+	if strings.HasPrefix(*value, "https://") || strings.HasPrefix(*value, "http://") {
+		return template.URL(*value)
+	}
+	url, err := assets(*value)
+	if err != nil {
+		log.Printf("Failed to resolve template image: %v", err)
+		return ""
+	}
+	return url
+}
+
+func dataURL(contentType string, data []byte) template.URL {
+	return template.URL("data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data))
+}
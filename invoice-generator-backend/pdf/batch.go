@@ -0,0 +1,80 @@
+package pdf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"invoice-generator-go/models"
+	"invoice-generator-go/storage"
+)
+
+// RenderPrintBatch renders invoices into a single PDF for printing, each
+// starting on a new page, calling progress after each invoice is rendered.
+// wkhtmltopdf converts all of them in one run, so the batch needs no PDF
+// merging.
+func RenderPrintBatch(ctx context.Context, invoices []models.Invoice, progress func(done int)) ([]byte, error) {
+	if len(invoices) == 0 {
+		return nil, fmt.Errorf("no invoices to render")
+	}
+
+	dir, err := os.MkdirTemp("", "invoice-batch-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	htmlPaths := make([]string, 0, len(invoices))
+	for i, invoice := range invoices {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		html, err := batchInvoiceHTML(ctx, invoice)
+		if err != nil {
+			return nil, fmt.Errorf("invoice %s: %w", invoice.InvoiceNumber, err)
+		}
+		htmlPath := filepath.Join(dir, fmt.Sprintf("%04d.html", i))
+		if err := os.WriteFile(htmlPath, html, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write temporary HTML file: %v", err)
+		}
+		htmlPaths = append(htmlPaths, htmlPath)
+		if progress != nil {
+			progress(i + 1)
+		}
+	}
+
+	pdfPath := filepath.Join(dir, "batch.pdf")
+	if err := convertHTMLToPDF(ctx, pdfPath, htmlPaths...); err != nil {
+		var sandboxErr *SandboxError
+		if errors.As(err, &sandboxErr) {
+			return nil, sandboxErr
+		}
+		return nil, fmt.Errorf("failed to convert HTML to PDF: %v", err)
+	}
+
+	data, err := os.ReadFile(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch PDF: %v", err)
+	}
+	return data, nil
+}
+
+// batchInvoiceHTML renders one invoice of a print batch with its stored
+// template and status stamp.
+func batchInvoiceHTML(ctx context.Context, invoice models.Invoice) ([]byte, error) {
+	dbTemplate, err := loadInvoiceTemplate(invoice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load template content: %v", err)
+	}
+	items, err := storage.GetInvoiceItemsByInvoiceID(invoice.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invoice items: %v", err)
+	}
+	company, err := storage.GetCompanyProfileForInvoice(&invoice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get company profile: %v", err)
+	}
+	return invoiceHTML(ctx, dbTemplate, invoice, items, company, Options{})
+}
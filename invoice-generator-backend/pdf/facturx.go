@@ -0,0 +1,404 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FacturXFileName is the attachment name mandated by Factur-X / ZUGFeRD 2.x.
+const FacturXFileName = "factur-x.xml"
+
+// Attachment is an XML payload embedded into a PDF.
+type Attachment struct {
+	FileName    string
+	Description string
+	Data        []byte
+	// ConformanceLevel is the Factur-X profile written to the XMP extension
+	// schema, e.g. "EN 16931".
+	ConformanceLevel string
+}
+
+var (
+	startXRefRe = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	trailerRe   = regexp.MustCompile(`(?s)trailer\s*(<<.*?>>)\s*startxref`)
+	refRe       = regexp.MustCompile(`^\s*(\d+)\s+(\d+)\s+R`)
+)
+
+// EmbedFacturX rewrites the PDF at pdfPath with the attachment embedded as
+// an associated file, the sRGB output intent and the XMP metadata with the
+// Factur-X extension schema, as Factur-X lays out for PDF/A-3. Nothing here
+// checks the rest of the file against PDF/A-3, wkhtmltopdf's output
+// included, so the metadata doesn't declare PDF/A conformance. The original
+// objects are kept untouched and the changes are appended as an incremental
+// update, which avoids having to re-serialise the output of wkhtmltopdf.
+func EmbedFacturX(pdfPath, iccProfilePath, title string, att Attachment) error {
+	original, err := os.ReadFile(pdfPath)
+	if err != nil {
+		return fmt.Errorf("failed to read PDF: %v", err)
+	}
+	icc, err := os.ReadFile(iccProfilePath)
+	if err != nil {
+		return fmt.Errorf("Factur-X output requires an sRGB ICC profile at %s: %v", iccProfilePath, err)
+	}
+
+	m := startXRefRe.FindSubmatch(original)
+	if m == nil {
+		return fmt.Errorf("PDF has no startxref marker")
+	}
+	prevXRef := string(m[1])
+
+	trailers := trailerRe.FindAllSubmatch(original, -1)
+	if len(trailers) == 0 {
+		return fmt.Errorf("PDF uses cross-reference streams, which are not supported")
+	}
+	trailer := string(trailers[len(trailers)-1][1])
+
+	size, err := strconv.Atoi(dictValue(trailer, "Size"))
+	if err != nil {
+		return fmt.Errorf("PDF trailer has invalid /Size: %v", err)
+	}
+	rootNum, rootGen, ok := parseRef(dictValue(trailer, "Root"))
+	if !ok {
+		return fmt.Errorf("PDF trailer has no /Root reference")
+	}
+	catalog, err := findObject(original, rootNum, rootGen)
+	if err != nil {
+		return fmt.Errorf("failed to read document catalog: %v", err)
+	}
+
+	now := time.Now()
+	docID := dictValue(trailer, "ID")
+	if docID == "" {
+		sum := md5.Sum(original)
+		docID = fmt.Sprintf("[<%x> <%x>]", sum, sum)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(original)
+	if !bytes.HasSuffix(original, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+
+	offsets := map[int]int{}
+	next := size
+	newObject := func() int {
+		next++
+		return next - 1
+	}
+	writeObject := func(num, gen int, body string) {
+		offsets[num] = buf.Len()
+		fmt.Fprintf(&buf, "%d %d obj\n%s\nendobj\n", num, gen, body)
+	}
+
+	fileNum := newObject()
+	writeObject(fileNum, 0, fmt.Sprintf(
+		"<< /Type /EmbeddedFile /Subtype /text#2Fxml /Params << /Size %d /ModDate %s >> /Length %d >>\nstream\n%s\nendstream",
+		len(att.Data), pdfDate(now), len(att.Data), att.Data))
+
+	specNum := newObject()
+	writeObject(specNum, 0, fmt.Sprintf(
+		"<< /Type /Filespec /F %s /UF %s /Desc %s /AFRelationship /Data /EF << /F %d 0 R /UF %d 0 R >> >>",
+		pdfString(att.FileName), pdfString(att.FileName), pdfString(att.Description), fileNum, fileNum))
+
+	xmp := xmpMetadata(title, now, att)
+	metaNum := newObject()
+	writeObject(metaNum, 0, fmt.Sprintf("<< /Type /Metadata /Subtype /XML /Length %d >>\nstream\n%s\nendstream", len(xmp), xmp))
+
+	iccNum := newObject()
+	writeObject(iccNum, 0, fmt.Sprintf("<< /N 3 /Length %d >>\nstream\n%s\nendstream", len(icc), icc))
+
+	intentNum := newObject()
+	writeObject(intentNum, 0, fmt.Sprintf(
+		"<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (sRGB IEC61966-2.1) /Info (sRGB IEC61966-2.1) /DestOutputProfile %d 0 R >>", iccNum))
+
+	// The Info dictionary must agree with the XMP metadata, so a fresh one
+	// replaces whatever wkhtmltopdf produced.
+	infoNum := newObject()
+	writeObject(infoNum, 0, fmt.Sprintf(
+		"<< /Title %s /Producer (invoice-generator-go) /CreationDate %s /ModDate %s >>",
+		pdfString(title), pdfDate(now), pdfDate(now)))
+
+	names, err := namesWithAttachment(original, catalog, fmt.Sprintf("%s %d 0 R", pdfString(att.FileName), specNum))
+	if err != nil {
+		return err
+	}
+	body := dictBody(catalog)
+	for _, key := range []string{"Metadata", "Names", "AF", "OutputIntents"} {
+		body = removeKey(body, key)
+	}
+	writeObject(rootNum, rootGen, fmt.Sprintf(
+		"<<%s /Metadata %d 0 R /Names %s /AF [%d 0 R] /OutputIntents [%d 0 R] >>",
+		body, metaNum, names, specNum, intentNum))
+
+	xrefOffset := buf.Len()
+	buf.WriteString("xref\n")
+	fmt.Fprintf(&buf, "%d 1\n%010d %05d n \n", rootNum, offsets[rootNum], rootGen)
+	fmt.Fprintf(&buf, "%d %d\n", size, next-size)
+	for num := size; num < next; num++ {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offsets[num])
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %d %d R /Info %d 0 R /ID %s /Prev %s >>\nstartxref\n%d\n%%%%EOF\n",
+		next, rootNum, rootGen, infoNum, docID, prevXRef, xrefOffset)
+
+	if err := os.WriteFile(pdfPath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write Factur-X PDF: %v", err)
+	}
+	return nil
+}
+
+// findObject returns the dictionary of an indirect object.
+func findObject(data []byte, num, gen int) (string, error) {
+	re := regexp.MustCompile(fmt.Sprintf(`(?:^|[\r\n\s])%d\s+%d\s+obj\b`, num, gen))
+	locs := re.FindAllIndex(data, -1)
+	if len(locs) == 0 {
+		return "", fmt.Errorf("object %d %d not found", num, gen)
+	}
+	// The last definition wins when a file already has incremental updates.
+	rest := data[locs[len(locs)-1][1]:]
+	start := bytes.Index(rest, []byte("<<"))
+	if start < 0 {
+		return "", fmt.Errorf("object %d %d is not a dictionary", num, gen)
+	}
+	end := matchingDictEnd(rest, start)
+	if end < 0 {
+		return "", fmt.Errorf("object %d %d has an unterminated dictionary", num, gen)
+	}
+	return string(rest[start:end]), nil
+}
+
+// matchingDictEnd returns the index just past the ">>" closing the
+// dictionary that opens at start.
+func matchingDictEnd(data []byte, start int) int {
+	depth := 0
+	for i := start; i < len(data)-1; i++ {
+		switch {
+		case data[i] == '(':
+			// Skip literal strings, which may contain unbalanced brackets.
+			nest := 0
+			for ; i < len(data); i++ {
+				if data[i] == '\\' {
+					i++
+					continue
+				}
+				if data[i] == '(' {
+					nest++
+				} else if data[i] == ')' {
+					nest--
+					if nest == 0 {
+						break
+					}
+				}
+			}
+		case data[i] == '<' && data[i+1] == '<':
+			depth++
+			i++
+		case data[i] == '<':
+			// Skip hex strings so their closing bracket is not mistaken
+			// for the end of a dictionary.
+			for i < len(data) && data[i] != '>' {
+				i++
+			}
+		case data[i] == '>' && data[i+1] == '>':
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// dictValue returns the raw value of a key in a flat PDF dictionary.
+func dictValue(dict, key string) string {
+	re := regexp.MustCompile(`/` + key + `\b\s*(\[[^\]]*\]|\d+\s+\d+\s+R|[^/\s>]+)`)
+	m := re.FindStringSubmatch(dict)
+	if m == nil {
+		return ""
+	}
+	return strings.TrimSpace(m[1])
+}
+
+// namesWithAttachment returns the catalog's name dictionary with an
+// EmbeddedFiles name tree holding entry added. The dictionary is resolved
+// when the catalog refers to it indirectly, and its other trees, such as
+// the /Dests of internal links, are kept.
+func namesWithAttachment(data []byte, catalog, entry string) (string, error) {
+	names, _, _, ok := findKey(dictBody(catalog), "Names")
+	if !ok {
+		names = "<<>>"
+	}
+	if num, gen, ok := parseRef(names); ok {
+		obj, err := findObject(data, num, gen)
+		if err != nil {
+			return "", fmt.Errorf("failed to read name dictionary: %v", err)
+		}
+		names = obj
+	}
+	if !strings.HasPrefix(names, "<<") {
+		return "", fmt.Errorf("document catalog has an invalid /Names entry")
+	}
+	body := dictBody(names)
+	if _, _, _, ok := findKey(body, "EmbeddedFiles"); ok {
+		return "", fmt.Errorf("PDF already has embedded files, which are not supported")
+	}
+	return fmt.Sprintf("<<%s /EmbeddedFiles << /Names [%s] >> >>", body, entry), nil
+}
+
+// dictBody strips the brackets of a dictionary.
+func dictBody(dict string) string {
+	dict = strings.TrimSpace(dict)
+	return strings.TrimSuffix(strings.TrimPrefix(dict, "<<"), ">>")
+}
+
+// findKey returns the raw value of a key in the body of a dictionary,
+// nested dictionaries included, and the span of the key and its value.
+func findKey(body, key string) (value string, start, end int, ok bool) {
+	re := regexp.MustCompile(`/` + key + `\b\s*`)
+	loc := re.FindStringIndex(body)
+	if loc == nil {
+		return "", 0, 0, false
+	}
+	rest := body[loc[1]:]
+	var n int
+	switch {
+	case strings.HasPrefix(rest, "<<"):
+		n = matchingDictEnd([]byte(rest), 0)
+	case strings.HasPrefix(rest, "["):
+		n = strings.Index(rest, "]") + 1
+	case refRe.MatchString(rest):
+		n = len(refRe.FindString(rest))
+	default:
+		// A number, a name or a literal up to the next delimiter; a name
+		// value starts with the delimiter itself.
+		skip := 0
+		if strings.HasPrefix(rest, "/") {
+			skip = 1
+		}
+		n = strings.IndexAny(rest[skip:], "/>\r\n ")
+		if n < 0 {
+			n = len(rest) - skip
+		}
+		n += skip
+	}
+	if n <= 0 {
+		return "", 0, 0, false
+	}
+	return rest[:n], loc[0], loc[1] + n, true
+}
+
+// removeKey drops a key and its value from the body of a dictionary.
+func removeKey(body, key string) string {
+	_, start, end, ok := findKey(body, key)
+	if !ok {
+		return body
+	}
+	return body[:start] + body[end:]
+}
+
+func parseRef(value string) (int, int, bool) {
+	m := refRe.FindStringSubmatch(value)
+	if m == nil {
+		return 0, 0, false
+	}
+	num, _ := strconv.Atoi(m[1])
+	gen, _ := strconv.Atoi(m[2])
+	return num, gen, true
+}
+
+// pdfString encodes text as a PDF string, using UTF-16BE for non-ASCII text.
+func pdfString(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r > 126 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		r := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`)
+		return "(" + r.Replace(s) + ")"
+	}
+	var hex strings.Builder
+	hex.WriteString("<FEFF")
+	for _, r := range s {
+		if r > 0xFFFF {
+			r -= 0x10000
+			fmt.Fprintf(&hex, "%04X%04X", 0xD800+(r>>10), 0xDC00+(r&0x3FF))
+			continue
+		}
+		fmt.Fprintf(&hex, "%04X", r)
+	}
+	hex.WriteString(">")
+	return hex.String()
+}
+
+func pdfDate(t time.Time) string {
+	_, offset := t.Zone()
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	return fmt.Sprintf("(D:%s%s%02d'%02d')", t.Format("20060102150405"), sign, offset/3600, (offset%3600)/60)
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// xmpMetadata builds the XMP packet with the document's title and dates and
+// the Factur-X extension schema.
+func xmpMetadata(title string, now time.Time, att Attachment) string {
+	ts := now.Format(time.RFC3339)
+	return `<?xpacket begin="` + "\uFEFF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">` + xmlEscape(title) + `</rdf:li></rdf:Alt></dc:title>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdf="http://ns.adobe.com/pdf/1.3/">
+<pdf:Producer>invoice-generator-go</pdf:Producer>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+<xmp:CreateDate>` + ts + `</xmp:CreateDate>
+<xmp:ModifyDate>` + ts + `</xmp:ModifyDate>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:fx="urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#">
+<fx:DocumentType>INVOICE</fx:DocumentType>
+<fx:DocumentFileName>` + xmlEscape(att.FileName) + `</fx:DocumentFileName>
+<fx:Version>1.0</fx:Version>
+<fx:ConformanceLevel>` + xmlEscape(att.ConformanceLevel) + `</fx:ConformanceLevel>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/" xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#" xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">
+<pdfaExtension:schemas>
+<rdf:Bag>
+<rdf:li rdf:parseType="Resource">
+<pdfaSchema:schema>Factur-X PDFA Extension Schema</pdfaSchema:schema>
+<pdfaSchema:namespaceURI>urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#</pdfaSchema:namespaceURI>
+<pdfaSchema:prefix>fx</pdfaSchema:prefix>
+<pdfaSchema:property>
+<rdf:Seq>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>DocumentFileName</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>name of the embedded XML invoice file</pdfaProperty:description></rdf:li>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>DocumentType</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>INVOICE</pdfaProperty:description></rdf:li>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>Version</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>The actual version of the Factur-X XML schema</pdfaProperty:description></rdf:li>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>ConformanceLevel</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>The conformance level of the embedded Factur-X data</pdfaProperty:description></rdf:li>
+</rdf:Seq>
+</pdfaSchema:property>
+</rdf:li>
+</rdf:Bag>
+</pdfaExtension:schemas>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+}
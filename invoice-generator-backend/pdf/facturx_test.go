@@ -0,0 +1,124 @@
+package pdf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// minimalPDF builds a small classic-xref PDF from the given objects, the
+// first of which is the catalog.
+func minimalPDF(objects ...string) []byte {
+	var b strings.Builder
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return []byte(b.String())
+}
+
+func TestEmbedFacturXKeepsNames(t *testing.T) {
+	pages := "<< /Type /Pages /Kids [] /Count 0 >>"
+	dests := "<< /Names [(section1) [3 0 R /XYZ 0 0 0]] >>"
+	tests := []struct {
+		name    string
+		objects []string
+		err     string
+	}{
+		{
+			name:    "no names",
+			objects: []string{"<< /Type /Catalog /Pages 2 0 R >>", pages},
+		},
+		{
+			name:    "inline names",
+			objects: []string{"<< /Type /Catalog /Pages 2 0 R /Names << /Dests 3 0 R >> >>", pages, dests},
+		},
+		{
+			name:    "indirect names",
+			objects: []string{"<< /Type /Catalog /Pages 2 0 R /Names 4 0 R >>", pages, dests, "<< /Dests 3 0 R >>"},
+		},
+		{
+			name:    "existing attachments",
+			objects: []string{"<< /Type /Catalog /Pages 2 0 R /Names << /EmbeddedFiles 3 0 R >> >>", pages, "<< /Names [] >>"},
+			err:     "already has embedded files",
+		},
+	}
+
+	dir := t.TempDir()
+	icc := filepath.Join(dir, "srgb.icc")
+	if err := os.WriteFile(icc, []byte("icc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_")+".pdf")
+			if err := os.WriteFile(path, minimalPDF(tt.objects...), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := EmbedFacturX(path, icc, "Invoice", Attachment{FileName: FacturXFileName, Data: []byte("<x/>"), ConformanceLevel: "EN 16931"})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("EmbedFacturX error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EmbedFacturX: %v", err)
+			}
+
+			out, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			catalog, err := findObject(out, 1, 0)
+			if err != nil {
+				t.Fatalf("updated catalog: %v", err)
+			}
+			names, _, _, ok := findKey(dictBody(catalog), "Names")
+			if !ok {
+				t.Fatalf("catalog %s has no /Names", catalog)
+			}
+			if !strings.Contains(names, "/EmbeddedFiles << /Names [(factur-x.xml) ") {
+				t.Errorf("names %s lack the attachment", names)
+			}
+			if len(tt.objects) > 2 && !strings.Contains(names, "/Dests 3 0 R") {
+				t.Errorf("names %s lost the destinations", names)
+			}
+			if strings.Count(catalog, "/Names") != strings.Count(names, "/Names")+1 {
+				t.Errorf("catalog %s has more than one name dictionary", catalog)
+			}
+		})
+	}
+}
+
+func TestFindKey(t *testing.T) {
+	body := " /Type /Catalog /Pages 2 0 R /Names << /Dests << /Kids [5 0 R] >> >> /AF [7 0 R] /Lang (en)"
+	tests := []struct {
+		key, value, removed string
+	}{
+		{"Type", "/Catalog", "  /Pages 2 0 R /Names << /Dests << /Kids [5 0 R] >> >> /AF [7 0 R] /Lang (en)"},
+		{"Pages", "2 0 R", " /Type /Catalog  /Names << /Dests << /Kids [5 0 R] >> >> /AF [7 0 R] /Lang (en)"},
+		{"Names", "<< /Dests << /Kids [5 0 R] >> >>", " /Type /Catalog /Pages 2 0 R  /AF [7 0 R] /Lang (en)"},
+		{"AF", "[7 0 R]", " /Type /Catalog /Pages 2 0 R /Names << /Dests << /Kids [5 0 R] >> >>  /Lang (en)"},
+		{"Metadata", "", body},
+	}
+	for _, tt := range tests {
+		value, _, _, _ := findKey(body, tt.key)
+		if value != tt.value {
+			t.Errorf("findKey(%s) = %q, want %q", tt.key, value, tt.value)
+		}
+		if got := removeKey(body, tt.key); got != tt.removed {
+			t.Errorf("removeKey(%s) = %q, want %q", tt.key, got, tt.removed)
+		}
+	}
+}
@@ -2,14 +2,23 @@ package pdf
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 
+	"invoice-generator-go/config"
+	"invoice-generator-go/einvoice"
+	"invoice-generator-go/i18n"
+	"invoice-generator-go/layout"
 	"invoice-generator-go/models"
+	"invoice-generator-go/paymentterms"
 	"invoice-generator-go/storage"
 
 	"github.com/google/uuid"
@@ -20,81 +29,351 @@ import (
 type DataForTemplate struct {
 	Invoice      models.Invoice
 	InvoiceItems []models.InvoiceItem
-	Company      models.User
+	Company      models.CompanyProfile
+	// CompanyLogoURL is the profile's logo as a data: URL, empty without a logo.
+	CompanyLogoURL template.URL
+	// LogoURL and BackgroundURL are the template's own images, resolved from
+	// its assets; empty when the template doesn't set them.
+	LogoURL       template.URL
+	BackgroundURL template.URL
+	PaymentQR     PaymentQR
+	// Language is the locale the document is rendered in, e.g. "de".
+	Language string
+	// Direction is "rtl" for right-to-left languages and "ltr" otherwise,
+	// for the <html dir> attribute. Start and End are the sides lines begin
+	// and end on, "left" and "right" swapped for RTL, for text-align.
+	Direction  string
+	Start, End string
+	// ScriptFonts is a font-family list covering the non-Latin scripts in
+	// the document, ending in sans-serif; append it to a template's own
+	// fonts, e.g. font-family: Arial, {{.ScriptFonts}}.
+	ScriptFonts template.CSS
+	// Watermark is the status stamp overlaid on the document: "draft",
+	// "paid", "void", "copy" or empty for none.
+	Watermark string
+	// Discount is the early payment discount the invoice offers, nil when
+	// it has none.
+	Discount *EarlyPaymentDiscount
 	// Add other fields as needed for your template
 }
 
+// EarlyPaymentDiscount is the discount for paying an invoice by DueDate:
+// Percent of the total, Amount off, leaving AmountDue to pay.
+type EarlyPaymentDiscount struct {
+	Percent   float64
+	Amount    float64
+	AmountDue float64
+	DueDate   time.Time
+}
+
+// earlyPaymentDiscount describes the discount an invoice offers, nil when
+// it has none.
+func earlyPaymentDiscount(invoice models.Invoice) *EarlyPaymentDiscount {
+	amount := paymentterms.Discount(invoice)
+	if amount <= 0 {
+		return nil
+	}
+	return &EarlyPaymentDiscount{
+		Percent:   invoice.DiscountPercent,
+		Amount:    amount,
+		AmountDue: invoice.TotalAmount - amount,
+		DueDate:   *invoice.DiscountDueDate,
+	}
+}
+
+// Options controls optional output features of GeneratePDFWithOptions.
+type Options struct {
+	// FacturX embeds a Factur-X (EN 16931) Cross Industry Invoice XML in the
+	// PDF. The file is laid out for PDF/A-3 but not checked against it.
+	FacturX bool
+	// Language overrides the document language, e.g. "fr".
+	Language string
+	// Watermark overrides the status stamp: a stamp name or WatermarkNone.
+	// Empty picks the stamp from the invoice status.
+	Watermark string
+	// Copy marks the document as a further copy of one already handed out.
+	Copy bool
+}
+
 // GeneratePDF generates a PDF from an Invoice object.
 func GeneratePDF(invoice models.Invoice) (string, error) {
-	// Load the template content from the database
-	templateContent, err := LoadTemplateContent(invoice.TemplateID.String())
+	return GeneratePDFWithOptions(invoice, Options{})
+}
+
+// GeneratePDFWithOptions generates a PDF from an Invoice object using the given options.
+func GeneratePDFWithOptions(invoice models.Invoice, opts Options) (string, error) {
+	// Define the path for the output PDF file
+	pdfFilePath := StoredPDFPath(invoice)
+	if err := writeInvoicePDF(invoice, opts, pdfFilePath); err != nil {
+		return "", err
+	}
+	return pdfFilePath, nil
+}
+
+// StoredPDFPath is where an invoice's generated PDF is kept.
+func StoredPDFPath(invoice models.Invoice) string {
+	return fmt.Sprintf("invoice_%s.pdf", invoice.ID)
+}
+
+// RenderPDF renders an invoice like GeneratePDFWithOptions but returns the
+// PDF instead of storing it, e.g. for copies stamped on re-download.
+func RenderPDF(invoice models.Invoice, opts Options) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "invoice-render-")
 	if err != nil {
-		return "", fmt.Errorf("failed to load template content: %v", err)
+		return nil, fmt.Errorf("failed to create temporary directory: %v", err)
 	}
+	defer os.RemoveAll(dir)
 
-	// Parse the HTML template
-	tmpl, err := template.New("invoice").Parse(templateContent)
+	pdfFilePath := filepath.Join(dir, "invoice.pdf")
+	if err := writeInvoicePDF(invoice, opts, pdfFilePath); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(pdfFilePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %v", err)
+		return nil, fmt.Errorf("failed to read PDF file: %v", err)
+	}
+	return data, nil
+}
+
+// writeInvoicePDF renders an invoice to a PDF file at pdfFilePath.
+func writeInvoicePDF(invoice models.Invoice, opts Options, pdfFilePath string) error {
+	// Load the template from the database
+	dbTemplate, err := loadInvoiceTemplate(invoice)
+	if err != nil {
+		return fmt.Errorf("failed to load template content: %v", err)
 	}
 
 	// Fetch related data for invoice
 	invoiceItems, err := storage.GetInvoiceItemsByInvoiceID(invoice.ID)
 	if err != nil {
-		return "", fmt.Errorf("failed to get invoice items: %v", err)
+		return fmt.Errorf("failed to get invoice items: %v", err)
 	}
 
-	// Fetch user details using GetUserByID
-	user, err := storage.GetUserByID(invoice.UserID)
+	// Fetch the sender profile for the invoice
+	company, err := storage.GetCompanyProfileForInvoice(&invoice)
 	if err != nil {
-		return "", fmt.Errorf("failed to get user details: %v", err)
+		return fmt.Errorf("failed to get company profile: %v", err)
 	}
-	// Prepare data for the template
-	data := DataForTemplate{
-		Invoice:      invoice,
-		InvoiceItems: invoiceItems,
-		Company:      *user, // Pass the user object
+	// Build and check the e-invoice XML before spending time on rendering
+	var facturX []byte
+	if opts.FacturX {
+		doc, err := einvoice.FromInvoice(invoice, invoiceItems, *company)
+		if err != nil {
+			return err
+		}
+		facturX, err = einvoice.MarshalCII(doc)
+		if err != nil {
+			return err
+		}
+		if err := einvoice.ValidateCII(facturX); err != nil {
+			return err
+		}
 	}
 
-	// Execute the template
-	var htmlBuffer bytes.Buffer
-	err = tmpl.Execute(&htmlBuffer, data)
+	// Render the HTML template
+	html, err := invoiceHTML(context.Background(), dbTemplate, invoice, invoiceItems, company, opts)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute template: %v", err)
+		return err
 	}
 
-	// Write the HTML content to a temporary file
-	tmpHTMLFile := fmt.Sprintf("temp_invoice_%s.html", invoice.ID)
-	err = os.WriteFile(tmpHTMLFile, htmlBuffer.Bytes(), 0644)
+	// Convert HTML to PDF using wkhtmltopdf
+	pdfBytes, err := htmlToPDF(context.Background(), html)
 	if err != nil {
-		return "", fmt.Errorf("failed to write temporary HTML file: %v", err)
+		return err
 	}
-	defer func(name string) {
-		err := os.Remove(name)
+	if err := os.WriteFile(pdfFilePath, pdfBytes, 0644); err != nil {
+		return fmt.Errorf("failed to write PDF file: %v", err)
+	}
+
+	if opts.FacturX {
+		err = EmbedFacturX(pdfFilePath, config.GetConfig().ICCProfilePath, "Invoice "+invoice.InvoiceNumber, Attachment{
+			FileName:         FacturXFileName,
+			Description:      "Factur-X invoice " + invoice.InvoiceNumber,
+			Data:             facturX,
+			ConformanceLevel: "EN 16931",
+		})
 		if err != nil {
+			return fmt.Errorf("failed to embed Factur-X XML: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// invoiceHTML renders an invoice with dbTemplate in the document language,
+// stamped according to opts.
+func invoiceHTML(ctx context.Context, dbTemplate *models.Template, invoice models.Invoice, invoiceItems []models.InvoiceItem, company *models.CompanyProfile, opts Options) ([]byte, error) {
+	// Layout templates are compiled to HTML first
+	content, language, err := templateSource(dbTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pick the document language and its translations
+	tr, err := documentTranslator(invoice.UserID, opts.Language, invoice.CustomerEmail, language)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load translations: %v", err)
+	}
+
+	// Prepare data for the template
+	data := templateData(invoice, invoiceItems, company, tr.Locale())
+	data.Watermark = watermarkFor(invoice, dbTemplate, opts.Watermark, opts.Copy)
 
+	// Render the HTML template
+	return renderHTML(ctx, dbTemplate, content, data, tr)
+}
+
+// templateData assembles the data an invoice template is rendered with.
+func templateData(invoice models.Invoice, items []models.InvoiceItem, company *models.CompanyProfile, language string) DataForTemplate {
+	return DataForTemplate{
+		Invoice:        invoice,
+		InvoiceItems:   items,
+		Company:        *company,
+		CompanyLogoURL: companyLogoURL(company),
+		PaymentQR:      buildPaymentQR(invoice, *company, templateLanguage(language)),
+		Language:       language,
+		Discount:       earlyPaymentDiscount(invoice),
+	}
+}
+
+// templateSource returns the HTML template content a template renders with
+// and the document language. Layout templates are compiled here, taking the
+// language from the spec's locale.
+func templateSource(dbTemplate *models.Template) (string, string, error) {
+	if !layout.IsLayout(dbTemplate.Language) {
+		return dbTemplate.Content, dbTemplate.Language, nil
+	}
+	spec, err := layout.Parse(dbTemplate.Content)
+	if err != nil {
+		return "", "", err
+	}
+	return layout.Compile(spec), spec.Locale, nil
+}
+
+// renderHTML parses template content and executes it with data inside the
+// rendering sandbox, resolving assets against the stored template and
+// translating with tr. Direction and script fonts follow the document
+// language and text, and data.Watermark is overlaid. Sandbox violations are returned as *SandboxError.
+func renderHTML(ctx context.Context, dbTemplate *models.Template, content string, data DataForTemplate, tr *i18n.Translator) ([]byte, error) {
+	assets := templateAssets(dbTemplate.ID)
+	data.LogoURL = resolveTemplateURL(dbTemplate.LogoURL, assets)
+	data.BackgroundURL = resolveTemplateURL(dbTemplate.BackgroundURL, assets)
+
+	applyScripts(&data, tr)
+
+	funcs := templateFuncs(data.PaymentQR, assets, tr)
+	tmpl, err := template.New("invoice").Funcs(funcs).Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %v", err)
+	}
+	if err := checkSandbox(tmpl, funcs); err != nil {
+		return nil, err
+	}
+
+	html, err := executeSandboxed(ctx, tmpl, funcs, data)
+	if err != nil {
+		var sandboxErr *SandboxError
+		if errors.As(err, &sandboxErr) {
+			return nil, sandboxErr
 		}
-	}(tmpHTMLFile) // Clean up the temporary file
+		return nil, fmt.Errorf("failed to execute template: %v", err)
+	}
+	return addWatermark(ensureDirection(html, data.Direction), data, tr), nil
+}
 
-	// Define the path for the output PDF file
-	pdfFilePath := fmt.Sprintf("invoice_%s.pdf", invoice.ID)
+// templateFuncs is the complete set of functions available to invoice
+// templates, besides the allow-listed builtins.
+func templateFuncs(qr PaymentQR, assets assetLoader, tr *i18n.Translator) template.FuncMap {
+	funcs := paymentQRFuncs(qr)
+	for _, extra := range []template.FuncMap{assetFuncs(assets), translationFuncs(tr)} {
+		for name, fn := range extra {
+			funcs[name] = fn
+		}
+	}
+	return funcs
+}
 
-	// Convert HTML to PDF using wkhtmltopdf
-	err = convertHTMLToPDF(tmpHTMLFile, pdfFilePath)
+// parseInvoiceTemplate parses invoice template content with the functions
+// available to invoice templates, with placeholders for assets and the
+// default translations.
+func parseInvoiceTemplate(content string, qr PaymentQR) (*template.Template, error) {
+	return template.New("invoice").Funcs(templateFuncs(qr, placeholderAssets, i18n.New(i18n.DefaultLocale, nil))).Parse(content)
+}
+
+// companyLogoURL loads the profile's logo from the blob store and returns it
+// as a data: URL so wkhtmltopdf doesn't need to fetch it.
+func companyLogoURL(company *models.CompanyProfile) template.URL {
+	if company.LogoKey == "" || storage.Blobs == nil {
+		return ""
+	}
+	logo, err := storage.Blobs.Get(company.LogoKey)
 	if err != nil {
-		return "", fmt.Errorf("failed to convert HTML to PDF: %v", err)
+		log.Printf("Failed to load company logo: %v", err)
+		return ""
 	}
+	return dataURL(http.DetectContentType(logo), logo)
+}
 
-	return pdfFilePath, nil
+// htmlToPDF converts rendered HTML to PDF bytes through a scratch directory
+// that is removed afterwards.
+func htmlToPDF(ctx context.Context, html []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "invoice-render-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	htmlPath := filepath.Join(dir, "invoice.html")
+	pdfPath := filepath.Join(dir, "invoice.pdf")
+	if err := os.WriteFile(htmlPath, html, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write temporary HTML file: %v", err)
+	}
+	if err := convertHTMLToPDF(ctx, pdfPath, htmlPath); err != nil {
+		var sandboxErr *SandboxError
+		if errors.As(err, &sandboxErr) {
+			return nil, sandboxErr
+		}
+		return nil, fmt.Errorf("failed to convert HTML to PDF: %v", err)
+	}
+
+	data, err := os.ReadFile(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rendered PDF: %v", err)
+	}
+	return data, nil
 }
 
-// convertHTMLToPDF uses wkhtmltopdf to convert an HTML file to a PDF file.
-func convertHTMLToPDF(htmlFilePath, pdfFilePath string) error {
-	// Construct the command
-	cmd := exec.Command("wkhtmltopdf", htmlFilePath, pdfFilePath)
+// convertHTMLToPDF uses wkhtmltopdf to convert HTML files, all in one
+// directory, to a single PDF file, each starting on a new page. The HTML
+// comes from user-authored templates, so wkhtmltopdf may only read files
+// next to it, reaches the network only through a render proxy that refuses
+// internal addresses, runs without JavaScript, and is killed together with
+// any children when ctx ends or pdfTimeout per file passes.
+func convertHTMLToPDF(ctx context.Context, pdfFilePath string, htmlFilePaths ...string) error {
+	timeout := pdfTimeout * time.Duration(len(htmlFilePaths))
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	// Set the working directory if necessary
-	cmd.Dir, _ = filepath.Abs(filepath.Dir(htmlFilePath))
+	dir, _ := filepath.Abs(filepath.Dir(htmlFilePaths[0]))
+
+	proxy, err := startRenderProxy()
+	if err != nil {
+		return err
+	}
+	defer proxy.Close()
+
+	// Construct the command
+	args := []string{
+		"--quiet",
+		"--disable-local-file-access",
+		"--allow", dir,
+		"--disable-javascript",
+		"--proxy", proxy.URL(),
+	}
+	args = append(args, htmlFilePaths...)
+	cmd := exec.CommandContext(ctx, "wkhtmltopdf", append(args, pdfFilePath)...)
+	cmd.Dir = dir
+	killProcessGroupOnCancel(cmd)
 
 	// Capture the output
 	var out bytes.Buffer
@@ -103,7 +382,10 @@ func convertHTMLToPDF(htmlFilePath, pdfFilePath string) error {
 	cmd.Stderr = &stderr
 
 	// Run the command
-	err := cmd.Run()
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return &SandboxError{Rule: RulePDFTimeout, Message: fmt.Sprintf("PDF conversion took longer than %s", timeout)}
+	}
 	if err != nil {
 		log.Printf("wkhtmltopdf output: %s\n", out.String())
 		log.Printf("wkhtmltopdf error: %s\n", stderr.String())
@@ -115,14 +397,45 @@ func convertHTMLToPDF(htmlFilePath, pdfFilePath string) error {
 
 // LoadTemplateContent fetches the template content from the database by its ID.
 func LoadTemplateContent(templateID string) (string, error) {
+	dbTemplate, err := loadTemplate(templateID)
+	if err != nil {
+		return "", err
+	}
+	return dbTemplate.Content, nil
+}
+
+// loadInvoiceTemplate loads the template an invoice renders with, falling
+// back through the customer, account and system defaults when the invoice
+// has none. Issued invoices use the template version they were pinned to.
+func loadInvoiceTemplate(invoice models.Invoice) (*models.Template, error) {
+	templateID, err := storage.ResolveTemplateID(&invoice)
+	if err != nil {
+		return nil, err
+	}
+	dbTemplate, err := loadTemplate(templateID.String())
+	if err != nil {
+		return nil, err
+	}
+	if invoice.TemplateVersion != nil && *invoice.TemplateVersion != dbTemplate.CurrentVersion {
+		version, err := storage.GetTemplateVersion(dbTemplate.ID, *invoice.TemplateVersion)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get template version %d: %v", *invoice.TemplateVersion, err)
+		}
+		dbTemplate.Content = version.Content
+		dbTemplate.Language = version.Language
+	}
+	return dbTemplate, nil
+}
+
+func loadTemplate(templateID string) (*models.Template, error) {
 	templateUUID, err := uuid.Parse(templateID)
 	if err != nil {
-		return "", fmt.Errorf("invalid template ID: %v", err)
+		return nil, fmt.Errorf("invalid template ID: %v", err)
 	}
 
 	dbTemplate, err := storage.GetTemplateByID(templateUUID)
 	if err != nil {
-		return "", fmt.Errorf("failed to get template by ID: %v", err)
+		return nil, fmt.Errorf("failed to get template by ID: %v", err)
 	}
-	return dbTemplate.Content, nil
+	return dbTemplate, nil
 }
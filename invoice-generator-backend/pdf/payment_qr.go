@@ -0,0 +1,177 @@
+package pdf
+
+import (
+	"html/template"
+	"log"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"invoice-generator-go/einvoice"
+	"invoice-generator-go/models"
+	"invoice-generator-go/paymentterms"
+	"invoice-generator-go/payqr"
+)
+
+// PaymentQR holds the scannable payment codes for an invoice's balance due.
+// A field is empty when the account's bank details or the invoice currency
+// don't support that scheme.
+type PaymentQR struct {
+	// Reference is the structured payment reference carried by the codes,
+	// formatted for printing.
+	Reference string
+	// EPC is a data: URL of the EPC069-12 SEPA credit transfer QR code.
+	EPC template.URL
+	// SwissQRBill is the Swiss QR-bill receipt and payment part.
+	SwissQRBill template.HTML
+}
+
+var nonDigitRe = regexp.MustCompile(`[^0-9]`)
+
+// buildPaymentQR generates the payment codes for an invoice. Problems with
+// the bank details are logged and leave the affected code out rather than
+// failing the PDF.
+func buildPaymentQR(invoice models.Invoice, company models.CompanyProfile, lang string) PaymentQR {
+	var qr PaymentQR
+	// The codes ask for what settles the invoice today, like the share page
+	// and online checkout
+	amount := paymentterms.AmountDue(invoice, time.Now())
+	if company.IBAN == "" || amount <= 0 {
+		return qr
+	}
+	if err := payqr.ValidateIBAN(company.IBAN); err != nil {
+		log.Printf("Skipping payment QR codes for invoice %s: %v", invoice.ID, err)
+		return qr
+	}
+
+	iban := payqr.NormalizeIBAN(company.IBAN)
+	currency := einvoice.CurrencyCode(invoice.Currency)
+	name := company.CompanyName
+
+	var reference string
+	var err error
+	if payqr.IsQRIBAN(iban) {
+		reference, err = payqr.QRReference(qrReferenceBase(invoice))
+	} else {
+		reference, err = payqr.CreditorReference(creditorReferenceBase(invoice))
+	}
+	if err != nil {
+		log.Printf("Skipping payment QR codes for invoice %s: %v", invoice.ID, err)
+		return qr
+	}
+	qr.Reference = payqr.FormatReference(reference)
+
+	if currency == "EUR" && !payqr.IsQRIBAN(iban) {
+		code, err := payqr.EPCCode(payqr.EPCTransfer{
+			BIC:       company.BIC,
+			Name:      truncate(name, 70),
+			IBAN:      iban,
+			Amount:    amount,
+			Reference: reference,
+		})
+		if err == nil {
+			var url string
+			if url, err = code.DataURL(8); err == nil {
+				qr.EPC = template.URL(url)
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to generate EPC QR code for invoice %s: %v", invoice.ID, err)
+		}
+	}
+
+	if cc := iban[:2]; (cc == "CH" || cc == "LI") && (currency == "CHF" || currency == "EUR") {
+		bill := payqr.SwissBill{
+			Account: iban,
+			Creditor: payqr.Address{
+				Name:       truncate(name, 70),
+				Street:     truncate(company.AddressLine, 70),
+				PostalCode: company.PostalCode,
+				Town:       company.City,
+				Country:    company.CountryCode,
+			},
+			Amount:    amount,
+			Currency:  currency,
+			Reference: reference,
+			Message:   truncate("Invoice "+invoice.InvoiceNumber, 140),
+		}
+		html, err := bill.PaymentPartHTML(lang)
+		if err != nil {
+			log.Printf("Failed to generate Swiss QR-bill for invoice %s: %v", invoice.ID, err)
+		} else {
+			qr.SwissQRBill = html
+		}
+	}
+
+	return qr
+}
+
+// qrReferenceBase takes the digits of the invoice number, or derives 26
+// digits from the invoice ID when the number has none or too many.
+func qrReferenceBase(invoice models.Invoice) string {
+	digits := nonDigitRe.ReplaceAllString(invoice.InvoiceNumber, "")
+	if len(digits) > 0 && len(digits) <= 26 && strings.Trim(digits, "0") != "" {
+		return digits
+	}
+	n := new(big.Int).SetBytes(invoice.ID[:])
+	return n.Mod(n, new(big.Int).Exp(big.NewInt(10), big.NewInt(26), nil)).String()
+}
+
+// creditorReferenceBase uses the alphanumerics of the invoice number, keeping
+// the last 21 characters since those usually carry the sequence number.
+func creditorReferenceBase(invoice models.Invoice) string {
+	base := strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, invoice.InvoiceNumber)
+	if base == "" {
+		base = strings.ReplaceAll(invoice.ID.String(), "-", "")
+	}
+	if len(base) > 21 {
+		base = base[len(base)-21:]
+	}
+	return base
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// paymentQRFuncs exposes the payment codes to templates:
+//
+//	{{epcQRCode}}        <img> of the SEPA QR code, or nothing
+//	{{swissQRBill}}      the Swiss QR-bill payment part, or nothing
+//	{{paymentReference}} the formatted payment reference
+func paymentQRFuncs(qr PaymentQR) template.FuncMap {
+	return template.FuncMap{
+		"epcQRCode": func() template.HTML {
+			if qr.EPC == "" {
+				return ""
+			}
+			return template.HTML(`<img class="epc-qr-code" src="` + string(qr.EPC) + `" alt="SEPA payment QR code" style="width:35mm;height:35mm;">`)
+		},
+		"swissQRBill":      func() template.HTML { return qr.SwissQRBill },
+		"paymentReference": func() string { return qr.Reference },
+	}
+}
+
+// templateLanguage maps a template's language setting to a two letter code.
+func templateLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	switch {
+	case strings.HasPrefix(language, "de"), strings.HasPrefix(language, "german"):
+		return "de"
+	case strings.HasPrefix(language, "fr"):
+		return "fr"
+	case strings.HasPrefix(language, "it"):
+		return "it"
+	default:
+		return "en"
+	}
+}
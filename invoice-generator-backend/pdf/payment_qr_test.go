@@ -0,0 +1,39 @@
+package pdf
+
+import (
+	"testing"
+	"time"
+
+	"invoice-generator-go/models"
+)
+
+func TestPaymentQRAmount(t *testing.T) {
+	company := models.CompanyProfile{CompanyName: "Seller AG", IBAN: "DE89370400440532013000"}
+	invoice := models.Invoice{InvoiceNumber: "INV-7", Status: "sent", Currency: "€", TotalAmount: 100}
+
+	if qr := buildPaymentQR(invoice, company, "en"); qr.EPC == "" || qr.Reference != "RF79 INV7" {
+		t.Errorf("unpaid invoice: EPC %t, reference %q", qr.EPC != "", qr.Reference)
+	}
+
+	discountDate := time.Now().AddDate(0, 0, 10)
+	tests := []struct {
+		name    string
+		invoice models.Invoice
+		want    bool
+	}{
+		{"partially paid", models.Invoice{Status: "sent", TotalAmount: 100, AmountPaid: 40}, true},
+		{"within the discount period", models.Invoice{Status: "sent", TotalAmount: 100, DiscountPercent: 2, DiscountDueDate: &discountDate}, true},
+		{"settled", models.Invoice{Status: "sent", TotalAmount: 100, AmountPaid: 100}, false},
+		{"paid", models.Invoice{Status: "paid", TotalAmount: 100, AmountPaid: 98}, false},
+		{"void", models.Invoice{Status: "void", TotalAmount: 100}, false},
+		{"credit note", models.Invoice{Status: "sent", DocumentType: "credit_note", TotalAmount: 100}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.invoice.InvoiceNumber, tt.invoice.Currency = "INV-7", "€"
+			if qr := buildPaymentQR(tt.invoice, company, "en"); (qr.EPC != "") != tt.want {
+				t.Errorf("EPC code %t, want %t", qr.EPC != "", tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package pdf
+
+import (
+	"context"
+	"fmt"
+
+	"invoice-generator-go/models"
+	"invoice-generator-go/storage"
+
+	"github.com/google/uuid"
+)
+
+// Preview output formats.
+const (
+	PreviewHTML = "html"
+	PreviewPDF  = "pdf"
+)
+
+// PreviewOptions controls a template preview.
+type PreviewOptions struct {
+	// Format is PreviewHTML or PreviewPDF.
+	Format string
+	// Language overrides the document language, e.g. "fr".
+	Language string
+	// UserID is the account whose translations are used.
+	UserID uuid.UUID
+	// Watermark overrides the status stamp like Options.Watermark.
+	Watermark string
+}
+
+// Preview renders a template for a template designer. It renders against the
+// given invoice, or against built-in sample data when invoice is nil, and
+// returns HTML or PDF bytes according to opts.Format. Assets are loaded for
+// stored templates; unsaved content (a zero ID) gets placeholders. Nothing is
+// stored: the invoice's pdf_path and the template's versions are left
+// untouched.
+func Preview(ctx context.Context, dbTemplate *models.Template, invoice *models.Invoice, opts PreviewOptions) ([]byte, error) {
+	content, language, err := templateSource(dbTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	// The sample customer has no language of its own
+	customerEmail := ""
+	if invoice != nil {
+		customerEmail = invoice.CustomerEmail
+	}
+	tr, err := documentTranslator(opts.UserID, opts.Language, customerEmail, language)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load translations: %v", err)
+	}
+
+	var data DataForTemplate
+	if invoice == nil {
+		data = sampleTemplateData()
+		data.Language = tr.Locale()
+	} else {
+		items, err := storage.GetInvoiceItemsByInvoiceID(invoice.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get invoice items: %v", err)
+		}
+		company, err := storage.GetCompanyProfileForInvoice(invoice)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get company profile: %v", err)
+		}
+		data = templateData(*invoice, items, company, tr.Locale())
+	}
+	data.Watermark = watermarkFor(data.Invoice, dbTemplate, opts.Watermark, false)
+
+	html, err := renderHTML(ctx, dbTemplate, content, data, tr)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.Format {
+	case PreviewHTML:
+		return html, nil
+	case PreviewPDF:
+		return htmlToPDF(ctx, html)
+	default:
+		return nil, fmt.Errorf("unsupported preview format %q", opts.Format)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package pdf
+
+import "os/exec"
+
+// killProcessGroupOnCancel relies on exec.CommandContext killing the process
+// itself; process groups are a Unix feature.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {}
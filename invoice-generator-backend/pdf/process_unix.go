@@ -0,0 +1,18 @@
+//go:build unix
+
+package pdf
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroupOnCancel starts cmd in its own process group and makes
+// cancellation kill the whole group, so helpers wkhtmltopdf spawns don't
+// outlive it.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
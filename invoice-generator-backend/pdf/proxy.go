@@ -0,0 +1,153 @@
+package pdf
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"invoice-generator-go/webhooks"
+)
+
+const (
+	// fetchTimeout bounds each connection wkhtmltopdf makes through the
+	// render proxy.
+	fetchTimeout = 10 * time.Second
+	// maxFetchedSize caps a response passed on to wkhtmltopdf.
+	maxFetchedSize = 10 << 20
+)
+
+// hopHeaders are the headers that concern a single connection and are not
+// passed on by the render proxy.
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// renderProxy is the only way out to the network for wkhtmltopdf, which is
+// pointed at it with --proxy. Templates may load images and fonts from
+// public http and https URLs; requests to loopback, private, link-local and
+// other internal addresses, such as a cloud metadata service, are refused
+// as they are dialed.
+type renderProxy struct {
+	listener  net.Listener
+	server    *http.Server
+	dialer    *net.Dialer
+	transport *http.Transport
+	tunnels   sync.WaitGroup
+}
+
+// startRenderProxy starts a render proxy on a loopback port.
+func startRenderProxy() (*renderProxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start render proxy: %v", err)
+	}
+	dialer := webhooks.PublicDialer(fetchTimeout)
+	p := &renderProxy{
+		listener: listener,
+		dialer:   dialer,
+		transport: &http.Transport{
+			// No further proxy, so the address checked on dialing is the
+			// requested one
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   fetchTimeout,
+			ResponseHeaderTimeout: fetchTimeout,
+		},
+	}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: fetchTimeout}
+	go p.server.Serve(listener)
+	return p, nil
+}
+
+// URL is the address to pass to wkhtmltopdf's --proxy.
+func (p *renderProxy) URL() string {
+	return "http://" + p.listener.Addr().String()
+}
+
+// Close stops the proxy and the connections it holds.
+func (p *renderProxy) Close() {
+	p.server.Close()
+	p.transport.CloseIdleConnections()
+	p.tunnels.Wait()
+}
+
+func (p *renderProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	if r.URL.Scheme != "http" || r.URL.Host == "" {
+		http.Error(w, "only http and https URLs can be fetched", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), fetchTimeout)
+	defer cancel()
+	out := r.Clone(ctx)
+	out.RequestURI = ""
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		log.Printf("Render proxy refused %s: %v", r.URL.Redacted(), err)
+		http.Error(w, "fetch refused", http.StatusForbidden)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, h := range hopHeaders {
+		resp.Header.Del(h)
+	}
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, io.LimitReader(resp.Body, maxFetchedSize))
+}
+
+// tunnel answers CONNECT, which https URLs are fetched with, by relaying
+// the connection to the requested host once it has been dialed.
+func (p *renderProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "tunnelling not supported", http.StatusInternalServerError)
+		return
+	}
+	upstream, err := p.dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		log.Printf("Render proxy refused %s: %v", r.Host, err)
+		http.Error(w, "fetch refused", http.StatusForbidden)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+
+	// Connections live no longer than a fetch, so Close doesn't wait on
+	// one wkhtmltopdf left open
+	deadline := time.Now().Add(fetchTimeout)
+	client.SetDeadline(deadline)
+	upstream.SetDeadline(deadline)
+
+	p.tunnels.Add(2)
+	go func() {
+		defer p.tunnels.Done()
+		io.Copy(upstream, io.MultiReader(buffered, client))
+		upstream.Close()
+	}()
+	go func() {
+		defer p.tunnels.Done()
+		io.CopyN(client, upstream, maxFetchedSize)
+		client.Close()
+	}()
+}
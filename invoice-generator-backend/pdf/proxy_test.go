@@ -0,0 +1,65 @@
+package pdf
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRenderProxyRefusesInternalAddresses(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "internal")
+	}))
+	defer internal.Close()
+	internalTLS := httptest.NewTLSServer(internal.Config.Handler)
+	defer internalTLS.Close()
+
+	proxy, err := startRenderProxy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL())
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"loopback", internal.URL},
+		{"loopback over https", internalTLS.URL},
+		{"metadata service", "http://169.254.169.254/latest/meta-data/"},
+		{"private network", "http://10.0.0.1/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Get(tt.url)
+			if err != nil {
+				// CONNECT refused: the client reports the proxy's answer
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusForbidden || strings.Contains(string(body), "internal") {
+				t.Errorf("GET %s through the proxy = %d %q, want it refused", tt.url, resp.StatusCode, body)
+			}
+		})
+	}
+
+	// Asked directly rather than as a proxy, there is no URL to fetch
+	resp, err := http.Get(proxy.URL() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("direct request = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,386 @@
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"reflect"
+	"sort"
+	"text/template/parse"
+	"time"
+)
+
+// Limits applied to user-authored templates.
+const (
+	// renderTimeout bounds template execution.
+	renderTimeout = 5 * time.Second
+	// maxRenderedSize caps the HTML a template may produce.
+	maxRenderedSize = 10 << 20
+	// maxRangeLiteral caps the iterations of {{range N}} over integer
+	// literals, nested ones multiplied together.
+	maxRangeLiteral = 10000
+	// maxRenderSteps caps the range iterations, template calls and
+	// function calls of one render.
+	maxRenderSteps = 1000000
+	// pdfTimeout bounds a wkhtmltopdf run.
+	pdfTimeout = 60 * time.Second
+)
+
+// Sandbox rules reported in SandboxError.Rule.
+const (
+	RuleTimeout    = "timeout"
+	RuleOutputSize = "output_size"
+	RuleSteps      = "steps"
+	RuleDisallowed = "disallowed"
+	RulePDFTimeout = "pdf_timeout"
+)
+
+// SandboxError is returned when a template trips one of the rendering
+// limits or uses a construct the sandbox doesn't allow.
+type SandboxError struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *SandboxError) Error() string {
+	return "template sandbox: " + e.Message
+}
+
+// allowedBuiltins are the text/template builtins templates may call. "call"
+// is left out: templates have no business invoking arbitrary function
+// values.
+var allowedBuiltins = map[string]bool{
+	"and": true, "or": true, "not": true,
+	"eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true,
+	"len": true, "index": true, "slice": true,
+	"print": true, "printf": true, "println": true,
+	"html": true, "js": true, "urlquery": true,
+}
+
+// checkSandbox returns a SandboxError for the first sandbox violation in the
+// parsed template.
+func checkSandbox(tmpl *template.Template, funcs template.FuncMap) error {
+	if diagnostics := sandboxDiagnostics(tmpl, funcs); len(diagnostics) > 0 {
+		d := diagnostics[0]
+		return &SandboxError{Rule: RuleDisallowed, Message: fmt.Sprintf("line %d: %s", d.Line, d.Message)}
+	}
+	return nil
+}
+
+// sandboxDiagnostics checks the parsed template for function calls outside
+// the allow-list, for ranges over anything but data or small integers, and
+// for recursive template calls.
+func sandboxDiagnostics(tmpl *template.Template, funcs template.FuncMap) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil || t.Tree.Root == nil {
+			continue
+		}
+		tree := t.Tree
+		report := func(node parse.Node, message string) {
+			diagnostics = append(diagnostics, diagnosticAt(tree, node, message))
+		}
+		inspectTree(tree.Root, func(node parse.Node) {
+			switch n := node.(type) {
+			case *parse.IdentifierNode:
+				if _, ok := funcs[n.Ident]; !ok && !allowedBuiltins[n.Ident] {
+					report(n, fmt.Sprintf("function %q is not allowed in templates", n.Ident))
+				}
+			}
+		})
+		checkRanges(tree.Root, 1, report)
+	}
+	return append(diagnostics, checkTemplateCalls(tmpl)...)
+}
+
+// checkRanges reports {{range N}} loops over integer literals whose
+// iteration count, multiplied with that of enclosing literal ranges, exceeds
+// maxRangeLiteral. Ranges over data are bounded by the data itself; ranges
+// over variables and computed values, which may hold any integer, are
+// reported too.
+func checkRanges(node parse.Node, outer int64, report func(parse.Node, string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			checkRanges(child, outer, report)
+		}
+	case *parse.IfNode:
+		checkRanges(n.List, outer, report)
+		checkRanges(n.ElseList, outer, report)
+	case *parse.WithNode:
+		checkRanges(n.List, outer, report)
+		checkRanges(n.ElseList, outer, report)
+	case *parse.RangeNode:
+		inner := outer
+		var operand parse.Node
+		if len(n.Pipe.Cmds) == 1 && len(n.Pipe.Cmds[0].Args) == 1 {
+			operand = n.Pipe.Cmds[0].Args[0]
+		}
+		switch arg := operand.(type) {
+		case *parse.NumberNode:
+			if arg.IsInt && arg.Int64 > 0 {
+				if arg.Int64 > maxRangeLiteral/outer {
+					if outer > 1 {
+						report(n, fmt.Sprintf("nested range loops exceed the limit of %d iterations", maxRangeLiteral))
+					} else {
+						report(n, fmt.Sprintf("range over %d exceeds the limit of %d iterations", arg.Int64, maxRangeLiteral))
+					}
+					return
+				}
+				inner = outer * arg.Int64
+			}
+		case *parse.FieldNode, *parse.ChainNode, *parse.DotNode:
+		case *parse.VariableNode:
+			if len(arg.Ident) == 1 && arg.Ident[0] != "$" {
+				report(n, fmt.Sprintf("range over the variable %s is not allowed, range over data such as .InvoiceItems", arg.Ident[0]))
+				return
+			}
+		default:
+			report(n, "range over a computed value is not allowed, range over data such as .InvoiceItems")
+			return
+		}
+		checkRanges(n.List, inner, report)
+		checkRanges(n.ElseList, outer, report)
+	}
+}
+
+// checkTemplateCalls reports {{template}} calls that lead back to the
+// calling template. Nothing bounds such recursion but the data, and two
+// calls per level grow exponentially.
+func checkTemplateCalls(tmpl *template.Template) []Diagnostic {
+	trees := map[string]*parse.Tree{}
+	calls := map[string][]*parse.TemplateNode{}
+	var names []string
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil || t.Tree.Root == nil {
+			continue
+		}
+		name := t.Name()
+		trees[name] = t.Tree
+		names = append(names, name)
+		inspectTree(t.Tree.Root, func(node parse.Node) {
+			if n, ok := node.(*parse.TemplateNode); ok {
+				calls[name] = append(calls[name], n)
+			}
+		})
+	}
+	sort.Strings(names)
+
+	var diagnostics []Diagnostic
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+		for _, call := range calls[name] {
+			switch state[call.Name] {
+			case visiting:
+				diagnostics = append(diagnostics, diagnosticAt(trees[name], call, fmt.Sprintf("template %q is called recursively, which is not allowed", call.Name)))
+			case unvisited:
+				visit(call.Name)
+			}
+		}
+		state[name] = visited
+	}
+	for _, name := range names {
+		if state[name] == unvisited {
+			visit(name)
+		}
+	}
+	return diagnostics
+}
+
+// inspectTree calls fn for every node below node.
+func inspectTree(node parse.Node, fn func(parse.Node)) {
+	if node == nil {
+		return
+	}
+	fn(node)
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			inspectTree(child, fn)
+		}
+	case *parse.ActionNode:
+		inspectTree(n.Pipe, fn)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			inspectTree(cmd, fn)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			inspectTree(arg, fn)
+		}
+	case *parse.ChainNode:
+		inspectTree(n.Node, fn)
+	case *parse.IfNode:
+		inspectBranch(&n.BranchNode, fn)
+	case *parse.RangeNode:
+		inspectBranch(&n.BranchNode, fn)
+	case *parse.WithNode:
+		inspectBranch(&n.BranchNode, fn)
+	case *parse.TemplateNode:
+		inspectTree(n.Pipe, fn)
+	}
+}
+
+func inspectBranch(n *parse.BranchNode, fn func(parse.Node)) {
+	inspectTree(n.Pipe, fn)
+	if n.List != nil {
+		inspectTree(n.List, fn)
+	}
+	if n.ElseList != nil {
+		inspectTree(n.ElseList, fn)
+	}
+}
+
+// executeSandboxed runs the template, parsed with funcs, with a deadline,
+// an output cap and a cap on its steps. html/template can't be interrupted,
+// so execution happens on its own goroutine: on timeout the caller gets an
+// error straight away, and the goroutine stops at its next step, function
+// call or write, which all fail once the deadline has passed. Every range
+// iteration and template call is a step, so loops that write nothing stop
+// too. The template is modified and can't be executed again.
+func executeSandboxed(ctx context.Context, tmpl *template.Template, funcs template.FuncMap, data interface{}) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, renderTimeout)
+	defer cancel()
+
+	guard := &renderGuard{ctx: ctx}
+	guarded := template.FuncMap{sandboxStep: guard.step}
+	for name, fn := range funcs {
+		guarded[name] = guard.wrap(fn)
+	}
+	tmpl.Funcs(guarded)
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil && t.Tree.Root != nil {
+			addSandboxSteps(t.Tree.Root)
+		}
+	}
+
+	w := &limitedWriter{ctx: ctx, max: maxRenderedSize}
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("template execution panicked: %v", r)
+			}
+		}()
+		done <- tmpl.Execute(w, data)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+		return w.buf.Bytes(), nil
+	case <-ctx.Done():
+		return nil, &SandboxError{Rule: RuleTimeout, Message: fmt.Sprintf("rendering took longer than %s", renderTimeout)}
+	}
+}
+
+// sandboxStep is the function executeSandboxed has templates call at each
+// step. The name can't be parsed as a call in user templates, which only
+// know the functions they are parsed with.
+const sandboxStep = "sandboxStep"
+
+// stepCheck is {{if sandboxStep}}{{end}}: a step that writes nothing, so
+// it changes no output whatever the context it is escaped in.
+var stepCheck = func() parse.Node {
+	trees, err := parse.Parse("sandbox", "{{if "+sandboxStep+"}}{{end}}", "", "", map[string]interface{}{sandboxStep: true})
+	if err != nil {
+		panic(err)
+	}
+	return trees["sandbox"].Root.Nodes[0]
+}()
+
+// addSandboxSteps puts a step at the start of the template list and of the
+// body of every range within it.
+func addSandboxSteps(root *parse.ListNode) {
+	inspectTree(root, func(node parse.Node) {
+		if n, ok := node.(*parse.RangeNode); ok && n.List != nil {
+			n.List.Nodes = append([]parse.Node{stepCheck.Copy()}, n.List.Nodes...)
+		}
+	})
+	root.Nodes = append([]parse.Node{stepCheck.Copy()}, root.Nodes...)
+}
+
+// renderGuard counts the steps of a render and fails them once the render
+// is out of time or steps.
+type renderGuard struct {
+	ctx   context.Context
+	steps int
+}
+
+func (g *renderGuard) step() (bool, error) {
+	if g.ctx.Err() != nil {
+		return false, &SandboxError{Rule: RuleTimeout, Message: fmt.Sprintf("rendering took longer than %s", renderTimeout)}
+	}
+	g.steps++
+	if g.steps > maxRenderSteps {
+		return false, &SandboxError{Rule: RuleSteps, Message: fmt.Sprintf("rendering took more than %d steps", maxRenderSteps)}
+	}
+	return true, nil
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// wrap returns template function fn as a function that takes a step before
+// calling fn, and fails instead when the step does. The result has fn's
+// parameters and an error result.
+func (g *renderGuard) wrap(fn interface{}) interface{} {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	in := make([]reflect.Type, t.NumIn())
+	for i := range in {
+		in[i] = t.In(i)
+	}
+	out := []reflect.Type{t.Out(0), errorType}
+	return reflect.MakeFunc(reflect.FuncOf(in, out, t.IsVariadic()), func(args []reflect.Value) []reflect.Value {
+		if _, err := g.step(); err != nil {
+			return []reflect.Value{reflect.Zero(out[0]), reflect.ValueOf(&err).Elem()}
+		}
+		var results []reflect.Value
+		if t.IsVariadic() {
+			results = v.CallSlice(args)
+		} else {
+			results = v.Call(args)
+		}
+		if len(results) == 1 {
+			results = append(results, reflect.Zero(errorType))
+		}
+		return results
+	}).Interface()
+}
+
+// limitedWriter buffers template output and fails once the context is done
+// or the output grows past max.
+type limitedWriter struct {
+	ctx context.Context
+	max int
+	buf bytes.Buffer
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.ctx.Err() != nil {
+		return 0, &SandboxError{Rule: RuleTimeout, Message: fmt.Sprintf("rendering took longer than %s", renderTimeout)}
+	}
+	if w.buf.Len()+len(p) > w.max {
+		return 0, &SandboxError{Rule: RuleOutputSize, Message: fmt.Sprintf("rendered output exceeds %d bytes", w.max)}
+	}
+	return w.buf.Write(p)
+}
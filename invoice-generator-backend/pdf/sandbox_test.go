@@ -0,0 +1,106 @@
+package pdf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSandboxDiagnostics(t *testing.T) {
+	funcs := template.FuncMap{"upper": strings.ToUpper}
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"range over data", `{{range .InvoiceItems}}{{upper .Description}}{{end}}`, ""},
+		{"range with declarations", `{{range $i, $item := .InvoiceItems}}{{$item}}{{end}}`, ""},
+		{"range from the root", `{{range $.InvoiceItems}}{{end}}`, ""},
+		{"small literal range", `{{range 3}}x{{end}}`, ""},
+		{"large literal range", `{{range 100000}}{{end}}`, "exceeds the limit"},
+		{"nested literal ranges", `{{range 200}}{{range 200}}{{end}}{{end}}`, "nested range loops"},
+		{"range over a variable", `{{$n := 100000000}}{{range $n}}{{end}}`, "variable $n"},
+		{"range over a parenthesized literal", `{{range (100000000)}}{{end}}`, "computed value"},
+		{"range over a function result", `{{range len .InvoiceItems}}{{end}}`, "computed value"},
+		{"repeated calls", `{{define "row"}}x{{end}}{{template "row" .}}{{template "row" .}}`, ""},
+		{"recursive template", `{{define "a"}}{{template "a" .}}{{template "a" .}}{{end}}{{template "a" .}}`, `"a" is called recursively`},
+		{"mutually recursive templates", `{{define "a"}}{{template "b" .}}{{end}}{{define "b"}}{{template "a" .}}{{end}}{{template "a" .}}`, "called recursively"},
+		{"call builtin", `{{call .Func}}`, `"call" is not allowed`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := template.New("invoice").Funcs(funcs).Parse(tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			diagnostics := sandboxDiagnostics(tmpl, funcs)
+			if tt.want == "" {
+				if len(diagnostics) > 0 {
+					t.Errorf("unexpected diagnostics %v", diagnostics)
+				}
+				return
+			}
+			if len(diagnostics) == 0 || !strings.Contains(diagnostics[0].Message, tt.want) {
+				t.Errorf("diagnostics = %v, want one containing %q", diagnostics, tt.want)
+			}
+		})
+	}
+}
+
+// TestExecuteSandboxedStops runs templates that would go on for hours past
+// the static checks and expects them to fail within the render timeout,
+// with the goroutine executing them gone.
+func TestExecuteSandboxedStops(t *testing.T) {
+	var fanOut strings.Builder
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&fanOut, `{{define "t%d"}}{{template "t%d" .}}{{template "t%d" .}}{{end}}`, i, i+1, i+1)
+	}
+	fanOut.WriteString(`{{define "t30"}}{{end}}{{template "t0" .}}`)
+
+	tests := []struct {
+		name    string
+		content string
+		timeout time.Duration
+		rule    string
+	}{
+		{"range over a variable", `{{$n := 100000000}}{{range $n}}{{end}}`, renderTimeout, RuleSteps},
+		{"exponential template calls", fanOut.String(), renderTimeout, RuleSteps},
+		{"slow function", `{{range 1000}}{{slow}}{{end}}`, 100 * time.Millisecond, RuleTimeout},
+	}
+	funcs := template.FuncMap{"slow": func() string {
+		time.Sleep(20 * time.Millisecond)
+		return ""
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := template.New("invoice").Funcs(funcs).Parse(tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			goroutines := runtime.NumGoroutine()
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			start := time.Now()
+			_, err = executeSandboxed(ctx, tmpl, funcs, nil)
+			var sandboxErr *SandboxError
+			if !errors.As(err, &sandboxErr) || sandboxErr.Rule != tt.rule {
+				t.Fatalf("executeSandboxed = %v, want a %s sandbox error", err, tt.rule)
+			}
+			if elapsed := time.Since(start); elapsed > renderTimeout {
+				t.Errorf("took %s, longer than the render timeout", elapsed)
+			}
+
+			for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > goroutines; time.Sleep(10 * time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatalf("%d goroutines still running, %d before", runtime.NumGoroutine(), goroutines)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package pdf
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"invoice-generator-go/i18n"
+)
+
+// Writing systems that need fonts beyond the Latin ones every template
+// names. Han characters are shared by Chinese, Japanese and Korean, so the
+// CJK variant is picked from the kana or hangul next to them, or from the
+// document language.
+const (
+	scriptArabic   = "arabic"
+	scriptHebrew   = "hebrew"
+	scriptJapanese = "japanese"
+	scriptKorean   = "korean"
+	scriptChinese  = "chinese"
+	scriptChineseT = "chinese-traditional"
+)
+
+// scriptFonts are the font families used for each script, as installed by
+// the Noto font packages in the Docker image. wkhtmltopdf embeds the glyphs
+// it uses from them into the PDF.
+var scriptFonts = map[string][]string{
+	scriptArabic:   {"Noto Naskh Arabic", "Noto Sans Arabic"},
+	scriptHebrew:   {"Noto Sans Hebrew"},
+	scriptJapanese: {"Noto Sans CJK JP"},
+	scriptKorean:   {"Noto Sans CJK KR"},
+	scriptChinese:  {"Noto Sans CJK SC"},
+	scriptChineseT: {"Noto Sans CJK TC"},
+}
+
+// scriptOrder fixes the order of fonts in the fallback list.
+var scriptOrder = []string{scriptArabic, scriptHebrew, scriptJapanese, scriptKorean, scriptChinese, scriptChineseT}
+
+// detectScripts returns the scripts found in texts that need their own
+// fonts. locale decides the CJK variant for Han characters without kana or
+// hangul.
+func detectScripts(locale string, texts ...string) []string {
+	var arabic, hebrew, han, kana, hangul bool
+	for _, text := range texts {
+		for _, r := range text {
+			if r < 0x0590 {
+				continue
+			}
+			switch {
+			case unicode.Is(unicode.Arabic, r):
+				arabic = true
+			case unicode.Is(unicode.Hebrew, r):
+				hebrew = true
+			case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+				kana = true
+			case unicode.Is(unicode.Hangul, r):
+				hangul = true
+			case unicode.Is(unicode.Han, r):
+				han = true
+			}
+		}
+	}
+
+	found := map[string]bool{
+		scriptArabic:   arabic,
+		scriptHebrew:   hebrew,
+		scriptJapanese: kana,
+		scriptKorean:   hangul,
+	}
+	if han && !kana && !hangul {
+		found[hanScript(locale)] = true
+	}
+
+	var scripts []string
+	for _, script := range scriptOrder {
+		if found[script] {
+			scripts = append(scripts, script)
+		}
+	}
+	return scripts
+}
+
+// hanScript picks the CJK variant for Han characters from the document
+// locale, defaulting to Simplified Chinese.
+func hanScript(locale string) string {
+	locale = i18n.Normalize(locale)
+	base, region, _ := strings.Cut(locale, "-")
+	switch base {
+	case "ja":
+		return scriptJapanese
+	case "ko":
+		return scriptKorean
+	case "zh":
+		if region == "tw" || region == "hk" || region == "mo" || region == "hant" {
+			return scriptChineseT
+		}
+	}
+	return scriptChinese
+}
+
+// scriptFontList returns a CSS font-family list with the fonts for scripts,
+// ending in the generic sans-serif family.
+func scriptFontList(scripts []string) template.CSS {
+	var families []string
+	for _, script := range scripts {
+		for _, family := range scriptFonts[script] {
+			families = append(families, `"`+family+`"`)
+		}
+	}
+	families = append(families, "sans-serif")
+	return template.CSS(strings.Join(families, ", "))
+}
+
+// documentTexts returns the free text of a document that may be written in
+// any script: customer and sender details, line items and the translated
+// labels.
+func documentTexts(data DataForTemplate, tr *i18n.Translator) []string {
+	inv, company := data.Invoice, data.Company
+	texts := []string{
+		inv.CustomerName, inv.CustomerAddress, inv.Notes, inv.BuyerReference,
+		company.CompanyName, company.AddressLine, company.City, company.BankName, company.LegalFooter,
+	}
+	for _, item := range data.InvoiceItems {
+		texts = append(texts, item.Description)
+	}
+	for _, text := range tr.Merged() {
+		texts = append(texts, text)
+	}
+	return texts
+}
+
+// applyScripts sets the text direction and the script fonts of data from the
+// document language and the text it contains.
+func applyScripts(data *DataForTemplate, tr *i18n.Translator) {
+	data.Direction = i18n.Direction(tr.Locale())
+	data.Start, data.End = "left", "right"
+	if data.Direction == "rtl" {
+		data.Start, data.End = "right", "left"
+	}
+	data.ScriptFonts = scriptFontList(detectScripts(tr.Locale(), documentTexts(*data, tr)...))
+}
+
+var (
+	htmlTagRe = regexp.MustCompile(`(?i)<html\b[^>]*>`)
+	dirAttrRe = regexp.MustCompile(`(?i)\sdir\s*=`)
+)
+
+// ensureDirection adds dir="rtl" to the <html> tag of a right-to-left
+// document when the template doesn't set a direction itself, so templates
+// written before RTL support still lay out correctly.
+func ensureDirection(html []byte, direction string) []byte {
+	if direction != "rtl" {
+		return html
+	}
+	loc := htmlTagRe.FindIndex(html)
+	if loc == nil {
+		return append([]byte(`<div dir="rtl">`), append(html, []byte(`</div>`)...)...)
+	}
+	tag := html[loc[0]:loc[1]]
+	if dirAttrRe.Match(tag) {
+		return html
+	}
+	var out bytes.Buffer
+	out.Grow(len(html) + len(` dir="rtl"`))
+	out.Write(html[:loc[0]])
+	out.WriteString(`<html dir="rtl"`)
+	out.Write(tag[len("<html"):])
+	out.Write(html[loc[1]:])
+	return out.Bytes()
+}
@@ -0,0 +1,150 @@
+package pdf
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"invoice-generator-go/i18n"
+	"invoice-generator-go/layout"
+	"invoice-generator-go/models"
+	"invoice-generator-go/templates"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestDetectScripts(t *testing.T) {
+	tests := []struct {
+		name   string
+		locale string
+		texts  []string
+		want   string
+	}{
+		{name: "latin only", locale: "de", texts: []string{"Müller GmbH", "Ærø"}},
+		{name: "arabic", locale: "en", texts: []string{"شركة الخليج"}, want: "arabic"},
+		{name: "hebrew", locale: "en", texts: []string{"חברה בע״מ"}, want: "hebrew"},
+		{name: "kana decides japanese", locale: "zh", texts: []string{"株式会社", "サンプル"}, want: "japanese"},
+		{name: "hangul decides korean", locale: "en", texts: []string{"主식회사 한국"}, want: "korean"},
+		{name: "han in a japanese document", locale: "ja", texts: []string{"東京都"}, want: "japanese"},
+		{name: "han in a traditional chinese document", locale: "zh-TW", texts: []string{"臺北市"}, want: "chinese-traditional"},
+		{name: "han defaults to simplified chinese", locale: "en", texts: []string{"北京市"}, want: "chinese"},
+		{name: "mixed", locale: "en", texts: []string{"ACME", "شركة", "שלום", "東京タワー"}, want: "arabic,hebrew,japanese"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(detectScripts(tt.locale, tt.texts...), ","); got != tt.want {
+				t.Errorf("detectScripts = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsureDirection(t *testing.T) {
+	tests := []struct {
+		name, direction, html, want string
+	}{
+		{"ltr untouched", "ltr", `<html><body>x</body></html>`, `<html><body>x</body></html>`},
+		{"rtl added", "rtl", `<html lang="ar"><body>x</body></html>`, `<html dir="rtl" lang="ar"><body>x</body></html>`},
+		{"template direction kept", "rtl", `<HTML DIR="ltr"><body>x</body></HTML>`, `<HTML DIR="ltr"><body>x</body></HTML>`},
+		{"fragment wrapped", "rtl", `<p>x</p>`, `<div dir="rtl"><p>x</p></div>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(ensureDirection([]byte(tt.html), tt.direction)); got != tt.want {
+				t.Errorf("ensureDirection = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// mixedScriptInvoices are the documents rendered for the golden files: an
+// invoice in each right-to-left and CJK language, and an English one mixing
+// every script.
+var mixedScriptInvoices = []struct {
+	name, locale string
+	customer     string
+	address      string
+	items        []string
+}{
+	{name: "arabic", locale: "ar", customer: "شركة الخليج للتجارة", address: "شارع الملك فهد، الرياض", items: []string{"استشارات", "Support (ACME-42)"}},
+	{name: "hebrew", locale: "he", customer: "חברת הדגמה בע״מ", address: "רחוב הרצל 1, תל אביב", items: []string{"ייעוץ", "Hosting 2026"}},
+	{name: "japanese", locale: "ja", customer: "株式会社サンプル", address: "東京都千代田区1-1", items: []string{"コンサルティング", "保守サービス"}},
+	{name: "mixed", locale: "en", customer: "ACME Global / شركة أكمي / 株式会社アクメ", address: "1 Main St, חיפה", items: []string{"Consulting — استشارات", "翻訳 (Translation)", "한국어 지원"}},
+}
+
+func goldenTemplates(t *testing.T) map[string]string {
+	t.Helper()
+	system, err := templates.SystemTemplates()
+	if err != nil {
+		t.Fatalf("SystemTemplates: %v", err)
+	}
+	sources := map[string]string{}
+	for _, tmpl := range system {
+		sources[tmpl.Key] = tmpl.Content
+	}
+	spec, err := layout.Parse(`{"locale": "en"}`)
+	if err != nil {
+		t.Fatalf("layout.Parse: %v", err)
+	}
+	sources["layout"] = layout.Compile(spec)
+	return sources
+}
+
+func TestMixedScriptGolden(t *testing.T) {
+	company := &models.CompanyProfile{CompanyName: "Seller GmbH", AddressLine: "Hauptstraße 1", City: "Berlin", PostalCode: "10115"}
+	date := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	for key, content := range goldenTemplates(t) {
+		for _, doc := range mixedScriptInvoices {
+			t.Run(key+"/"+doc.name, func(t *testing.T) {
+				invoice := models.Invoice{
+					InvoiceNumber:   "INV-2026-0001",
+					InvoiceDate:     date,
+					DueDate:         date.AddDate(0, 0, 30),
+					Status:          "sent",
+					DocumentType:    "invoice",
+					Currency:        "€",
+					CustomerName:    doc.customer,
+					CustomerEmail:   "customer@example.com",
+					CustomerAddress: doc.address,
+					Subtotal:        300,
+					TaxRate:         19,
+					TaxAmount:       57,
+					TotalAmount:     357,
+				}
+				var items []models.InvoiceItem
+				for _, description := range doc.items {
+					items = append(items, models.InvoiceItem{Description: description, Quantity: 1, UnitPrice: 100, TotalPrice: 100})
+				}
+
+				tr := i18n.New(doc.locale, nil)
+				data := templateData(invoice, items, company, tr.Locale())
+				html, err := renderHTML(context.Background(), &models.Template{Content: content}, content, data, tr)
+				if err != nil {
+					t.Fatalf("renderHTML: %v", err)
+				}
+
+				golden := filepath.Join("testdata", "scripts", key+"_"+doc.name+".html")
+				if *update {
+					if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(golden, html, 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("missing golden file, run go test ./pdf -update: %v", err)
+				}
+				if string(html) != string(want) {
+					t.Errorf("rendered HTML differs from %s; run go test ./pdf -run TestMixedScriptGolden -update and review the diff", golden)
+				}
+			})
+		}
+	}
+}
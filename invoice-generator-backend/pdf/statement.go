@@ -0,0 +1,87 @@
+package pdf
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"html/template"
+
+	"invoice-generator-go/i18n"
+	"invoice-generator-go/models"
+
+	"github.com/google/uuid"
+)
+
+// statementTemplate is the bundled template account statements are
+// rendered with.
+//
+//go:embed statement.html
+var statementTemplate string
+
+// StatementData is the data the statement template is rendered with.
+type StatementData struct {
+	Statement      models.Statement
+	Company        models.CompanyProfile
+	CompanyLogoURL template.URL
+	// Language, Direction, Start, End and ScriptFonts are as in
+	// DataForTemplate.
+	Language    string
+	Direction   string
+	Start, End  string
+	ScriptFonts template.CSS
+}
+
+// StatementOptions controls RenderStatement.
+type StatementOptions struct {
+	// UserID selects the account's custom translations and the customer's
+	// language.
+	UserID uuid.UUID
+	// Language overrides the document language, e.g. "fr".
+	Language string
+}
+
+// RenderStatement renders a customer account statement as a PDF, in the
+// customer's language unless opts overrides it.
+func RenderStatement(ctx context.Context, statement models.Statement, company *models.CompanyProfile, opts StatementOptions) ([]byte, error) {
+	tr, err := documentTranslator(opts.UserID, opts.Language, statement.CustomerEmail, i18n.DefaultLocale)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load translations: %v", err)
+	}
+
+	data := StatementData{
+		Statement:      statement,
+		Company:        *company,
+		CompanyLogoURL: companyLogoURL(company),
+		Language:       tr.Locale(),
+		Direction:      i18n.Direction(tr.Locale()),
+		Start:          "left",
+		End:            "right",
+	}
+	if data.Direction == "rtl" {
+		data.Start, data.End = "right", "left"
+	}
+	texts := []string{statement.CustomerName, statement.CustomerAddress, company.CompanyName, company.AddressLine, company.City}
+	for _, entry := range statement.Entries {
+		texts = append(texts, entry.Reference)
+	}
+	for _, text := range tr.Merged() {
+		texts = append(texts, text)
+	}
+	data.ScriptFonts = scriptFontList(detectScripts(tr.Locale(), texts...))
+
+	funcs := translationFuncs(tr)
+	tmpl, err := template.New("statement").Funcs(funcs).Parse(statementTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse statement template: %v", err)
+	}
+	html, err := executeSandboxed(ctx, tmpl, funcs, data)
+	if err != nil {
+		var sandboxErr *SandboxError
+		if errors.As(err, &sandboxErr) {
+			return nil, sandboxErr
+		}
+		return nil, fmt.Errorf("failed to execute statement template: %v", err)
+	}
+	return htmlToPDF(ctx, html)
+}
@@ -0,0 +1,55 @@
+package pdf
+
+import (
+	"html/template"
+
+	"invoice-generator-go/i18n"
+	"invoice-generator-go/storage"
+
+	"github.com/google/uuid"
+)
+
+// documentTranslator picks the language a document is rendered in, the first
+// of: the explicit override, the customer's language, the template's
+// language and i18n.DefaultLocale. It loads the account's custom
+// translations for that language.
+func documentTranslator(userID uuid.UUID, override, customerEmail, templateLang string) (*i18n.Translator, error) {
+	language := override
+	if language == "" && userID != uuid.Nil && customerEmail != "" {
+		customerLanguage, err := storage.GetCustomerLanguage(userID, customerEmail)
+		if err != nil {
+			return nil, err
+		}
+		language = customerLanguage
+	}
+	if language == "" {
+		language = templateLang
+	}
+	if !i18n.ValidLocale(language) {
+		// Older templates store free-form names such as "German"
+		language = templateLanguage(language)
+	}
+
+	var custom map[string]i18n.Catalog
+	if userID != uuid.Nil {
+		catalogs, err := storage.GetTranslations(userID, i18n.Chain(language)...)
+		if err != nil {
+			return nil, err
+		}
+		custom = make(map[string]i18n.Catalog, len(catalogs))
+		for locale, catalog := range catalogs {
+			custom[locale] = catalog
+		}
+	}
+	return i18n.New(language, custom), nil
+}
+
+// translationFuncs provides {{t "key"}}, which returns the text for key in
+// the document language. Extra arguments fill in fmt verbs in the text.
+func translationFuncs(tr *i18n.Translator) template.FuncMap {
+	return template.FuncMap{
+		"t": func(key string, args ...interface{}) string {
+			return tr.T(key, args...)
+		},
+	}
+}
@@ -0,0 +1,356 @@
+package pdf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template/parse"
+	"time"
+
+	"invoice-generator-go/i18n"
+	"invoice-generator-go/layout"
+	"invoice-generator-go/models"
+
+	"github.com/google/uuid"
+)
+
+// MaxTemplateSize is the largest template content accepted, in bytes.
+const MaxTemplateSize = 1 << 20
+
+// Diagnostic severities.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is a problem found in an invoice template. Line and Column are
+// 1-based and zero when the problem isn't tied to a position.
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Message  string `json:"message"`
+}
+
+// HasErrors reports whether any diagnostic is an error rather than a warning.
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTemplate checks invoice template content before it is stored. It
+// parses the template with the functions available at render time, applies
+// the rendering sandbox's rules, checks that every field it references exists
+// on DataForTemplate, and renders it against a sample invoice. Layout
+// templates (language "layout") are checked against the layout schema and
+// then compiled and checked the same way. An empty result means the template
+// is fine.
+func ValidateTemplate(content, language string) []Diagnostic {
+	if len(content) > MaxTemplateSize {
+		return []Diagnostic{{
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("template is %d bytes, the limit is %d", len(content), MaxTemplateSize),
+		}}
+	}
+	if strings.TrimSpace(content) == "" {
+		return []Diagnostic{{Severity: SeverityError, Message: "template is empty"}}
+	}
+
+	if layout.IsLayout(language) {
+		spec, err := layout.Parse(content)
+		if err != nil {
+			return layoutDiagnostics(err)
+		}
+		content = layout.Compile(spec)
+	}
+
+	data := sampleTemplateData()
+	tmpl, err := parseInvoiceTemplate(content, data.PaymentQR)
+	if err != nil {
+		return []Diagnostic{diagnosticFromError(SeverityError, err)}
+	}
+
+	funcs := templateFuncs(data.PaymentQR, placeholderAssets, i18n.New(i18n.DefaultLocale, nil))
+	diagnostics := sandboxDiagnostics(tmpl, funcs)
+	if tmpl.Tree != nil && tmpl.Tree.Root != nil {
+		checker := fieldChecker{tree: tmpl.Tree, root: reflect.TypeOf(data)}
+		checker.walk(tmpl.Tree.Root, checker.root)
+		diagnostics = append(diagnostics, checker.diagnostics...)
+	}
+
+	// Only render when the checks pass; otherwise the first bad field would
+	// be reported twice.
+	if !HasErrors(diagnostics) {
+		if _, err := executeSandboxed(context.Background(), tmpl, funcs, data); err != nil {
+			diagnostics = append(diagnostics, diagnosticFromError(SeverityError, err))
+		}
+	}
+
+	if !strings.Contains(content, ".Invoice") {
+		diagnostics = append(diagnostics, Diagnostic{
+			Severity: SeverityWarning,
+			Message:  "template does not reference any invoice data",
+		})
+	}
+
+	return diagnostics
+}
+
+// layoutDiagnostics converts a layout parse error into diagnostics.
+func layoutDiagnostics(err error) []Diagnostic {
+	var validationErr *layout.ValidationError
+	if !errors.As(err, &validationErr) {
+		return []Diagnostic{{Severity: SeverityError, Message: err.Error()}}
+	}
+	diagnostics := make([]Diagnostic, 0, len(validationErr.Violations))
+	for _, v := range validationErr.Violations {
+		diagnostics = append(diagnostics, Diagnostic{Severity: SeverityError, Line: v.Line, Column: v.Column, Message: v.String()})
+	}
+	return diagnostics
+}
+
+// templateErrorRe matches the position prefix of text/template and
+// html/template errors, e.g. "template: invoice:3:14: ...".
+var templateErrorRe = regexp.MustCompile(`(?s)^(?:html/)?template: ?[^:]*:(\d+)(?::(\d+))?: (.*)$`)
+
+func diagnosticFromError(severity string, err error) Diagnostic {
+	d := Diagnostic{Severity: severity, Message: err.Error()}
+	if m := templateErrorRe.FindStringSubmatch(err.Error()); m != nil {
+		d.Line, _ = strconv.Atoi(m[1])
+		d.Column, _ = strconv.Atoi(m[2])
+		d.Message = m[3]
+	}
+	return d
+}
+
+// fieldChecker walks a parsed template tracking the type of dot, and reports
+// field references that don't exist on that type. Where the type can't be
+// known statically (variables, function results, maps) it stops checking.
+type fieldChecker struct {
+	tree        *parse.Tree
+	root        reflect.Type
+	diagnostics []Diagnostic
+}
+
+func (fc *fieldChecker) walk(node parse.Node, dot reflect.Type) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			fc.walk(child, dot)
+		}
+	case *parse.ActionNode:
+		fc.pipe(n.Pipe, dot)
+	case *parse.IfNode:
+		fc.pipe(n.Pipe, dot)
+		fc.walk(n.List, dot)
+		fc.walk(n.ElseList, dot)
+	case *parse.RangeNode:
+		fc.pipe(n.Pipe, dot)
+		fc.walk(n.List, elemType(fc.pipeType(n.Pipe, dot)))
+		fc.walk(n.ElseList, dot)
+	case *parse.WithNode:
+		fc.pipe(n.Pipe, dot)
+		fc.walk(n.List, fc.pipeType(n.Pipe, dot))
+		fc.walk(n.ElseList, dot)
+	case *parse.TemplateNode:
+		fc.pipe(n.Pipe, dot)
+	}
+}
+
+func (fc *fieldChecker) pipe(pipe *parse.PipeNode, dot reflect.Type) {
+	if pipe == nil {
+		return
+	}
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			fc.arg(arg, dot)
+		}
+	}
+}
+
+// arg checks a single command argument and returns its type, or nil when
+// it can't be determined.
+func (fc *fieldChecker) arg(node parse.Node, dot reflect.Type) reflect.Type {
+	switch n := node.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.FieldNode:
+		return fc.resolve(n, dot, n.Ident)
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" {
+			return fc.resolve(n, fc.root, n.Ident[1:])
+		}
+	case *parse.ChainNode:
+		var base reflect.Type
+		if pipe, ok := n.Node.(*parse.PipeNode); ok {
+			fc.pipe(pipe, dot)
+			base = fc.pipeType(pipe, dot)
+		} else {
+			base = fc.arg(n.Node, dot)
+		}
+		return fc.resolve(n, base, n.Field)
+	case *parse.PipeNode:
+		fc.pipe(n, dot)
+		return fc.pipeType(n, dot)
+	}
+	return nil
+}
+
+// pipeType returns the type a pipeline evaluates to when it is a plain field
+// reference.
+func (fc *fieldChecker) pipeType(pipe *parse.PipeNode, dot reflect.Type) reflect.Type {
+	if pipe == nil || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return nil
+	}
+	// Checking happens in pipe(); only compute the type here.
+	silent := fieldChecker{tree: fc.tree, root: fc.root}
+	return silent.arg(pipe.Cmds[0].Args[0], dot)
+}
+
+func (fc *fieldChecker) resolve(node parse.Node, t reflect.Type, idents []string) reflect.Type {
+	for _, ident := range idents {
+		if t == nil {
+			return nil
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if m, ok := reflect.PointerTo(t).MethodByName(ident); ok {
+			if m.Type.NumOut() == 0 {
+				return nil
+			}
+			t = m.Type.Out(0)
+			continue
+		}
+		switch t.Kind() {
+		case reflect.Interface, reflect.Map:
+			return nil
+		case reflect.Struct:
+			if f, ok := t.FieldByName(ident); ok && f.IsExported() {
+				t = f.Type
+				continue
+			}
+		}
+		fc.report(node, fmt.Sprintf("%s is not a field of %s", ident, typeName(t)))
+		return nil
+	}
+	return t
+}
+
+func (fc *fieldChecker) report(node parse.Node, message string) {
+	fc.diagnostics = append(fc.diagnostics, diagnosticAt(fc.tree, node, message))
+}
+
+// diagnosticAt returns an error diagnostic positioned at node.
+func diagnosticAt(tree *parse.Tree, node parse.Node, message string) Diagnostic {
+	d := Diagnostic{Severity: SeverityError, Message: message}
+	location, _ := tree.ErrorContext(node)
+	// location is "name:line:col".
+	if parts := strings.Split(location, ":"); len(parts) >= 3 {
+		d.Line, _ = strconv.Atoi(parts[len(parts)-2])
+		d.Column, _ = strconv.Atoi(parts[len(parts)-1])
+	}
+	return d
+}
+
+// elemType is the type of dot inside {{range}} over a value of type t.
+func elemType(t reflect.Type) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+		return t.Elem()
+	case reflect.Int:
+		return t
+	}
+	return nil
+}
+
+func typeName(t reflect.Type) string {
+	if t.Name() != "" {
+		return t.Name()
+	}
+	return t.String()
+}
+
+// sampleTemplateData returns a representative invoice used to dry-run
+// templates.
+func sampleTemplateData() DataForTemplate {
+	issued := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	templateID := uuid.New()
+	invoice := models.Invoice{
+		ID:              uuid.New(),
+		UserID:          uuid.New(),
+		TemplateID:      &templateID,
+		InvoiceNumber:   "INV-2024-0001",
+		Status:          "sent",
+		DocumentType:    "invoice",
+		BuyerReference:  "PO-4711",
+		CustomerName:    "Example Customer Ltd",
+		CustomerEmail:   "billing@example.com",
+		CustomerAddress: "1 Sample Street\n12345 Sample City",
+		InvoiceDate:     issued,
+		DueDate:         issued.AddDate(0, 0, 30),
+		Currency:        "EUR",
+		Subtotal:        1500,
+		TaxRate:         20,
+		TaxAmount:       300,
+		TotalAmount:     1800,
+		Notes:           "Thank you for your business.",
+		PaymentTerms:    "2/10 Net 30",
+		DiscountPercent: 2,
+		CreatedAt:       issued,
+		UpdatedAt:       issued,
+	}
+	items := []models.InvoiceItem{
+		{ID: uuid.New(), InvoiceID: invoice.ID, Description: "Consulting services", Quantity: 10, UnitPrice: 120, TotalPrice: 1200},
+		{ID: uuid.New(), InvoiceID: invoice.ID, Description: "Travel expenses", Quantity: 1, UnitPrice: 300, TotalPrice: 300},
+	}
+	invoice.Items = items
+	discountDue := issued.AddDate(0, 0, 10)
+	invoice.DiscountDueDate = &discountDue
+
+	data := DataForTemplate{
+		Invoice:      invoice,
+		InvoiceItems: items,
+		Company: models.CompanyProfile{
+			ID:          uuid.New(),
+			UserID:      invoice.UserID,
+			Name:        "Default",
+			IsDefault:   true,
+			CompanyName: "Sample Company GmbH",
+			AddressLine: "Musterstrasse 1",
+			PostalCode:  "10115",
+			City:        "Berlin",
+			CountryCode: "DE",
+			Email:       "invoices@sample.example",
+			Phone:       "+49 30 1234567",
+			Website:     "https://sample.example",
+			TaxID:       "DE123456789",
+			BankName:    "Sample Bank",
+			IBAN:        "DE89370400440532013000",
+			BIC:         "COBADEFFXXX",
+			LegalFooter: "Registered at Amtsgericht Berlin, HRB 12345",
+		},
+		PaymentQR: PaymentQR{Reference: "RF18 5390 0754 7034"},
+		Language:  i18n.DefaultLocale,
+		Discount:  earlyPaymentDiscount(invoice),
+	}
+	applyScripts(&data, i18n.New(i18n.DefaultLocale, nil))
+	return data
+}
@@ -0,0 +1,108 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+
+	"invoice-generator-go/i18n"
+	"invoice-generator-go/models"
+)
+
+// Watermarks: status stamps overlaid on rendered documents.
+const (
+	WatermarkDraft = "draft"
+	WatermarkPaid  = "paid"
+	WatermarkVoid  = "void"
+	WatermarkCopy  = "copy"
+	// WatermarkNone suppresses the stamp in a render request.
+	WatermarkNone = "none"
+)
+
+// watermarkColors are the stamp colours, drawn semi-transparent.
+var watermarkColors = map[string]string{
+	WatermarkDraft: "rgba(120, 120, 120, 0.25)",
+	WatermarkPaid:  "rgba(39, 174, 96, 0.3)",
+	WatermarkVoid:  "rgba(192, 57, 43, 0.3)",
+	WatermarkCopy:  "rgba(120, 120, 120, 0.25)",
+}
+
+// ValidWatermark reports whether name is a stamp a template can enable.
+func ValidWatermark(name string) bool {
+	_, ok := watermarkColors[name]
+	return ok
+}
+
+// ValidWatermarkOverride reports whether name can override the stamp of a
+// render request: a stamp or WatermarkNone.
+func ValidWatermarkOverride(name string) bool {
+	return name == WatermarkNone || ValidWatermark(name)
+}
+
+// watermarkFor picks the stamp for a document. An override from the render
+// request wins; otherwise draft, paid and void invoices get their status
+// stamp and other copies of a document already handed out get
+// WatermarkCopy, if the template shows that stamp. It returns "" for no
+// stamp.
+func watermarkFor(invoice models.Invoice, dbTemplate *models.Template, override string, isCopy bool) string {
+	if override == WatermarkNone {
+		return ""
+	}
+	if override != "" {
+		return override
+	}
+
+	stamp := ""
+	switch invoice.Status {
+	case WatermarkDraft, WatermarkPaid, WatermarkVoid:
+		stamp = invoice.Status
+	default:
+		if isCopy {
+			stamp = WatermarkCopy
+		}
+	}
+	if stamp == "" || dbTemplate.Watermarks == nil {
+		return stamp
+	}
+	for _, enabled := range dbTemplate.Watermarks {
+		if enabled == stamp {
+			return stamp
+		}
+	}
+	return ""
+}
+
+// watermarkText is the stamp text in the document language. Paid stamps
+// carry the payment date when it is known.
+func watermarkText(stamp string, invoice models.Invoice, tr *i18n.Translator) string {
+	if stamp == WatermarkPaid && invoice.PaidAt != nil {
+		return tr.T("watermark_paid_on", invoice.PaidAt.Format("2006-01-02"))
+	}
+	return tr.T("watermark_" + stamp)
+}
+
+var bodyEndRe = regexp.MustCompile(`(?i)</body\s*>`)
+
+// addWatermark overlays the document's stamp, if any, on rendered HTML. The
+// stamp is placed just before </body>, or appended to documents without
+// one.
+func addWatermark(doc []byte, data DataForTemplate, tr *i18n.Translator) []byte {
+	if data.Watermark == "" {
+		return doc
+	}
+	stamp := fmt.Sprintf(`<div class="invoice-watermark" style="position: fixed; top: 38%%; left: 0; width: 100%%; text-align: center; z-index: 1000; font-family: Helvetica, Arial, %s; font-size: 88pt; font-weight: bold; color: %s; -webkit-transform: rotate(-30deg); transform: rotate(-30deg); pointer-events: none;">%s</div>`,
+		data.ScriptFonts, watermarkColors[data.Watermark], html.EscapeString(watermarkText(data.Watermark, data.Invoice, tr)))
+
+	locs := bodyEndRe.FindAllIndex(doc, -1)
+	if len(locs) == 0 {
+		return append(doc, stamp...)
+	}
+	end := locs[len(locs)-1][0]
+	var out bytes.Buffer
+	out.Grow(len(doc) + len(stamp))
+	out.Write(doc[:end])
+	out.WriteString(stamp)
+	out.Write(doc[end:])
+	return out.Bytes()
+}
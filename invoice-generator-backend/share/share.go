@@ -0,0 +1,137 @@
+// Package share issues the tokens of share links, which let customers
+// without a login open their invoices, and builds the customer-facing view
+// of an invoice.
+package share
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"invoice-generator-go/models"
+	"invoice-generator-go/paymentterms"
+)
+
+const (
+	// DefaultExpiryDays is how long a link stays valid when its creator
+	// picks no expiry.
+	DefaultExpiryDays = 30
+	// MaxExpiryDays bounds the validity of a link.
+	MaxExpiryDays = 365
+)
+
+// tokenBytes is the entropy of a token.
+const tokenBytes = 32
+
+// NewToken returns a new unguessable token and the hash to store for it.
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate share token: %v", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hash a token is stored and looked up by.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ExpiresAt is when a link created at now and valid for days expires; 0
+// days picks DefaultExpiryDays.
+func ExpiresAt(now time.Time, days int) (time.Time, error) {
+	if days == 0 {
+		days = DefaultExpiryDays
+	}
+	if days < 1 || days > MaxExpiryDays {
+		return time.Time{}, fmt.Errorf("expires_in_days must be between 1 and %d", MaxExpiryDays)
+	}
+	return now.AddDate(0, 0, days), nil
+}
+
+// Usable reports whether link still opens at now: it is neither revoked nor
+// expired.
+func Usable(link models.ShareLink, now time.Time) bool {
+	return link.RevokedAt == nil && now.Before(link.ExpiresAt)
+}
+
+// InvoiceURL is the address of an invoice link on a server at baseURL.
+func InvoiceURL(baseURL, token string) string {
+	return strings.TrimRight(baseURL, "/") + "/public/invoices/" + token
+}
+
+// CustomerURL is the address of a customer link on a server at baseURL.
+func CustomerURL(baseURL, token string) string {
+	return strings.TrimRight(baseURL, "/") + "/public/customers/" + token
+}
+
+// Visible reports whether a customer may see invoice through a link: drafts
+// have not been issued yet.
+func Visible(invoice models.Invoice) bool {
+	return invoice.Status != "draft"
+}
+
+// PublicInvoice is the customer-facing view of invoice, with its items and
+// seller when given.
+func PublicInvoice(invoice models.Invoice, items []models.InvoiceItem, company *models.CompanyProfile, pdfURL string) models.PublicInvoice {
+	view := models.PublicInvoice{
+		ID:              invoice.ID,
+		InvoiceNumber:   invoice.InvoiceNumber,
+		DocumentType:    invoice.DocumentType,
+		Status:          invoice.Status,
+		BuyerReference:  invoice.BuyerReference,
+		CustomerName:    invoice.CustomerName,
+		CustomerAddress: invoice.CustomerAddress,
+		InvoiceDate:     invoice.InvoiceDate,
+		DueDate:         invoice.DueDate,
+		PaymentTerms:    invoice.PaymentTerms,
+		DiscountPercent: invoice.DiscountPercent,
+		DiscountDueDate: invoice.DiscountDueDate,
+		Currency:        invoice.Currency,
+		Subtotal:        invoice.Subtotal,
+		TaxRate:         invoice.TaxRate,
+		TaxAmount:       invoice.TaxAmount,
+		TotalAmount:     invoice.TotalAmount,
+		AmountPaid:      invoice.AmountPaid,
+		AmountDue:       paymentterms.AmountDue(invoice, time.Now()),
+		Notes:           invoice.Notes,
+		Seller:          Seller(company),
+		PDFURL:          pdfURL,
+	}
+	for _, item := range items {
+		view.Items = append(view.Items, models.PublicInvoiceItem{
+			Description: item.Description,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			TotalPrice:  item.TotalPrice,
+		})
+	}
+	return view
+}
+
+// Seller is the customer-facing view of a company profile, nil for none.
+func Seller(company *models.CompanyProfile) *models.PublicSeller {
+	if company == nil {
+		return nil
+	}
+	return &models.PublicSeller{
+		CompanyName: company.CompanyName,
+		AddressLine: company.AddressLine,
+		PostalCode:  company.PostalCode,
+		City:        company.City,
+		CountryCode: company.CountryCode,
+		Email:       company.Email,
+		Phone:       company.Phone,
+		Website:     company.Website,
+		TaxID:       company.TaxID,
+		BankName:    company.BankName,
+		IBAN:        company.IBAN,
+		BIC:         company.BIC,
+	}
+}
@@ -0,0 +1,99 @@
+package share
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"invoice-generator-go/models"
+)
+
+func TestNewToken(t *testing.T) {
+	token, hash, err := NewToken()
+	if err != nil {
+		t.Fatalf("NewToken: %v", err)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		t.Fatalf("token %q is not unpadded base64url: %v", token, err)
+	}
+	if len(raw) != tokenBytes {
+		t.Errorf("token carries %d bytes, want %d", len(raw), tokenBytes)
+	}
+	if hash != HashToken(token) {
+		t.Errorf("hash = %s, want HashToken(token) = %s", hash, HashToken(token))
+	}
+	if hash == token {
+		t.Error("the stored hash is the token itself")
+	}
+
+	other, _, err := NewToken()
+	if err != nil {
+		t.Fatalf("NewToken: %v", err)
+	}
+	if other == token {
+		t.Error("two tokens are equal")
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	tests := []struct{ token, want string }{
+		// SHA-256 test vectors
+		{"", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	}
+	for _, tt := range tests {
+		if got := HashToken(tt.token); got != tt.want {
+			t.Errorf("HashToken(%q) = %s, want %s", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestExpiresAt(t *testing.T) {
+	now := time.Date(2026, time.January, 31, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		days    int
+		want    time.Time
+		wantErr bool
+	}{
+		{"default", 0, now.AddDate(0, 0, DefaultExpiryDays), false},
+		{"one day", 1, time.Date(2026, time.February, 1, 12, 0, 0, 0, time.UTC), false},
+		{"maximum", MaxExpiryDays, time.Date(2027, time.January, 31, 12, 0, 0, 0, time.UTC), false},
+		{"over the maximum", MaxExpiryDays + 1, time.Time{}, true},
+		{"negative", -1, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpiresAt(now, tt.days)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpiresAt(%d) error = %v, want error %v", tt.days, err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ExpiresAt(%d) = %s, want %s", tt.days, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsable(t *testing.T) {
+	now := time.Date(2026, time.March, 1, 9, 0, 0, 0, time.UTC)
+	revoked := now.Add(-time.Hour)
+	tests := []struct {
+		name string
+		link models.ShareLink
+		want bool
+	}{
+		{"valid", models.ShareLink{ExpiresAt: now.Add(time.Second)}, true},
+		{"expires now", models.ShareLink{ExpiresAt: now}, false},
+		{"expired", models.ShareLink{ExpiresAt: now.Add(-time.Second)}, false},
+		{"revoked", models.ShareLink{ExpiresAt: now.Add(time.Hour), RevokedAt: &revoked}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Usable(tt.link, now); got != tt.want {
+				t.Errorf("Usable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
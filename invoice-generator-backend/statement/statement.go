@@ -0,0 +1,192 @@
+// Package statement builds customer account statements: the opening
+// balance, the invoices, credit notes and payments of a period with a
+// running balance, and the closing balance split by age.
+package statement
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"invoice-generator-go/models"
+
+	"github.com/google/uuid"
+)
+
+// Entry types.
+const (
+	TypeInvoice    = "invoice"
+	TypeCreditNote = "credit_note"
+	TypePayment    = "payment"
+)
+
+// onStatement reports whether an invoice counts towards the customer's
+// balance: drafts were never issued and void invoices are cancelled.
+func onStatement(invoice models.Invoice) bool {
+	return invoice.Status != "draft" && invoice.Status != "void"
+}
+
+// Currencies lists the currencies of the invoices that count towards the
+// customer's balance, sorted.
+func Currencies(invoices []models.Invoice) []string {
+	seen := map[string]bool{}
+	var currencies []string
+	for _, invoice := range invoices {
+		currency := strings.ToUpper(invoice.Currency)
+		if onStatement(invoice) && !seen[currency] {
+			seen[currency] = true
+			currencies = append(currencies, currency)
+		}
+	}
+	sort.Strings(currencies)
+	return currencies
+}
+
+// Build produces the statement from from to to, both dates inclusive, of a
+// customer's invoices and their payments in currency. Aging is as of the end
+// of the period.
+func Build(invoices []models.Invoice, payments []models.Payment, currency string, from, to time.Time) models.Statement {
+	start := day(from)
+	end := day(to).AddDate(0, 0, 1)
+
+	st := models.Statement{
+		Currency: strings.ToUpper(currency),
+		From:     start,
+		To:       day(to),
+		Entries:  []models.StatementEntry{},
+	}
+
+	byID := map[uuid.UUID]models.Invoice{}
+	var latest time.Time
+	for _, invoice := range invoices {
+		if !onStatement(invoice) || !strings.EqualFold(invoice.Currency, currency) {
+			continue
+		}
+		byID[invoice.ID] = invoice
+		if st.CustomerEmail == "" || !invoice.InvoiceDate.Before(latest) {
+			latest = invoice.InvoiceDate
+			st.CustomerName = invoice.CustomerName
+			st.CustomerEmail = invoice.CustomerEmail
+			st.CustomerAddress = invoice.CustomerAddress
+		}
+
+		amount := invoice.TotalAmount
+		entryType := TypeInvoice
+		if invoice.DocumentType == TypeCreditNote {
+			amount, entryType = -amount, TypeCreditNote
+		}
+		switch {
+		case invoice.InvoiceDate.Before(start):
+			st.OpeningBalance += amount
+		case invoice.InvoiceDate.Before(end):
+			entry := models.StatementEntry{
+				Date:          invoice.InvoiceDate,
+				Type:          entryType,
+				InvoiceID:     invoice.ID,
+				InvoiceNumber: invoice.InvoiceNumber,
+				Reference:     invoice.BuyerReference,
+				Amount:        amount,
+			}
+			if entryType == TypeInvoice {
+				due := invoice.DueDate
+				entry.DueDate = &due
+			}
+			st.Entries = append(st.Entries, entry)
+		}
+	}
+
+	// paidBy holds what was paid on each invoice by the end of the period
+	paidBy := map[uuid.UUID]float64{}
+	var unapplied float64
+	for _, payment := range payments {
+		invoice, ok := byID[payment.InvoiceID]
+		if !ok || !payment.PaidAt.Before(end) {
+			continue
+		}
+		// An early payment discount settles the invoice along with the payment
+		settled := payment.Amount + payment.Discount
+		if invoice.InvoiceDate.Before(end) {
+			paidBy[invoice.ID] += settled
+		} else {
+			// Paid in advance of an invoice dated after the period
+			unapplied += settled
+		}
+		if payment.PaidAt.Before(start) {
+			st.OpeningBalance -= settled
+			continue
+		}
+		st.Entries = append(st.Entries, models.StatementEntry{
+			Date:          payment.PaidAt,
+			Type:          TypePayment,
+			InvoiceID:     invoice.ID,
+			InvoiceNumber: invoice.InvoiceNumber,
+			Reference:     payment.Reference,
+			Amount:        -settled,
+		})
+	}
+
+	// Documents come before the payments made against them on the same day
+	sort.SliceStable(st.Entries, func(i, j int) bool {
+		a, b := st.Entries[i], st.Entries[j]
+		if !day(a.Date).Equal(day(b.Date)) {
+			return a.Date.Before(b.Date)
+		}
+		return a.Type != TypePayment && b.Type == TypePayment
+	})
+
+	st.OpeningBalance = round(st.OpeningBalance)
+	balance := st.OpeningBalance
+	for i := range st.Entries {
+		st.Entries[i].Amount = round(st.Entries[i].Amount)
+		balance = round(balance + st.Entries[i].Amount)
+		st.Entries[i].Balance = balance
+	}
+	st.ClosingBalance = balance
+	st.Aging = aging(byID, paidBy, unapplied, end)
+	return st
+}
+
+// aging splits the balance at the end of the period by the days each
+// invoice's open amount is past due.
+func aging(invoices map[uuid.UUID]models.Invoice, paid map[uuid.UUID]float64, unapplied float64, end time.Time) models.StatementAging {
+	var a models.StatementAging
+	a.Current -= unapplied
+	asOf := end.AddDate(0, 0, -1)
+	for _, invoice := range invoices {
+		if !invoice.InvoiceDate.Before(end) {
+			continue
+		}
+		if invoice.DocumentType == TypeCreditNote {
+			a.Current -= invoice.TotalAmount
+			continue
+		}
+		open := invoice.TotalAmount - paid[invoice.ID]
+		overdue := int(asOf.Sub(day(invoice.DueDate)).Hours() / 24)
+		switch {
+		case overdue <= 0:
+			a.Current += open
+		case overdue <= 30:
+			a.Days1To30 += open
+		case overdue <= 60:
+			a.Days31To60 += open
+		case overdue <= 90:
+			a.Days61To90 += open
+		default:
+			a.Over90 += open
+		}
+	}
+	a.Current, a.Days1To30, a.Days31To60 = round(a.Current), round(a.Days1To30), round(a.Days31To60)
+	a.Days61To90, a.Over90 = round(a.Days61To90), round(a.Over90)
+	return a
+}
+
+// day truncates t to midnight UTC of its date.
+func day(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
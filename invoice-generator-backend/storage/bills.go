@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"invoice-generator-go/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrDuplicateBill is returned when a supplier's bill number has already
+// been imported for the user.
+var ErrDuplicateBill = errors.New("bill already imported")
+
+// ErrOverpayment is returned when a payment exceeds a bill's open balance.
+var ErrOverpayment = errors.New("payment exceeds the open balance")
+
+// ErrBillVoid and ErrBillPaid are returned when a payment is recorded on a
+// bill that no longer takes payments.
+var (
+	ErrBillVoid = errors.New("bill is void")
+	ErrBillPaid = errors.New("bill is already paid")
+)
+
+const billColumns = `id, user_id, supplier_id, bill_number, document_type, status, bill_date, due_date, currency, subtotal, tax_amount, total_amount, amount_paid, COALESCE(notes, ''), source_format, created_at, updated_at`
+
+func scanBill(row interface{ Scan(...interface{}) error }, bill *models.Bill) error {
+	return row.Scan(&bill.ID, &bill.UserID, &bill.SupplierID, &bill.BillNumber, &bill.DocumentType, &bill.Status, &bill.BillDate, &bill.DueDate, &bill.Currency, &bill.Subtotal, &bill.TaxAmount, &bill.TotalAmount, &bill.AmountPaid, &bill.Notes, &bill.SourceFormat, &bill.CreatedAt, &bill.UpdatedAt)
+}
+
+// CreateBill inserts a bill together with its items in one transaction.
+func CreateBill(bill *models.Bill) (string, error) {
+	bill.ID = uuid.New()
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO bills (id, user_id, supplier_id, bill_number, document_type, status, bill_date, due_date, currency, subtotal, tax_amount, total_amount, amount_paid, notes, source_format, source_document, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+    `
+	_, err = tx.Exec(query, bill.ID, bill.UserID, bill.SupplierID, bill.BillNumber, bill.DocumentType, bill.Status, bill.BillDate, bill.DueDate, bill.Currency, bill.Subtotal, bill.TaxAmount, bill.TotalAmount, bill.AmountPaid, bill.Notes, bill.SourceFormat, bill.SourceDocument)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return "", ErrDuplicateBill
+		}
+		return "", fmt.Errorf("failed to insert bill: %v", err)
+	}
+
+	for i := range bill.Items {
+		item := &bill.Items[i]
+		item.ID = uuid.New()
+		item.BillID = bill.ID
+		_, err = tx.Exec(`
+            INSERT INTO bill_items (id, bill_id, description, quantity, unit_price, tax_rate, total_price, created_at, updated_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+        `, item.ID, item.BillID, item.Description, item.Quantity, item.UnitPrice, item.TaxRate, item.TotalPrice)
+		if err != nil {
+			return "", fmt.Errorf("failed to insert bill item: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit bill: %v", err)
+	}
+	return bill.ID.String(), nil
+}
+
+// GetBillByID retrieves a bill by its ID.
+func GetBillByID(billID uuid.UUID) (*models.Bill, error) {
+	var bill models.Bill
+	row := DB.QueryRow(`SELECT `+billColumns+` FROM bills WHERE id = $1`, billID)
+	if err := scanBill(row, &bill); err != nil {
+		return nil, fmt.Errorf("failed to get bill by ID: %v", err)
+	}
+	return &bill, nil
+}
+
+// GetBillSourceDocument returns the original XML a bill was imported from.
+func GetBillSourceDocument(billID uuid.UUID) (string, error) {
+	var source string
+	if err := DB.QueryRow(`SELECT source_document FROM bills WHERE id = $1`, billID).Scan(&source); err != nil {
+		return "", fmt.Errorf("failed to get bill source document: %v", err)
+	}
+	return source, nil
+}
+
+// GetBillsByUserID retrieves a user's bills, optionally filtered by status,
+// ordered by due date.
+func GetBillsByUserID(userID uuid.UUID, status string) ([]models.Bill, error) {
+	query := `SELECT ` + billColumns + ` FROM bills WHERE user_id = $1 AND ($2 = '' OR status = $2) ORDER BY due_date NULLS LAST, bill_date`
+	rows, err := DB.Query(query, userID, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bills by user ID: %v", err)
+	}
+	defer rows.Close()
+
+	var bills []models.Bill
+	for rows.Next() {
+		var bill models.Bill
+		if err := scanBill(rows, &bill); err != nil {
+			return nil, fmt.Errorf("failed to scan bill: %v", err)
+		}
+		bills = append(bills, bill)
+	}
+
+	return bills, nil
+}
+
+// GetBillItemsByBillID retrieves all items for a given bill ID.
+func GetBillItemsByBillID(billID uuid.UUID) ([]models.BillItem, error) {
+	rows, err := DB.Query(`
+        SELECT id, bill_id, description, quantity, unit_price, tax_rate, total_price, created_at, updated_at
+        FROM bill_items
+        WHERE bill_id = $1
+        ORDER BY created_at, id
+    `, billID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bill items by bill ID: %v", err)
+	}
+	defer rows.Close()
+
+	var items []models.BillItem
+	for rows.Next() {
+		var item models.BillItem
+		if err := rows.Scan(&item.ID, &item.BillID, &item.Description, &item.Quantity, &item.UnitPrice, &item.TaxRate, &item.TotalPrice, &item.CreatedAt, &item.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan bill item: %v", err)
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// GetBillPaymentsByBillID retrieves the payments recorded against a bill.
+func GetBillPaymentsByBillID(billID uuid.UUID) ([]models.BillPayment, error) {
+	rows, err := DB.Query(`
+        SELECT id, bill_id, amount, paid_at, COALESCE(reference, ''), created_at
+        FROM bill_payments
+        WHERE bill_id = $1
+        ORDER BY paid_at
+    `, billID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bill payments by bill ID: %v", err)
+	}
+	defer rows.Close()
+
+	var payments []models.BillPayment
+	for rows.Next() {
+		var p models.BillPayment
+		if err := rows.Scan(&p.ID, &p.BillID, &p.Amount, &p.PaidAt, &p.Reference, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan bill payment: %v", err)
+		}
+		payments = append(payments, p)
+	}
+
+	return payments, nil
+}
+
+// RecordBillPayment stores a payment and updates the bill's paid amount and
+// status. The bill row is locked, so a concurrent payment cannot overpay it
+// and a bill voided or paid meanwhile is not paid again.
+func RecordBillPayment(payment *models.BillPayment) (*models.Bill, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	var total, paid float64
+	err = tx.QueryRow(`SELECT status, total_amount, amount_paid FROM bills WHERE id = $1 FOR UPDATE`, payment.BillID).Scan(&status, &total, &paid)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no bill found with ID: %s", payment.BillID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock bill: %v", err)
+	}
+	switch status {
+	case "void":
+		return nil, ErrBillVoid
+	case "paid":
+		return nil, ErrBillPaid
+	}
+	if payment.Amount > total-paid+0.005 {
+		return nil, ErrOverpayment
+	}
+
+	payment.ID = uuid.New()
+	_, err = tx.Exec(`
+        INSERT INTO bill_payments (id, bill_id, amount, paid_at, reference, created_at)
+        VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+    `, payment.ID, payment.BillID, payment.Amount, payment.PaidAt, payment.Reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert bill payment: %v", err)
+	}
+
+	_, err = tx.Exec(`
+        UPDATE bills
+        SET amount_paid = amount_paid + $2,
+            status = CASE WHEN amount_paid + $2 >= total_amount THEN 'paid' ELSE 'partially_paid' END
+        WHERE id = $1
+    `, payment.BillID, payment.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update bill balance: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit bill payment: %v", err)
+	}
+	return GetBillByID(payment.BillID)
+}
+
+// UpdateBillStatus sets the status of a bill.
+func UpdateBillStatus(billID uuid.UUID, status string) error {
+	result, err := DB.Exec(`UPDATE bills SET status = $2 WHERE id = $1`, billID, status)
+	if err != nil {
+		return fmt.Errorf("failed to update bill status: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no bill found with ID: %s", billID)
+	}
+	return nil
+}
+
+// DeleteBill deletes a bill; its items and payments are removed by cascade.
+func DeleteBill(billID uuid.UUID) error {
+	result, err := DB.Exec("DELETE FROM bills WHERE id = $1", billID)
+	if err != nil {
+		return fmt.Errorf("failed to delete bill: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("no bill found with ID: %s", billID)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// BlobStore keeps binary objects such as logos outside the database. Keys
+// are slash separated relative paths, e.g. "logos/<user>/<profile>.png".
+type BlobStore interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// Blobs is the blob store used by the application. It is set up by
+// ConnectBlobStore.
+var Blobs BlobStore
+
+// ConnectBlobStore initialises Blobs with a file system store rooted at dir.
+func ConnectBlobStore(dir string) error {
+	store, err := NewFileBlobStore(dir)
+	if err != nil {
+		return err
+	}
+	Blobs = store
+	return nil
+}
+
+// FileBlobStore is a BlobStore backed by a directory.
+type FileBlobStore struct {
+	root string
+}
+
+// NewFileBlobStore creates dir if needed and returns a store rooted there.
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blob storage directory: %v", err)
+	}
+	return &FileBlobStore{root: dir}, nil
+}
+
+// path maps a key to a file below the root, rejecting keys that would
+// escape it.
+func (s *FileBlobStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || clean == "/" || strings.Contains(key, "\\") || clean != "/"+key {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean[1:])), nil
+}
+
+// Put writes data under key, replacing any existing blob.
+func (s *FileBlobStore) Put(key string, data []byte) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("failed to create blob directory: %v", err)
+	}
+	// Write to a temporary file first so readers never see partial data.
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write blob: %v", err)
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to store blob: %v", err)
+	}
+	return nil
+}
+
+// Get returns the blob stored under key.
+func (s *FileBlobStore) Get(key string) ([]byte, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob: %v", err)
+	}
+	return data, nil
+}
+
+// Delete removes the blob stored under key. Missing blobs are not an error.
+func (s *FileBlobStore) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete blob: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	"invoice-generator-go/models"
+
+	"github.com/google/uuid"
+)
+
+const checkoutSessionColumns = `id, invoice_id, provider, provider_session_id, amount, currency, url, status, created_at, updated_at`
+
+func scanCheckoutSession(row interface{ Scan(...interface{}) error }, s *models.CheckoutSession) error {
+	return row.Scan(&s.ID, &s.InvoiceID, &s.Provider, &s.ProviderSessionID, &s.Amount, &s.Currency, &s.URL, &s.Status, &s.CreatedAt, &s.UpdatedAt)
+}
+
+// CreateCheckoutSession stores a checkout session started with the payment
+// provider.
+func CreateCheckoutSession(session *models.CheckoutSession) error {
+	session.ID = uuid.New()
+	session.Status = "open"
+	err := DB.QueryRow(`
+        INSERT INTO checkout_sessions (id, invoice_id, provider, provider_session_id, amount, currency, url, status)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING created_at, updated_at
+    `, session.ID, session.InvoiceID, session.Provider, session.ProviderSessionID, session.Amount, session.Currency, session.URL, session.Status).Scan(&session.CreatedAt, &session.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create checkout session: %v", err)
+	}
+	return nil
+}
+
+// GetCheckoutSession retrieves a checkout session by the provider's ID for
+// it. It returns sql.ErrNoRows when there is none.
+func GetCheckoutSession(provider, providerSessionID string) (*models.CheckoutSession, error) {
+	var session models.CheckoutSession
+	err := scanCheckoutSession(DB.QueryRow(`
+        SELECT `+checkoutSessionColumns+`
+        FROM checkout_sessions
+        WHERE provider = $1 AND provider_session_id = $2
+    `, provider, providerSessionID), &session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RecordProviderPayment records the payment a webhook event reports for a
+// checkout session, once: it reports false when the event, or another one
+// for the same provider payment, was processed before. The money has been
+// taken, so a payment above the open balance, or on an invoice voided in
+// the meantime, is recorded rather than refused; the latter leaves the
+// invoice's status alone.
+func RecordProviderPayment(eventID string, session *models.CheckoutSession, payment *models.Payment) (*models.Invoice, bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	claimed, err := claimPaymentEvent(tx, session.Provider, eventID, "payment_succeeded")
+	if err != nil || !claimed {
+		return nil, false, err
+	}
+
+	var recorded bool
+	err = tx.QueryRow(`
+        SELECT EXISTS (SELECT 1 FROM invoice_payments WHERE provider = $1 AND provider_payment_id = $2)
+    `, session.Provider, payment.ProviderPaymentID).Scan(&recorded)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to check provider payment: %v", err)
+	}
+	if !recorded {
+		payment.InvoiceID = session.InvoiceID
+		payment.Provider = session.Provider
+		if err := recordInvoicePayment(tx, payment, true); err != nil {
+			return nil, false, err
+		}
+	}
+	if err := setCheckoutSessionStatus(tx, session.ID, "paid"); err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit provider payment: %v", err)
+	}
+	if recorded {
+		return nil, false, nil
+	}
+	invoice, err := GetInvoiceByID(session.InvoiceID)
+	return invoice, true, err
+}
+
+// CloseCheckoutSession records a webhook event that ends a checkout session
+// unpaid, with status failed or expired. It reports false when the event
+// was processed before.
+func CloseCheckoutSession(eventID, eventType string, session *models.CheckoutSession, status string) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	claimed, err := claimPaymentEvent(tx, session.Provider, eventID, eventType)
+	if err != nil || !claimed {
+		return false, err
+	}
+	if err := setCheckoutSessionStatus(tx, session.ID, status); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit checkout session: %v", err)
+	}
+	return true, nil
+}
+
+// claimPaymentEvent records a webhook event as processed, reporting false
+// when it already was.
+func claimPaymentEvent(tx *sql.Tx, provider, eventID, eventType string) (bool, error) {
+	result, err := tx.Exec(`
+        INSERT INTO payment_events (provider, event_id, type)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (provider, event_id) DO NOTHING
+    `, provider, eventID, eventType)
+	if err != nil {
+		return false, fmt.Errorf("failed to record payment event: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	return n > 0, nil
+}
+
+// setCheckoutSessionStatus moves an open session to status; a paid session
+// stays paid.
+func setCheckoutSessionStatus(tx *sql.Tx, sessionID uuid.UUID, status string) error {
+	_, err := tx.Exec(`UPDATE checkout_sessions SET status = $2 WHERE id = $1 AND status <> 'paid'`, sessionID, status)
+	if err != nil {
+		return fmt.Errorf("failed to update checkout session: %v", err)
+	}
+	return nil
+}
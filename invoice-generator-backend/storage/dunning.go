@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"invoice-generator-go/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GetDunningPolicy retrieves a user's dunning policy. It returns
+// sql.ErrNoRows when the user has none.
+func GetDunningPolicy(userID uuid.UUID) (*models.DunningPolicy, error) {
+	var policy models.DunningPolicy
+	var steps []byte
+	err := DB.QueryRow(`SELECT enabled, steps, updated_at FROM dunning_policies WHERE user_id = $1`, userID).Scan(&policy.Enabled, &steps, &policy.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(steps, &policy.Steps); err != nil {
+		return nil, fmt.Errorf("failed to decode dunning steps: %v", err)
+	}
+	return &policy, nil
+}
+
+// SetDunningPolicy creates or replaces a user's dunning policy.
+func SetDunningPolicy(userID uuid.UUID, policy *models.DunningPolicy) error {
+	steps, err := json.Marshal(policy.Steps)
+	if err != nil {
+		return fmt.Errorf("failed to encode dunning steps: %v", err)
+	}
+	err = DB.QueryRow(`
+        INSERT INTO dunning_policies (user_id, enabled, steps)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (user_id) DO UPDATE
+        SET enabled = EXCLUDED.enabled, steps = EXCLUDED.steps
+        RETURNING updated_at
+    `, userID, policy.Enabled, steps).Scan(&policy.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save dunning policy: %v", err)
+	}
+	return nil
+}
+
+// GetEnabledDunningPolicies retrieves the enabled dunning policies by user.
+func GetEnabledDunningPolicies() (map[uuid.UUID]models.DunningPolicy, error) {
+	rows, err := DB.Query(`SELECT user_id, enabled, steps, updated_at FROM dunning_policies WHERE enabled`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dunning policies: %v", err)
+	}
+	defer rows.Close()
+
+	policies := map[uuid.UUID]models.DunningPolicy{}
+	for rows.Next() {
+		var userID uuid.UUID
+		var policy models.DunningPolicy
+		var steps []byte
+		if err := rows.Scan(&userID, &policy.Enabled, &steps, &policy.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan dunning policy: %v", err)
+		}
+		if err := json.Unmarshal(steps, &policy.Steps); err != nil {
+			return nil, fmt.Errorf("failed to decode dunning steps: %v", err)
+		}
+		policies[userID] = policy
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate dunning policies: %v", err)
+	}
+	return policies, nil
+}
+
+// GetDunningExclusions lists the customers a user exempted from reminders.
+func GetDunningExclusions(userID uuid.UUID) ([]models.DunningExclusion, error) {
+	rows, err := DB.Query(`SELECT customer_email, COALESCE(reason, ''), created_at FROM dunning_exclusions WHERE user_id = $1 ORDER BY customer_email`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dunning exclusions: %v", err)
+	}
+	defer rows.Close()
+
+	exclusions := []models.DunningExclusion{}
+	for rows.Next() {
+		var e models.DunningExclusion
+		if err := rows.Scan(&e.CustomerEmail, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan dunning exclusion: %v", err)
+		}
+		exclusions = append(exclusions, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate dunning exclusions: %v", err)
+	}
+	return exclusions, nil
+}
+
+// SetDunningExclusion exempts a customer from reminders, updating the
+// reason if they already are. Emails are stored lower-cased.
+func SetDunningExclusion(userID uuid.UUID, e *models.DunningExclusion) error {
+	e.CustomerEmail = strings.ToLower(e.CustomerEmail)
+	err := DB.QueryRow(`
+        INSERT INTO dunning_exclusions (user_id, customer_email, reason)
+        VALUES ($1, $2, NULLIF($3, ''))
+        ON CONFLICT (user_id, customer_email) DO UPDATE SET reason = EXCLUDED.reason
+        RETURNING created_at
+    `, userID, e.CustomerEmail, e.Reason).Scan(&e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save dunning exclusion: %v", err)
+	}
+	return nil
+}
+
+// DeleteDunningExclusion lets reminders go to a customer again, reporting
+// whether they were exempted.
+func DeleteDunningExclusion(userID uuid.UUID, customerEmail string) (bool, error) {
+	result, err := DB.Exec(`DELETE FROM dunning_exclusions WHERE user_id = $1 AND customer_email = LOWER($2)`, userID, customerEmail)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete dunning exclusion: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	return n > 0, nil
+}
+
+// FindDunningCandidates retrieves a user's invoices that may need a
+// reminder: issued, not paid in full, with a customer email that isn't
+// excluded, and due before dueBefore.
+func FindDunningCandidates(userID uuid.UUID, dueBefore time.Time) ([]models.Invoice, error) {
+	rows, err := DB.Query(`
+        SELECT `+invoiceColumns+`
+        FROM invoices i
+        WHERE i.user_id = $1
+          AND i.status IN ('sent', 'overdue')
+          AND i.document_type = 'invoice'
+          AND i.amount_paid < i.total_amount
+          AND COALESCE(i.customer_email, '') <> ''
+          AND i.due_date < $2
+          AND NOT EXISTS (
+              SELECT 1 FROM dunning_exclusions e
+              WHERE e.user_id = i.user_id AND e.customer_email = LOWER(i.customer_email)
+          )
+        ORDER BY i.due_date
+    `, userID, dueBefore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find dunning candidates: %v", err)
+	}
+	defer rows.Close()
+
+	var invoices []models.Invoice
+	for rows.Next() {
+		var invoice models.Invoice
+		if err := scanInvoice(rows, &invoice); err != nil {
+			return nil, fmt.Errorf("failed to scan invoice: %v", err)
+		}
+		invoices = append(invoices, invoice)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find dunning candidates: %v", err)
+	}
+	return invoices, nil
+}
+
+// GetTakenDunningSteps returns, by invoice, the latest reminder step sent or
+// being sent for a user's invoices.
+func GetTakenDunningSteps(userID uuid.UUID) (map[uuid.UUID]int, error) {
+	rows, err := DB.Query(`
+        SELECT invoice_id, MAX(step)
+        FROM dunning_events
+        WHERE user_id = $1 AND status IN ('pending', 'sent')
+        GROUP BY invoice_id
+    `, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dunning steps: %v", err)
+	}
+	defer rows.Close()
+
+	steps := map[uuid.UUID]int{}
+	for rows.Next() {
+		var invoiceID uuid.UUID
+		var step int
+		if err := rows.Scan(&invoiceID, &step); err != nil {
+			return nil, fmt.Errorf("failed to scan dunning step: %v", err)
+		}
+		steps[invoiceID] = step
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate dunning steps: %v", err)
+	}
+	return steps, nil
+}
+
+// ClaimDunningStep records a reminder step as pending. It returns false when
+// the step was already sent or is being sent.
+func ClaimDunningStep(userID uuid.UUID, event *models.DunningEvent) (bool, error) {
+	err := DB.QueryRow(`
+        INSERT INTO dunning_events (id, user_id, invoice_id, step, days, template)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (invoice_id, step) WHERE status IN ('pending', 'sent') DO NOTHING
+        RETURNING id, status, created_at
+    `, uuid.New(), userID, event.InvoiceID, event.Step, event.Days, event.Template).Scan(&event.ID, &event.Status, &event.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim dunning step: %v", err)
+	}
+	return true, nil
+}
+
+// CompleteDunningEvent records the outcome of a claimed reminder step.
+func CompleteDunningEvent(event *models.DunningEvent) error {
+	_, err := DB.Exec(`UPDATE dunning_events SET status = $2, sent_email_id = $3, error = NULLIF($4, '') WHERE id = $1`,
+		event.ID, event.Status, event.SentEmailID, event.Error)
+	if err != nil {
+		return fmt.Errorf("failed to complete dunning event: %v", err)
+	}
+	return nil
+}
+
+// FailInterruptedDunningEvents marks steps left pending when the server
+// stopped as failed, so they are retried, and returns how many there were.
+func FailInterruptedDunningEvents() (int64, error) {
+	result, err := DB.Exec(`UPDATE dunning_events SET status = 'failed', error = 'interrupted by a server restart' WHERE status = 'pending'`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail interrupted dunning events: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// GetDunningEvents lists the reminder steps taken for an invoice, oldest
+// first.
+func GetDunningEvents(invoiceID uuid.UUID) ([]models.DunningEvent, error) {
+	rows, err := DB.Query(`
+        SELECT id, invoice_id, step, days, template, status, sent_email_id, COALESCE(error, ''), created_at
+        FROM dunning_events
+        WHERE invoice_id = $1
+        ORDER BY created_at
+    `, invoiceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dunning events: %v", err)
+	}
+	defer rows.Close()
+
+	events := []models.DunningEvent{}
+	for rows.Next() {
+		var e models.DunningEvent
+		if err := rows.Scan(&e.ID, &e.InvoiceID, &e.Step, &e.Days, &e.Template, &e.Status, &e.SentEmailID, &e.Error, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan dunning event: %v", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate dunning events: %v", err)
+	}
+	return events, nil
+}
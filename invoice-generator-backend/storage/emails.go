@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"fmt"
+	"invoice-generator-go/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// GetEmailTemplates retrieves the email templates a user has customised,
+// by kind.
+func GetEmailTemplates(userID uuid.UUID) (map[string]models.EmailTemplate, error) {
+	rows, err := DB.Query(`SELECT kind, subject, body, updated_at FROM email_templates WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email templates: %v", err)
+	}
+	defer rows.Close()
+
+	templates := map[string]models.EmailTemplate{}
+	for rows.Next() {
+		var t models.EmailTemplate
+		if err := rows.Scan(&t.Kind, &t.Subject, &t.Body, &t.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan email template: %v", err)
+		}
+		templates[t.Kind] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate email templates: %v", err)
+	}
+	return templates, nil
+}
+
+// GetEmailTemplate retrieves a user's customised email template of kind. It
+// returns sql.ErrNoRows when the user hasn't customised it.
+func GetEmailTemplate(userID uuid.UUID, kind string) (*models.EmailTemplate, error) {
+	var t models.EmailTemplate
+	err := DB.QueryRow(`SELECT kind, subject, body, updated_at FROM email_templates WHERE user_id = $1 AND kind = $2`, userID, kind).
+		Scan(&t.Kind, &t.Subject, &t.Body, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SetEmailTemplate creates or replaces a user's email template of t.Kind.
+func SetEmailTemplate(userID uuid.UUID, t *models.EmailTemplate) error {
+	err := DB.QueryRow(`
+        INSERT INTO email_templates (user_id, kind, subject, body)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (user_id, kind) DO UPDATE
+        SET subject = EXCLUDED.subject, body = EXCLUDED.body
+        RETURNING updated_at
+    `, userID, t.Kind, t.Subject, t.Body).Scan(&t.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save email template: %v", err)
+	}
+	return nil
+}
+
+// DeleteEmailTemplate removes a user's customised email template of kind,
+// reporting whether there was one.
+func DeleteEmailTemplate(userID uuid.UUID, kind string) (bool, error) {
+	result, err := DB.Exec(`DELETE FROM email_templates WHERE user_id = $1 AND kind = $2`, userID, kind)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete email template: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	return n > 0, nil
+}
+
+const sentEmailColumns = `id, user_id, invoice_id, kind, recipients, subject, status, COALESCE(error, ''), COALESCE(message_id, ''), created_at`
+
+func scanSentEmail(row interface{ Scan(...interface{}) error }, e *models.SentEmail) error {
+	return row.Scan(&e.ID, &e.UserID, &e.InvoiceID, &e.Kind, pq.Array(&e.Recipients), &e.Subject, &e.Status, &e.Error, &e.MessageID, &e.CreatedAt)
+}
+
+// CreateSentEmail logs an email sent to a customer.
+func CreateSentEmail(e *models.SentEmail) error {
+	query := `
+        INSERT INTO sent_emails (id, user_id, invoice_id, kind, recipients, subject, status, error, message_id)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''))
+        RETURNING ` + sentEmailColumns
+
+	err := scanSentEmail(DB.QueryRow(query, uuid.New(), e.UserID, e.InvoiceID, e.Kind, pq.Array(e.Recipients), e.Subject, e.Status, e.Error, e.MessageID), e)
+	if err != nil {
+		return fmt.Errorf("failed to insert sent email: %v", err)
+	}
+	return nil
+}
+
+// GetSentEmailsByInvoiceID lists the emails sent for an invoice, newest
+// first.
+func GetSentEmailsByInvoiceID(invoiceID uuid.UUID) ([]models.SentEmail, error) {
+	rows, err := DB.Query(`SELECT `+sentEmailColumns+` FROM sent_emails WHERE invoice_id = $1 ORDER BY created_at DESC`, invoiceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sent emails: %v", err)
+	}
+	defer rows.Close()
+
+	emails := []models.SentEmail{}
+	for rows.Next() {
+		var e models.SentEmail
+		if err := scanSentEmail(rows, &e); err != nil {
+			return nil, fmt.Errorf("failed to scan sent email: %v", err)
+		}
+		emails = append(emails, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sent emails: %v", err)
+	}
+	return emails, nil
+}
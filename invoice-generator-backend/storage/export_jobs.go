@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"fmt"
+	"invoice-generator-go/models"
+
+	"github.com/google/uuid"
+)
+
+const exportJobColumns = `id, user_id, share_link_id, format, status, total, processed, COALESCE(error, ''), COALESCE(file_name, ''), COALESCE(blob_key, ''), created_at, updated_at, finished_at`
+
+func scanExportJob(row interface{ Scan(...interface{}) error }, job *models.ExportJob) error {
+	return row.Scan(&job.ID, &job.UserID, &job.ShareLinkID, &job.Format, &job.Status, &job.Total, &job.Processed, &job.Error, &job.FileName, &job.BlobKey, &job.CreatedAt, &job.UpdatedAt, &job.FinishedAt)
+}
+
+// CreateExportJob inserts a queued export job.
+func CreateExportJob(job *models.ExportJob) error {
+	query := `
+        INSERT INTO export_jobs (id, user_id, share_link_id, format, total)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING ` + exportJobColumns
+
+	err := scanExportJob(DB.QueryRow(query, uuid.New(), job.UserID, job.ShareLinkID, job.Format, job.Total), job)
+	if err != nil {
+		return fmt.Errorf("failed to insert export job: %v", err)
+	}
+	return nil
+}
+
+// GetExportJob retrieves an export job. It returns sql.ErrNoRows when there
+// is none.
+func GetExportJob(jobID uuid.UUID) (*models.ExportJob, error) {
+	var job models.ExportJob
+	err := scanExportJob(DB.QueryRow(`SELECT `+exportJobColumns+` FROM export_jobs WHERE id = $1`, jobID), &job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetActiveShareLinkExportJob retrieves the queued or running export job
+// started through a share link. It returns sql.ErrNoRows when there is none.
+func GetActiveShareLinkExportJob(linkID uuid.UUID) (*models.ExportJob, error) {
+	var job models.ExportJob
+	query := `SELECT ` + exportJobColumns + ` FROM export_jobs WHERE share_link_id = $1 AND status IN ('queued', 'running') ORDER BY created_at DESC LIMIT 1`
+	if err := scanExportJob(DB.QueryRow(query, linkID), &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetExportJobs lists a user's own export jobs, newest first. Jobs started
+// through the user's share links are left out.
+func GetExportJobs(userID uuid.UUID) ([]models.ExportJob, error) {
+	rows, err := DB.Query(`SELECT `+exportJobColumns+` FROM export_jobs WHERE user_id = $1 AND share_link_id IS NULL ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export jobs: %v", err)
+	}
+	defer rows.Close()
+
+	jobs := []models.ExportJob{}
+	for rows.Next() {
+		var job models.ExportJob
+		if err := scanExportJob(rows, &job); err != nil {
+			return nil, fmt.Errorf("failed to scan export job: %v", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate export jobs: %v", err)
+	}
+	return jobs, nil
+}
+
+// UpdateExportJobProgress marks a job running and records how many
+// invoices it has processed.
+func UpdateExportJobProgress(jobID uuid.UUID, processed int) error {
+	_, err := DB.Exec(`UPDATE export_jobs SET status = 'running', processed = $2 WHERE id = $1`, jobID, processed)
+	if err != nil {
+		return fmt.Errorf("failed to update export job progress: %v", err)
+	}
+	return nil
+}
+
+// CompleteExportJob marks a job done with its result file.
+func CompleteExportJob(jobID uuid.UUID, fileName, blobKey string) error {
+	_, err := DB.Exec(`
+        UPDATE export_jobs
+        SET status = 'done', processed = total, file_name = $2, blob_key = $3, finished_at = CURRENT_TIMESTAMP
+        WHERE id = $1
+    `, jobID, fileName, blobKey)
+	if err != nil {
+		return fmt.Errorf("failed to complete export job: %v", err)
+	}
+	return nil
+}
+
+// FailExportJob marks a job failed with the reason.
+func FailExportJob(jobID uuid.UUID, reason string) error {
+	_, err := DB.Exec(`UPDATE export_jobs SET status = 'failed', error = $2, finished_at = CURRENT_TIMESTAMP WHERE id = $1`, jobID, reason)
+	if err != nil {
+		return fmt.Errorf("failed to fail export job: %v", err)
+	}
+	return nil
+}
+
+// FailInterruptedExportJobs marks jobs that were queued or running when the
+// server stopped as failed, and returns how many there were.
+func FailInterruptedExportJobs() (int64, error) {
+	result, err := DB.Exec(`
+        UPDATE export_jobs
+        SET status = 'failed', error = 'interrupted by a server restart', finished_at = CURRENT_TIMESTAMP
+        WHERE status IN ('queued', 'running')
+    `)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail interrupted export jobs: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// DeleteExportJob deletes an export job.
+func DeleteExportJob(jobID uuid.UUID) error {
+	_, err := DB.Exec(`DELETE FROM export_jobs WHERE id = $1`, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to delete export job: %v", err)
+	}
+	return nil
+}
@@ -1,38 +1,73 @@
 package storage
 
 import (
+	"database/sql"
 	"fmt"
 	"invoice-generator-go/models"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-// CreateInvoice inserts a new invoice into the database.
-func CreateInvoice(invoice *models.Invoice) (string, error) {
-	invoice.ID = uuid.New()
-	query := `
-        INSERT INTO invoices (id, user_id, template_id, invoice_number, status, customer_name, customer_email, customer_address, invoice_date, due_date, currency, subtotal, tax_rate, tax_amount, total_amount, notes, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+const invoiceColumns = `id, user_id, template_id, invoice_number, status, customer_name, customer_email, customer_address, invoice_date, due_date, currency, subtotal, tax_rate, tax_amount, total_amount, notes, COALESCE(pdf_path, ''), document_type, COALESCE(buyer_reference, ''), company_profile_id, template_version, payment_terms_id, COALESCE(payment_terms, ''), discount_percent, discount_due_date, amount_paid, paid_at, status_changed_at, first_viewed_at, view_count, created_at, updated_at`
+
+func scanInvoice(row interface{ Scan(...interface{}) error }, invoice *models.Invoice) error {
+	return row.Scan(&invoice.ID, &invoice.UserID, &invoice.TemplateID, &invoice.InvoiceNumber, &invoice.Status, &invoice.CustomerName, &invoice.CustomerEmail, &invoice.CustomerAddress, &invoice.InvoiceDate, &invoice.DueDate, &invoice.Currency, &invoice.Subtotal, &invoice.TaxRate, &invoice.TaxAmount, &invoice.TotalAmount, &invoice.Notes, &invoice.PdfPath, &invoice.DocumentType, &invoice.BuyerReference, &invoice.CompanyProfileID, &invoice.TemplateVersion, &invoice.PaymentTermsID, &invoice.PaymentTerms, &invoice.DiscountPercent, &invoice.DiscountDueDate, &invoice.AmountPaid, &invoice.PaidAt, &invoice.StatusChangedAt, &invoice.FirstViewedAt, &invoice.ViewCount, &invoice.CreatedAt, &invoice.UpdatedAt)
+}
+
+const insertInvoiceQuery = `
+        INSERT INTO invoices (id, user_id, template_id, invoice_number, status, customer_name, customer_email, customer_address, invoice_date, due_date, currency, subtotal, tax_rate, tax_amount, total_amount, notes, created_at, updated_at, document_type, buyer_reference, company_profile_id, payment_terms_id, payment_terms, discount_percent, discount_due_date)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, NULLIF($23, ''), $24, $25)
         RETURNING id
     `
 
+func insertInvoiceArgs(invoice *models.Invoice) []interface{} {
+	return []interface{}{invoice.ID, invoice.UserID, invoice.TemplateID, invoice.InvoiceNumber, invoice.Status, invoice.CustomerName, invoice.CustomerEmail, invoice.CustomerAddress, invoice.InvoiceDate, invoice.DueDate, invoice.Currency, invoice.Subtotal, invoice.TaxRate, invoice.TaxAmount, invoice.TotalAmount, invoice.Notes, invoice.CreatedAt, invoice.UpdatedAt, invoice.DocumentType, invoice.BuyerReference, invoice.CompanyProfileID, invoice.PaymentTermsID, invoice.PaymentTerms, invoice.DiscountPercent, invoice.DiscountDueDate}
+}
+
+// CreateInvoice inserts a new invoice and its items into the database, and
+// queues its invoice.created webhook event with it.
+func CreateInvoice(invoice *models.Invoice) (string, error) {
+	invoice.ID = uuid.New()
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
 	var id uuid.UUID
-	err := DB.QueryRow(query, invoice.ID, invoice.UserID, invoice.TemplateID, invoice.InvoiceNumber, invoice.Status, invoice.CustomerName, invoice.CustomerEmail, invoice.CustomerAddress, invoice.InvoiceDate, invoice.DueDate, invoice.Currency, invoice.Subtotal, invoice.TaxRate, invoice.TaxAmount, invoice.TotalAmount, invoice.Notes, invoice.CreatedAt, invoice.UpdatedAt).Scan(&id)
+	err = tx.QueryRow(insertInvoiceQuery, insertInvoiceArgs(invoice)...).Scan(&id)
 	if err != nil {
 		return "", fmt.Errorf("failed to insert invoice: %v", err)
 	}
+	for i := range invoice.Items {
+		item := &invoice.Items[i]
+		item.ID = uuid.New()
+		item.InvoiceID = id
+		if _, err := tx.Exec(insertInvoiceItemQuery, item.ID, item.InvoiceID, item.Description, item.Quantity, item.UnitPrice, item.TotalPrice); err != nil {
+			return "", fmt.Errorf("failed to insert invoice item: %v", err)
+		}
+	}
+	if err := enqueueInvoiceEvent(tx, "invoice.created", id); err != nil {
+		return "", err
+	}
 
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit invoice: %v", err)
+	}
 	return id.String(), nil
 }
 
-// CreateInvoiceItem inserts a new invoice item into the database.
-func CreateInvoiceItem(item *models.InvoiceItem) error {
-	query := `
+const insertInvoiceItemQuery = `
         INSERT INTO invoice_items (id, invoice_id, description, quantity, unit_price, total_price, created_at, updated_at)
         VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
     `
 
-	_, err := DB.Exec(query,
+// CreateInvoiceItem inserts a new invoice item into the database.
+func CreateInvoiceItem(item *models.InvoiceItem) error {
+	_, err := DB.Exec(insertInvoiceItemQuery,
 		item.ID,
 		item.InvoiceID,
 		item.Description,
@@ -51,11 +86,11 @@ func CreateInvoiceItem(item *models.InvoiceItem) error {
 func GetInvoiceByID(invoiceID uuid.UUID) (*models.Invoice, error) {
 	var invoice models.Invoice
 	query := `
-        SELECT id, user_id, template_id, invoice_number, status, customer_name, customer_email, customer_address, invoice_date, due_date, currency, subtotal, tax_rate, tax_amount, total_amount, notes, created_at, updated_at
+        SELECT ` + invoiceColumns + `
         FROM invoices
         WHERE id = $1
     `
-	err := DB.QueryRow(query, invoiceID).Scan(&invoice.ID, &invoice.UserID, &invoice.TemplateID, &invoice.InvoiceNumber, &invoice.Status, &invoice.CustomerName, &invoice.CustomerEmail, &invoice.CustomerAddress, &invoice.InvoiceDate, &invoice.DueDate, &invoice.Currency, &invoice.Subtotal, &invoice.TaxRate, &invoice.TaxAmount, &invoice.TotalAmount, &invoice.Notes, &invoice.CreatedAt, &invoice.UpdatedAt)
+	err := scanInvoice(DB.QueryRow(query, invoiceID), &invoice)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get invoice by ID: %v", err)
 	}
@@ -87,8 +122,34 @@ func GetInvoiceItemsByInvoiceID(invoiceID uuid.UUID) ([]models.InvoiceItem, erro
 	return items, nil
 }
 
-// UpdateInvoice updates an existing invoice in the database.
+// UpdateInvoice updates an existing invoice in the database. When the invoice
+// leaves draft it is pinned to the current version of its template, so later
+// template edits don't change how an issued invoice renders; moving it back
+// to draft or switching templates releases the pin. An issued invoice without
+// a template gets the one it would fall back to. Moving the invoice from
+// draft to sent, to paid or to void queues the matching webhook event.
 func UpdateInvoice(invoice *models.Invoice) error {
+	if invoice.Status != "draft" && invoice.TemplateID == nil {
+		if templateID, err := ResolveTemplateID(invoice); err == nil {
+			invoice.TemplateID = &templateID
+		}
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var previousStatus string
+	err = tx.QueryRow(`SELECT status FROM invoices WHERE id = $1 FOR UPDATE`, invoice.ID).Scan(&previousStatus)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no invoice found with ID: %s", invoice.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock invoice: %v", err)
+	}
+
 	query := `
         UPDATE invoices
         SET
@@ -108,30 +169,45 @@ func UpdateInvoice(invoice *models.Invoice) error {
             total_amount = $15,
             notes = $16,
             updated_at = $17,
-            pdf_path = $18
+            pdf_path = $18,
+            document_type = $19,
+            buyer_reference = $20,
+            company_profile_id = $21,
+            payment_terms_id = $22,
+            payment_terms = NULLIF($23, ''),
+            discount_percent = $24,
+            discount_due_date = $25,
+            template_version = CASE
+                WHEN $5 = 'draft' THEN NULL
+                WHEN template_version IS NOT NULL AND template_id IS NOT DISTINCT FROM $3 THEN template_version
+                ELSE (SELECT current_version FROM templates WHERE id = $3)
+            END
         WHERE id = $1
+        RETURNING template_version
     `
-	result, err := DB.Exec(query, invoice.ID, invoice.UserID, invoice.TemplateID, invoice.InvoiceNumber, invoice.Status, invoice.CustomerName, invoice.CustomerEmail, invoice.CustomerAddress, invoice.InvoiceDate, invoice.DueDate, invoice.Currency, invoice.Subtotal, invoice.TaxRate, invoice.TaxAmount, invoice.TotalAmount, invoice.Notes, invoice.UpdatedAt, invoice.PdfPath)
+	err = tx.QueryRow(query, invoice.ID, invoice.UserID, invoice.TemplateID, invoice.InvoiceNumber, invoice.Status, invoice.CustomerName, invoice.CustomerEmail, invoice.CustomerAddress, invoice.InvoiceDate, invoice.DueDate, invoice.Currency, invoice.Subtotal, invoice.TaxRate, invoice.TaxAmount, invoice.TotalAmount, invoice.Notes, invoice.UpdatedAt, invoice.PdfPath, invoice.DocumentType, invoice.BuyerReference, invoice.CompanyProfileID, invoice.PaymentTermsID, invoice.PaymentTerms, invoice.DiscountPercent, invoice.DiscountDueDate).Scan(&invoice.TemplateVersion)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no invoice found with ID: %s", invoice.ID)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update invoice: %v", err)
 	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
+	if eventType := invoiceStatusEvent(previousStatus, invoice.Status); eventType != "" {
+		if err := enqueueInvoiceEvent(tx, eventType, invoice.ID); err != nil {
+			return err
+		}
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("no invoice found with ID: %s", invoice.ID)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit invoice: %v", err)
 	}
-
 	return nil
 }
 
 // GetInvoicesByUserID retrieves all invoices for a given user ID.
 func GetInvoicesByUserID(userID uuid.UUID) ([]models.Invoice, error) {
 	query := `
-        SELECT id, user_id, template_id, invoice_number, status, customer_name, customer_email, customer_address, invoice_date, due_date, currency, subtotal, tax_rate, tax_amount, total_amount, notes, pdf_path, created_at, updated_at
+        SELECT ` + invoiceColumns + `
         FROM invoices
         WHERE user_id = $1
         ORDER BY created_at DESC
@@ -145,7 +221,7 @@ func GetInvoicesByUserID(userID uuid.UUID) ([]models.Invoice, error) {
 	var invoices []models.Invoice
 	for rows.Next() {
 		var invoice models.Invoice
-		if err := rows.Scan(&invoice.ID, &invoice.UserID, &invoice.TemplateID, &invoice.InvoiceNumber, &invoice.Status, &invoice.CustomerName, &invoice.CustomerEmail, &invoice.CustomerAddress, &invoice.InvoiceDate, &invoice.DueDate, &invoice.Currency, &invoice.Subtotal, &invoice.TaxRate, &invoice.TaxAmount, &invoice.TotalAmount, &invoice.Notes, &invoice.PdfPath, &invoice.CreatedAt, &invoice.UpdatedAt); err != nil {
+		if err := scanInvoice(rows, &invoice); err != nil {
 			return nil, fmt.Errorf("failed to scan invoice: %v", err)
 		}
 		invoices = append(invoices, invoice)
@@ -154,6 +230,97 @@ func GetInvoicesByUserID(userID uuid.UUID) ([]models.Invoice, error) {
 	return invoices, nil
 }
 
+// InvoiceFilter selects invoices for FindInvoices. Zero fields don't
+// filter.
+type InvoiceFilter struct {
+	IDs           []uuid.UUID
+	Status        string
+	DocumentType  string
+	CustomerEmail string
+	// From and To bound the invoice date, inclusive.
+	From, To *time.Time
+}
+
+// FindInvoices retrieves a user's invoices matching filter, oldest first.
+func FindInvoices(userID uuid.UUID, filter InvoiceFilter) ([]models.Invoice, error) {
+	query := `SELECT ` + invoiceColumns + ` FROM invoices WHERE user_id = $1`
+	args := []interface{}{userID}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		query += fmt.Sprintf(" AND "+condition, len(args))
+	}
+	if len(filter.IDs) > 0 {
+		ids := make([]string, len(filter.IDs))
+		for i, id := range filter.IDs {
+			ids[i] = id.String()
+		}
+		where("id = ANY($%d::uuid[])", pq.Array(ids))
+	}
+	if filter.Status != "" {
+		where("status = $%d", filter.Status)
+	}
+	if filter.DocumentType != "" {
+		where("document_type = $%d", filter.DocumentType)
+	}
+	if filter.CustomerEmail != "" {
+		where("LOWER(customer_email) = LOWER($%d)", filter.CustomerEmail)
+	}
+	if filter.From != nil {
+		where("invoice_date >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		where("invoice_date <= $%d", *filter.To)
+	}
+	query += ` ORDER BY invoice_date, invoice_number`
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find invoices: %v", err)
+	}
+	defer rows.Close()
+
+	var invoices []models.Invoice
+	for rows.Next() {
+		var invoice models.Invoice
+		if err := scanInvoice(rows, &invoice); err != nil {
+			return nil, fmt.Errorf("failed to scan invoice: %v", err)
+		}
+		invoices = append(invoices, invoice)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find invoices: %v", err)
+	}
+
+	return invoices, nil
+}
+
+// MarkInvoiceDownloaded records that an invoice's PDF was downloaded and
+// reports whether this was the first download.
+func MarkInvoiceDownloaded(invoiceID uuid.UUID) (bool, error) {
+	result, err := DB.Exec(`UPDATE invoices SET downloaded_at = CURRENT_TIMESTAMP WHERE id = $1 AND downloaded_at IS NULL`, invoiceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark invoice downloaded: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	return n > 0, nil
+}
+
+// RecordInvoiceView counts a view of an invoice through a share link.
+func RecordInvoiceView(invoiceID uuid.UUID) error {
+	_, err := DB.Exec(`
+        UPDATE invoices
+        SET view_count = view_count + 1, first_viewed_at = COALESCE(first_viewed_at, CURRENT_TIMESTAMP)
+        WHERE id = $1
+    `, invoiceID)
+	if err != nil {
+		return fmt.Errorf("failed to record invoice view: %v", err)
+	}
+	return nil
+}
+
 // DeleteInvoice deletes an invoice by its ID.
 func DeleteInvoice(invoiceID uuid.UUID) error {
 	// First, delete all related invoice items
@@ -188,3 +355,32 @@ func DeleteInvoiceItems(invoiceID uuid.UUID) error {
 	}
 	return nil
 }
+
+// MarkOverdueInvoices moves sent invoices with an open balance that were due
+// before today to overdue, and overdue ones whose due date was moved to today
+// or later back to sent. It returns how many invoices changed each way.
+func MarkOverdueInvoices(today time.Time) (overdue, reopened int64, err error) {
+	result, err := DB.Exec(`
+        UPDATE invoices
+        SET status = 'overdue'
+        WHERE status = 'sent'
+          AND document_type = 'invoice'
+          AND amount_paid < total_amount
+          AND due_date < $1
+    `, today)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to mark overdue invoices: %v", err)
+	}
+	if overdue, err = result.RowsAffected(); err != nil {
+		return 0, 0, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+
+	result, err = DB.Exec(`UPDATE invoices SET status = 'sent' WHERE status = 'overdue' AND due_date >= $1`, today)
+	if err != nil {
+		return overdue, 0, fmt.Errorf("failed to reopen invoices: %v", err)
+	}
+	if reopened, err = result.RowsAffected(); err != nil {
+		return overdue, 0, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	return overdue, reopened, nil
+}
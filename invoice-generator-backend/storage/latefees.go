@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"invoice-generator-go/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrLateFeesChanged is returned when late payment charges were billed for
+// an invoice while another follow-up invoice was being created.
+var ErrLateFeesChanged = errors.New("late payment charges were billed in the meantime")
+
+// GetLateFeeRule retrieves a user's late fee rule. It returns sql.ErrNoRows
+// when the user has none.
+func GetLateFeeRule(userID uuid.UUID) (*models.LateFeeRule, error) {
+	var rule models.LateFeeRule
+	err := DB.QueryRow(`
+        SELECT fixed_fee, interest_type, annual_rate, margin, base_rate, grace_days, updated_at
+        FROM late_fee_rules
+        WHERE user_id = $1
+    `, userID).Scan(&rule.FixedFee, &rule.InterestType, &rule.AnnualRate, &rule.Margin, &rule.BaseRate, &rule.GraceDays, &rule.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// SetLateFeeRule creates or replaces a user's late fee rule.
+func SetLateFeeRule(userID uuid.UUID, rule *models.LateFeeRule) error {
+	err := DB.QueryRow(`
+        INSERT INTO late_fee_rules (user_id, fixed_fee, interest_type, annual_rate, margin, base_rate, grace_days)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        ON CONFLICT (user_id) DO UPDATE
+        SET fixed_fee = EXCLUDED.fixed_fee, interest_type = EXCLUDED.interest_type, annual_rate = EXCLUDED.annual_rate,
+            margin = EXCLUDED.margin, base_rate = EXCLUDED.base_rate, grace_days = EXCLUDED.grace_days
+        RETURNING updated_at
+    `, userID, rule.FixedFee, rule.InterestType, rule.AnnualRate, rule.Margin, rule.BaseRate, rule.GraceDays).Scan(&rule.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save late fee rule: %v", err)
+	}
+	return nil
+}
+
+// GetLateFeeCharges lists the late payment charges billed for an invoice on
+// follow-up invoices that weren't voided, oldest first.
+func GetLateFeeCharges(invoiceID uuid.UUID) ([]models.LateFeeCharge, error) {
+	rows, err := DB.Query(`
+        SELECT c.id, c.invoice_id, c.charge_invoice_id, c.interest_to, c.fixed_fee, c.interest, c.created_at
+        FROM late_fee_charges c
+        JOIN invoices i ON i.id = c.charge_invoice_id
+        WHERE c.invoice_id = $1 AND i.status <> 'void'
+        ORDER BY c.interest_to, c.created_at
+    `, invoiceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get late fee charges: %v", err)
+	}
+	defer rows.Close()
+
+	charges := []models.LateFeeCharge{}
+	for rows.Next() {
+		var ch models.LateFeeCharge
+		if err := rows.Scan(&ch.ID, &ch.InvoiceID, &ch.ChargeInvoiceID, &ch.InterestTo, &ch.FixedFee, &ch.Interest, &ch.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan late fee charge: %v", err)
+		}
+		charges = append(charges, ch)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate late fee charges: %v", err)
+	}
+	return charges, nil
+}
+
+// CreateLateFeeInvoice stores a follow-up invoice with its items and records
+// the charges it bills. chargedTo is the end of the interest already billed
+// when the charges were assessed; if other charges were recorded since, it
+// returns ErrLateFeesChanged and stores nothing. The follow-up invoice's
+// invoice.created webhook event is queued with it.
+func CreateLateFeeInvoice(invoice *models.Invoice, items []models.InvoiceItem, charge *models.LateFeeCharge, chargedTo *time.Time) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT 1 FROM invoices WHERE id = $1 FOR UPDATE`, charge.InvoiceID); err != nil {
+		return fmt.Errorf("failed to lock invoice: %v", err)
+	}
+	var latest *time.Time
+	err = tx.QueryRow(`
+        SELECT MAX(c.interest_to)
+        FROM late_fee_charges c
+        JOIN invoices i ON i.id = c.charge_invoice_id
+        WHERE c.invoice_id = $1 AND i.status <> 'void'
+    `, charge.InvoiceID).Scan(&latest)
+	if err != nil {
+		return fmt.Errorf("failed to get billed late fees: %v", err)
+	}
+	if (latest == nil) != (chargedTo == nil) || (latest != nil && !latest.Equal(*chargedTo)) {
+		return ErrLateFeesChanged
+	}
+
+	invoice.ID = uuid.New()
+	if _, err := tx.Exec(insertInvoiceQuery, insertInvoiceArgs(invoice)...); err != nil {
+		return fmt.Errorf("failed to insert invoice: %v", err)
+	}
+	for i := range items {
+		item := &items[i]
+		item.ID = uuid.New()
+		item.InvoiceID = invoice.ID
+		if _, err := tx.Exec(insertInvoiceItemQuery, item.ID, item.InvoiceID, item.Description, item.Quantity, item.UnitPrice, item.TotalPrice); err != nil {
+			return fmt.Errorf("failed to insert invoice item: %v", err)
+		}
+	}
+
+	charge.ID = uuid.New()
+	charge.ChargeInvoiceID = invoice.ID
+	err = tx.QueryRow(`
+        INSERT INTO late_fee_charges (id, invoice_id, charge_invoice_id, interest_to, fixed_fee, interest)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING created_at
+    `, charge.ID, charge.InvoiceID, charge.ChargeInvoiceID, charge.InterestTo, charge.FixedFee, charge.Interest).Scan(&charge.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert late fee charge: %v", err)
+	}
+	if err := enqueueInvoiceEvent(tx, "invoice.created", invoice.ID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	invoice.Items = items
+	return nil
+}
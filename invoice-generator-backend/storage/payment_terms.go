@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"invoice-generator-go/models"
+	"invoice-generator-go/paymentterms"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// DefaultSystemPaymentTermsKey names the system terms used when neither the
+// invoice, its customer nor the account picks any.
+const DefaultSystemPaymentTermsKey = "net_30"
+
+// ErrDuplicatePaymentTerms is returned when an account already has payment
+// terms of the same name.
+var ErrDuplicatePaymentTerms = errors.New("payment terms with this name already exist")
+
+const paymentTermsColumns = `id, user_id, name, due_days, end_of_month, discount_percent, discount_days, created_at, updated_at`
+
+func scanPaymentTerms(row interface{ Scan(...interface{}) error }, terms *models.PaymentTerms) error {
+	var owner uuid.NullUUID
+	err := row.Scan(&terms.ID, &owner, &terms.Name, &terms.DueDays, &terms.EndOfMonth, &terms.DiscountPercent, &terms.DiscountDays, &terms.CreatedAt, &terms.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	terms.UserID = owner.UUID
+	terms.IsSystem = !owner.Valid
+	return nil
+}
+
+// GetPaymentTermsByID retrieves payment terms by ID. It returns
+// sql.ErrNoRows when there are none.
+func GetPaymentTermsByID(id uuid.UUID) (*models.PaymentTerms, error) {
+	var terms models.PaymentTerms
+	err := scanPaymentTerms(DB.QueryRow(`SELECT `+paymentTermsColumns+` FROM payment_terms WHERE id = $1`, id), &terms)
+	if err != nil {
+		return nil, err
+	}
+	return &terms, nil
+}
+
+// GetPaymentTermsByUserID lists the payment terms available to a user: the
+// shared system terms followed by the user's own.
+func GetPaymentTermsByUserID(userID uuid.UUID) ([]models.PaymentTerms, error) {
+	rows, err := DB.Query(`
+        SELECT `+paymentTermsColumns+`
+        FROM payment_terms
+        WHERE user_id = $1 OR user_id IS NULL
+        ORDER BY user_id IS NULL DESC, due_days, name
+    `, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment terms: %v", err)
+	}
+	defer rows.Close()
+
+	list := []models.PaymentTerms{}
+	for rows.Next() {
+		var terms models.PaymentTerms
+		if err := scanPaymentTerms(rows, &terms); err != nil {
+			return nil, fmt.Errorf("failed to scan payment terms: %v", err)
+		}
+		list = append(list, terms)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate payment terms: %v", err)
+	}
+	return list, nil
+}
+
+// CreatePaymentTerms stores new payment terms for terms.UserID.
+func CreatePaymentTerms(terms *models.PaymentTerms) error {
+	terms.ID = uuid.New()
+	err := DB.QueryRow(`
+        INSERT INTO payment_terms (id, user_id, name, due_days, end_of_month, discount_percent, discount_days)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING created_at, updated_at
+    `, terms.ID, terms.UserID, terms.Name, terms.DueDays, terms.EndOfMonth, terms.DiscountPercent, terms.DiscountDays).Scan(&terms.CreatedAt, &terms.UpdatedAt)
+	if err != nil {
+		return paymentTermsError("create", err)
+	}
+	return nil
+}
+
+// UpdatePaymentTerms saves changes to an account's payment terms. Invoices
+// already issued under them keep their due date and discount.
+func UpdatePaymentTerms(terms *models.PaymentTerms) error {
+	err := DB.QueryRow(`
+        UPDATE payment_terms
+        SET name = $2, due_days = $3, end_of_month = $4, discount_percent = $5, discount_days = $6
+        WHERE id = $1 AND user_id IS NOT NULL
+        RETURNING updated_at
+    `, terms.ID, terms.Name, terms.DueDays, terms.EndOfMonth, terms.DiscountPercent, terms.DiscountDays).Scan(&terms.UpdatedAt)
+	if err != nil {
+		return paymentTermsError("update", err)
+	}
+	return nil
+}
+
+// DeletePaymentTerms deletes an account's payment terms. Customers assigned
+// to them fall back to the account default; invoices keep their name and
+// discount.
+func DeletePaymentTerms(id uuid.UUID) error {
+	_, err := DB.Exec(`DELETE FROM payment_terms WHERE id = $1 AND user_id IS NOT NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete payment terms: %v", err)
+	}
+	return nil
+}
+
+func paymentTermsError(action string, err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrDuplicatePaymentTerms
+	}
+	return fmt.Errorf("failed to %s payment terms: %v", action, err)
+}
+
+// ResolvePaymentTerms returns the terms a new invoice to a customer is
+// issued under when it names none, as chosen by paymentterms.Choose. It
+// returns nil when there are none, e.g. when the system default is missing.
+func ResolvePaymentTerms(userID uuid.UUID, customerEmail string) (*models.PaymentTerms, error) {
+	var customer, account, system uuid.NullUUID
+	err := DB.QueryRow(`
+        SELECT
+            (SELECT payment_terms_id FROM customer_payment_terms WHERE user_id = $1 AND customer_email = $2),
+            (SELECT default_payment_terms_id FROM users WHERE id = $1),
+            (SELECT id FROM payment_terms WHERE system_key = $3)
+    `, userID, strings.ToLower(strings.TrimSpace(customerEmail)), DefaultSystemPaymentTermsKey).Scan(&customer, &account, &system)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve payment terms: %v", err)
+	}
+
+	id := paymentterms.Choose(nullUUID(customer), nullUUID(account), nullUUID(system))
+	if id == nil {
+		return nil, nil
+	}
+	terms, err := GetPaymentTermsByID(*id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve payment terms: %v", err)
+	}
+	return terms, nil
+}
+
+func nullUUID(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+// GetDefaultPaymentTermsID returns the account's default payment terms, or
+// nil if none are set.
+func GetDefaultPaymentTermsID(userID uuid.UUID) (*uuid.UUID, error) {
+	var id uuid.NullUUID
+	err := DB.QueryRow(`SELECT default_payment_terms_id FROM users WHERE id = $1`, userID).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get default payment terms: %v", err)
+	}
+	if !id.Valid {
+		return nil, nil
+	}
+	return &id.UUID, nil
+}
+
+// SetDefaultPaymentTermsID sets the account's default payment terms; nil
+// clears them.
+func SetDefaultPaymentTermsID(userID uuid.UUID, termsID *uuid.UUID) error {
+	_, err := DB.Exec(`UPDATE users SET default_payment_terms_id = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, userID, termsID)
+	if err != nil {
+		return fmt.Errorf("failed to set default payment terms: %v", err)
+	}
+	return nil
+}
+
+// GetCustomerPaymentTerms lists the per-customer payment terms of a user.
+func GetCustomerPaymentTerms(userID uuid.UUID) ([]models.CustomerPaymentTerms, error) {
+	rows, err := DB.Query(`
+        SELECT id, user_id, customer_email, payment_terms_id, created_at, updated_at
+        FROM customer_payment_terms
+        WHERE user_id = $1
+        ORDER BY customer_email
+    `, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer payment terms: %v", err)
+	}
+	defer rows.Close()
+
+	assignments := []models.CustomerPaymentTerms{}
+	for rows.Next() {
+		var a models.CustomerPaymentTerms
+		if err := rows.Scan(&a.ID, &a.UserID, &a.CustomerEmail, &a.PaymentTermsID, &a.CreatedAt, &a.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan customer payment terms: %v", err)
+		}
+		assignments = append(assignments, a)
+	}
+
+	return assignments, rows.Err()
+}
+
+// SetCustomerPaymentTerms creates or replaces a customer's payment terms.
+func SetCustomerPaymentTerms(assignment *models.CustomerPaymentTerms) error {
+	assignment.CustomerEmail = strings.ToLower(strings.TrimSpace(assignment.CustomerEmail))
+	err := DB.QueryRow(`
+        INSERT INTO customer_payment_terms (id, user_id, customer_email, payment_terms_id)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (user_id, customer_email) DO UPDATE SET payment_terms_id = EXCLUDED.payment_terms_id
+        RETURNING id, created_at, updated_at
+    `, uuid.New(), assignment.UserID, assignment.CustomerEmail, assignment.PaymentTermsID).Scan(&assignment.ID, &assignment.CreatedAt, &assignment.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set customer payment terms: %v", err)
+	}
+	return nil
+}
+
+// DeleteCustomerPaymentTerms removes a customer's payment terms. It reports
+// whether an assignment existed.
+func DeleteCustomerPaymentTerms(userID uuid.UUID, customerEmail string) (bool, error) {
+	result, err := DB.Exec(`DELETE FROM customer_payment_terms WHERE user_id = $1 AND customer_email = $2`, userID, strings.ToLower(strings.TrimSpace(customerEmail)))
+	if err != nil {
+		return false, fmt.Errorf("failed to delete customer payment terms: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	return n > 0, nil
+}
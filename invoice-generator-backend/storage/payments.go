@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"invoice-generator-go/models"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotPayable is returned when a payment is recorded on a draft, a void
+// invoice or a credit note.
+var ErrNotPayable = errors.New("invoice does not take payments")
+
+const paymentColumns = `p.id, p.invoice_id, p.amount, p.paid_at, COALESCE(p.reference, ''), p.discount, COALESCE(p.provider, ''), COALESCE(p.provider_payment_id, ''), p.created_at`
+
+func scanPayment(row interface{ Scan(...interface{}) error }, p *models.Payment) error {
+	return row.Scan(&p.ID, &p.InvoiceID, &p.Amount, &p.PaidAt, &p.Reference, &p.Discount, &p.Provider, &p.ProviderPaymentID, &p.CreatedAt)
+}
+
+// RecordInvoicePayment stores a payment and adds it to the invoice's paid
+// amount. A payment made by the invoice's discount due date that settles
+// the open balance less the early payment discount is granted the discount,
+// recorded on the payment. An invoice paid in full becomes paid as of the
+// payment date, which queues its invoice.paid webhook event. The invoice row
+// is locked so concurrent payments cannot overpay it, and drafts, void
+// invoices and credit notes refuse payments with ErrNotPayable.
+func RecordInvoicePayment(payment *models.Payment) (*models.Invoice, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := recordInvoicePayment(tx, payment, false); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit invoice payment: %v", err)
+	}
+	return GetInvoiceByID(payment.InvoiceID)
+}
+
+// recordInvoicePayment does the work of RecordInvoicePayment within tx.
+// A payment the provider has already taken is recorded rather than refused:
+// above the open balance it overpays the invoice, and on an invoice that
+// doesn't take payments it leaves the status alone and queues no event.
+func recordInvoicePayment(tx *sql.Tx, payment *models.Payment, taken bool) error {
+	var total, paid, discountPercent float64
+	var discountDue *time.Time
+	var previousStatus, documentType string
+	err := tx.QueryRow(`SELECT total_amount, amount_paid, discount_percent, discount_due_date, status, document_type FROM invoices WHERE id = $1 FOR UPDATE`, payment.InvoiceID).Scan(&total, &paid, &discountPercent, &discountDue, &previousStatus, &documentType)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no invoice found with ID: %s", payment.InvoiceID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock invoice: %v", err)
+	}
+	payable := invoicePayable(previousStatus, documentType)
+	if !taken {
+		if !payable {
+			return ErrNotPayable
+		}
+		if payment.Amount > total-paid+0.005 {
+			return ErrOverpayment
+		}
+	}
+	if payable {
+		payment.Discount = earlyPaymentDiscount(total, total-paid, discountPercent, discountDue, payment)
+	}
+
+	payment.ID = uuid.New()
+	err = tx.QueryRow(`
+        INSERT INTO invoice_payments (id, invoice_id, amount, paid_at, reference, discount, provider, provider_payment_id, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), CURRENT_TIMESTAMP)
+        RETURNING created_at
+    `, payment.ID, payment.InvoiceID, payment.Amount, payment.PaidAt, payment.Reference, payment.Discount, payment.Provider, payment.ProviderPaymentID).Scan(&payment.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert invoice payment: %v", err)
+	}
+
+	status := paymentStatus(previousStatus, documentType, total, paid+payment.Amount+payment.Discount)
+	_, err = tx.Exec(`
+        UPDATE invoices
+        SET amount_paid = amount_paid + $2,
+            status = $3,
+            paid_at = CASE WHEN $4 THEN $5 ELSE paid_at END
+        WHERE id = $1
+    `, payment.InvoiceID, payment.Amount+payment.Discount, status, status == "paid", payment.PaidAt)
+	if err != nil {
+		return fmt.Errorf("failed to update invoice balance: %v", err)
+	}
+	if eventType := invoiceStatusEvent(previousStatus, status); eventType != "" {
+		return enqueueInvoiceEvent(tx, eventType, payment.InvoiceID)
+	}
+	return nil
+}
+
+// invoicePayable reports whether an invoice takes payments: drafts haven't
+// been issued, void invoices are cancelled and credit notes are owed by the
+// seller.
+func invoicePayable(status, documentType string) bool {
+	return status != "draft" && status != "void" && documentType != "credit_note"
+}
+
+// paymentStatus returns the status of an invoice once paid has been paid on
+// it: paid when that covers the total, unless it doesn't take payments.
+func paymentStatus(status, documentType string, total, paid float64) string {
+	if invoicePayable(status, documentType) && paid >= total {
+		return "paid"
+	}
+	return status
+}
+
+// GetInvoicePayments retrieves the payments recorded against an invoice,
+// oldest first.
+func GetInvoicePayments(invoiceID uuid.UUID) ([]models.Payment, error) {
+	return queryPayments(`
+        SELECT `+paymentColumns+`
+        FROM invoice_payments p
+        WHERE p.invoice_id = $1
+        ORDER BY p.paid_at, p.created_at
+    `, invoiceID)
+}
+
+// GetCustomerPayments retrieves the payments against a user's invoices to a
+// customer, matched by email without regard to case, oldest first.
+func GetCustomerPayments(userID uuid.UUID, customerEmail string) ([]models.Payment, error) {
+	return queryPayments(`
+        SELECT `+paymentColumns+`
+        FROM invoice_payments p
+        JOIN invoices i ON i.id = p.invoice_id
+        WHERE i.user_id = $1 AND LOWER(i.customer_email) = LOWER($2)
+        ORDER BY p.paid_at, p.created_at
+    `, userID, customerEmail)
+}
+
+func queryPayments(query string, args ...interface{}) ([]models.Payment, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invoice payments: %v", err)
+	}
+	defer rows.Close()
+
+	payments := []models.Payment{}
+	for rows.Next() {
+		var p models.Payment
+		if err := scanPayment(rows, &p); err != nil {
+			return nil, fmt.Errorf("failed to scan invoice payment: %v", err)
+		}
+		payments = append(payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate invoice payments: %v", err)
+	}
+	return payments, nil
+}
+
+// earlyPaymentDiscount returns the discount a payment earns: percent of the
+// invoice total when it is made by the discount due date and, with the
+// discount, settles the open balance. Dates are compared in UTC.
+func earlyPaymentDiscount(total, open, percent float64, discountDue *time.Time, payment *models.Payment) float64 {
+	if percent <= 0 || discountDue == nil {
+		return 0
+	}
+	y, m, d := discountDue.UTC().Date()
+	if !payment.PaidAt.UTC().Before(time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)) {
+		return 0
+	}
+	discount := math.Round(total*percent) / 100
+	remainder := math.Round((open-payment.Amount)*100) / 100
+	if remainder <= 0 || remainder > discount {
+		return 0
+	}
+	return remainder
+}
@@ -0,0 +1,31 @@
+package storage
+
+import "testing"
+
+func TestPaymentStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       string
+		documentType string
+		paid         float64
+		want         string
+	}{
+		{"partly paid", "sent", "invoice", 40, "sent"},
+		{"paid in full", "sent", "invoice", 100, "paid"},
+		{"overdue, overpaid", "overdue", "invoice", 120, "paid"},
+		{"webhook against a voided invoice", "void", "invoice", 100, "void"},
+		{"webhook against a draft", "draft", "invoice", 100, "draft"},
+		{"credit note", "sent", "credit_note", 100, "sent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := paymentStatus(tt.status, tt.documentType, 100, tt.paid)
+			if status != tt.want {
+				t.Errorf("paymentStatus = %q, want %q", status, tt.want)
+			}
+			if event := invoiceStatusEvent(tt.status, status); (event == "invoice.paid") != (tt.want == "paid") {
+				t.Errorf("event %q for status %q", event, status)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"invoice-generator-go/models"
+
+	"github.com/google/uuid"
+)
+
+const companyProfileColumns = `id, user_id, name, is_default, company_name, COALESCE(address_line, ''), COALESCE(postal_code, ''), COALESCE(city, ''), COALESCE(country_code, ''), COALESCE(email, ''), COALESCE(phone, ''), COALESCE(website, ''), COALESCE(tax_id, ''), COALESCE(bank_name, ''), COALESCE(iban, ''), COALESCE(bic, ''), COALESCE(legal_footer, ''), COALESCE(logo_key, ''), created_at, updated_at`
+
+func scanCompanyProfile(row interface{ Scan(...interface{}) error }, p *models.CompanyProfile) error {
+	err := row.Scan(&p.ID, &p.UserID, &p.Name, &p.IsDefault, &p.CompanyName, &p.AddressLine, &p.PostalCode, &p.City, &p.CountryCode, &p.Email, &p.Phone, &p.Website, &p.TaxID, &p.BankName, &p.IBAN, &p.BIC, &p.LegalFooter, &p.LogoKey, &p.CreatedAt, &p.UpdatedAt)
+	p.HasLogo = p.LogoKey != ""
+	return err
+}
+
+// CreateCompanyProfile inserts a new company profile. If it is marked as
+// default, any previous default of the user is cleared.
+func CreateCompanyProfile(profile *models.CompanyProfile) (string, error) {
+	profile.ID = uuid.New()
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if profile.IsDefault {
+		if _, err := tx.Exec(`UPDATE company_profiles SET is_default = FALSE WHERE user_id = $1 AND is_default`, profile.UserID); err != nil {
+			return "", fmt.Errorf("failed to clear default company profile: %v", err)
+		}
+	}
+
+	query := `
+        INSERT INTO company_profiles (id, user_id, name, is_default, company_name, address_line, postal_code, city, country_code, email, phone, website, tax_id, bank_name, iban, bic, legal_footer, logo_key, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+    `
+	_, err = tx.Exec(query, profile.ID, profile.UserID, profile.Name, profile.IsDefault, profile.CompanyName, profile.AddressLine, profile.PostalCode, profile.City, nullIfEmpty(profile.CountryCode), profile.Email, profile.Phone, profile.Website, profile.TaxID, profile.BankName, profile.IBAN, profile.BIC, profile.LegalFooter, nullIfEmpty(profile.LogoKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to insert company profile: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit company profile: %v", err)
+	}
+	return profile.ID.String(), nil
+}
+
+// GetCompanyProfileByID retrieves a company profile by its ID.
+func GetCompanyProfileByID(profileID uuid.UUID) (*models.CompanyProfile, error) {
+	var profile models.CompanyProfile
+	row := DB.QueryRow(`SELECT `+companyProfileColumns+` FROM company_profiles WHERE id = $1`, profileID)
+	if err := scanCompanyProfile(row, &profile); err != nil {
+		return nil, fmt.Errorf("failed to get company profile by ID: %v", err)
+	}
+	return &profile, nil
+}
+
+// GetCompanyProfilesByUserID retrieves all company profiles of a user, the
+// default first.
+func GetCompanyProfilesByUserID(userID uuid.UUID) ([]models.CompanyProfile, error) {
+	rows, err := DB.Query(`SELECT `+companyProfileColumns+` FROM company_profiles WHERE user_id = $1 ORDER BY is_default DESC, name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get company profiles by user ID: %v", err)
+	}
+	defer rows.Close()
+
+	var profiles []models.CompanyProfile
+	for rows.Next() {
+		var profile models.CompanyProfile
+		if err := scanCompanyProfile(rows, &profile); err != nil {
+			return nil, fmt.Errorf("failed to scan company profile: %v", err)
+		}
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, nil
+}
+
+// GetDefaultCompanyProfile returns the user's default company profile,
+// creating one from the account details if the user has none yet.
+func GetDefaultCompanyProfile(userID uuid.UUID) (*models.CompanyProfile, error) {
+	var profile models.CompanyProfile
+	row := DB.QueryRow(`SELECT `+companyProfileColumns+` FROM company_profiles WHERE user_id = $1 AND is_default`, userID)
+	err := scanCompanyProfile(row, &profile)
+	if err == nil {
+		return &profile, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get default company profile: %v", err)
+	}
+
+	user, err := GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	profile = models.CompanyProfile{
+		UserID:      userID,
+		Name:        "Default",
+		IsDefault:   true,
+		CompanyName: user.CompanyName,
+		Email:       user.Email,
+	}
+	if profile.CompanyName == "" {
+		profile.CompanyName = user.Email
+	}
+	if _, err := CreateCompanyProfile(&profile); err != nil {
+		return nil, err
+	}
+	return GetCompanyProfileByID(profile.ID)
+}
+
+// GetCompanyProfileForInvoice returns the sender profile of an invoice: the
+// one it names, or the user's default profile.
+func GetCompanyProfileForInvoice(invoice *models.Invoice) (*models.CompanyProfile, error) {
+	if invoice.CompanyProfileID != nil {
+		profile, err := GetCompanyProfileByID(*invoice.CompanyProfileID)
+		if err == nil && profile.UserID == invoice.UserID {
+			return profile, nil
+		}
+	}
+	return GetDefaultCompanyProfile(invoice.UserID)
+}
+
+// UpdateCompanyProfile updates an existing company profile. Making it the
+// default clears the flag on the user's other profiles.
+func UpdateCompanyProfile(profile *models.CompanyProfile) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if profile.IsDefault {
+		if _, err := tx.Exec(`UPDATE company_profiles SET is_default = FALSE WHERE user_id = $1 AND id <> $2 AND is_default`, profile.UserID, profile.ID); err != nil {
+			return fmt.Errorf("failed to clear default company profile: %v", err)
+		}
+	}
+
+	query := `
+        UPDATE company_profiles
+        SET
+            name = $2,
+            is_default = $3,
+            company_name = $4,
+            address_line = $5,
+            postal_code = $6,
+            city = $7,
+            country_code = $8,
+            email = $9,
+            phone = $10,
+            website = $11,
+            tax_id = $12,
+            bank_name = $13,
+            iban = $14,
+            bic = $15,
+            legal_footer = $16,
+            logo_key = $17
+        WHERE id = $1
+    `
+	result, err := tx.Exec(query, profile.ID, profile.Name, profile.IsDefault, profile.CompanyName, profile.AddressLine, profile.PostalCode, profile.City, nullIfEmpty(profile.CountryCode), profile.Email, profile.Phone, profile.Website, profile.TaxID, profile.BankName, profile.IBAN, profile.BIC, profile.LegalFooter, nullIfEmpty(profile.LogoKey))
+	if err != nil {
+		return fmt.Errorf("failed to update company profile: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no company profile found with ID: %s", profile.ID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit company profile: %v", err)
+	}
+	return nil
+}
+
+// DeleteCompanyProfile deletes a company profile. Invoices that used it fall
+// back to the default profile.
+func DeleteCompanyProfile(profileID uuid.UUID) error {
+	result, err := DB.Exec("DELETE FROM company_profiles WHERE id = $1", profileID)
+	if err != nil {
+		return fmt.Errorf("failed to delete company profile: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("no company profile found with ID: %s", profileID)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"invoice-generator-go/models"
+
+	"github.com/google/uuid"
+)
+
+const shareLinkColumns = `id, user_id, invoice_id, COALESCE(customer_email, ''), expires_at, revoked_at, last_used_at, created_at`
+
+func scanShareLink(row interface{ Scan(...interface{}) error }, link *models.ShareLink) error {
+	return row.Scan(&link.ID, &link.UserID, &link.InvoiceID, &link.CustomerEmail, &link.ExpiresAt, &link.RevokedAt, &link.LastUsedAt, &link.CreatedAt)
+}
+
+// CreateShareLink stores a new share link under the hash of its token.
+func CreateShareLink(link *models.ShareLink, tokenHash string) error {
+	link.ID = uuid.New()
+	link.CustomerEmail = strings.ToLower(strings.TrimSpace(link.CustomerEmail))
+	err := DB.QueryRow(`
+        INSERT INTO share_links (id, user_id, invoice_id, customer_email, token_hash, expires_at)
+        VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)
+        RETURNING created_at
+    `, link.ID, link.UserID, link.InvoiceID, link.CustomerEmail, tokenHash, link.ExpiresAt).Scan(&link.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create share link: %v", err)
+	}
+	return nil
+}
+
+// GetShareLinkByID retrieves a share link by ID. It returns sql.ErrNoRows
+// when there is none.
+func GetShareLinkByID(id uuid.UUID) (*models.ShareLink, error) {
+	var link models.ShareLink
+	if err := scanShareLink(DB.QueryRow(`SELECT `+shareLinkColumns+` FROM share_links WHERE id = $1`, id), &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// GetShareLinkByTokenHash retrieves the share link of a token, whether or
+// not it is still valid. It returns sql.ErrNoRows when there is none.
+func GetShareLinkByTokenHash(tokenHash string) (*models.ShareLink, error) {
+	var link models.ShareLink
+	if err := scanShareLink(DB.QueryRow(`SELECT `+shareLinkColumns+` FROM share_links WHERE token_hash = $1`, tokenHash), &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// GetInvoiceShareLinks lists the share links of an invoice, newest first.
+func GetInvoiceShareLinks(invoiceID uuid.UUID) ([]models.ShareLink, error) {
+	return findShareLinks(`WHERE invoice_id = $1`, invoiceID)
+}
+
+// GetCustomerShareLinks lists a user's share links for a customer, newest
+// first.
+func GetCustomerShareLinks(userID uuid.UUID, customerEmail string) ([]models.ShareLink, error) {
+	return findShareLinks(`WHERE user_id = $1 AND customer_email = $2`, userID, strings.ToLower(strings.TrimSpace(customerEmail)))
+}
+
+func findShareLinks(where string, args ...interface{}) ([]models.ShareLink, error) {
+	rows, err := DB.Query(`SELECT `+shareLinkColumns+` FROM share_links `+where+` ORDER BY created_at DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share links: %v", err)
+	}
+	defer rows.Close()
+
+	links := []models.ShareLink{}
+	for rows.Next() {
+		var link models.ShareLink
+		if err := scanShareLink(rows, &link); err != nil {
+			return nil, fmt.Errorf("failed to scan share link: %v", err)
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate share links: %v", err)
+	}
+	return links, nil
+}
+
+// RevokeShareLink ends a share link. Revoking it again keeps the original
+// time.
+func RevokeShareLink(link *models.ShareLink) error {
+	err := DB.QueryRow(`
+        UPDATE share_links
+        SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP)
+        WHERE id = $1
+        RETURNING revoked_at
+    `, link.ID).Scan(&link.RevokedAt)
+	if err != nil {
+		return fmt.Errorf("failed to revoke share link: %v", err)
+	}
+	return nil
+}
+
+// TouchShareLink records that a share link was used.
+func TouchShareLink(id uuid.UUID) error {
+	_, err := DB.Exec(`UPDATE share_links SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to update share link: %v", err)
+	}
+	return nil
+}
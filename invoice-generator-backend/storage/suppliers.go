@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"invoice-generator-go/models"
+
+	"github.com/google/uuid"
+)
+
+// FindOrCreateSupplier looks up a user's supplier by VAT ID, falling back to
+// a case-insensitive name match, and inserts it if none exists. On return
+// supplier.ID identifies the stored record.
+func FindOrCreateSupplier(supplier *models.Supplier) error {
+	var id uuid.UUID
+	var err error
+	if supplier.VATID != "" {
+		err = DB.QueryRow(`SELECT id FROM suppliers WHERE user_id = $1 AND vat_id = $2 LIMIT 1`, supplier.UserID, supplier.VATID).Scan(&id)
+	} else {
+		err = DB.QueryRow(`SELECT id FROM suppliers WHERE user_id = $1 AND LOWER(name) = LOWER($2) LIMIT 1`, supplier.UserID, supplier.Name).Scan(&id)
+	}
+	if err == nil {
+		supplier.ID = id
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to look up supplier: %v", err)
+	}
+
+	supplier.ID = uuid.New()
+	query := `
+        INSERT INTO suppliers (id, user_id, name, email, address, city, postal_code, country_code, vat_id, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+    `
+	_, err = DB.Exec(query, supplier.ID, supplier.UserID, supplier.Name, supplier.Email, supplier.Address, supplier.City, supplier.PostalCode, nullIfEmpty(supplier.CountryCode), supplier.VATID)
+	if err != nil {
+		return fmt.Errorf("failed to insert supplier: %v", err)
+	}
+	return nil
+}
+
+// GetSupplierByID retrieves a supplier by its ID.
+func GetSupplierByID(supplierID uuid.UUID) (*models.Supplier, error) {
+	var s models.Supplier
+	query := `
+        SELECT id, user_id, name, COALESCE(email, ''), COALESCE(address, ''), COALESCE(city, ''), COALESCE(postal_code, ''), COALESCE(country_code, ''), COALESCE(vat_id, ''), created_at, updated_at
+        FROM suppliers
+        WHERE id = $1
+    `
+	err := DB.QueryRow(query, supplierID).Scan(&s.ID, &s.UserID, &s.Name, &s.Email, &s.Address, &s.City, &s.PostalCode, &s.CountryCode, &s.VATID, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get supplier by ID: %v", err)
+	}
+	return &s, nil
+}
+
+// GetSuppliersByUserID retrieves all suppliers for a given user ID.
+func GetSuppliersByUserID(userID uuid.UUID) ([]models.Supplier, error) {
+	query := `
+        SELECT id, user_id, name, COALESCE(email, ''), COALESCE(address, ''), COALESCE(city, ''), COALESCE(postal_code, ''), COALESCE(country_code, ''), COALESCE(vat_id, ''), created_at, updated_at
+        FROM suppliers
+        WHERE user_id = $1
+        ORDER BY name
+    `
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get suppliers by user ID: %v", err)
+	}
+	defer rows.Close()
+
+	var suppliers []models.Supplier
+	for rows.Next() {
+		var s models.Supplier
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Name, &s.Email, &s.Address, &s.City, &s.PostalCode, &s.CountryCode, &s.VATID, &s.CreatedAt, &s.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan supplier: %v", err)
+		}
+		suppliers = append(suppliers, s)
+	}
+
+	return suppliers, nil
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
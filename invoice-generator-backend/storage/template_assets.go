@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"invoice-generator-go/models"
+
+	"github.com/google/uuid"
+)
+
+const templateAssetColumns = `id, template_id, name, content_type, size, blob_key, created_at, updated_at`
+
+func scanTemplateAsset(row interface{ Scan(...interface{}) error }, asset *models.TemplateAsset) error {
+	return row.Scan(&asset.ID, &asset.TemplateID, &asset.Name, &asset.ContentType, &asset.Size, &asset.BlobKey, &asset.CreatedAt, &asset.UpdatedAt)
+}
+
+// SaveTemplateAsset stores an asset's metadata, replacing an existing asset
+// of the same name on the template. It returns the blob key the replaced
+// asset used, or "" when the name was new.
+func SaveTemplateAsset(asset *models.TemplateAsset) (string, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var previous string
+	err = tx.QueryRow(`SELECT blob_key FROM template_assets WHERE template_id = $1 AND name = $2 FOR UPDATE`, asset.TemplateID, asset.Name).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("failed to look up template asset: %v", err)
+	}
+
+	query := `
+        INSERT INTO template_assets (id, template_id, name, content_type, size, blob_key)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (template_id, name) DO UPDATE
+        SET content_type = EXCLUDED.content_type, size = EXCLUDED.size, blob_key = EXCLUDED.blob_key
+        RETURNING ` + templateAssetColumns
+
+	err = scanTemplateAsset(tx.QueryRow(query, uuid.New(), asset.TemplateID, asset.Name, asset.ContentType, asset.Size, asset.BlobKey), asset)
+	if err != nil {
+		return "", fmt.Errorf("failed to save template asset: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit template asset: %v", err)
+	}
+	if previous == asset.BlobKey {
+		previous = ""
+	}
+	return previous, nil
+}
+
+// GetTemplateAssets lists a template's assets ordered by name.
+func GetTemplateAssets(templateID uuid.UUID) ([]models.TemplateAsset, error) {
+	query := `
+        SELECT ` + templateAssetColumns + `
+        FROM template_assets
+        WHERE template_id = $1
+        ORDER BY name
+    `
+	rows, err := DB.Query(query, templateID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template assets: %v", err)
+	}
+	defer rows.Close()
+
+	assets := []models.TemplateAsset{}
+	for rows.Next() {
+		var asset models.TemplateAsset
+		if err := scanTemplateAsset(rows, &asset); err != nil {
+			return nil, fmt.Errorf("failed to scan template asset: %v", err)
+		}
+		assets = append(assets, asset)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate template assets: %v", err)
+	}
+	return assets, nil
+}
+
+// GetTemplateAsset retrieves a template's asset by name. It returns
+// sql.ErrNoRows, unwrapped, when there is no such asset.
+func GetTemplateAsset(templateID uuid.UUID, name string) (*models.TemplateAsset, error) {
+	query := `
+        SELECT ` + templateAssetColumns + `
+        FROM template_assets
+        WHERE template_id = $1 AND name = $2
+    `
+	var asset models.TemplateAsset
+	if err := scanTemplateAsset(DB.QueryRow(query, templateID, name), &asset); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// DeleteTemplateAsset removes a template's asset by name and returns the
+// deleted row so the caller can remove its blob. It returns sql.ErrNoRows,
+// unwrapped, when there is no such asset.
+func DeleteTemplateAsset(templateID uuid.UUID, name string) (*models.TemplateAsset, error) {
+	query := `
+        DELETE FROM template_assets
+        WHERE template_id = $1 AND name = $2
+        RETURNING ` + templateAssetColumns
+	var asset models.TemplateAsset
+	if err := scanTemplateAsset(DB.QueryRow(query, templateID, name), &asset); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"invoice-generator-go/models"
+
+	"github.com/google/uuid"
+)
+
+// DefaultSystemTemplateKey names the bundled template used when neither the
+// invoice, its customer nor the account picks one.
+const DefaultSystemTemplateKey = "basic"
+
+// ResolveTemplateID returns the template an invoice renders with: its own
+// template, else the customer's default, else the account's default, else
+// the system default.
+func ResolveTemplateID(invoice *models.Invoice) (uuid.UUID, error) {
+	if invoice.TemplateID != nil {
+		return *invoice.TemplateID, nil
+	}
+
+	query := `
+        SELECT COALESCE(
+            (SELECT template_id FROM customer_templates WHERE user_id = $1 AND customer_email = $2),
+            (SELECT default_template_id FROM users WHERE id = $1),
+            (SELECT id FROM templates WHERE system_key = $3),
+            (SELECT id FROM templates WHERE user_id IS NULL ORDER BY created_at LIMIT 1)
+        )
+    `
+	var id uuid.NullUUID
+	err := DB.QueryRow(query, invoice.UserID, strings.ToLower(strings.TrimSpace(invoice.CustomerEmail)), DefaultSystemTemplateKey).Scan(&id)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to resolve template: %v", err)
+	}
+	if !id.Valid {
+		return uuid.Nil, fmt.Errorf("no template available for invoice %s", invoice.ID)
+	}
+
+	return id.UUID, nil
+}
+
+// GetDefaultTemplateID returns the account's default template, or nil if
+// none is set.
+func GetDefaultTemplateID(userID uuid.UUID) (*uuid.UUID, error) {
+	var id uuid.NullUUID
+	err := DB.QueryRow(`SELECT default_template_id FROM users WHERE id = $1`, userID).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get default template: %v", err)
+	}
+	if !id.Valid {
+		return nil, nil
+	}
+	return &id.UUID, nil
+}
+
+// SetDefaultTemplateID sets the account's default template; nil clears it.
+func SetDefaultTemplateID(userID uuid.UUID, templateID *uuid.UUID) error {
+	_, err := DB.Exec(`UPDATE users SET default_template_id = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, userID, templateID)
+	if err != nil {
+		return fmt.Errorf("failed to set default template: %v", err)
+	}
+	return nil
+}
+
+// GetSystemDefaultTemplateID returns the template used when nothing else is
+// configured.
+func GetSystemDefaultTemplateID() (*uuid.UUID, error) {
+	var id uuid.UUID
+	err := DB.QueryRow(`
+        SELECT id FROM templates
+        WHERE user_id IS NULL
+        ORDER BY system_key = $1 DESC, created_at
+        LIMIT 1
+    `, DefaultSystemTemplateKey).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get system default template: %v", err)
+	}
+	return &id, nil
+}
+
+// GetCustomerTemplates lists the per-customer default templates of a user.
+func GetCustomerTemplates(userID uuid.UUID) ([]models.CustomerTemplate, error) {
+	rows, err := DB.Query(`
+        SELECT id, user_id, customer_email, template_id, created_at, updated_at
+        FROM customer_templates
+        WHERE user_id = $1
+        ORDER BY customer_email
+    `, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer templates: %v", err)
+	}
+	defer rows.Close()
+
+	assignments := []models.CustomerTemplate{}
+	for rows.Next() {
+		var a models.CustomerTemplate
+		if err := rows.Scan(&a.ID, &a.UserID, &a.CustomerEmail, &a.TemplateID, &a.CreatedAt, &a.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan customer template: %v", err)
+		}
+		assignments = append(assignments, a)
+	}
+
+	return assignments, rows.Err()
+}
+
+// SetCustomerTemplate creates or replaces a customer's default template.
+func SetCustomerTemplate(assignment *models.CustomerTemplate) error {
+	assignment.CustomerEmail = strings.ToLower(strings.TrimSpace(assignment.CustomerEmail))
+	err := DB.QueryRow(`
+        INSERT INTO customer_templates (id, user_id, customer_email, template_id)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (user_id, customer_email) DO UPDATE SET template_id = EXCLUDED.template_id
+        RETURNING id, created_at, updated_at
+    `, uuid.New(), assignment.UserID, assignment.CustomerEmail, assignment.TemplateID).Scan(&assignment.ID, &assignment.CreatedAt, &assignment.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set customer template: %v", err)
+	}
+	return nil
+}
+
+// DeleteCustomerTemplate removes a customer's default template. It reports
+// whether an assignment existed.
+func DeleteCustomerTemplate(userID uuid.UUID, customerEmail string) (bool, error) {
+	result, err := DB.Exec(`DELETE FROM customer_templates WHERE user_id = $1 AND customer_email = $2`, userID, strings.ToLower(strings.TrimSpace(customerEmail)))
+	if err != nil {
+		return false, fmt.Errorf("failed to delete customer template: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	return n > 0, nil
+}
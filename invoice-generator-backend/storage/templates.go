@@ -1,27 +1,64 @@
 package storage
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"invoice-generator-go/models"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-// CreateTemplate inserts a new template into the database.
+// ErrTemplateInUse is returned by DeleteTemplate when issued (non-draft)
+// invoices still render with the template.
+var ErrTemplateInUse = errors.New("template is used by issued invoices")
+
+const templateColumns = `id, user_id, name, COALESCE(language, ''), background_url, logo_url, content, watermarks, current_version, created_at, updated_at`
+
+func scanTemplate(row interface{ Scan(...interface{}) error }, template *models.Template) error {
+	var owner uuid.NullUUID
+	err := row.Scan(&template.ID, &owner, &template.Name, &template.Language, &template.BackgroundURL, &template.LogoURL, &template.Content, pq.Array(&template.Watermarks), &template.CurrentVersion, &template.CreatedAt, &template.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	template.UserID = owner.UUID
+	template.IsSystem = !owner.Valid
+	return nil
+}
+
+// CreateTemplate inserts a new template into the database and records its
+// content as version 1.
 func CreateTemplate(template *models.Template) (string, error) {
 	template.ID = uuid.New()
+	template.CurrentVersion = 1
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
 	query := `
-        INSERT INTO templates (id, user_id, name, language, background_url, logo_url, content, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        INSERT INTO templates (id, user_id, name, language, background_url, logo_url, content, watermarks, current_version, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
         RETURNING id
     `
 
 	var id uuid.UUID
-	err := DB.QueryRow(query, template.ID, template.UserID, template.Name, template.Language, template.BackgroundURL, template.LogoURL, template.Content, template.CreatedAt, template.UpdatedAt).Scan(&id)
+	err = tx.QueryRow(query, template.ID, template.UserID, template.Name, template.Language, template.BackgroundURL, template.LogoURL, template.Content, pq.Array(template.Watermarks), template.CurrentVersion, template.CreatedAt, template.UpdatedAt).Scan(&id)
 	if err != nil {
 		return "", fmt.Errorf("failed to insert template: %v", err)
 	}
 
+	if err := insertTemplateVersion(tx, template); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit template: %v", err)
+	}
+
 	return id.String(), nil
 }
 
@@ -29,11 +66,11 @@ func CreateTemplate(template *models.Template) (string, error) {
 func GetTemplateByID(templateID uuid.UUID) (*models.Template, error) {
 	var template models.Template
 	query := `
-        SELECT id, user_id, name, language, background_url, logo_url, content, created_at, updated_at
+        SELECT ` + templateColumns + `
         FROM templates
         WHERE id = $1
     `
-	err := DB.QueryRow(query, templateID).Scan(&template.ID, &template.UserID, &template.Name, &template.Language, &template.BackgroundURL, &template.LogoURL, &template.Content, &template.CreatedAt, &template.UpdatedAt)
+	err := scanTemplate(DB.QueryRow(query, templateID), &template)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get template by ID: %v", err)
 	}
@@ -41,13 +78,15 @@ func GetTemplateByID(templateID uuid.UUID) (*models.Template, error) {
 	return &template, nil
 }
 
-// GetTemplatesByUserID retrieves templates by their user ID from the database.
+// GetTemplatesByUserID retrieves the templates available to a user: the
+// shared system templates followed by the user's own.
 func GetTemplatesByUserID(userID uuid.UUID) ([]models.Template, error) {
 	var templates []models.Template
 	query := `
-        SELECT id, user_id, name, language, background_url, logo_url, content, created_at, updated_at
+        SELECT ` + templateColumns + `
         FROM templates
-        WHERE user_id = $1
+        WHERE user_id = $1 OR user_id IS NULL
+        ORDER BY user_id IS NULL DESC, created_at
     `
 	rows, err := DB.Query(query, userID)
 	if err != nil {
@@ -57,7 +96,7 @@ func GetTemplatesByUserID(userID uuid.UUID) ([]models.Template, error) {
 
 	for rows.Next() {
 		var template models.Template
-		if err := rows.Scan(&template.ID, &template.UserID, &template.Name, &template.Language, &template.BackgroundURL, &template.LogoURL, &template.Content, &template.CreatedAt, &template.UpdatedAt); err != nil {
+		if err := scanTemplate(rows, &template); err != nil {
 			return nil, fmt.Errorf("failed to scan template: %v", err)
 		}
 		templates = append(templates, template)
@@ -65,3 +104,203 @@ func GetTemplatesByUserID(userID uuid.UUID) ([]models.Template, error) {
 
 	return templates, nil
 }
+
+// UpdateTemplate saves a template's name, language, URLs, watermarks and
+// content. If the content or language changed, a new version is recorded
+// and template.CurrentVersion is advanced.
+func UpdateTemplate(template *models.Template) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var content, language string
+	var version int
+	err = tx.QueryRow(`SELECT content, COALESCE(language, ''), current_version FROM templates WHERE id = $1 FOR UPDATE`, template.ID).Scan(&content, &language, &version)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no template found with ID: %s", template.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock template: %v", err)
+	}
+
+	template.CurrentVersion = version
+	if content != template.Content || language != template.Language {
+		template.CurrentVersion = version + 1
+		if err := insertTemplateVersion(tx, template); err != nil {
+			return err
+		}
+	}
+
+	query := `
+        UPDATE templates
+        SET name = $2, language = $3, background_url = $4, logo_url = $5, content = $6, watermarks = $7, current_version = $8
+        WHERE id = $1
+    `
+	_, err = tx.Exec(query, template.ID, template.Name, template.Language, template.BackgroundURL, template.LogoURL, template.Content, pq.Array(template.Watermarks), template.CurrentVersion)
+	if err != nil {
+		return fmt.Errorf("failed to update template: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit template: %v", err)
+	}
+	return nil
+}
+
+// DeleteTemplate deletes a template and its version history. Draft invoices
+// using it fall back to no template; it returns ErrTemplateInUse if any
+// issued invoice references it.
+func DeleteTemplate(templateID uuid.UUID) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the template so no invoice can be issued with it meanwhile.
+	var id uuid.UUID
+	err = tx.QueryRow(`SELECT id FROM templates WHERE id = $1 FOR UPDATE`, templateID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no template found with ID: %s", templateID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock template: %v", err)
+	}
+
+	var inUse bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM invoices WHERE template_id = $1 AND status <> 'draft')`, templateID).Scan(&inUse)
+	if err != nil {
+		return fmt.Errorf("failed to check template usage: %v", err)
+	}
+	if inUse {
+		return ErrTemplateInUse
+	}
+
+	if _, err := tx.Exec(`DELETE FROM templates WHERE id = $1`, templateID); err != nil {
+		return fmt.Errorf("failed to delete template: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit template deletion: %v", err)
+	}
+	return nil
+}
+
+// SyncSystemTemplate creates or refreshes the system template with the given
+// key. Changed content is recorded as a new version, so invoices issued with
+// an older bundled version keep rendering as they did.
+func SyncSystemTemplate(key, name, language, content string) error {
+	var id uuid.UUID
+	err := DB.QueryRow(`SELECT id FROM templates WHERE system_key = $1`, key).Scan(&id)
+	if err == sql.ErrNoRows {
+		return createSystemTemplate(key, name, language, content)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up system template %s: %v", key, err)
+	}
+
+	template, err := GetTemplateByID(id)
+	if err != nil {
+		return err
+	}
+	if template.Name == name && template.Language == language && template.Content == content {
+		return nil
+	}
+	template.Name = name
+	template.Language = language
+	template.Content = content
+	return UpdateTemplate(template)
+}
+
+func createSystemTemplate(key, name, language, content string) error {
+	template := &models.Template{
+		ID:             uuid.New(),
+		IsSystem:       true,
+		Name:           name,
+		Language:       language,
+		Content:        content,
+		CurrentVersion: 1,
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+        INSERT INTO templates (id, user_id, system_key, name, language, content, current_version)
+        VALUES ($1, NULL, $2, $3, $4, $5, $6)
+        ON CONFLICT (system_key) DO NOTHING
+    `, template.ID, key, template.Name, template.Language, template.Content, template.CurrentVersion)
+	if err != nil {
+		return fmt.Errorf("failed to insert system template %s: %v", key, err)
+	}
+	// Another instance starting up at the same time got there first.
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return nil
+	}
+	if err := insertTemplateVersion(tx, template); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit system template %s: %v", key, err)
+	}
+	return nil
+}
+
+// GetTemplateVersions lists a template's versions, newest first, without
+// their content.
+func GetTemplateVersions(templateID uuid.UUID) ([]models.TemplateVersion, error) {
+	rows, err := DB.Query(`
+        SELECT id, template_id, version, COALESCE(language, ''), created_at
+        FROM template_versions
+        WHERE template_id = $1
+        ORDER BY version DESC
+    `, templateID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template versions: %v", err)
+	}
+	defer rows.Close()
+
+	versions := []models.TemplateVersion{}
+	for rows.Next() {
+		var v models.TemplateVersion
+		if err := rows.Scan(&v.ID, &v.TemplateID, &v.Version, &v.Language, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan template version: %v", err)
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+// GetTemplateVersion retrieves one version of a template, including its
+// content.
+func GetTemplateVersion(templateID uuid.UUID, version int) (*models.TemplateVersion, error) {
+	var v models.TemplateVersion
+	err := DB.QueryRow(`
+        SELECT id, template_id, version, COALESCE(language, ''), content, created_at
+        FROM template_versions
+        WHERE template_id = $1 AND version = $2
+    `, templateID, version).Scan(&v.ID, &v.TemplateID, &v.Version, &v.Language, &v.Content, &v.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template version: %v", err)
+	}
+
+	return &v, nil
+}
+
+func insertTemplateVersion(tx *sql.Tx, template *models.Template) error {
+	_, err := tx.Exec(`
+        INSERT INTO template_versions (id, template_id, version, language, content)
+        VALUES ($1, $2, $3, $4, $5)
+    `, uuid.New(), template.ID, template.CurrentVersion, template.Language, template.Content)
+	if err != nil {
+		return fmt.Errorf("failed to insert template version: %v", err)
+	}
+	return nil
+}
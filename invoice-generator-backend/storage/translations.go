@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"invoice-generator-go/models"
+
+	"github.com/google/uuid"
+)
+
+// GetTranslations returns a user's custom translations for the given
+// locales, keyed by locale and then translation key.
+func GetTranslations(userID uuid.UUID, locales ...string) (map[string]map[string]string, error) {
+	query := `SELECT locale, key, value FROM translations WHERE user_id = $1`
+	args := []interface{}{userID}
+	if len(locales) > 0 {
+		placeholders := make([]string, len(locales))
+		for i, locale := range locales {
+			placeholders[i] = fmt.Sprintf("$%d", i+2)
+			args = append(args, locale)
+		}
+		query += ` AND locale IN (` + strings.Join(placeholders, ", ") + `)`
+	}
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get translations: %v", err)
+	}
+	defer rows.Close()
+
+	catalogs := map[string]map[string]string{}
+	for rows.Next() {
+		var locale, key, value string
+		if err := rows.Scan(&locale, &key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan translation: %v", err)
+		}
+		if catalogs[locale] == nil {
+			catalogs[locale] = map[string]string{}
+		}
+		catalogs[locale][key] = value
+	}
+
+	return catalogs, rows.Err()
+}
+
+// SetTranslations stores a user's custom translations for one locale. An
+// empty value removes the custom translation for that key.
+func SetTranslations(userID uuid.UUID, locale string, translations map[string]string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for key, value := range translations {
+		if value == "" {
+			_, err = tx.Exec(`DELETE FROM translations WHERE user_id = $1 AND locale = $2 AND key = $3`, userID, locale, key)
+		} else {
+			_, err = tx.Exec(`
+                INSERT INTO translations (id, user_id, locale, key, value)
+                VALUES ($1, $2, $3, $4, $5)
+                ON CONFLICT (user_id, locale, key) DO UPDATE SET value = EXCLUDED.value
+            `, uuid.New(), userID, locale, key, value)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set translation %q: %v", key, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit translations: %v", err)
+	}
+	return nil
+}
+
+// DeleteTranslations removes all of a user's custom translations for a
+// locale and returns how many there were.
+func DeleteTranslations(userID uuid.UUID, locale string) (int64, error) {
+	result, err := DB.Exec(`DELETE FROM translations WHERE user_id = $1 AND locale = $2`, userID, locale)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete translations: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	return n, nil
+}
+
+// GetCustomerLanguage returns the language set for a customer, or "" when
+// none is.
+func GetCustomerLanguage(userID uuid.UUID, customerEmail string) (string, error) {
+	email := strings.ToLower(strings.TrimSpace(customerEmail))
+	if email == "" {
+		return "", nil
+	}
+	var language string
+	err := DB.QueryRow(`SELECT language FROM customer_languages WHERE user_id = $1 AND customer_email = $2`, userID, email).Scan(&language)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get customer language: %v", err)
+	}
+	return language, nil
+}
+
+// GetCustomerLanguages lists the per-customer languages of a user.
+func GetCustomerLanguages(userID uuid.UUID) ([]models.CustomerLanguage, error) {
+	rows, err := DB.Query(`
+        SELECT id, user_id, customer_email, language, created_at, updated_at
+        FROM customer_languages
+        WHERE user_id = $1
+        ORDER BY customer_email
+    `, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer languages: %v", err)
+	}
+	defer rows.Close()
+
+	languages := []models.CustomerLanguage{}
+	for rows.Next() {
+		var l models.CustomerLanguage
+		if err := rows.Scan(&l.ID, &l.UserID, &l.CustomerEmail, &l.Language, &l.CreatedAt, &l.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan customer language: %v", err)
+		}
+		languages = append(languages, l)
+	}
+
+	return languages, rows.Err()
+}
+
+// SetCustomerLanguage creates or replaces a customer's language.
+func SetCustomerLanguage(l *models.CustomerLanguage) error {
+	l.CustomerEmail = strings.ToLower(strings.TrimSpace(l.CustomerEmail))
+	err := DB.QueryRow(`
+        INSERT INTO customer_languages (id, user_id, customer_email, language)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (user_id, customer_email) DO UPDATE SET language = EXCLUDED.language
+        RETURNING id, created_at, updated_at
+    `, uuid.New(), l.UserID, l.CustomerEmail, l.Language).Scan(&l.ID, &l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set customer language: %v", err)
+	}
+	return nil
+}
+
+// DeleteCustomerLanguage removes a customer's language. It reports whether
+// one was set.
+func DeleteCustomerLanguage(userID uuid.UUID, customerEmail string) (bool, error) {
+	result, err := DB.Exec(`DELETE FROM customer_languages WHERE user_id = $1 AND customer_email = $2`, userID, strings.ToLower(strings.TrimSpace(customerEmail)))
+	if err != nil {
+		return false, fmt.Errorf("failed to delete customer language: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	return n > 0, nil
+}
@@ -39,7 +39,7 @@ func CreateUser(user *models.User) (string, error) {
 func GetUserByEmail(email string) (*models.User, error) {
 	var user models.User
 	query := `
-        SELECT id, email, password_hash, company_name, created_at, updated_at
+        SELECT id, email, password_hash, COALESCE(company_name, ''), created_at, updated_at
         FROM users
         WHERE email = $1
     `
@@ -55,7 +55,7 @@ func GetUserByEmail(email string) (*models.User, error) {
 func GetUserByID(userID uuid.UUID) (*models.User, error) {
 	var user models.User
 	query := `
-        SELECT id, email, password_hash, company_name, created_at, updated_at
+        SELECT id, email, password_hash, COALESCE(company_name, ''), created_at, updated_at
         FROM users
         WHERE id = $1
     `
@@ -0,0 +1,398 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"invoice-generator-go/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const webhookSubscriptionColumns = `id, user_id, url, event_types, active, created_at, updated_at`
+
+func scanWebhookSubscription(row interface{ Scan(...interface{}) error }, s *models.WebhookSubscription) error {
+	return row.Scan(&s.ID, &s.UserID, &s.URL, pq.Array(&s.EventTypes), &s.Active, &s.CreatedAt, &s.UpdatedAt)
+}
+
+const webhookDeliveryColumns = `d.id, d.subscription_id, d.event_id, e.type, e.invoice_id, d.status, d.attempts, d.next_attempt_at, d.last_attempt_at, d.response_status, COALESCE(d.last_error, ''), d.created_at, d.updated_at`
+
+// scanWebhookDelivery scans webhookDeliveryColumns into d, followed by any
+// extra columns selected into extra.
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }, d *models.WebhookDelivery, extra ...interface{}) error {
+	var responseStatus sql.NullInt64
+	dest := []interface{}{&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.InvoiceID, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastAttemptAt, &responseStatus, &d.LastError, &d.CreatedAt, &d.UpdatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	if responseStatus.Valid {
+		status := int(responseStatus.Int64)
+		d.ResponseStatus = &status
+	}
+	return nil
+}
+
+// webhookEventBody is the JSON body subscribers receive for an invoice
+// event.
+type webhookEventBody struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      struct {
+		Invoice models.Invoice `json:"invoice"`
+	} `json:"data"`
+}
+
+// CreateWebhookSubscription stores a new webhook subscription.
+func CreateWebhookSubscription(sub *models.WebhookSubscription) error {
+	sub.ID = uuid.New()
+	err := DB.QueryRow(`
+        INSERT INTO webhook_subscriptions (id, user_id, url, secret, event_types, active)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING created_at, updated_at
+    `, sub.ID, sub.UserID, sub.URL, sub.Secret, pq.Array(sub.EventTypes), sub.Active).Scan(&sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook subscription: %v", err)
+	}
+	return nil
+}
+
+// GetWebhookSubscriptionByID retrieves a webhook subscription without its
+// secret. It returns sql.ErrNoRows when there is none.
+func GetWebhookSubscriptionByID(id uuid.UUID) (*models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	err := scanWebhookSubscription(DB.QueryRow(`SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions WHERE id = $1`, id), &sub)
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// GetWebhookSubscriptionsByUserID lists a user's webhook subscriptions,
+// without their secrets, oldest first.
+func GetWebhookSubscriptionsByUserID(userID uuid.UUID) ([]models.WebhookSubscription, error) {
+	rows, err := DB.Query(`SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook subscriptions: %v", err)
+	}
+	defer rows.Close()
+
+	subs := []models.WebhookSubscription{}
+	for rows.Next() {
+		var sub models.WebhookSubscription
+		if err := scanWebhookSubscription(rows, &sub); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscription: %v", err)
+		}
+		subs = append(subs, sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate webhook subscriptions: %v", err)
+	}
+	return subs, nil
+}
+
+// UpdateWebhookSubscription replaces a subscription's endpoint, event types
+// and active flag, and its secret when one is given.
+func UpdateWebhookSubscription(sub *models.WebhookSubscription) error {
+	err := DB.QueryRow(`
+        UPDATE webhook_subscriptions
+        SET url = $2, event_types = $3, active = $4, secret = COALESCE(NULLIF($5, ''), secret)
+        WHERE id = $1
+        RETURNING updated_at
+    `, sub.ID, sub.URL, pq.Array(sub.EventTypes), sub.Active, sub.Secret).Scan(&sub.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook subscription: %v", err)
+	}
+	return nil
+}
+
+// DeleteWebhookSubscription deletes a subscription and its delivery log.
+func DeleteWebhookSubscription(id uuid.UUID) error {
+	_, err := DB.Exec(`DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %v", err)
+	}
+	return nil
+}
+
+// enqueueInvoiceEvent writes an invoice event of eventType, one of
+// webhooks.EventTypes, to the webhook outbox within tx, with the invoice and
+// its items as they stand in tx. The event is only sent if tx commits.
+func enqueueInvoiceEvent(tx *sql.Tx, eventType string, invoiceID uuid.UUID) error {
+	body := webhookEventBody{ID: uuid.New(), Type: eventType, CreatedAt: time.Now().UTC()}
+	invoice := &body.Data.Invoice
+	if err := scanInvoice(tx.QueryRow(`SELECT `+invoiceColumns+` FROM invoices WHERE id = $1`, invoiceID), invoice); err != nil {
+		return fmt.Errorf("failed to get invoice for webhook event: %v", err)
+	}
+
+	rows, err := tx.Query(`
+        SELECT id, invoice_id, description, quantity, unit_price, total_price, created_at, updated_at
+        FROM invoice_items
+        WHERE invoice_id = $1
+    `, invoiceID)
+	if err != nil {
+		return fmt.Errorf("failed to get invoice items for webhook event: %v", err)
+	}
+	for rows.Next() {
+		var item models.InvoiceItem
+		if err := rows.Scan(&item.ID, &item.InvoiceID, &item.Description, &item.Quantity, &item.UnitPrice, &item.TotalPrice, &item.CreatedAt, &item.UpdatedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan invoice item: %v", err)
+		}
+		invoice.Items = append(invoice.Items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate invoice items: %v", err)
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook event: %v", err)
+	}
+	_, err = tx.Exec(`
+        INSERT INTO webhook_events (id, user_id, type, invoice_id, payload, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+    `, body.ID, invoice.UserID, eventType, invoiceID, payload, body.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue webhook event: %v", err)
+	}
+	return nil
+}
+
+// invoiceStatusEvent names the webhook event of an invoice moving from one
+// status to another, or returns "" when the move isn't one.
+func invoiceStatusEvent(from, to string) string {
+	if from == to {
+		return ""
+	}
+	switch {
+	case to == "sent" && from == "draft":
+		return "invoice.sent"
+	case to == "paid":
+		return "invoice.paid"
+	case to == "void":
+		return "invoice.voided"
+	}
+	return ""
+}
+
+// DispatchWebhookEvents queues deliveries of up to limit outbox events, oldest
+// first, to the active subscriptions of their account that take their type,
+// and marks them dispatched. Events are locked while this runs, so
+// concurrent dispatchers take different ones. It returns how many events
+// were dispatched.
+func DispatchWebhookEvents(limit int) (int64, error) {
+	result, err := DB.Exec(`
+        WITH batch AS (
+            SELECT id, user_id, type
+            FROM webhook_events
+            WHERE dispatched_at IS NULL
+            ORDER BY created_at
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        ), queued AS (
+            INSERT INTO webhook_deliveries (subscription_id, event_id)
+            SELECT s.id, b.id
+            FROM batch b
+            JOIN webhook_subscriptions s ON s.user_id = b.user_id AND s.active AND b.type = ANY(s.event_types)
+            ON CONFLICT (subscription_id, event_id) DO NOTHING
+        )
+        UPDATE webhook_events
+        SET dispatched_at = CURRENT_TIMESTAMP
+        WHERE id IN (SELECT id FROM batch)
+    `, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to dispatch webhook events: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	return n, nil
+}
+
+// DueWebhookDelivery is a delivery claimed for an attempt, with what it
+// takes to send it.
+type DueWebhookDelivery struct {
+	Delivery models.WebhookDelivery
+	URL      string
+	Secret   string
+}
+
+// ClaimWebhookDeliveries claims up to limit pending deliveries to active
+// subscriptions that are due, oldest first, by moving their next attempt
+// lease into the future. A delivery whose attempt is never finished, because
+// the process died, is attempted again once the lease is over.
+func ClaimWebhookDeliveries(limit int, lease time.Duration) ([]DueWebhookDelivery, error) {
+	rows, err := DB.Query(`
+        WITH due AS (
+            SELECT d.id
+            FROM webhook_deliveries d
+            JOIN webhook_subscriptions s ON s.id = d.subscription_id
+            WHERE d.status = 'pending' AND d.next_attempt_at <= CURRENT_TIMESTAMP AND s.active
+            ORDER BY d.next_attempt_at
+            LIMIT $1
+            FOR UPDATE OF d SKIP LOCKED
+        ), claimed AS (
+            UPDATE webhook_deliveries
+            SET next_attempt_at = CURRENT_TIMESTAMP + $2::float8 * INTERVAL '1 second'
+            WHERE id IN (SELECT id FROM due)
+            RETURNING *
+        )
+        SELECT `+webhookDeliveryColumns+`, e.payload, s.url, s.secret
+        FROM claimed d
+        JOIN webhook_events e ON e.id = d.event_id
+        JOIN webhook_subscriptions s ON s.id = d.subscription_id
+        ORDER BY d.created_at
+    `, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	var due []DueWebhookDelivery
+	for rows.Next() {
+		var d DueWebhookDelivery
+		var payload []byte
+		if err := scanWebhookDelivery(rows, &d.Delivery, &payload, &d.URL, &d.Secret); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %v", err)
+		}
+		d.Delivery.Payload = payload
+		due = append(due, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate webhook deliveries: %v", err)
+	}
+	return due, nil
+}
+
+// FinishWebhookAttempt logs an attempt at a delivery and moves the delivery
+// to status: succeeded, failed, or pending again until nextAttemptAt.
+func FinishWebhookAttempt(attempt *models.WebhookAttempt, status string, nextAttemptAt *time.Time) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	attempt.ID = uuid.New()
+	_, err = tx.Exec(`
+        INSERT INTO webhook_delivery_attempts (id, delivery_id, attempted_at, duration_ms, response_status, response_body, error)
+        VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''))
+    `, attempt.ID, attempt.DeliveryID, attempt.AttemptedAt, attempt.DurationMS, attempt.ResponseStatus, attempt.ResponseBody, attempt.Error)
+	if err != nil {
+		return fmt.Errorf("failed to log webhook attempt: %v", err)
+	}
+
+	_, err = tx.Exec(`
+        UPDATE webhook_deliveries
+        SET status = $2,
+            attempts = attempts + 1,
+            next_attempt_at = $3,
+            last_attempt_at = $4,
+            response_status = $5,
+            last_error = NULLIF($6, '')
+        WHERE id = $1
+    `, attempt.DeliveryID, status, nextAttemptAt, attempt.AttemptedAt, attempt.ResponseStatus, attempt.Error)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit webhook attempt: %v", err)
+	}
+	return nil
+}
+
+// GetWebhookDeliveries lists the latest deliveries to a subscription, newest
+// first, optionally only those with status.
+func GetWebhookDeliveries(subscriptionID uuid.UUID, status string, limit int) ([]models.WebhookDelivery, error) {
+	rows, err := DB.Query(`
+        SELECT `+webhookDeliveryColumns+`
+        FROM webhook_deliveries d
+        JOIN webhook_events e ON e.id = d.event_id
+        WHERE d.subscription_id = $1 AND ($2::text = '' OR d.status = $2::text)
+        ORDER BY d.created_at DESC
+        LIMIT $3
+    `, subscriptionID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := scanWebhookDelivery(rows, &d); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %v", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate webhook deliveries: %v", err)
+	}
+	return deliveries, nil
+}
+
+// GetWebhookDelivery retrieves a delivery with the payload sent and its
+// attempt log. It returns sql.ErrNoRows when there is none.
+func GetWebhookDelivery(id uuid.UUID) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var payload []byte
+	err := scanWebhookDelivery(DB.QueryRow(`
+        SELECT `+webhookDeliveryColumns+`, e.payload
+        FROM webhook_deliveries d
+        JOIN webhook_events e ON e.id = d.event_id
+        WHERE d.id = $1
+    `, id), &d, &payload)
+	if err != nil {
+		return nil, err
+	}
+	d.Payload = payload
+
+	rows, err := DB.Query(`
+        SELECT id, delivery_id, attempted_at, duration_ms, response_status, COALESCE(response_body, ''), COALESCE(error, '')
+        FROM webhook_delivery_attempts
+        WHERE delivery_id = $1
+        ORDER BY attempted_at
+    `, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook attempts: %v", err)
+	}
+	defer rows.Close()
+
+	d.AttemptLog = []models.WebhookAttempt{}
+	for rows.Next() {
+		var a models.WebhookAttempt
+		var responseStatus sql.NullInt64
+		if err := rows.Scan(&a.ID, &a.DeliveryID, &a.AttemptedAt, &a.DurationMS, &responseStatus, &a.ResponseBody, &a.Error); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook attempt: %v", err)
+		}
+		if responseStatus.Valid {
+			status := int(responseStatus.Int64)
+			a.ResponseStatus = &status
+		}
+		d.AttemptLog = append(d.AttemptLog, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate webhook attempts: %v", err)
+	}
+	return &d, nil
+}
+
+// RedeliverWebhook queues a delivery to be attempted again straight away,
+// with its retries started over, whatever its status.
+func RedeliverWebhook(id uuid.UUID) error {
+	_, err := DB.Exec(`
+        UPDATE webhook_deliveries
+        SET status = 'pending', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+        WHERE id = $1
+    `, id)
+	if err != nil {
+		return fmt.Errorf("failed to redeliver webhook: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+// Package templates bundles the system invoice templates that are shared by
+// all accounts. They are synced into the templates table at startup.
+package templates
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed *.html
+var files embed.FS
+
+// names gives the bundled templates their display names. Files not listed
+// are named after the file.
+var names = map[string]string{
+	"basic":        "Classic Professional",
+	"minimalistic": "Modern Minimalist",
+	"modern":       "Modern Business",
+}
+
+// System is a bundled template. Key is the file name without extension and
+// identifies the template across restarts.
+type System struct {
+	Key      string
+	Name     string
+	Language string
+	Content  string
+}
+
+// SystemTemplates returns the bundled templates sorted by key.
+func SystemTemplates() ([]System, error) {
+	entries, err := files.ReadDir(".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list system templates: %v", err)
+	}
+
+	var result []System
+	for _, entry := range entries {
+		data, err := files.ReadFile(entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read system template %s: %v", entry.Name(), err)
+		}
+
+		key := strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+		name, ok := names[key]
+		if !ok {
+			name = strings.ToUpper(key[:1]) + key[1:]
+		}
+		result = append(result, System{
+			Key:      key,
+			Name:     name,
+			Language: "en",
+			Content:  strings.TrimPrefix(string(data), "\ufeff"),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result, nil
+}
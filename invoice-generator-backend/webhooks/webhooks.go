@@ -0,0 +1,357 @@
+// Package webhooks tells an account's own systems about its invoices. Each
+// change to an invoice writes its event to an outbox table in the same
+// transaction as the change. A background dispatcher fans the events out to
+// the account's subscriptions and posts them, signed, to their endpoints.
+// Failed deliveries are retried with exponential backoff. Delivery is at
+// least once, so receivers should skip event IDs they have seen.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"invoice-generator-go/models"
+	"invoice-generator-go/storage"
+)
+
+// The invoice events subscriptions can take.
+const (
+	EventInvoiceCreated = "invoice.created"
+	EventInvoiceSent    = "invoice.sent"
+	EventInvoicePaid    = "invoice.paid"
+	EventInvoiceVoided  = "invoice.voided"
+)
+
+// EventTypes lists the event types in the order they usually occur.
+var EventTypes = []string{EventInvoiceCreated, EventInvoiceSent, EventInvoicePaid, EventInvoiceVoided}
+
+// Headers of a delivery request.
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	EventIDHeader   = "X-Webhook-Event-ID"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+const (
+	// MaxAttempts is how often a delivery is attempted before it fails.
+	MaxAttempts = 10
+	// firstRetry is the wait after the first failed attempt; it doubles
+	// with every further one, up to maxRetry.
+	firstRetry = time.Minute
+	maxRetry   = 6 * time.Hour
+
+	deliveryTimeout = 10 * time.Second
+	// lease is how long a claimed delivery is held for its attempt. It must
+	// be well over deliveryTimeout.
+	lease = 2 * time.Minute
+	// batchSize is how many events are dispatched, and how many deliveries
+	// attempted in parallel, at a time.
+	batchSize = 20
+	// maxResponseBody bounds the part of an endpoint's answer that is logged.
+	maxResponseBody = 1024
+	// secretBytes is the entropy of a generated secret.
+	secretBytes = 24
+	// minSecretLength bounds secrets chosen by the account.
+	minSecretLength = 16
+)
+
+var client = &http.Client{
+	Timeout: deliveryTimeout,
+	Transport: &http.Transport{
+		// No proxy, so the address checked on dialing is the endpoint's
+		Proxy: nil,
+		// Endpoints are checked again as they are dialed, in case their name
+		// resolves elsewhere than when they were subscribed
+		DialContext:           PublicDialer(deliveryTimeout).DialContext,
+		TLSHandshakeTimeout:   deliveryTimeout,
+		ResponseHeaderTimeout: deliveryTimeout,
+		MaxIdleConns:          batchSize,
+		IdleConnTimeout:       90 * time.Second,
+	},
+	// Redirects aren't followed, so a delivery goes where it was subscribed
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// lookupIP resolves an endpoint's host name.
+var lookupIP = net.LookupIP
+
+// Validate checks a subscription's endpoint, event types and any secret
+// chosen for it, and sorts and deduplicates its event types. The endpoint
+// must resolve to public addresses only.
+func Validate(sub *models.WebhookSubscription) error {
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if err := checkHost(u.Hostname()); err != nil {
+		return err
+	}
+	if sub.Secret != "" && (len(sub.Secret) < minSecretLength || len(sub.Secret) > 255) {
+		return fmt.Errorf("secret must be between %d and 255 characters", minSecretLength)
+	}
+	if len(sub.EventTypes) == 0 {
+		return fmt.Errorf("subscribe to at least one event type")
+	}
+
+	order := map[string]int{}
+	for i, t := range EventTypes {
+		order[t] = i
+	}
+	seen := map[string]bool{}
+	var types []string
+	for _, t := range sub.EventTypes {
+		if _, ok := order[t]; !ok {
+			return fmt.Errorf("unknown event type %q, expected %s, %s, %s or %s", t, EventInvoiceCreated, EventInvoiceSent, EventInvoicePaid, EventInvoiceVoided)
+		}
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return order[types[i]] < order[types[j]] })
+	sub.EventTypes = types
+	return nil
+}
+
+// checkHost resolves host and checks that none of its addresses is
+// internal.
+func checkHost(host string) error {
+	ips, err := lookupIP(host)
+	if err != nil || len(ips) == 0 {
+		return fmt.Errorf("url host %q cannot be resolved", host)
+	}
+	for _, ip := range ips {
+		if internalIP(ip) {
+			return fmt.Errorf("url must not point to a loopback, private, link-local or multicast address")
+		}
+	}
+	return nil
+}
+
+// checkDialed is the dialer's Control hook: it refuses connections to
+// internal addresses.
+func checkDialed(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %v", address, err)
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || internalAddr(addr) {
+		return fmt.Errorf("refusing to connect to internal address %s", host)
+	}
+	return nil
+}
+
+// PublicDialer returns a dialer that, like the one webhooks are delivered
+// with, refuses connections to loopback, private, link-local, multicast and
+// other special-purpose addresses. The check is made on the address dialed,
+// so host names can't be resolved around it.
+func PublicDialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{Timeout: timeout, Control: checkDialed}
+}
+
+// specialPrefixes are the special-purpose ranges (RFC 6890 and its
+// updates) that an endpoint must not point to, besides the loopback,
+// private, link-local and multicast ones netip.Addr reports itself.
+var specialPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // shared address space (CGNAT)
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation (TEST-NET-1)
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation (TEST-NET-2)
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation (TEST-NET-3)
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use IPv4/IPv6 translation
+	netip.MustParsePrefix("100::/64"),        // discard-only
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// nat64Prefix is the well-known IPv4/IPv6 translation prefix; its addresses
+// reach the IPv4 address in their last four bytes.
+var nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+// internalIP reports whether ip is one an endpoint must not point to.
+func internalIP(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	return !ok || internalAddr(addr)
+}
+
+// internalAddr reports whether addr is loopback, private, link-local,
+// unspecified, multicast or in another special-purpose range.
+func internalAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsUnspecified() || addr.IsMulticast() {
+		return true
+	}
+	for _, prefix := range specialPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	if nat64Prefix.Contains(addr) {
+		b := addr.As16()
+		return internalAddr(netip.AddrFrom4([4]byte{b[12], b[13], b[14], b[15]}))
+	}
+	return false
+}
+
+// NewSecret returns a new random signing secret.
+func NewSecret() (string, error) {
+	b := make([]byte, secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %v", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value of a payload sent at timestamp:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<payload>" under secret>".
+// Receivers recompute the HMAC and should reject old timestamps to guard
+// against replays.
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(payload)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Start runs the dispatcher in the background, once straight away and then
+// every interval.
+func Start(interval time.Duration) {
+	go func() {
+		for {
+			Run()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Run dispatches the events in the outbox and attempts the deliveries that
+// are due, until none are left.
+func Run() {
+	for {
+		n, err := storage.DispatchWebhookEvents(batchSize)
+		if err != nil {
+			log.Printf("Webhook dispatch failed: %v", err)
+			break
+		}
+		if n < batchSize {
+			break
+		}
+	}
+
+	for {
+		due, err := storage.ClaimWebhookDeliveries(batchSize, lease)
+		if err != nil {
+			log.Printf("Webhook delivery failed: %v", err)
+			return
+		}
+		var wg sync.WaitGroup
+		for i := range due {
+			wg.Add(1)
+			go func(d storage.DueWebhookDelivery) {
+				defer wg.Done()
+				attempt(d)
+			}(due[i])
+		}
+		wg.Wait()
+		if len(due) < batchSize {
+			return
+		}
+	}
+}
+
+// attempt posts a delivery to its endpoint and records the outcome: any 2xx
+// answer succeeds it; otherwise it is retried later, or fails once its
+// attempts are used up.
+func attempt(d storage.DueWebhookDelivery) {
+	delivery := d.Delivery
+	record := models.WebhookAttempt{DeliveryID: delivery.ID, AttemptedAt: time.Now()}
+
+	status, body, err := post(d)
+	record.DurationMS = int(time.Since(record.AttemptedAt).Milliseconds())
+	record.ResponseBody = body
+	if status != 0 {
+		record.ResponseStatus = &status
+	}
+	if err != nil {
+		record.Error = err.Error()
+	} else if status < 200 || status > 299 {
+		record.Error = fmt.Sprintf("endpoint answered HTTP %d", status)
+	}
+
+	outcome := "succeeded"
+	var next *time.Time
+	if record.Error != "" {
+		outcome = "failed"
+		if delivery.Attempts+1 < MaxAttempts {
+			outcome = "pending"
+			at := time.Now().Add(RetryDelay(delivery.Attempts + 1))
+			next = &at
+		}
+	}
+	if err := storage.FinishWebhookAttempt(&record, outcome, next); err != nil {
+		log.Printf("Error recording webhook delivery %s: %v", delivery.ID, err)
+	}
+	if outcome == "failed" {
+		log.Printf("Webhook delivery %s of %s to %s failed after %d attempts: %s", delivery.ID, delivery.EventType, d.URL, MaxAttempts, record.Error)
+	}
+}
+
+// post sends a delivery and returns the endpoint's status code and the
+// start of its answer.
+func post(d storage.DueWebhookDelivery) (int, string, error) {
+	payload := []byte(d.Delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "invoice-generator-webhooks")
+	req.Header.Set(SignatureHeader, Sign(d.Secret, time.Now(), payload))
+	req.Header.Set(EventHeader, d.Delivery.EventType)
+	req.Header.Set(EventIDHeader, d.Delivery.EventID.String())
+	req.Header.Set(DeliveryHeader, d.Delivery.ID.String())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	body = bytes.ReplaceAll(bytes.ToValidUTF8(body, nil), []byte{0}, nil)
+	return resp.StatusCode, string(body), nil
+}
+
+// RetryDelay is the wait after a delivery's attempts-th failed attempt.
+func RetryDelay(attempts int) time.Duration {
+	delay := firstRetry
+	for i := 1; i < attempts && delay < maxRetry; i++ {
+		delay *= 2
+	}
+	if delay > maxRetry {
+		delay = maxRetry
+	}
+	return delay
+}
@@ -0,0 +1,230 @@
+package webhooks
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"invoice-generator-go/models"
+)
+
+func TestInternalIP(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		want bool
+	}{
+		{"loopback", "127.0.0.1", true},
+		{"loopback range", "127.8.9.10", true},
+		{"loopback IPv6", "::1", true},
+		{"private 10/8", "10.0.0.5", true},
+		{"private 172.16/12", "172.31.255.254", true},
+		{"private 192.168/16", "192.168.1.10", true},
+		{"unique local IPv6", "fd00::1", true},
+		{"link-local", "169.254.169.254", true},
+		{"link-local IPv6", "fe80::1", true},
+		{"unspecified", "0.0.0.0", true},
+		{"unspecified IPv6", "::", true},
+		{"this network 0/8", "0.1.2.3", true},
+		{"CGNAT 100.64/10 start", "100.64.0.1", true},
+		{"CGNAT 100.64/10 end", "100.127.255.254", true},
+		{"IETF protocol assignments 192.0.0/24", "192.0.0.170", true},
+		{"TEST-NET-1", "192.0.2.1", true},
+		{"benchmarking 198.18/15 start", "198.18.0.1", true},
+		{"benchmarking 198.18/15 end", "198.19.255.254", true},
+		{"TEST-NET-2", "198.51.100.7", true},
+		{"TEST-NET-3", "203.0.113.9", true},
+		{"reserved 240/4", "240.0.0.1", true},
+		{"broadcast", "255.255.255.255", true},
+		{"multicast", "224.0.0.1", true},
+		{"multicast IPv6", "ff02::1", true},
+		{"discard-only IPv6", "100::1", true},
+		{"documentation IPv6", "2001:db8::1", true},
+		{"local-use NAT64", "64:ff9b:1::a00:1", true},
+		{"NAT64 of a private address", "64:ff9b::a00:1", true},
+		{"NAT64 of a metadata address", "64:ff9b::a9fe:a9fe", true},
+		{"IPv4-mapped loopback", "::ffff:127.0.0.1", true},
+		{"IPv4-mapped private", "::ffff:10.1.2.3", true},
+		{"IPv4-mapped CGNAT", "::ffff:100.64.0.1", true},
+		{"public", "93.184.216.34", false},
+		{"public DNS", "8.8.8.8", false},
+		{"just past 172.16/12", "172.32.0.1", false},
+		{"just before CGNAT", "100.63.255.255", false},
+		{"just past CGNAT", "100.128.0.0", false},
+		{"just past 198.18/15", "198.20.0.0", false},
+		{"192.0.1/24 is public", "192.0.1.1", false},
+		{"NAT64 of a public address", "64:ff9b::5db8:d822", false},
+		{"public IPv6", "2606:4700:4700::1111", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := internalIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("internalIP(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+	if !internalIP(nil) {
+		t.Error("internalIP(nil) = false, want an invalid address treated as internal")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	hosts := map[string][]net.IP{
+		"erp.example.com":   {net.ParseIP("93.184.216.34")},
+		"internal.example":  {net.ParseIP("10.0.0.7")},
+		"mixed.example.com": {net.ParseIP("93.184.216.34"), net.ParseIP("127.0.0.1")},
+		"metadata.example":  {net.ParseIP("169.254.169.254")},
+	}
+	defer func(lookup func(string) ([]net.IP, error)) { lookupIP = lookup }(lookupIP)
+	lookupIP = func(host string) ([]net.IP, error) {
+		if ip := net.ParseIP(host); ip != nil {
+			return []net.IP{ip}, nil
+		}
+		if ips, ok := hosts[host]; ok {
+			return ips, nil
+		}
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr string
+	}{
+		{"public host", "https://erp.example.com/hooks", ""},
+		{"public address", "http://93.184.216.34:8080/hooks", ""},
+		{"not http", "ftp://erp.example.com/hooks", "absolute http or https"},
+		{"relative", "/hooks", "absolute http or https"},
+		{"unresolvable", "https://nowhere.example/hooks", "cannot be resolved"},
+		{"loopback", "http://127.0.0.1:5432/", "must not point"},
+		{"loopback IPv6", "http://[::1]/", "must not point"},
+		{"private host", "https://internal.example/hooks", "must not point"},
+		{"any address private", "https://mixed.example.com/hooks", "must not point"},
+		{"link-local", "http://169.254.169.254/latest/meta-data/", "must not point"},
+		{"link-local host", "http://metadata.example/", "must not point"},
+		{"unspecified", "http://0.0.0.0/", "must not point"},
+		{"multicast", "http://224.0.0.1/", "must not point"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := &models.WebhookSubscription{URL: tt.url, EventTypes: []string{EventInvoicePaid}}
+			err := Validate(sub)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate(%s) = %v, want nil", tt.url, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate(%s) = %v, want an error containing %q", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateEventTypes(t *testing.T) {
+	defer func(lookup func(string) ([]net.IP, error)) { lookupIP = lookup }(lookupIP)
+	lookupIP = func(string) ([]net.IP, error) { return []net.IP{net.ParseIP("93.184.216.34")}, nil }
+
+	sub := &models.WebhookSubscription{
+		URL:        "https://erp.example.com/hooks",
+		EventTypes: []string{EventInvoiceVoided, EventInvoiceCreated, EventInvoiceVoided},
+	}
+	if err := Validate(sub); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if got := strings.Join(sub.EventTypes, ","); got != EventInvoiceCreated+","+EventInvoiceVoided {
+		t.Errorf("event types = %s, want them sorted and deduplicated", got)
+	}
+
+	sub.EventTypes = []string{"invoice.deleted"}
+	if err := Validate(sub); err == nil {
+		t.Error("Validate accepted an unknown event type")
+	}
+}
+
+func TestCheckDialed(t *testing.T) {
+	tests := []struct {
+		address string
+		wantErr bool
+	}{
+		{"93.184.216.34:443", false},
+		{"[2606:4700:4700::1111]:443", false},
+		{"127.0.0.1:80", true},
+		{"[::1]:80", true},
+		{"10.1.2.3:5432", true},
+		{"169.254.169.254:80", true},
+		{"0.0.0.0:80", true},
+		{"100.100.100.200:80", true},
+		{"198.18.0.1:443", true},
+		{"localhost:80", true},
+		{"no-port", true},
+	}
+	for _, tt := range tests {
+		if err := checkDialed("tcp", tt.address, nil); (err != nil) != tt.wantErr {
+			t.Errorf("checkDialed(%s) = %v, want error %v", tt.address, err, tt.wantErr)
+		}
+	}
+}
+
+// TestClientRefusesInternal checks that the delivery client won't connect
+// to an internal address even when it gets past Validate, e.g. by a name
+// that resolves elsewhere later.
+func TestClientRefusesInternal(t *testing.T) {
+	reached := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer server.Close()
+
+	resp, err := client.Post(server.URL, "application/json", strings.NewReader("{}"))
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("the client delivered to a loopback address")
+	}
+	if !strings.Contains(err.Error(), "internal address") {
+		t.Errorf("error = %v, want the internal address to be refused", err)
+	}
+	if reached {
+		t.Error("the request reached the server")
+	}
+}
+
+func TestSign(t *testing.T) {
+	at := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	got := Sign("whsec_test", at, []byte(`{"id":"evt_1"}`))
+	want := "t=1767225600,v1=45b40331de0325606dc5400202ade162460fbe48daf9401adfdcd0d7b4f35470"
+	if got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+	if Sign("whsec_other", at, []byte(`{"id":"evt_1"}`)) == got {
+		t.Error("the signature does not depend on the secret")
+	}
+	if Sign("whsec_test", at.Add(time.Second), []byte(`{"id":"evt_1"}`)) == got {
+		t.Error("the signature does not depend on the timestamp")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{5, 16 * time.Minute},
+		{9, 256 * time.Minute},
+		{10, 6 * time.Hour},
+		{40, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := RetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("RetryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}